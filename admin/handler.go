@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+)
+
+const (
+	SyncPath         = "/v1/sync"
+	EmitPath         = "/v1/emit"
+	RouteWeightsPath = "/v1/routes/weights"
+
+	ProcessGUIDParam = "process_guid"
+	HostnameParam    = "hostname"
+)
+
+type handler struct {
+	logger       lager.Logger
+	syncCh       chan struct{}
+	emitChs      []chan struct{}
+	refreshCh    chan<- string
+	routingTable routingtable.RoutingTable
+}
+
+// NewHandler serves the admin endpoints used by operators to force a full
+// sync, a refresh of a single process or an immediate emit of the routing
+// table, and to inspect how the traffic of weighted routes is split
+func NewHandler(
+	logger lager.Logger,
+	syncCh chan struct{},
+	emitChs []chan struct{},
+	refreshCh chan<- string,
+	routingTable routingtable.RoutingTable,
+) http.Handler {
+	h := &handler{
+		logger:       logger.Session("admin-handler"),
+		syncCh:       syncCh,
+		emitChs:      emitChs,
+		refreshCh:    refreshCh,
+		routingTable: routingTable,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(SyncPath, h.sync)
+	mux.HandleFunc(EmitPath, h.emit)
+	mux.HandleFunc(RouteWeightsPath, h.routeWeights)
+	return mux
+}
+
+func (h *handler) sync(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	processGUID := req.URL.Query().Get(ProcessGUIDParam)
+	if processGUID == "" {
+		logger := h.logger.Session("sync")
+		logger.Info("requested")
+		trigger(logger, h.syncCh)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	logger := h.logger.Session("refresh", lager.Data{"process-guid": processGUID})
+	select {
+	case h.refreshCh <- processGUID:
+		logger.Info("requested")
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		logger.Info("refresh-queue-full")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func (h *handler) emit(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	logger := h.logger.Session("emit")
+	logger.Info("requested")
+	trigger(logger, h.emitChs...)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// routeWeights responds with the effective share of the traffic of every
+// http route per routing key, optionally limited to a single route given as
+// its hostname and context path
+func (h *handler) routeWeights(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	weights := h.routingTable.HTTPRouteWeights()
+	if hostname := req.URL.Query().Get(HostnameParam); hostname != "" {
+		routeKey := routingtable.RouteWeightKey(hostname)
+		weights = map[string][]routingtable.RouteWeight{routeKey: weights[routeKey]}
+		if weights[routeKey] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(weights)
+	if err != nil {
+		h.logger.Error("failed-to-write-route-weights", err)
+	}
+}
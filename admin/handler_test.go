@@ -0,0 +1,160 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/admin"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/routingtable/fakeroutingtable"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		handler                http.Handler
+		syncCh                 chan struct{}
+		externalCh, internalCh chan struct{}
+		refreshCh              chan string
+		table                  *fakeroutingtable.FakeRoutingTable
+		recorder               *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		syncCh = make(chan struct{}, 1)
+		externalCh = make(chan struct{}, 1)
+		internalCh = make(chan struct{}, 1)
+		refreshCh = make(chan string, 1)
+		table = &fakeroutingtable.FakeRoutingTable{}
+		recorder = httptest.NewRecorder()
+
+		logger := lagertest.NewTestLogger("test")
+		handler = admin.NewHandler(logger, syncCh, []chan struct{}{externalCh, internalCh}, refreshCh, table)
+	})
+
+	Describe("sync", func() {
+		It("triggers a full sync", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("POST", admin.SyncPath, nil))
+			Expect(recorder.Code).To(Equal(http.StatusAccepted))
+			Expect(syncCh).To(Receive())
+		})
+
+		Context("when a sync is already pending", func() {
+			BeforeEach(func() {
+				syncCh <- struct{}{}
+			})
+
+			It("does not block", func() {
+				handler.ServeHTTP(recorder, httptest.NewRequest("POST", admin.SyncPath, nil))
+				Expect(recorder.Code).To(Equal(http.StatusAccepted))
+				Expect(syncCh).To(HaveLen(1))
+			})
+		})
+
+		Context("when a process guid is given", func() {
+			It("refreshes only that process", func() {
+				handler.ServeHTTP(recorder, httptest.NewRequest("POST", admin.SyncPath+"?process_guid=some-guid", nil))
+				Expect(recorder.Code).To(Equal(http.StatusAccepted))
+				Expect(refreshCh).To(Receive(Equal("some-guid")))
+				Expect(syncCh).NotTo(Receive())
+			})
+
+			Context("and the refresh queue is full", func() {
+				BeforeEach(func() {
+					refreshCh <- "other-guid"
+				})
+
+				It("responds with service unavailable", func() {
+					handler.ServeHTTP(recorder, httptest.NewRequest("POST", admin.SyncPath+"?process_guid=some-guid", nil))
+					Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				})
+			})
+		})
+
+		It("only accepts POST requests", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", admin.SyncPath, nil))
+			Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(syncCh).NotTo(Receive())
+		})
+	})
+
+	Describe("emit", func() {
+		It("triggers an emit on every scheduler", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("POST", admin.EmitPath, nil))
+			Expect(recorder.Code).To(Equal(http.StatusAccepted))
+			Expect(externalCh).To(Receive())
+			Expect(internalCh).To(Receive())
+		})
+
+		It("only accepts POST requests", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", admin.EmitPath, nil))
+			Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(externalCh).NotTo(Receive())
+		})
+	})
+
+	Describe("route weights", func() {
+		var weights map[string][]routingtable.RouteWeight
+
+		BeforeEach(func() {
+			weights = map[string][]routingtable.RouteWeight{
+				"app.example.com": {
+					{ProcessGUID: "blue", ContainerPort: 8080, Weight: 9, Instances: 1, Percentage: 90},
+					{ProcessGUID: "green", ContainerPort: 8080, Weight: 1, Instances: 1, Percentage: 10},
+				},
+				"other.example.com": {
+					{ProcessGUID: "other", ContainerPort: 8080, Weight: 1, Instances: 2, Percentage: 100},
+				},
+			}
+			table.HTTPRouteWeightsReturns(weights)
+		})
+
+		It("responds with the weights of every hostname", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", admin.RouteWeightsPath, nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var response map[string][]routingtable.RouteWeight
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response).To(Equal(weights))
+		})
+
+		It("limits the response to the requested hostname", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", admin.RouteWeightsPath+"?hostname=app.example.com", nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			var response map[string][]routingtable.RouteWeight
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response).To(HaveLen(1))
+			Expect(response["app.example.com"]).To(Equal(weights["app.example.com"]))
+		})
+
+		It("looks up the requested route by hostname and context path", func() {
+			weights["app.example.com/api"] = []routingtable.RouteWeight{
+				{ProcessGUID: "api", ContainerPort: 8080, Weight: 1, Instances: 1, Percentage: 100},
+			}
+
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", admin.RouteWeightsPath+"?hostname=App.example.com/api/", nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			var response map[string][]routingtable.RouteWeight
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response).To(HaveLen(1))
+			Expect(response["app.example.com/api"]).To(Equal(weights["app.example.com/api"]))
+		})
+
+		It("responds with not found for an unknown hostname", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", admin.RouteWeightsPath+"?hostname=unknown.example.com", nil))
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("only accepts GET requests", func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("POST", admin.RouteWeightsPath, nil))
+			Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+})
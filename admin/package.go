@@ -0,0 +1 @@
+package admin // import "code.cloudfoundry.org/route-emitter/admin"
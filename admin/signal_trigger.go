@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"os"
+	"os/signal"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// SignalTrigger forces a full sync when the process receives SIGUSR1 and an
+// immediate emit of the routing table when it receives SIGUSR2
+type SignalTrigger struct {
+	logger  lager.Logger
+	syncCh  chan struct{}
+	emitChs []chan struct{}
+}
+
+func NewSignalTrigger(logger lager.Logger, syncCh chan struct{}, emitChs []chan struct{}) *SignalTrigger {
+	return &SignalTrigger{
+		logger:  logger.Session("signal-trigger"),
+		syncCh:  syncCh,
+		emitChs: emitChs,
+	}
+}
+
+func (t *SignalTrigger) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	triggers := make(chan os.Signal, 1)
+	if len(triggerSignals) > 0 {
+		signal.Notify(triggers, triggerSignals...)
+		defer signal.Stop(triggers)
+	}
+
+	close(ready)
+	t.logger.Info("started")
+	defer t.logger.Info("finished")
+
+	for {
+		select {
+		case sig := <-triggers:
+			switch sig {
+			case syncSignal:
+				logger := t.logger.Session("sync")
+				logger.Info("received-signal", lager.Data{"signal": sig.String()})
+				trigger(logger, t.syncCh)
+			case emitSignal:
+				logger := t.logger.Session("emit")
+				logger.Info("received-signal", lager.Data{"signal": sig.String()})
+				trigger(logger, t.emitChs...)
+			}
+		case <-signals:
+			t.logger.Info("stopping")
+			return nil
+		}
+	}
+}
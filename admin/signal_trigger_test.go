@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package admin_test
+
+import (
+	"os"
+	"syscall"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/admin"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SignalTrigger", func() {
+	var (
+		syncCh  chan struct{}
+		emitCh  chan struct{}
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		syncCh = make(chan struct{}, 1)
+		emitCh = make(chan struct{}, 1)
+
+		logger := lagertest.NewTestLogger("test")
+		process = ifrit.Invoke(admin.NewSignalTrigger(logger, syncCh, []chan struct{}{emitCh}))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("triggers a sync on SIGUSR1", func() {
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGUSR1)).To(Succeed())
+		Eventually(syncCh).Should(Receive())
+		Consistently(emitCh).ShouldNot(Receive())
+	})
+
+	It("triggers an emit on SIGUSR2", func() {
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGUSR2)).To(Succeed())
+		Eventually(emitCh).Should(Receive())
+		Consistently(syncCh).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package admin
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	syncSignal os.Signal = syscall.SIGUSR1
+	emitSignal os.Signal = syscall.SIGUSR2
+
+	triggerSignals = []os.Signal{syncSignal, emitSignal}
+)
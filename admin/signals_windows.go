@@ -0,0 +1,11 @@
+package admin
+
+import "os"
+
+// windows has no user defined signals, operators use the admin endpoints instead
+var (
+	syncSignal os.Signal
+	emitSignal os.Signal
+
+	triggerSignals []os.Signal
+)
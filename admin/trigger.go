@@ -0,0 +1,15 @@
+package admin
+
+import "code.cloudfoundry.org/lager"
+
+// trigger performs a non-blocking send on each channel. A full channel means
+// the same work is already pending, so the request is coalesced with it.
+func trigger(logger lager.Logger, chs ...chan struct{}) {
+	for _, ch := range chs {
+		select {
+		case ch <- struct{}{}:
+		default:
+			logger.Debug("already-pending")
+		}
+	}
+}
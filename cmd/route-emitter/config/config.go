@@ -18,15 +18,79 @@ type RoutingAPIConfig struct {
 	ClientCertFile string `json:"client_cert_file"`
 	ClientKeyFile  string `json:"client_key_file"`
 	AuthEnabled    bool   `json:"auth_enabled"`
+
+	// ReconcileInterval enables the periodic removal of orphaned TCP route
+	// mappings. A mapping is deleted once it has been orphaned in two
+	// consecutive cycles. At most ReconcileMaxDeletes mappings are deleted per
+	// cycle, and none in ReconcileReportOnly mode.
+	ReconcileInterval     durationjson.Duration `json:"reconcile_interval,omitempty"`
+	ReconcileMaxDeletes   int                   `json:"reconcile_max_deletes,omitempty"`
+	ReconcileReportOnly   bool                  `json:"reconcile_report_only,omitempty"`
+	ReconcileRouterGroups []string              `json:"reconcile_router_groups,omitempty"`
+
+	// RouterGroupsRefreshInterval is how long router groups are cached when
+	// validating TCP route mappings
+	RouterGroupsRefreshInterval durationjson.Duration `json:"router_groups_refresh_interval,omitempty"`
 }
 
+const (
+	OAuthProviderUAA       = "uaa"
+	OAuthProviderOIDC      = "oidc"
+	OAuthProviderTokenFile = "token_file"
+	OAuthProviderMTLS      = "mtls"
+)
+
+// OAuthConfig configures how the tokens authorizing the routing API calls
+// are obtained. Provider is one of "uaa" (the default), "oidc" for the client
+// credentials grant of a generic OpenID Connect provider, "token_file" for a
+// static bearer token read from a watched file, or "mtls" when the routing
+// API client certificate alone authenticates the emitter. The client secret
+// can be read from ClientSecretFile instead of being set in the config.
 type OAuthConfig struct {
-	UaaURL            string                `json:"uaa_url"`
-	UaaRequestTimeout durationjson.Duration `json:"uaa_request_timeout"`
-	ClientName        string                `json:"client_name"`
-	ClientSecret      string                `json:"client_secret"`
-	CACerts           string                `json:"ca_certs"`
-	SkipCertVerify    bool                  `json:"skip_cert_verify"`
+	Provider              string                `json:"provider,omitempty"`
+	UaaURL                string                `json:"uaa_url"`
+	UaaRequestTimeout     durationjson.Duration `json:"uaa_request_timeout"`
+	ClientName            string                `json:"client_name"`
+	ClientSecret          string                `json:"client_secret"`
+	ClientSecretFile      string                `json:"client_secret_file,omitempty"`
+	CACerts               string                `json:"ca_certs"`
+	SkipCertVerify        bool                  `json:"skip_cert_verify"`
+	TokenURL              string                `json:"token_url,omitempty"`
+	IssuerURL             string                `json:"issuer_url,omitempty"`
+	Scopes                []string              `json:"scopes,omitempty"`
+	TokenFile             string                `json:"token_file,omitempty"`
+	TokenFilePollInterval durationjson.Duration `json:"token_file_poll_interval,omitempty"`
+	RefreshAhead          durationjson.Duration `json:"refresh_ahead,omitempty"`
+}
+
+// RegistrySigningConfig enables signing of the registry messages published
+// on NATS. Rotating the key is done by first adding the new key id to the
+// routers' trusted keys, then switching the emitters over to it by replacing
+// the key file and the key id file, which are reloaded every ReloadInterval.
+// KeyIDFile takes precedence over KeyID.
+type RegistrySigningConfig struct {
+	KeyID          string                `json:"key_id"`
+	KeyIDFile      string                `json:"key_id_file,omitempty"`
+	Algorithm      string                `json:"algorithm"`
+	KeyFile        string                `json:"key_file"`
+	ReloadInterval durationjson.Duration `json:"reload_interval,omitempty"`
+}
+
+// NATSTargetConfig describes one NATS cluster that routes are published to
+type NATSTargetConfig struct {
+	Name                    string                `json:"name"`
+	Addresses               string                `json:"addresses"`
+	Username                string                `json:"username,omitempty"`
+	Password                string                `json:"password,omitempty"`
+	TLSEnabled              bool                  `json:"tls_enabled"`
+	CACertFile              string                `json:"ca_cert_file"`
+	ClientCertFile          string                `json:"client_cert_file"`
+	ClientKeyFile           string                `json:"client_key_file"`
+	NKeySeedFile            string                `json:"nkey_seed_file,omitempty"`
+	CredsFile               string                `json:"creds_file,omitempty"`
+	Token                   string                `json:"token,omitempty"`
+	TokenFile               string                `json:"token_file,omitempty"`
+	CredentialsPollInterval durationjson.Duration `json:"credentials_poll_interval,omitempty"`
 }
 
 type RouteEmitterConfig struct {
@@ -37,6 +101,7 @@ type RouteEmitterConfig struct {
 	BBSClientSessionCacheSize          int                   `json:"bbs_client_session_cache_size,omitempty"`
 	BBSMaxIdleConnsPerHost             int                   `json:"bbs_max_idle_conns_per_host,omitempty"`
 	CellID                             string                `json:"cell_id,omitempty"`
+	CellZonesFile                      string                `json:"cell_zones_file,omitempty"`
 	UUID                               string                `json:"uuid,omitempty"`
 	RegisterDirectInstanceRoutes       bool                  `json:"register_direct_instance_routes,omitempty"`
 	CommunicationTimeout               durationjson.Duration `json:"communication_timeout,omitempty"`
@@ -44,6 +109,7 @@ type RouteEmitterConfig struct {
 	ConsulDownModeNotificationInterval durationjson.Duration `json:"consul_down_mode_notification_interval,omitempty"`
 	ConsulSessionName                  string                `json:"consul_session_name,omitempty"`
 	HealthCheckAddress                 string                `json:"healthcheck_address,omitempty"`
+	AdminAddress                       string                `json:"admin_address,omitempty"`
 	LockRetryInterval                  durationjson.Duration `json:"lock_retry_interval,omitempty"`
 	LockTTL                            durationjson.Duration `json:"lock_ttl,omitempty"`
 	NATSAddresses                      string                `json:"nats_addresses,omitempty"`
@@ -53,17 +119,44 @@ type RouteEmitterConfig struct {
 	NATSCACertFile                     string                `json:"nats_ca_cert_file"`
 	NATSClientCertFile                 string                `json:"nats_client_cert_file"`
 	NATSClientKeyFile                  string                `json:"nats_client_key_file"`
+	NATSNKeySeedFile                   string                `json:"nats_nkey_seed_file,omitempty"`
+	NATSCredsFile                      string                `json:"nats_creds_file,omitempty"`
+	NATSToken                          string                `json:"nats_token,omitempty"`
+	NATSTokenFile                      string                `json:"nats_token_file,omitempty"`
+	NATSCredentialsPollInterval        durationjson.Duration `json:"nats_credentials_poll_interval,omitempty"`
+	NATSTargets                        []NATSTargetConfig    `json:"nats_targets,omitempty"`
+	NATSTargetEmitTimeout              durationjson.Duration `json:"nats_target_emit_timeout,omitempty"`
+	NATSSubjectNamespace               string                `json:"nats_subject_namespace,omitempty"`
+	NATSIsolationSegmentSubjects       map[string]string     `json:"nats_isolation_segment_subjects,omitempty"`
+	NATSCircuitBreakerFailureThreshold int                   `json:"nats_circuit_breaker_failure_threshold,omitempty"`
+	NATSCircuitBreakerCooldown         durationjson.Duration `json:"nats_circuit_breaker_cooldown,omitempty"`
 	RouteEmittingWorkers               int                   `json:"route_emitting_workers,omitempty"`
+	StaticMetricTags                   map[string]string     `json:"static_metric_tags,omitempty"`
+	DynamicMetricTags                  map[string]string     `json:"dynamic_metric_tags,omitempty"`
 	SyncInterval                       durationjson.Duration `json:"sync_interval,omitempty"`
 	TCPRouteTTL                        durationjson.Duration `json:"tcp_route_ttl,omitempty"`
+	TCPPortConflictPolicy              string                `json:"tcp_port_conflict_policy,omitempty"`
+	TCPRouteRefreshFraction            float64               `json:"tcp_route_refresh_fraction,omitempty"`
+	TCPRouteRefreshConcurrency         int                   `json:"tcp_route_refresh_concurrency,omitempty"`
 	OAuth                              OAuthConfig           `json:"oauth"`
 	RoutingAPI                         RoutingAPIConfig      `json:"routing_api"`
+	RegistrySigning                    RegistrySigningConfig `json:"registry_signing"`
 	EnableTCPEmitter                   bool                  `json:"enable_tcp_emitter"`
 	LoggregatorConfig                  loggingclient.Config  `json:"loggregator"`
 	ReportInterval                     durationjson.Duration `json:"report_interval,omitempty"`
 	UnregistrationInterval             durationjson.Duration `json:"unregistration_interval,omitempty"`
 	UnregistrationSendCount            int                   `json:"unregistration_send_count,omitempty"`
+	InternalUnregistrationInterval     durationjson.Duration `json:"internal_unregistration_interval,omitempty"`
+	InternalUnregistrationSendCount    int                   `json:"internal_unregistration_send_count,omitempty"`
+	TCPUnregistrationInterval          durationjson.Duration `json:"tcp_unregistration_interval,omitempty"`
+	TCPUnregistrationSendCount         int                   `json:"tcp_unregistration_send_count,omitempty"`
+	UnregistrationCachePath            string                `json:"unregistration_cache_path,omitempty"`
+	UnregistrationCacheMaxAge          durationjson.Duration `json:"unregistration_cache_max_age,omitempty"`
 	EnableInternalEmitter              bool                  `json:"enable_internal_emitter"`
+	EventCoalesceWindow                durationjson.Duration `json:"event_coalesce_window,omitempty"`
+	MaxCachedEvents                    int                   `json:"max_cached_events,omitempty"`
+	PacedEmitFraction                  float64               `json:"paced_emit_fraction,omitempty"`
+	PacedEmitMaxMessagesPerSecond      int                   `json:"paced_emit_max_messages_per_second,omitempty"`
 	ConsulEnabled                      bool                  `json:"consul_enabled"`
 	LocketEnabled                      bool                  `json:"locket_enabled"`
 	lagerflags.LagerConfig
@@ -87,5 +180,47 @@ func NewRouteEmitterConfig(configPath string) (RouteEmitterConfig, error) {
 		return RouteEmitterConfig{}, err
 	}
 
+	routeEmitterConfig.setUnregistrationDefaults()
 	return routeEmitterConfig, nil
 }
+
+// setUnregistrationDefaults resends internal and TCP unregistrations like
+// http unregistrations unless configured otherwise
+func (c *RouteEmitterConfig) setUnregistrationDefaults() {
+	if c.InternalUnregistrationInterval == 0 {
+		c.InternalUnregistrationInterval = c.UnregistrationInterval
+	}
+	if c.InternalUnregistrationSendCount == 0 {
+		c.InternalUnregistrationSendCount = c.UnregistrationSendCount
+	}
+	if c.TCPUnregistrationInterval == 0 {
+		c.TCPUnregistrationInterval = c.UnregistrationInterval
+	}
+	if c.TCPUnregistrationSendCount == 0 {
+		c.TCPUnregistrationSendCount = c.UnregistrationSendCount
+	}
+}
+
+// NATSTargetConfigs returns the NATS clusters to publish to. When no targets
+// are declared, the top level NATS properties describe a single unnamed
+// target.
+func (c RouteEmitterConfig) NATSTargetConfigs() []NATSTargetConfig {
+	if len(c.NATSTargets) > 0 {
+		return c.NATSTargets
+	}
+
+	return []NATSTargetConfig{{
+		Addresses:               c.NATSAddresses,
+		Username:                c.NATSUsername,
+		Password:                c.NATSPassword,
+		TLSEnabled:              c.NATSTLSEnabled,
+		CACertFile:              c.NATSCACertFile,
+		ClientCertFile:          c.NATSClientCertFile,
+		ClientKeyFile:           c.NATSClientKeyFile,
+		NKeySeedFile:            c.NATSNKeySeedFile,
+		CredsFile:               c.NATSCredsFile,
+		Token:                   c.NATSToken,
+		TokenFile:               c.NATSTokenFile,
+		CredentialsPollInterval: c.NATSCredentialsPollInterval,
+	}}
+}
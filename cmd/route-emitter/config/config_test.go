@@ -23,6 +23,7 @@ var _ = Describe("Config", func() {
 	BeforeEach(func() {
 		configData = `{
 			"healthcheck_address": "127.0.0.1:8090",
+			"admin_address": "127.0.0.1:8091",
 			"cell_id": "cellID",
 			"uuid": "bosh-boshy-bosh-bosh",
 			"consul_cluster": "consul.example.com",
@@ -44,20 +45,66 @@ var _ = Describe("Config", func() {
 			"nats_ca_cert_file": "/tmp/nats_ca_cert",
 			"nats_client_cert_file": "/tmp/nats_client_cert",
 			"nats_client_key_file": "/tmp/nats_client_key",
+			"nats_creds_file": "/tmp/nats_user.creds",
+			"nats_credentials_poll_interval": "15s",
+			"nats_subject_namespace": "tenant-a",
+			"nats_isolation_segment_subjects": {"segment-a": "router-segment-a"},
+			"nats_circuit_breaker_failure_threshold": 20,
+			"nats_circuit_breaker_cooldown": "3s",
+			"nats_targets": [
+				{
+					"name": "new-fleet",
+					"addresses": "127.0.0.3:4222",
+					"tls_enabled": true,
+					"ca_cert_file": "/tmp/new_fleet_ca_cert",
+					"client_cert_file": "/tmp/new_fleet_client_cert",
+					"client_key_file": "/tmp/new_fleet_client_key",
+					"token_file": "/tmp/new_fleet_token"
+				}
+			],
+			"nats_target_emit_timeout": "7s",
 			"lock_retry_interval": "15s",
 			"lock_ttl": "20s",
 			"tcp_route_ttl": "2m",
+			"tcp_port_conflict_policy": "refuse-both",
+			"tcp_route_refresh_fraction": 0.25,
+			"tcp_route_refresh_concurrency": 8,
+			"cell_zones_file": "/path/to/cell_zones.json",
+			"static_metric_tags": {"deployment": "cf"},
+			"dynamic_metric_tags": {"zone": "availability_zone"},
 			"log_level": "debug",
 			"debug_address": "127.0.0.1:9999",
 			"enable_tcp_emitter": true,
 			"enable_internal_emitter": true,
+			"event_coalesce_window": "250ms",
+			"max_cached_events": 5000,
+			"paced_emit_fraction": 0.5,
+			"paced_emit_max_messages_per_second": 2000,
+			"internal_unregistration_interval": "5s",
+			"internal_unregistration_send_count": 4,
+			"tcp_unregistration_interval": "10s",
+			"tcp_unregistration_send_count": 2,
+			"unregistration_cache_path": "/var/vcap/data/route-emitter/unregistrations.json",
+			"unregistration_cache_max_age": "10m",
 			"register_direct_instance_routes": true,
 			"routing_api": {
 				"url": "https://routing-api.cf.service.internal",
 				"port": 443,
 				"ca_cert_file": "/tmp/routing_api_ca_cert_file",
 				"client_cert_file": "/tmp/routing_api_client_cert_file",
-				"client_key_file": "/tmp/routing_api_client_key_file"
+				"client_key_file": "/tmp/routing_api_client_key_file",
+				"reconcile_interval": "5m",
+				"reconcile_max_deletes": 50,
+				"reconcile_report_only": true,
+				"reconcile_router_groups": ["tcp-router-group"],
+				"router_groups_refresh_interval": "2m"
+			},
+			"registry_signing": {
+				"key_id": "key-1",
+				"key_id_file": "/tmp/registry_signing_key_id",
+				"algorithm": "ed25519",
+				"key_file": "/tmp/registry_signing_key",
+				"reload_interval": "30s"
 			},
 			"consul_enabled": true,
 			"locket_enabled": true,
@@ -72,7 +119,8 @@ var _ = Describe("Config", func() {
 				"client_name": "someclient",
 				"client_secret": "somesecret",
 				"ca_certs": "some-cert",
-				"skip_cert_verify": true
+				"skip_cert_verify": true,
+				"refresh_ahead": "2m"
 			},
 			"loggregator": {
 			  "loggregator_use_v2_api": true,
@@ -113,6 +161,7 @@ var _ = Describe("Config", func() {
 
 		expectedConfig := config.RouteEmitterConfig{
 			HealthCheckAddress:                 "127.0.0.1:8090",
+			AdminAddress:                       "127.0.0.1:8091",
 			ConsulCluster:                      "consul.example.com",
 			CellID:                             "cellID",
 			UUID:                               "bosh-boshy-bosh-bosh",
@@ -132,23 +181,69 @@ var _ = Describe("Config", func() {
 			NATSCACertFile:                     "/tmp/nats_ca_cert",
 			NATSClientCertFile:                 "/tmp/nats_client_cert",
 			NATSClientKeyFile:                  "/tmp/nats_client_key",
+			NATSCredsFile:                      "/tmp/nats_user.creds",
+			NATSCredentialsPollInterval:        durationjson.Duration(15 * time.Second),
+			NATSSubjectNamespace:               "tenant-a",
+			NATSIsolationSegmentSubjects:       map[string]string{"segment-a": "router-segment-a"},
+			NATSCircuitBreakerFailureThreshold: 20,
+			NATSCircuitBreakerCooldown:         durationjson.Duration(3 * time.Second),
 			LockRetryInterval:                  durationjson.Duration(15 * time.Second),
 			LockTTL:                            durationjson.Duration(20 * time.Second),
 			ConsulSessionName:                  "myconsulsession",
 			RouteEmittingWorkers:               18,
 			TCPRouteTTL:                        durationjson.Duration(2 * time.Minute),
+			TCPPortConflictPolicy:              "refuse-both",
+			TCPRouteRefreshFraction:            0.25,
+			TCPRouteRefreshConcurrency:         8,
+			CellZonesFile:                      "/path/to/cell_zones.json",
+			StaticMetricTags:                   map[string]string{"deployment": "cf"},
+			DynamicMetricTags:                  map[string]string{"zone": "availability_zone"},
 			ReportInterval:                     durationjson.Duration(1 * time.Minute),
 			EnableTCPEmitter:                   true,
 			EnableInternalEmitter:              true,
+			EventCoalesceWindow:                durationjson.Duration(250 * time.Millisecond),
+			MaxCachedEvents:                    5000,
+			PacedEmitFraction:                  0.5,
+			PacedEmitMaxMessagesPerSecond:      2000,
+			InternalUnregistrationInterval:     durationjson.Duration(5 * time.Second),
+			InternalUnregistrationSendCount:    4,
+			TCPUnregistrationInterval:          durationjson.Duration(10 * time.Second),
+			TCPUnregistrationSendCount:         2,
+			UnregistrationCachePath:            "/var/vcap/data/route-emitter/unregistrations.json",
+			UnregistrationCacheMaxAge:          durationjson.Duration(10 * time.Minute),
 			RegisterDirectInstanceRoutes:       true,
 			ConsulEnabled:                      true,
 			LocketEnabled:                      true,
+			NATSTargets: []config.NATSTargetConfig{{
+				Name:           "new-fleet",
+				Addresses:      "127.0.0.3:4222",
+				TLSEnabled:     true,
+				CACertFile:     "/tmp/new_fleet_ca_cert",
+				ClientCertFile: "/tmp/new_fleet_client_cert",
+				ClientKeyFile:  "/tmp/new_fleet_client_key",
+				TokenFile:      "/tmp/new_fleet_token",
+			}},
+			NATSTargetEmitTimeout: durationjson.Duration(7 * time.Second),
 			RoutingAPI: config.RoutingAPIConfig{
 				URL:            "https://routing-api.cf.service.internal",
 				Port:           443,
 				CACertFile:     "/tmp/routing_api_ca_cert_file",
 				ClientCertFile: "/tmp/routing_api_client_cert_file",
 				ClientKeyFile:  "/tmp/routing_api_client_key_file",
+
+				ReconcileInterval:     durationjson.Duration(5 * time.Minute),
+				ReconcileMaxDeletes:   50,
+				ReconcileReportOnly:   true,
+				ReconcileRouterGroups: []string{"tcp-router-group"},
+
+				RouterGroupsRefreshInterval: durationjson.Duration(2 * time.Minute),
+			},
+			RegistrySigning: config.RegistrySigningConfig{
+				KeyID:          "key-1",
+				KeyIDFile:      "/tmp/registry_signing_key_id",
+				Algorithm:      "ed25519",
+				KeyFile:        "/tmp/registry_signing_key",
+				ReloadInterval: durationjson.Duration(30 * time.Second),
 			},
 			DebugServerConfig: debugserver.DebugServerConfig{
 				DebugAddress: "127.0.0.1:9999",
@@ -163,6 +258,7 @@ var _ = Describe("Config", func() {
 				ClientSecret:      "somesecret",
 				CACerts:           "some-cert",
 				SkipCertVerify:    true,
+				RefreshAhead:      durationjson.Duration(2 * time.Minute),
 			},
 			LoggregatorConfig: loggingclient.Config{
 				UseV2API:      true,
@@ -187,6 +283,56 @@ var _ = Describe("Config", func() {
 		Expect(routeEmitterConfig).To(test_helpers.DeepEqual(expectedConfig))
 	})
 
+	Describe("NATSTargetConfigs", func() {
+		It("returns the declared targets", func() {
+			cfg := config.RouteEmitterConfig{
+				NATSAddresses: "127.0.0.2:4222",
+				NATSTargets: []config.NATSTargetConfig{
+					{Name: "old-fleet", Addresses: "127.0.0.2:4222"},
+					{Name: "new-fleet", Addresses: "127.0.0.3:4222"},
+				},
+			}
+			Expect(cfg.NATSTargetConfigs()).To(Equal(cfg.NATSTargets))
+		})
+
+		It("falls back to the top level nats properties", func() {
+			cfg := config.RouteEmitterConfig{
+				NATSAddresses:  "127.0.0.2:4222",
+				NATSUsername:   "user",
+				NATSPassword:   "password",
+				NATSTLSEnabled: true,
+				NATSTokenFile:  "/tmp/token",
+			}
+			Expect(cfg.NATSTargetConfigs()).To(Equal([]config.NATSTargetConfig{{
+				Addresses:  "127.0.0.2:4222",
+				Username:   "user",
+				Password:   "password",
+				TLSEnabled: true,
+				TokenFile:  "/tmp/token",
+			}}))
+		})
+	})
+
+	Context("when the internal and tcp unregistration settings are not set", func() {
+		BeforeEach(func() {
+			configData = `{
+				"unregistration_interval": "30s",
+				"unregistration_send_count": 5,
+				"tcp_unregistration_send_count": 2
+			}`
+		})
+
+		It("uses the http unregistration settings", func() {
+			routeEmitterConfig, err := config.NewRouteEmitterConfig(configPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(routeEmitterConfig.InternalUnregistrationInterval).To(Equal(durationjson.Duration(30 * time.Second)))
+			Expect(routeEmitterConfig.InternalUnregistrationSendCount).To(Equal(5))
+			Expect(routeEmitterConfig.TCPUnregistrationInterval).To(Equal(durationjson.Duration(30 * time.Second)))
+			Expect(routeEmitterConfig.TCPUnregistrationSendCount).To(Equal(2))
+		})
+	})
+
 	Context("when the file does not exist", func() {
 		It("returns an error", func() {
 			_, err := config.NewRouteEmitterConfig("foobar")
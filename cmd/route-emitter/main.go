@@ -1,11 +1,14 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/bbs"
@@ -21,6 +24,7 @@ import (
 	"code.cloudfoundry.org/locket/lock"
 	locketmodels "code.cloudfoundry.org/locket/models"
 	route_emitter "code.cloudfoundry.org/route-emitter"
+	"code.cloudfoundry.org/route-emitter/admin"
 	"code.cloudfoundry.org/route-emitter/cmd/route-emitter/config"
 	"code.cloudfoundry.org/route-emitter/consuldownchecker"
 	"code.cloudfoundry.org/route-emitter/consuldownmodenotifier"
@@ -29,7 +33,9 @@ import (
 	"code.cloudfoundry.org/route-emitter/routehandlers"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/scheduler"
+	"code.cloudfoundry.org/route-emitter/signing"
 	"code.cloudfoundry.org/route-emitter/syncer"
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
 	"code.cloudfoundry.org/route-emitter/unregistration"
 	"code.cloudfoundry.org/route-emitter/watcher"
 	routing_api "code.cloudfoundry.org/routing-api"
@@ -51,7 +57,12 @@ var configFilePath = flag.String(
 )
 
 const (
-	routeEmitterLockKey = "route_emitter"
+	routeEmitterLockKey                = "route_emitter"
+	defaultRouterGroupsRefreshInterval = time.Minute
+	defaultTokenFilePollInterval       = 10 * time.Second
+	defaultTCPRouteRefreshFraction     = 0.5
+	defaultTCPRouteRefreshConcurrency  = 4
+	natsTargetRetryInterval            = 5 * time.Second
 )
 
 func main() {
@@ -65,33 +76,46 @@ func main() {
 
 	logger, reconfigurableSink := lagerflags.NewFromConfig(cfg.ConsulSessionName, cfg.LagerConfig)
 
-	natsClient, err := initializeNATSClient(logger, cfg.NATSTLSEnabled, cfg.NATSCACertFile, cfg.NATSClientCertFile, cfg.NATSClientKeyFile)
-	if err != nil {
-		logger.Error("failed-to-initialize-nats-client", err)
-		os.Exit(1)
-	}
-
 	clock := clock.NewClock()
 
-	externalChan := make(chan struct{}, 1)
-	internalChan := make(chan struct{}, 1)
-	syncer := syncer.NewSyncer(clock, time.Duration(cfg.SyncInterval), logger)
-	externalScheduler := scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, "router", externalChan)
-	internalScheduler := scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, "service-discovery", internalChan)
-
 	metronClient, err := initializeMetron(logger, cfg)
 	if err != nil {
 		logger.Error("failed-to-initialize-metron-client", err)
 		os.Exit(1)
 	}
 
-	natsClientRunner := diegonats.NewClientRunner(cfg.NATSAddresses, cfg.NATSUsername, cfg.NATSPassword, logger, natsClient)
+	externalChan := make(chan struct{}, 1)
+	internalChan := make(chan struct{}, 1)
+	syncer := syncer.NewSyncer(clock, time.Duration(cfg.SyncInterval), logger)
+
+	signer, signingMembers := initializeRegistrySigner(logger, clock, cfg.RegistrySigning)
+	natsTargets := initializeNATSTargets(logger, clock, cfg, metronClient, externalChan, internalChan, signer)
 
 	bbsClient := initializeBBSClient(logger, cfg)
 
 	localMode := cfg.CellID != ""
-	table := routingtable.NewRoutingTable(cfg.RegisterDirectInstanceRoutes, metronClient)
-	natsEmitter := initializeNatsEmitter(logger, natsClient, cfg.RouteEmittingWorkers, metronClient, cfg.EnableInternalEmitter)
+	tcpPortConflictPolicy := routingtable.TCPPortConflictPolicy(cfg.TCPPortConflictPolicy)
+	if tcpPortConflictPolicy == "" {
+		tcpPortConflictPolicy = routingtable.TCPPortConflictFirstWins
+	}
+	if !tcpPortConflictPolicy.Valid() {
+		logger.Fatal("invalid-tcp-port-conflict-policy", errors.New("unknown tcp port conflict policy"), lager.Data{"policy": cfg.TCPPortConflictPolicy})
+	}
+	metricTagResolver := routingtable.NewMetricTagResolver(cfg.StaticMetricTags, cfg.DynamicMetricTags)
+	if err := metricTagResolver.Validate(); err != nil {
+		logger.Fatal("invalid-dynamic-metric-tags", err)
+	}
+	table := routingtable.NewRoutingTable(cfg.RegisterDirectInstanceRoutes, metronClient, tcpPortConflictPolicy, metricTagResolver)
+	natsEmitter := natsTargets[0].emitter
+	var multiNATSEmitter *emitter.MultiNATSEmitter
+	if len(natsTargets) > 1 {
+		targets := []emitter.NATSTarget{}
+		for _, target := range natsTargets {
+			targets = append(targets, emitter.NATSTarget{Name: target.name, Emitter: target.emitter})
+		}
+		multiNATSEmitter = emitter.NewMultiNATSEmitter(logger, clock, metronClient, targets, time.Duration(cfg.NATSTargetEmitTimeout))
+		natsEmitter = multiNATSEmitter
+	}
 
 	routeTTL := time.Duration(cfg.TCPRouteTTL)
 	if routeTTL.Seconds() > 65535 {
@@ -99,14 +123,20 @@ func main() {
 	}
 
 	var routingAPIEmitter emitter.RoutingAPIEmitter
+	var routingAPIClient routing_api.Client
+	var tokenProvider tokenprovider.TokenProvider
+	authMembers := grouper.Members{}
 	if cfg.EnableTCPEmitter {
 		tcpLogger := logger.Session("tcp")
-		uaaClient := newUaaClient(tcpLogger, &cfg, clock)
+		var tokenRefresher ifrit.Runner
+		tokenProvider, tokenRefresher = newTokenProvider(tcpLogger, &cfg, clock)
+		if tokenRefresher != nil {
+			authMembers = append(authMembers, grouper.Member{"token-provider", tokenRefresher})
+		}
 
 		routingAPIAddress := fmt.Sprintf("%s:%d", cfg.RoutingAPI.URL, cfg.RoutingAPI.Port)
 		logger.Debug("creating-routing-api-client", lager.Data{"api-location": routingAPIAddress})
 
-		var routingAPIClient routing_api.Client
 		if cfg.RoutingAPI.ClientCertFile != "" && cfg.RoutingAPI.ClientKeyFile != "" && cfg.RoutingAPI.CACertFile != "" {
 			tlsConfig, err := tlsconfig.Build(
 				tlsconfig.WithInternalServiceDefaults(),
@@ -122,12 +152,54 @@ func main() {
 			routingAPIClient = routing_api.NewClient(routingAPIAddress, false)
 		}
 
-		routingAPIEmitter = emitter.NewRoutingAPIEmitter(tcpLogger, routingAPIClient, uaaClient, int(routeTTL.Seconds()))
+		routerGroupsRefreshInterval := time.Duration(cfg.RoutingAPI.RouterGroupsRefreshInterval)
+		if routerGroupsRefreshInterval <= 0 {
+			routerGroupsRefreshInterval = defaultRouterGroupsRefreshInterval
+		}
+		validator := emitter.NewRouterGroupValidator(tcpLogger, clock, routingAPIClient, tokenProvider, metronClient, routerGroupsRefreshInterval)
+		routingAPIEmitter = emitter.NewRoutingAPIEmitter(tcpLogger, routingAPIClient, tokenProvider, int(routeTTL.Seconds()), validator)
 	}
 
 	unregistrationCache := unregistration.NewCache(logger)
+	if cfg.UnregistrationCachePath != "" {
+		unregistrationCache, err = unregistration.NewPersistentCache(logger, clock, cfg.UnregistrationCachePath, time.Duration(cfg.UnregistrationCacheMaxAge))
+		if err != nil {
+			logger.Fatal("failed-to-load-unregistration-cache", err, lager.Data{"path": cfg.UnregistrationCachePath})
+		}
+	}
+
+	var pacedEmitter *emitter.PacedNATSEmitter
+	var periodicEmitter emitter.NATSEmitter
+	eventEmitter := natsEmitter
+	if cfg.PacedEmitFraction > 0 {
+		pacedEmitter = emitter.NewPacedNATSEmitter(
+			natsEmitter,
+			clock,
+			logger,
+			minRegisterInterval(natsTargets, natsTarget.externalRegisterInterval),
+			minRegisterInterval(natsTargets, natsTarget.internalRegisterInterval),
+			cfg.PacedEmitFraction,
+			cfg.PacedEmitMaxMessagesPerSecond,
+		)
+		periodicEmitter = pacedEmitter
+		eventEmitter = pacedEmitter.Immediate()
+	}
+
+	var cellZones routehandlers.CellZones
+	if cfg.CellZonesFile != "" {
+		cellZones, err = routehandlers.LoadCellZones(cfg.CellZonesFile)
+		if err != nil {
+			logger.Fatal("failed-to-load-cell-zones", err, lager.Data{"cell-zones-file": cfg.CellZonesFile})
+		}
+		logger.Info("loaded-cell-zones", lager.Data{"cells": len(cellZones)})
+	}
 
-	handler := routehandlers.NewHandler(table, natsEmitter, routingAPIEmitter, localMode, metronClient, unregistrationCache)
+	handler := routehandlers.NewHandler(table, eventEmitter, routingAPIEmitter, localMode, metronClient, unregistrationCache, routehandlers.HandlerOptions{
+		PeriodicNATSEmitter:           periodicEmitter,
+		CellZones:                     cellZones,
+		ResendInternalUnregistrations: unregistration.ResendEnabled(time.Duration(cfg.InternalUnregistrationInterval), cfg.InternalUnregistrationSendCount),
+		ResendTCPUnregistrations:      routingAPIEmitter != nil && unregistration.ResendEnabled(time.Duration(cfg.TCPUnregistrationInterval), cfg.TCPUnregistrationSendCount),
+	})
 
 	watcher := watcher.NewWatcher(
 		cfg.CellID,
@@ -135,23 +207,74 @@ func main() {
 		clock,
 		handler,
 		syncer.SyncCh(),
-		externalScheduler.EmitCh(),
-		internalScheduler.EmitCh(),
+		externalChan,
+		internalChan,
 		logger,
 		metronClient,
+		time.Duration(cfg.EventCoalesceWindow),
+		cfg.MaxCachedEvents,
 	)
 
+	emitChs := []chan struct{}{externalChan}
+	if cfg.EnableInternalEmitter {
+		emitChs = append(emitChs, internalChan)
+	}
+	signalTrigger := admin.NewSignalTrigger(logger, syncer.SyncCh(), emitChs)
+
 	healthHandler := func(resp http.ResponseWriter, req *http.Request) {
 		resp.WriteHeader(http.StatusOK)
 	}
 	healthCheckServer := http_server.New(cfg.HealthCheckAddress, http.HandlerFunc(healthHandler))
-	unregistrationSender := unregistration.NewSender(logger, clock, unregistrationCache, natsEmitter, time.Duration(cfg.UnregistrationInterval), cfg.UnregistrationSendCount)
-	members := grouper.Members{
-		{"nats-client", natsClientRunner},
-		{"healthcheck", healthCheckServer},
-		{"unregistration", unregistrationSender},
+	unregistrationSender := unregistration.NewSender(
+		logger,
+		clock,
+		unregistrationCache,
+		eventEmitter,
+		routingAPIEmitter,
+		metronClient,
+		time.Duration(cfg.UnregistrationInterval),
+		cfg.UnregistrationSendCount,
+		time.Duration(cfg.InternalUnregistrationInterval),
+		cfg.InternalUnregistrationSendCount,
+		time.Duration(cfg.TCPUnregistrationInterval),
+		cfg.TCPUnregistrationSendCount,
+	)
+	// TCP routes are refreshed independently of the NATS emit cycle so that
+	// they do not expire while NATS is unavailable
+	tcpRefresherMembers := grouper.Members{}
+	if cfg.EnableTCPEmitter && routeTTL > 0 {
+		refreshFraction := cfg.TCPRouteRefreshFraction
+		if refreshFraction == 0 {
+			refreshFraction = defaultTCPRouteRefreshFraction
+		}
+		if refreshFraction < 0 || refreshFraction > 1 {
+			logger.Fatal("invalid-tcp-route-refresh-fraction", errors.New("tcp route refresh fraction must be between 0 and 1"), lager.Data{"fraction": refreshFraction})
+		}
+		refreshConcurrency := cfg.TCPRouteRefreshConcurrency
+		if refreshConcurrency <= 0 {
+			refreshConcurrency = defaultTCPRouteRefreshConcurrency
+		}
+		refresher := emitter.NewTCPRouteRefresher(
+			logger.Session("tcp"),
+			clock,
+			time.Duration(float64(routeTTL)*refreshFraction),
+			table,
+			handler.Synced,
+			routingAPIEmitter,
+			metronClient,
+			refreshConcurrency,
+		)
+		tcpRefresherMembers = append(tcpRefresherMembers, grouper.Member{"tcp-route-refresher", refresher})
 	}
 
+	members := natsMembers(logger, clock, natsTargets, cfg.EnableInternalEmitter, multiNATSEmitter)
+	members = append(members, signingMembers...)
+	members = append(members, authMembers...)
+	members = append(members,
+		grouper.Member{"healthcheck", healthCheckServer},
+		grouper.Member{"unregistration", unregistrationSender},
+	)
+
 	lockMembers := []grouper.Member{}
 	if cfg.CellID == "" {
 		if cfg.ConsulEnabled {
@@ -212,14 +335,43 @@ func main() {
 		)
 	}
 
-	members = append(members,
-		grouper.Member{"watcher", watcher},
-		grouper.Member{"external-scheduler", externalScheduler},
-		grouper.Member{"syncer", syncer},
-	)
+	if pacedEmitter != nil {
+		members = append(members, grouper.Member{"paced-nats-emitter", pacedEmitter})
+	}
+
+	members = append(members, grouper.Member{"watcher", watcher})
+	members = append(members, tcpRefresherMembers...)
+
+	// only an emitter that owns the whole routing table can tell which
+	// mappings are orphaned
+	if cfg.EnableTCPEmitter && cfg.CellID == "" && cfg.RoutingAPI.ReconcileInterval > 0 {
+		reconciler := emitter.NewTCPRouteReconciler(
+			logger.Session("tcp"),
+			clock,
+			time.Duration(cfg.RoutingAPI.ReconcileInterval),
+			table,
+			handler.Synced,
+			routingAPIClient,
+			tokenProvider,
+			metronClient,
+			cfg.RoutingAPI.ReconcileRouterGroups,
+			cfg.RoutingAPI.ReconcileMaxDeletes,
+			cfg.RoutingAPI.ReconcileReportOnly,
+		)
+		members = append(members, grouper.Member{"tcp-route-reconciler", reconciler})
+	}
+	members = append(members, schedulerMembers(natsTargets, false)...)
+	members = append(members, grouper.Member{"syncer", syncer})
 
 	if cfg.EnableInternalEmitter {
-		members = append(members, grouper.Member{"internal-scheduler", internalScheduler})
+		members = append(members, schedulerMembers(natsTargets, true)...)
+	}
+
+	members = append(members, grouper.Member{"signal-trigger", signalTrigger})
+
+	if cfg.AdminAddress != "" {
+		adminHandler := admin.NewHandler(logger, syncer.SyncCh(), emitChs, watcher.RefreshCh(), table)
+		members = append(members, grouper.Member{"admin-server", http_server.New(cfg.AdminAddress, adminHandler)})
 	}
 
 	if cfg.DebugAddress != "" {
@@ -262,19 +414,29 @@ func main() {
 		)
 
 		// we are running in global mode
-		members = grouper.Members{
-			{"nats-client", natsClientRunner},
-			{"consul-down-checker", consulDownChecker},
-			{"consul-down-mode-notifier", consulDownModeNotifier},
-			{"watcher", watcher},
-			{"external-scheduler", externalScheduler},
-			{"syncer", syncer},
+		members = natsMembers(logger, clock, natsTargets, cfg.EnableInternalEmitter, multiNATSEmitter)
+		members = append(members, signingMembers...)
+		members = append(members, authMembers...)
+		members = append(members,
+			grouper.Member{"consul-down-checker", consulDownChecker},
+			grouper.Member{"consul-down-mode-notifier", consulDownModeNotifier},
+		)
+
+		if pacedEmitter != nil {
+			members = append(members, grouper.Member{"paced-nats-emitter", pacedEmitter})
 		}
 
+		members = append(members, grouper.Member{"watcher", watcher})
+		members = append(members, tcpRefresherMembers...)
+		members = append(members, schedulerMembers(natsTargets, false)...)
+		members = append(members, grouper.Member{"syncer", syncer})
+
 		if cfg.EnableInternalEmitter {
-			members = append(members, grouper.Member{"internal-scheduler", internalScheduler})
+			members = append(members, schedulerMembers(natsTargets, true)...)
 		}
 
+		members = append(members, grouper.Member{"signal-trigger", signalTrigger})
+
 		group = grouper.NewOrdered(os.Interrupt, members)
 
 		logger.Info("starting")
@@ -304,18 +466,95 @@ func lockRunner(logger lager.Logger, clk clock.Clock, locks []grouper.Member) if
 	}
 }
 
-func newUaaClient(logger lager.Logger, c *config.RouteEmitterConfig, klok clock.Clock) uaaclient.Client {
+// newTokenProvider returns the provider of the routing API tokens, and the
+// runner refreshing them ahead of their expiry if there is one
+func newTokenProvider(logger lager.Logger, c *config.RouteEmitterConfig, klok clock.Clock) (tokenprovider.TokenProvider, ifrit.Runner) {
 	if !c.RoutingAPI.AuthEnabled {
-		logger.Debug("creating-noop-uaa-client")
-		client := uaaclient.NewNoOpUaaClient()
-		return client
+		logger.Debug("creating-noop-token-provider")
+		return tokenprovider.NoTokenProvider{}, nil
+	}
+
+	var source tokenprovider.Source
+	var maxAge time.Duration
+	switch c.OAuth.Provider {
+	case "", config.OAuthProviderUAA:
+		source = tokenprovider.NewUAASource(newUaaClient(logger, c, klok), klok)
+	case config.OAuthProviderOIDC:
+		logger.Debug("creating-oidc-token-source")
+		httpClient, err := newOIDCHTTPClient(c.OAuth)
+		if err != nil {
+			logger.Fatal("failed-to-create-oidc-http-client", err)
+		}
+		source, err = tokenprovider.NewOIDCSource(httpClient, klok, tokenprovider.OIDCConfig{
+			TokenURL:     c.OAuth.TokenURL,
+			IssuerURL:    c.OAuth.IssuerURL,
+			ClientID:     c.OAuth.ClientName,
+			ClientSecret: clientSecret(logger, c.OAuth),
+			Scopes:       c.OAuth.Scopes,
+		})
+		if err != nil {
+			logger.Fatal("failed-to-create-oidc-token-source", err)
+		}
+	case config.OAuthProviderTokenFile:
+		logger.Debug("creating-token-file-source", lager.Data{"path": c.OAuth.TokenFile})
+		source = tokenprovider.NewFileSource(c.OAuth.TokenFile)
+		maxAge = time.Duration(c.OAuth.TokenFilePollInterval)
+		if maxAge <= 0 {
+			maxAge = defaultTokenFilePollInterval
+		}
+	case config.OAuthProviderMTLS:
+		if c.RoutingAPI.ClientCertFile == "" || c.RoutingAPI.ClientKeyFile == "" || c.RoutingAPI.CACertFile == "" {
+			logger.Fatal("invalid-oauth-provider", errors.New("mtls requires the routing API client certificate, key and CA"))
+		}
+		logger.Debug("using-mtls-without-token")
+		return tokenprovider.NoTokenProvider{}, nil
+	default:
+		logger.Fatal("invalid-oauth-provider", errors.New("unknown oauth provider"), lager.Data{"provider": c.OAuth.Provider})
+	}
+
+	provider := tokenprovider.NewRefreshingProvider(logger, klok, source, time.Duration(c.OAuth.RefreshAhead), maxAge)
+	_, err := provider.AccessToken(false)
+	if err != nil {
+		logger.Error("failed-to-fetch-initial-token", err)
+	}
+	return provider, provider
+}
+
+func clientSecret(logger lager.Logger, c config.OAuthConfig) string {
+	if c.ClientSecretFile == "" {
+		return c.ClientSecret
+	}
+
+	contents, err := ioutil.ReadFile(c.ClientSecretFile)
+	if err != nil {
+		logger.Fatal("failed-to-read-client-secret-file", err, lager.Data{"path": c.ClientSecretFile})
 	}
+	return strings.TrimSpace(string(contents))
+}
 
+func newOIDCHTTPClient(c config.OAuthConfig) (*http.Client, error) {
+	options := []tlsconfig.ClientOption{}
+	if c.CACerts != "" {
+		options = append(options, tlsconfig.WithAuthorityFromFile(c.CACerts))
+	}
+	tlsConfig, err := tlsconfig.Build(tlsconfig.WithExternalServiceDefaults()).Client(options...)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.InsecureSkipVerify = c.SkipCertVerify
+
+	return &http.Client{
+		Timeout:   time.Duration(c.UaaRequestTimeout),
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+func newUaaClient(logger lager.Logger, c *config.RouteEmitterConfig, klok clock.Clock) uaaclient.Client {
 	logger.Debug("creating-uaa-client")
 	cfg := uaaconfig.Config{
 		UaaEndpoint:      c.OAuth.UaaURL,
 		ClientName:       c.OAuth.ClientName,
-		ClientSecret:     c.OAuth.ClientSecret,
+		ClientSecret:     clientSecret(logger, c.OAuth),
 		SkipVerification: c.OAuth.SkipCertVerify,
 		CACerts:          c.OAuth.CACerts,
 		RequestTimeout:   time.Duration(c.OAuth.UaaRequestTimeout),
@@ -353,13 +592,14 @@ func initializeNatsEmitter(
 	routeEmittingWorkers int,
 	metronClient loggingclient.IngressClient,
 	emitInternalRoutes bool,
+	opts emitter.NATSEmitterOptions,
 ) emitter.NATSEmitter {
 	workPool, err := workpool.NewWorkPool(routeEmittingWorkers)
 	if err != nil {
 		logger.Fatal("failed-to-construct-nats-emitter-workpool", err, lager.Data{"num-workers": routeEmittingWorkers}) // should never happen
 	}
 
-	return emitter.NewNATSEmitter(natsClient, workPool, logger, metronClient, emitInternalRoutes)
+	return emitter.NewNATSEmitter(natsClient, workPool, logger, metronClient, emitInternalRoutes, opts)
 }
 
 func initializeConsulClient(logger lager.Logger, consulCluster string) consuladapter.Client {
@@ -408,10 +648,237 @@ func initializeBBSClient(
 	return bbsClient
 }
 
-func initializeNATSClient(logger lager.Logger, tlsEnabled bool, caFile, certFile, keyFile string) (diegonats.NATSClient, error) {
-	var natsClient diegonats.NATSClient
+// natsTarget holds the client, emitter and greeting schedulers of one NATS
+// cluster that routes are published to
+type natsTarget struct {
+	name              string
+	credentials       *diegonats.CredentialStore
+	clientRunner      ifrit.Runner
+	emitter           emitter.NATSEmitter
+	externalScheduler *scheduler.RouteBroadcastScheduler
+	internalScheduler *scheduler.RouteBroadcastScheduler
+}
+
+// memberName suffixes the name of a group member with the target name so
+// that the members of several targets can be told apart
+func (t natsTarget) memberName(name string) string {
+	if t.name == "" {
+		return name
+	}
+	return name + "-" + t.name
+}
+
+func (t natsTarget) externalRegisterInterval() time.Duration {
+	return t.externalScheduler.RegisterInterval()
+}
+
+func (t natsTarget) internalRegisterInterval() time.Duration {
+	return t.internalScheduler.RegisterInterval()
+}
+
+func initializeNATSTargets(
+	logger lager.Logger,
+	clock clock.Clock,
+	cfg config.RouteEmitterConfig,
+	metronClient loggingclient.IngressClient,
+	externalChan, internalChan chan struct{},
+	signer *signing.Signer,
+) []natsTarget {
+	externalSubjects := routingtable.NewSubjectLayout(cfg.NATSSubjectNamespace, "router", cfg.NATSIsolationSegmentSubjects)
+	internalSubjects := routingtable.NewSubjectLayout(cfg.NATSSubjectNamespace, "service-discovery", nil)
+
+	targets := []natsTarget{}
+	for _, targetConfig := range cfg.NATSTargetConfigs() {
+		targetLogger := logger
+		if targetConfig.Name != "" {
+			targetLogger = logger.WithData(lager.Data{"nats-target": targetConfig.Name})
+		}
+
+		credentials, err := diegonats.NewCredentialStore(targetLogger, clock, diegonats.Credentials{
+			NKeySeedFile: targetConfig.NKeySeedFile,
+			CredsFile:    targetConfig.CredsFile,
+			Token:        targetConfig.Token,
+			TokenFile:    targetConfig.TokenFile,
+		}, time.Duration(targetConfig.CredentialsPollInterval))
+		if err != nil {
+			targetLogger.Error("failed-to-load-nats-credentials", err)
+			os.Exit(1)
+		}
+
+		natsClient, err := initializeNATSClient(targetLogger, targetConfig.TLSEnabled, targetConfig.CACertFile, targetConfig.ClientCertFile, targetConfig.ClientKeyFile, credentials)
+		if err != nil {
+			targetLogger.Error("failed-to-initialize-nats-client", err)
+			os.Exit(1)
+		}
+
+		// re-emit every route once a target that dropped messages recovers
+		breaker := emitter.NewCircuitBreaker(targetLogger, clock, cfg.NATSCircuitBreakerFailureThreshold, time.Duration(cfg.NATSCircuitBreakerCooldown), func() {
+			triggerEmit(externalChan)
+			triggerEmit(internalChan)
+		})
+		// publishes are buffered without errors while the client reconnects,
+		// so the connection state opens and closes the breaker
+		natsClient.OnDisconnect(func(error) { breaker.Disconnected() })
+		natsClient.OnReconnect(breaker.Reconnected)
+
+		// the schedulers of every target share the emit channels, so a greeting
+		// on any cluster triggers a full emit to all of them
+		targets = append(targets, natsTarget{
+			name:         targetConfig.Name,
+			credentials:  credentials,
+			clientRunner: diegonats.NewClientRunner(targetConfig.Addresses, targetConfig.Username, targetConfig.Password, targetLogger, natsClient, clock, metronClient),
+			emitter: initializeNatsEmitter(targetLogger, natsClient, cfg.RouteEmittingWorkers, metronClient, cfg.EnableInternalEmitter, emitter.NATSEmitterOptions{
+				ExternalSubjects: externalSubjects,
+				InternalSubjects: internalSubjects,
+				Signer:           signer,
+				Breaker:          breaker,
+			}),
+			externalScheduler: scheduler.NewRouteBroadcastScheduler(clock, natsClient, targetLogger, externalSubjects, externalChan),
+			internalScheduler: scheduler.NewRouteBroadcastScheduler(clock, natsClient, targetLogger, internalSubjects, internalChan),
+		})
+	}
+	return targets
+}
+
+func triggerEmit(emitCh chan struct{}) {
+	select {
+	case emitCh <- struct{}{}:
+	default:
+	}
+}
+
+// initializeRegistrySigner returns the signer of the registry messages, if
+// signing is enabled, along with the runner that reloads its key
+func initializeRegistrySigner(logger lager.Logger, clock clock.Clock, cfg config.RegistrySigningConfig) (*signing.Signer, grouper.Members) {
+	if cfg.KeyFile == "" {
+		return nil, grouper.Members{}
+	}
+
+	keyFiles := signing.KeyFiles{
+		KeyID:     cfg.KeyID,
+		KeyIDFile: cfg.KeyIDFile,
+		Algorithm: cfg.Algorithm,
+		KeyFile:   cfg.KeyFile,
+	}
+	key, err := keyFiles.Load()
+	if err != nil {
+		logger.Error("failed-to-load-registry-signing-key", err, lager.Data{"key-id": cfg.KeyID, "key-id-file": cfg.KeyIDFile})
+		os.Exit(1)
+	}
+
+	signer, err := signing.NewSigner(key, clock)
+	if err != nil {
+		logger.Error("failed-to-initialize-registry-signer", err, lager.Data{"key-id": key.ID})
+		os.Exit(1)
+	}
+
+	logger.Info("signing-registry-messages", lager.Data{"key-id": key.ID, "algorithm": cfg.Algorithm})
+	reloader := signing.NewKeyReloader(logger, clock, signer, keyFiles, time.Duration(cfg.ReloadInterval))
+	return signer, grouper.Members{grouper.Member{"registry-signing-key-reloader", reloader}}
+}
+
+// natsMembers returns the credential stores and clients of the targets. With
+// several targets, the client and schedulers of each target run in a group
+// of their own so that a target that cannot be reached does not stop the
+// emitter or hold back the other targets.
+func natsMembers(logger lager.Logger, clk clock.Clock, targets []natsTarget, internal bool, multiNATSEmitter *emitter.MultiNATSEmitter) grouper.Members {
+	members := grouper.Members{}
+	for _, target := range targets {
+		members = append(members, grouper.Member{target.memberName("nats-credentials"), target.credentials})
+	}
+
+	if len(targets) == 1 {
+		return append(members, grouper.Member{"nats-client", targets[0].clientRunner})
+	}
+
+	for _, target := range targets {
+		targetMembers := grouper.Members{
+			{"nats-client", target.clientRunner},
+			{"external-scheduler", target.externalScheduler},
+		}
+		if internal {
+			targetMembers = append(targetMembers, grouper.Member{"internal-scheduler", target.internalScheduler})
+		}
+		members = append(members, grouper.Member{
+			target.memberName("nats-target"),
+			natsTargetRunner(logger, clk, target.name, targetMembers, multiNATSEmitter),
+		})
+	}
+	return members
+}
+
+// natsTargetRunner runs the members of one of several NATS targets. It is
+// ready right away and restarts the members after natsTargetRetryInterval
+// whenever they fail, e.g. because the cluster cannot be connected to,
+// reporting the target as unhealthy in the meantime.
+func natsTargetRunner(logger lager.Logger, clk clock.Clock, name string, members grouper.Members, multiNATSEmitter *emitter.MultiNATSEmitter) ifrit.Runner {
+	logger = logger.Session("nats-target", lager.Data{"nats-target": name})
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		close(ready)
+
+		for {
+			process := ifrit.Background(grouper.NewOrdered(os.Interrupt, members))
+
+			select {
+			case signal := <-signals:
+				process.Signal(signal)
+				return <-process.Wait()
+			case err := <-process.Wait():
+				if err == nil {
+					err = errors.New("nats target exited")
+				}
+				logger.Error("nats-target-failed", err, lager.Data{"retry-interval": natsTargetRetryInterval.String()})
+				multiNATSEmitter.TargetFailed(name, err)
+			}
+
+			timer := clk.NewTimer(natsTargetRetryInterval)
+			select {
+			case <-signals:
+				timer.Stop()
+				return nil
+			case <-timer.C():
+				logger.Info("retrying")
+			}
+		}
+	})
+}
+
+// schedulerMembers returns the schedulers of a single target; the schedulers
+// of several targets are run by natsMembers
+func schedulerMembers(targets []natsTarget, internal bool) grouper.Members {
+	members := grouper.Members{}
+	if len(targets) > 1 {
+		return members
+	}
+	for _, target := range targets {
+		if internal {
+			members = append(members, grouper.Member{target.memberName("internal-scheduler"), target.internalScheduler})
+		} else {
+			members = append(members, grouper.Member{target.memberName("external-scheduler"), target.externalScheduler})
+		}
+	}
+	return members
+}
+
+// minRegisterInterval returns the shortest register interval requested on any
+// target, so that paced emits keep up with the most demanding cluster
+func minRegisterInterval(targets []natsTarget, interval func(natsTarget) time.Duration) func() time.Duration {
+	return func() time.Duration {
+		var min time.Duration
+		for _, target := range targets {
+			if i := interval(target); i > 0 && (min == 0 || i < min) {
+				min = i
+			}
+		}
+		return min
+	}
+}
+
+func initializeNATSClient(logger lager.Logger, tlsEnabled bool, caFile, certFile, keyFile string, credentials *diegonats.CredentialStore) (diegonats.NATSClient, error) {
+	var tlsConfig *tls.Config
 	if tlsEnabled {
-		tlsConfig, err := tlsconfig.Build(
+		var err error
+		tlsConfig, err = tlsconfig.Build(
 			tlsconfig.WithInternalServiceDefaults(),
 			tlsconfig.WithIdentityFromFile(certFile, keyFile),
 		).Client(
@@ -420,10 +887,8 @@ func initializeNATSClient(logger lager.Logger, tlsEnabled bool, caFile, certFile
 		if err != nil {
 			return nil, err
 		}
-		natsClient = diegonats.NewClientWithTLSConfig(tlsConfig)
-	} else {
-		natsClient = diegonats.NewClient()
 	}
+	natsClient := diegonats.NewClientWithCredentials(tlsConfig, credentials)
 
 	natsPingDuration := 20 * time.Second
 	logger.Info("setting-nats-ping-interval", lager.Data{"duration-in-seconds": natsPingDuration.Seconds()})
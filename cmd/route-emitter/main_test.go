@@ -37,6 +37,7 @@ import (
 	"code.cloudfoundry.org/locket"
 	"code.cloudfoundry.org/route-emitter/cmd/route-emitter/config"
 	"code.cloudfoundry.org/route-emitter/cmd/route-emitter/runners"
+	"code.cloudfoundry.org/route-emitter/diegonats"
 	"code.cloudfoundry.org/route-emitter/diegonats/natsserverrunner"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	. "code.cloudfoundry.org/route-emitter/routingtable/matchers"
@@ -606,6 +607,22 @@ var _ = Describe("Route Emitter", func() {
 					verifyEmitterIsUP()
 				})
 
+				Context("and the oidc provider is used", func() {
+					BeforeEach(func() {
+						cfgs = append(cfgs, func(cfg *config.RouteEmitterConfig) {
+							cfg.OAuth = config.OAuthConfig{
+								Provider:     config.OAuthProviderOIDC,
+								TokenURL:     oauthServer.URL() + "/oauth/token",
+								ClientName:   "someclient",
+								ClientSecret: "somesecret",
+								CACerts:      "fixtures/ca.crt",
+							}
+						})
+					})
+
+					verifyEmitterIsUP()
+				})
+
 				Context("and the uaa server does not respond with the request timeout", func() {
 					BeforeEach(func() {
 						cfgs = append(cfgs, func(cfg *config.RouteEmitterConfig) {
@@ -649,7 +666,7 @@ var _ = Describe("Route Emitter", func() {
 			})
 
 			It("starts successfully without oauth config", func() {
-				Expect(runner).To(gbytes.Say("creating-noop-uaa-client"))
+				Expect(runner).To(gbytes.Say("creating-noop-token-provider"))
 			})
 
 			Context("and the initial sync loop is finished", func() {
@@ -1380,6 +1397,86 @@ var _ = Describe("Route Emitter", func() {
 			})
 		})
 
+		Context("when configured with multiple nats targets", func() {
+			var (
+				secondNATSProcess ifrit.Process
+				secondNATSClient  diegonats.NATSClient
+				secondRoutes      chan routingtable.RegistryMessage
+			)
+
+			BeforeEach(func() {
+				secondNATSPort, err := portAllocator.ClaimPorts(1)
+				Expect(err).NotTo(HaveOccurred())
+				secondNATSProcess, secondNATSClient = natsserverrunner.StartNatsServer(int(secondNATSPort))
+
+				secondRoutes = make(chan routingtable.RegistryMessage)
+				secondNATSClient.Subscribe("router.register", func(msg *nats.Msg) {
+					defer GinkgoRecover()
+
+					var message routingtable.RegistryMessage
+					err := json.Unmarshal(msg.Data, &message)
+					Expect(err).NotTo(HaveOccurred())
+
+					secondRoutes <- message
+				})
+
+				cfgs = append(cfgs, func(cfg *config.RouteEmitterConfig) {
+					cfg.NATSTargets = []config.NATSTargetConfig{
+						{Name: "old-fleet", Addresses: fmt.Sprintf("127.0.0.1:%d", natsPort), Username: "nats", Password: "nats"},
+						{Name: "new-fleet", Addresses: fmt.Sprintf("127.0.0.1:%d", secondNATSPort)},
+					}
+				})
+			})
+
+			AfterEach(func() {
+				secondNATSClient.Close()
+				ginkgomon.Kill(secondNATSProcess)
+			})
+
+			It("emits routes to every cluster", func() {
+				err := bbsClient.DesireLRP(logger, desiredLRP)
+				Expect(err).NotTo(HaveOccurred())
+				err = bbsClient.StartActualLRP(logger, &lrpKey, &instanceKey, &netInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				var msg routingtable.RegistryMessage
+				Eventually(registeredRoutes).Should(Receive(&msg))
+				Expect(msg.Host).To(Equal(netInfo.Address))
+				Eventually(secondRoutes).Should(Receive(&msg))
+				Expect(msg.Host).To(Equal(netInfo.Address))
+			})
+
+			It("starts a client for every cluster", func() {
+				logs := func() string { return string(runner.Buffer().Contents()) }
+				Eventually(logs).Should(ContainSubstring(`"nats-target":"old-fleet"`))
+				Eventually(logs).Should(ContainSubstring(`"nats-target":"new-fleet"`))
+			})
+
+			Context("when one of the clusters cannot be reached", func() {
+				BeforeEach(func() {
+					cfgs = append(cfgs, func(cfg *config.RouteEmitterConfig) {
+						cfg.NATSTargets = append(cfg.NATSTargets, config.NATSTargetConfig{Name: "lost-fleet", Addresses: "localhost:0"})
+					})
+				})
+
+				It("keeps emitting routes to the other clusters", func() {
+					Eventually(runner.Buffer()).Should(gbytes.Say("nats-target-failed"))
+
+					err := bbsClient.DesireLRP(logger, desiredLRP)
+					Expect(err).NotTo(HaveOccurred())
+					err = bbsClient.StartActualLRP(logger, &lrpKey, &instanceKey, &netInfo)
+					Expect(err).NotTo(HaveOccurred())
+
+					var msg routingtable.RegistryMessage
+					Eventually(registeredRoutes).Should(Receive(&msg))
+					Expect(msg.Host).To(Equal(netInfo.Address))
+					Eventually(secondRoutes).Should(Receive(&msg))
+					Expect(msg.Host).To(Equal(netInfo.Address))
+					Consistently(emitter.Wait()).ShouldNot(Receive())
+				})
+			})
+		})
+
 		It("enables the healthcheck server", func() {
 			client := http.Client{
 				Timeout: time.Second,
@@ -0,0 +1,299 @@
+package diegonats
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// DefaultCredentialsPollInterval is how often credential files are checked
+// for rotation when no interval is configured
+const DefaultCredentialsPollInterval = 10 * time.Second
+
+var (
+	ErrMultipleCredentials = errors.New("only one of nkey seed file, creds file, token and token file can be set")
+	ErrEmptyToken          = errors.New("nats token file is empty")
+)
+
+// Credentials configures how the client authenticates to NATS in addition to
+// a username and password embedded in the server URLs. At most one of the
+// fields can be set.
+type Credentials struct {
+	// NKeySeedFile is a file containing a user nkey seed
+	NKeySeedFile string
+	// CredsFile is a .creds file containing a user JWT and its nkey seed
+	CredsFile string
+	// Token is a static authentication token
+	Token string
+	// TokenFile is a file containing an authentication token
+	TokenFile string
+}
+
+func (c Credentials) files() []string {
+	files := []string{}
+	for _, file := range []string{c.NKeySeedFile, c.CredsFile, c.TokenFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// CredentialStore holds the credentials used to authenticate to NATS. It is
+// an ifrit runner that watches the credential files and reloads them when
+// they rotate. The client reads the current credentials every time it
+// (re)connects, so a rotated file is used on the next reconnect. The nkey
+// public key is fixed for the lifetime of a connection, so a client replaces
+// its connection when the nkey seed rotates. A file that fails to load keeps
+// the previous credentials in place.
+type CredentialStore struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	credentials  Credentials
+	pollInterval time.Duration
+
+	lock      sync.RWMutex
+	token     string
+	userJWT   string
+	keyPair   nkeys.KeyPair
+	publicKey string
+	stats     map[string]fileStat
+	// nkeyRotated is closed and replaced whenever the nkey seed rotates
+	nkeyRotated chan struct{}
+}
+
+func NewCredentialStore(logger lager.Logger, clock clock.Clock, credentials Credentials, pollInterval time.Duration) (*CredentialStore, error) {
+	modes := len(credentials.files())
+	if credentials.Token != "" {
+		modes++
+	}
+	if modes > 1 {
+		return nil, ErrMultipleCredentials
+	}
+
+	if pollInterval <= 0 {
+		pollInterval = DefaultCredentialsPollInterval
+	}
+
+	store := &CredentialStore{
+		logger:       logger.Session("nats-credentials"),
+		clock:        clock,
+		credentials:  credentials,
+		pollInterval: pollInterval,
+		token:        credentials.Token,
+		stats:        map[string]fileStat{},
+		nkeyRotated:  make(chan struct{}),
+	}
+
+	err := store.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *CredentialStore) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+
+	if len(s.credentials.files()) == 0 {
+		<-signals
+		return nil
+	}
+
+	s.logger.Info("started", lager.Data{"files": s.credentials.files(), "poll-interval": s.pollInterval.String()})
+	defer s.logger.Info("finished")
+
+	ticker := s.clock.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C():
+			if !s.changed() {
+				continue
+			}
+			err := s.reload()
+			if err != nil {
+				s.logger.Error("failed-to-reload-credentials", err)
+				continue
+			}
+			s.logger.Info("reloaded-credentials")
+		}
+	}
+}
+
+// changed returns true if any credential file has a different modification
+// time or size than when it was last loaded
+func (s *CredentialStore) changed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, file := range s.credentials.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			s.logger.Error("failed-to-stat-credentials-file", err, lager.Data{"file": file})
+			continue
+		}
+		if s.stats[file] != (fileStat{modTime: info.ModTime(), size: info.Size()}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CredentialStore) reload() error {
+	stats := map[string]fileStat{}
+	for _, file := range s.credentials.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		stats[file] = fileStat{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	var (
+		token, userJWT string
+		keyPair        nkeys.KeyPair
+		err            error
+	)
+
+	switch {
+	case s.credentials.CredsFile != "":
+		userJWT, keyPair, err = loadCredsFile(s.credentials.CredsFile)
+	case s.credentials.NKeySeedFile != "":
+		keyPair, err = loadNKeySeedFile(s.credentials.NKeySeedFile)
+	case s.credentials.TokenFile != "":
+		token, err = loadTokenFile(s.credentials.TokenFile)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var publicKey string
+	if keyPair != nil {
+		publicKey, err = keyPair.PublicKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the nkey public key is sent as a connect option and cannot change for
+	// the lifetime of the connection, clients replace their connection
+	if s.credentials.NKeySeedFile != "" && s.publicKey != "" && s.publicKey != publicKey {
+		s.logger.Info("nkey-rotated", lager.Data{"public-key": publicKey})
+		close(s.nkeyRotated)
+		s.nkeyRotated = make(chan struct{})
+	}
+
+	s.token = token
+	s.userJWT = userJWT
+	s.keyPair = keyPair
+	s.publicKey = publicKey
+	s.stats = stats
+	return nil
+}
+
+// apply configures the connection options to authenticate with the current
+// credentials
+func (s *CredentialStore) apply(options *nats.Options) {
+	switch {
+	case s.credentials.CredsFile != "":
+		options.UserJWT = s.currentUserJWT
+		options.SignatureCB = s.sign
+	case s.credentials.NKeySeedFile != "":
+		s.lock.RLock()
+		options.Nkey = s.publicKey
+		s.lock.RUnlock()
+		options.SignatureCB = s.sign
+	case s.credentials.TokenFile != "":
+		options.TokenHandler = s.currentToken
+	case s.credentials.Token != "":
+		options.Token = s.credentials.Token
+	}
+}
+
+// rotation returns a channel that is closed when the nkey seed next rotates
+func (s *CredentialStore) rotation() <-chan struct{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.nkeyRotated
+}
+
+func (s *CredentialStore) currentUserJWT() (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.userJWT, nil
+}
+
+func (s *CredentialStore) currentToken() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.token
+}
+
+func (s *CredentialStore) sign(nonce []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.keyPair.Sign(nonce)
+}
+
+func loadCredsFile(path string) (string, nkeys.KeyPair, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	userJWT, err := nkeys.ParseDecoratedJWT(contents)
+	if err != nil {
+		return "", nil, err
+	}
+
+	keyPair, err := nkeys.ParseDecoratedNKey(contents)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return userJWT, keyPair, nil
+}
+
+func loadNKeySeedFile(path string) (nkeys.KeyPair, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return nkeys.ParseDecoratedNKey(contents)
+}
+
+func loadTokenFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", ErrEmptyToken
+	}
+	return token, nil
+}
@@ -0,0 +1,157 @@
+package diegonats_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "code.cloudfoundry.org/route-emitter/diegonats"
+	"code.cloudfoundry.org/route-emitter/diegonats/natsserverrunner"
+	"github.com/nats-io/nats.go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("CredentialStore", func() {
+	var (
+		logger         *lagertest.TestLogger
+		clock          *fakeclock.FakeClock
+		credentialsDir string
+		tokenFile      string
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+
+		var err error
+		credentialsDir, err = ioutil.TempDir("", "nats-credentials")
+		Expect(err).NotTo(HaveOccurred())
+		tokenFile = filepath.Join(credentialsDir, "token")
+		Expect(ioutil.WriteFile(tokenFile, []byte("some-token"), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(credentialsDir)).To(Succeed())
+	})
+
+	It("rejects more than one kind of credentials", func() {
+		_, err := NewCredentialStore(logger, clock, Credentials{Token: "some-token", TokenFile: tokenFile}, 0)
+		Expect(err).To(Equal(ErrMultipleCredentials))
+	})
+
+	It("fails when a credentials file cannot be loaded", func() {
+		_, err := NewCredentialStore(logger, clock, Credentials{CredsFile: filepath.Join(credentialsDir, "missing.creds")}, 0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails when the token file is empty", func() {
+		Expect(ioutil.WriteFile(tokenFile, []byte("\n"), 0600)).To(Succeed())
+		_, err := NewCredentialStore(logger, clock, Credentials{TokenFile: tokenFile}, 0)
+		Expect(err).To(Equal(ErrEmptyToken))
+	})
+
+	Context("when the token file rotates", func() {
+		var (
+			natsClient   NATSClient
+			storeProcess ifrit.Process
+		)
+
+		BeforeEach(func() {
+			store, err := NewCredentialStore(logger, clock, Credentials{TokenFile: tokenFile}, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			storeProcess = ifrit.Invoke(store)
+
+			startNATSWithRunner(natsserverrunner.NewNatsServerWithTokenTestRunner(int(natsPort), "some-token"))
+			natsClient = NewClientWithCredentials(nil, store)
+			_, err = natsClient.Connect([]string{fmt.Sprintf("nats://127.0.0.1:%d", natsPort)})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			natsClient.Close()
+			stopNATS()
+			storeProcess.Signal(os.Interrupt)
+			Eventually(storeProcess.Wait()).Should(Receive())
+		})
+
+		It("reconnects with the new token", func() {
+			Expect(ioutil.WriteFile(tokenFile, []byte("some-rotated-token"), 0600)).To(Succeed())
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(logger).Should(gbytes.Say("reloaded-credentials"))
+
+			stopNATS()
+			Eventually(natsClient.Ping).Should(BeFalse())
+
+			startNATSWithRunner(natsserverrunner.NewNatsServerWithTokenTestRunner(int(natsPort), "some-rotated-token"))
+			Eventually(natsClient.Ping, 5).Should(BeTrue())
+		})
+
+		It("keeps the previous token when the file is emptied", func() {
+			Expect(ioutil.WriteFile(tokenFile, []byte(""), 0600)).To(Succeed())
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(logger).Should(gbytes.Say("failed-to-reload-credentials"))
+
+			stopNATS()
+			Eventually(natsClient.Ping).Should(BeFalse())
+
+			startNATSWithRunner(natsserverrunner.NewNatsServerWithTokenTestRunner(int(natsPort), "some-token"))
+			Eventually(natsClient.Ping, 5).Should(BeTrue())
+		})
+	})
+
+	Context("when the nkey seed file rotates", func() {
+		var (
+			natsClient   NATSClient
+			storeProcess ifrit.Process
+			closedChan   chan struct{}
+			payloads     chan []byte
+		)
+
+		BeforeEach(func() {
+			configFile, seedFile := natsserverrunner.WriteNKeyServerConfig(credentialsDir)
+			store, err := NewCredentialStore(logger, clock, Credentials{NKeySeedFile: seedFile}, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			storeProcess = ifrit.Invoke(store)
+
+			startNATSWithRunner(natsserverrunner.NewNatsServerWithConfigTestRunner(int(natsPort), configFile))
+			natsClient = NewClientWithCredentials(nil, store)
+			closedChan, err = natsClient.Connect([]string{fmt.Sprintf("nats://127.0.0.1:%d", natsPort)})
+			Expect(err).NotTo(HaveOccurred())
+
+			payloads = make(chan []byte, 1)
+			_, err = natsClient.Subscribe("some-subject", func(msg *nats.Msg) {
+				payloads <- msg.Data
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			natsClient.Close()
+			stopNATS()
+			storeProcess.Signal(os.Interrupt)
+			Eventually(storeProcess.Wait()).Should(Receive())
+		})
+
+		It("connects with the new nkey and keeps the subscriptions", func() {
+			configFile, _ := natsserverrunner.WriteNKeyServerConfig(credentialsDir)
+			stopNATS()
+			Eventually(natsClient.Ping).Should(BeFalse())
+			startNATSWithRunner(natsserverrunner.NewNatsServerWithConfigTestRunner(int(natsPort), configFile))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(logger).Should(gbytes.Say("nkey-rotated"))
+			Eventually(natsClient.Ping, 5).Should(BeTrue())
+			Expect(closedChan).NotTo(BeClosed())
+
+			Expect(natsClient.Publish("some-subject", []byte("hello"))).To(Succeed())
+			Eventually(payloads).Should(Receive(Equal([]byte("hello"))))
+		})
+	})
+})
@@ -47,6 +47,10 @@ func startNATSWithTLS(caFile, certFile, keyFile string) {
 	natsServerProcess = ginkgomon.Invoke(natsserverrunner.NewNatsServerWithTLSTestRunner(int(natsPort), caFile, certFile, keyFile))
 }
 
+func startNATSWithRunner(runner *ginkgomon.Runner) {
+	natsServerProcess = ginkgomon.Invoke(runner)
+}
+
 func stopNATS() {
 	ginkgomon.Kill(natsServerProcess)
 }
@@ -24,6 +24,10 @@ type FakeNATSClient struct {
 	pingResponse bool
 	pingInterval time.Duration
 
+	nextHandlerID      int
+	disconnectHandlers map[int]func(error)
+	reconnectHandlers  map[int]func()
+
 	sync.RWMutex
 }
 
@@ -79,6 +83,78 @@ func (f *FakeNATSClient) OnPing(onPingCallback func() bool) {
 	f.Unlock()
 }
 
+func (f *FakeNATSClient) OnDisconnect(handler func(error)) func() {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.disconnectHandlers == nil {
+		f.disconnectHandlers = map[int]func(error){}
+	}
+	id := f.nextHandlerID
+	f.nextHandlerID++
+	f.disconnectHandlers[id] = handler
+
+	return func() {
+		f.Lock()
+		defer f.Unlock()
+		delete(f.disconnectHandlers, id)
+	}
+}
+
+func (f *FakeNATSClient) OnReconnect(handler func()) func() {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.reconnectHandlers == nil {
+		f.reconnectHandlers = map[int]func(){}
+	}
+	id := f.nextHandlerID
+	f.nextHandlerID++
+	f.reconnectHandlers[id] = handler
+
+	return func() {
+		f.Lock()
+		defer f.Unlock()
+		delete(f.reconnectHandlers, id)
+	}
+}
+
+// HandlerCount returns the number of registered disconnect and reconnect
+// handlers
+func (f *FakeNATSClient) HandlerCount() int {
+	f.RLock()
+	defer f.RUnlock()
+	return len(f.disconnectHandlers) + len(f.reconnectHandlers)
+}
+
+// Disconnect calls the registered disconnect handlers with err
+func (f *FakeNATSClient) Disconnect(err error) {
+	f.RLock()
+	handlers := make([]func(error), 0, len(f.disconnectHandlers))
+	for _, handler := range f.disconnectHandlers {
+		handlers = append(handlers, handler)
+	}
+	f.RUnlock()
+
+	for _, handler := range handlers {
+		handler(err)
+	}
+}
+
+// Reconnect calls the registered reconnect handlers
+func (f *FakeNATSClient) Reconnect() {
+	f.RLock()
+	handlers := make([]func(), 0, len(f.reconnectHandlers))
+	for _, handler := range f.reconnectHandlers {
+		handlers = append(handlers, handler)
+	}
+	f.RUnlock()
+
+	for _, handler := range handlers {
+		handler()
+	}
+}
+
 func (f *FakeNATSClient) Ping() bool {
 	f.RLock()
 	onPing := f.onPing
@@ -2,11 +2,19 @@ package diegonats
 
 import (
 	"crypto/tls"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
+// ErrNotConnected is returned when publishing or subscribing before the
+// client has connected
+var ErrNotConnected = errors.New("nats client is not connected")
+
+const reconnectWait = 500 * time.Millisecond
+
 type NATSClient interface {
 	Connect(urls []string) (chan struct{}, error)
 	SetPingInterval(interval time.Duration)
@@ -14,6 +22,13 @@ type NATSClient interface {
 	Ping() bool
 	Unsubscribe(sub *nats.Subscription) error
 
+	// OnDisconnect and OnReconnect register handlers that are called when the
+	// connection is lost and when it has been re-established. They return a
+	// function that deregisters the handler, runners that can be restarted on
+	// the same client call it when they exit.
+	OnDisconnect(handler func(error)) (deregister func())
+	OnReconnect(handler func()) (deregister func())
+
 	// Via nats-io/nats.Conn
 	Publish(subject string, data []byte) error
 	PublishRequest(subj, reply string, data []byte) error
@@ -23,9 +38,30 @@ type NATSClient interface {
 }
 
 type natsClient struct {
-	*nats.Conn
+	connLock      sync.RWMutex
+	conn          *nats.Conn
+	closed        bool
+	subscriptions []*subscription
+
 	pingInterval time.Duration
 	tlsConfig    *tls.Config
+	credentials  *CredentialStore
+
+	handlersLock       sync.Mutex
+	nextHandlerID      int
+	disconnectHandlers map[int]func(error)
+	reconnectHandlers  map[int]func()
+}
+
+// subscription remembers how a subscription was made so that it can be made
+// again when the connection is replaced. original is handed out to the
+// caller, current belongs to the current connection.
+type subscription struct {
+	subject  string
+	queue    string
+	handler  nats.MsgHandler
+	original *nats.Subscription
+	current  *nats.Subscription
 }
 
 func NewClient() NATSClient {
@@ -41,43 +77,300 @@ func NewClientWithTLSConfig(tlsConfig *tls.Config) NATSClient {
 	}
 }
 
+// NewClientWithCredentials returns a client that authenticates with the
+// credentials held by the store. tlsConfig may be nil.
+func NewClientWithCredentials(tlsConfig *tls.Config, credentials *CredentialStore) NATSClient {
+	return &natsClient{
+		pingInterval: nats.DefaultPingInterval,
+		tlsConfig:    tlsConfig,
+		credentials:  credentials,
+	}
+}
+
 func (nc *natsClient) SetPingInterval(interval time.Duration) {
 	nc.pingInterval = interval
 }
 
 func (nc *natsClient) Connect(urls []string) (chan struct{}, error) {
+	// the nkey cannot change for the lifetime of a connection, so the
+	// connection is replaced when the nkey seed rotates
+	var rotation <-chan struct{}
+	if nc.credentials != nil && nc.credentials.credentials.NKeySeedFile != "" {
+		rotation = nc.credentials.rotation()
+	}
+
+	closedChan := make(chan struct{})
+	natsConnection, err := nc.options(urls, closedChan).Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	nc.connLock.Lock()
+	nc.conn = natsConnection
+	nc.closed = false
+	nc.connLock.Unlock()
+
+	if rotation != nil {
+		go nc.replaceOnRotation(urls, closedChan, rotation)
+	}
+	return closedChan, nil
+}
+
+func (nc *natsClient) options(urls []string, closedChan chan struct{}) nats.Options {
 	options := nats.DefaultOptions
 	options.Servers = urls
-	options.ReconnectWait = 500 * time.Millisecond
+	options.ReconnectWait = reconnectWait
 	options.MaxReconnect = -1
 	options.PingInterval = nc.pingInterval
 	options.TLSConfig = nc.tlsConfig
+	if nc.credentials != nil {
+		nc.credentials.apply(&options)
+	}
 
-	closedChan := make(chan struct{})
-	options.ClosedCB = func(*nats.Conn) {
-		close(closedChan)
+	// callbacks of a replaced connection are ignored
+	options.DisconnectedErrCB = func(conn *nats.Conn, err error) {
+		if nc.connection() == conn {
+			nc.handleDisconnect(err)
+		}
+	}
+	options.ReconnectedCB = func(conn *nats.Conn) {
+		if nc.connection() == conn {
+			nc.handleReconnect()
+		}
+	}
+
+	options.ClosedCB = func(conn *nats.Conn) {
+		if nc.connection() == conn {
+			close(closedChan)
+		}
+	}
+
+	return options
+}
+
+// replaceOnRotation connects with the new nkey every time the nkey seed
+// rotates, retrying until it succeeds or the client is closed
+func (nc *natsClient) replaceOnRotation(urls []string, closedChan chan struct{}, rotation <-chan struct{}) {
+	for {
+		select {
+		case <-closedChan:
+			return
+		case <-rotation:
+		}
+		rotation = nc.credentials.rotation()
+
+		for nc.replaceConnection(urls, closedChan) != nil {
+			select {
+			case <-closedChan:
+				return
+			case <-time.After(reconnectWait):
+			}
+		}
 	}
+}
 
-	natsConnection, err := options.Connect()
+// replaceConnection connects with the current credentials, subscribes the
+// new connection to everything the client is subscribed to and closes the
+// previous connection
+func (nc *natsClient) replaceConnection(urls []string, closedChan chan struct{}) error {
+	natsConnection, err := nc.options(urls, closedChan).Connect()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	nc.Conn = natsConnection
-	return closedChan, nil
+	nc.connLock.Lock()
+	if nc.closed {
+		nc.connLock.Unlock()
+		natsConnection.Close()
+		return nil
+	}
+
+	current := make([]*nats.Subscription, len(nc.subscriptions))
+	for i, sub := range nc.subscriptions {
+		current[i], err = subscribe(natsConnection, sub.subject, sub.queue, sub.handler)
+		if err != nil {
+			nc.connLock.Unlock()
+			natsConnection.Close()
+			return err
+		}
+	}
+	for i, sub := range nc.subscriptions {
+		sub.current = current[i]
+	}
+
+	previous := nc.conn
+	nc.conn = natsConnection
+	nc.connLock.Unlock()
+
+	previous.Close()
+	nc.handleReconnect()
+	return nil
+}
+
+// connection returns the current connection, which is nil until Connect
+// succeeds
+func (nc *natsClient) connection() *nats.Conn {
+	nc.connLock.RLock()
+	defer nc.connLock.RUnlock()
+	return nc.conn
 }
 
 func (nc *natsClient) Close() {
-	if nc.Conn != nil {
-		nc.Conn.Close()
+	nc.connLock.Lock()
+	defer nc.connLock.Unlock()
+
+	nc.closed = true
+	nc.subscriptions = nil
+	if nc.conn != nil {
+		nc.conn.Close()
 	}
 }
 
 func (c *natsClient) Ping() bool {
-	err := c.FlushTimeout(500 * time.Millisecond)
+	conn := c.connection()
+	if conn == nil {
+		return false
+	}
+	err := conn.FlushTimeout(500 * time.Millisecond)
 	return err == nil
 }
 
+func (nc *natsClient) Publish(subject string, data []byte) error {
+	conn := nc.connection()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return conn.Publish(subject, data)
+}
+
+func (nc *natsClient) PublishRequest(subj, reply string, data []byte) error {
+	conn := nc.connection()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return conn.PublishRequest(subj, reply, data)
+}
+
+func (nc *natsClient) Request(subj string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	conn := nc.connection()
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+	return conn.Request(subj, data, timeout)
+}
+
+func (nc *natsClient) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return nc.subscribe(subject, "", handler)
+}
+
+func (nc *natsClient) QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return nc.subscribe(subject, queue, handler)
+}
+
+func (nc *natsClient) subscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	nc.connLock.Lock()
+	defer nc.connLock.Unlock()
+
+	if nc.conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	sub, err := subscribe(nc.conn, subject, queue, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	nc.subscriptions = append(nc.subscriptions, &subscription{
+		subject:  subject,
+		queue:    queue,
+		handler:  handler,
+		original: sub,
+		current:  sub,
+	})
+	return sub, nil
+}
+
+func subscribe(conn *nats.Conn, subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	if queue == "" {
+		return conn.Subscribe(subject, handler)
+	}
+	return conn.QueueSubscribe(subject, queue, handler)
+}
+
+// Unsubscribe removes a subscription made by the client, it must be used
+// instead of unsubscribing directly since the subscription is made again when
+// the connection is replaced
 func (nc *natsClient) Unsubscribe(sub *nats.Subscription) error {
+	nc.connLock.Lock()
+	defer nc.connLock.Unlock()
+
+	for i, s := range nc.subscriptions {
+		if s.original == sub {
+			nc.subscriptions = append(nc.subscriptions[:i], nc.subscriptions[i+1:]...)
+			return s.current.Unsubscribe()
+		}
+	}
 	return sub.Unsubscribe()
 }
+
+func (nc *natsClient) OnDisconnect(handler func(error)) func() {
+	nc.handlersLock.Lock()
+	defer nc.handlersLock.Unlock()
+
+	if nc.disconnectHandlers == nil {
+		nc.disconnectHandlers = map[int]func(error){}
+	}
+	id := nc.nextHandlerID
+	nc.nextHandlerID++
+	nc.disconnectHandlers[id] = handler
+
+	return func() {
+		nc.handlersLock.Lock()
+		defer nc.handlersLock.Unlock()
+		delete(nc.disconnectHandlers, id)
+	}
+}
+
+func (nc *natsClient) OnReconnect(handler func()) func() {
+	nc.handlersLock.Lock()
+	defer nc.handlersLock.Unlock()
+
+	if nc.reconnectHandlers == nil {
+		nc.reconnectHandlers = map[int]func(){}
+	}
+	id := nc.nextHandlerID
+	nc.nextHandlerID++
+	nc.reconnectHandlers[id] = handler
+
+	return func() {
+		nc.handlersLock.Lock()
+		defer nc.handlersLock.Unlock()
+		delete(nc.reconnectHandlers, id)
+	}
+}
+
+func (nc *natsClient) handleDisconnect(err error) {
+	nc.handlersLock.Lock()
+	handlers := make([]func(error), 0, len(nc.disconnectHandlers))
+	for _, handler := range nc.disconnectHandlers {
+		handlers = append(handlers, handler)
+	}
+	nc.handlersLock.Unlock()
+
+	for _, handler := range handlers {
+		handler(err)
+	}
+}
+
+func (nc *natsClient) handleReconnect() {
+	nc.handlersLock.Lock()
+	handlers := make([]func(), 0, len(nc.reconnectHandlers))
+	for _, handler := range nc.reconnectHandlers {
+		handlers = append(handlers, handler)
+	}
+	nc.handlersLock.Unlock()
+
+	for _, handler := range handlers {
+		handler()
+	}
+}
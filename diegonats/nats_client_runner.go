@@ -5,25 +5,44 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 )
 
+const (
+	natsDisconnectedDurationMetric = "NATSDisconnectedDuration"
+	natsReconnectsCounter          = "NATSReconnects"
+)
+
 type NATSClientRunner struct {
-	addresses string
-	username  string
-	password  string
-	logger    lager.Logger
-	client    NATSClient
+	addresses    string
+	username     string
+	password     string
+	logger       lager.Logger
+	client       NATSClient
+	clock        clock.Clock
+	metronClient loggingclient.IngressClient
 }
 
-func NewClientRunner(addresses, username, password string, logger lager.Logger, client NATSClient) NATSClientRunner {
+func NewClientRunner(
+	addresses, username, password string,
+	logger lager.Logger,
+	client NATSClient,
+	clock clock.Clock,
+	metronClient loggingclient.IngressClient,
+) NATSClientRunner {
 	return NATSClientRunner{
-		addresses: addresses,
-		username:  username,
-		password:  password,
-		logger:    logger.Session("nats-runner"),
-		client:    client,
+		addresses:    addresses,
+		username:     username,
+		password:     password,
+		logger:       logger.Session("nats-runner"),
+		client:       client,
+		clock:        clock,
+		metronClient: metronClient,
 	}
 }
 
@@ -32,12 +51,26 @@ func (runner NATSClientRunner) Run(signals <-chan os.Signal, ready chan<- struct
 	for _, addr := range strings.Split(runner.addresses, ",") {
 		uri := url.URL{
 			Scheme: "nats",
-			User:   url.UserPassword(runner.username, runner.password),
 			Host:   addr,
 		}
+		if runner.username != "" {
+			uri.User = url.UserPassword(runner.username, runner.password)
+		}
 		natsMembers = append(natsMembers, uri.String())
 	}
 
+	outage := &connectionOutage{}
+	deregisterDisconnect := runner.client.OnDisconnect(func(err error) {
+		if outage.start(runner.clock.Now()) {
+			runner.logger.Error("nats-disconnected", err)
+		}
+	})
+	defer deregisterDisconnect()
+	deregisterReconnect := runner.client.OnReconnect(func() {
+		runner.reconnected(outage.end(runner.clock.Now()))
+	})
+	defer deregisterReconnect()
+
 	unexpectedConnClosed, err := runner.client.Connect(natsMembers)
 	if err != nil {
 		runner.logger.Error("connecting-to-nats-failed", err)
@@ -49,6 +82,7 @@ func (runner NATSClientRunner) Run(signals <-chan os.Signal, ready chan<- struct
 
 	select {
 	case <-signals:
+		outage.close()
 		runner.client.Close()
 		runner.logger.Info("shutting-down")
 		return nil
@@ -57,3 +91,53 @@ func (runner NATSClientRunner) Run(signals <-chan os.Signal, ready chan<- struct
 		return errors.New("nats closed unexpectedly")
 	}
 }
+
+func (runner NATSClientRunner) reconnected(disconnected time.Duration) {
+	runner.logger.Info("nats-reconnected", lager.Data{"disconnected-duration": disconnected.String()})
+
+	err := runner.metronClient.SendDuration(natsDisconnectedDurationMetric, disconnected)
+	if err != nil {
+		runner.logger.Error("cannot-send-disconnected-duration-metric", err)
+	}
+	err = runner.metronClient.IncrementCounter(natsReconnectsCounter)
+	if err != nil {
+		runner.logger.Error("cannot-send-reconnects-metric", err)
+	}
+}
+
+// connectionOutage tracks when the connection was lost. Disconnects reported
+// while shutting down are ignored.
+type connectionOutage struct {
+	lock         sync.Mutex
+	disconnected time.Time
+	closing      bool
+}
+
+func (o *connectionOutage) start(now time.Time) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.closing || !o.disconnected.IsZero() {
+		return false
+	}
+	o.disconnected = now
+	return true
+}
+
+func (o *connectionOutage) end(now time.Time) time.Duration {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.disconnected.IsZero() {
+		return 0
+	}
+	duration := now.Sub(o.disconnected)
+	o.disconnected = time.Time{}
+	return duration
+}
+
+func (o *connectionOutage) close() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.closing = true
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"os"
 
+	"code.cloudfoundry.org/clock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/lager/lagertest"
 	. "code.cloudfoundry.org/route-emitter/diegonats"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/tedsuo/ifrit"
 )
 
@@ -16,11 +19,15 @@ var _ = Describe("Starting the NatsClientRunner process", func() {
 	var natsClient NATSClient
 	var natsClientRunner ifrit.Runner
 	var natsClientProcess ifrit.Process
+	var logger *lagertest.TestLogger
+	var fakeMetronClient *mfakes.FakeIngressClient
 
 	BeforeEach(func() {
 		natsAddress := fmt.Sprintf("127.0.0.1:%d", natsPort)
 		natsClient = NewClient()
-		natsClientRunner = NewClientRunner(natsAddress, "nats", "nats", lagertest.NewTestLogger("test"), natsClient)
+		logger = lagertest.NewTestLogger("test")
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		natsClientRunner = NewClientRunner(natsAddress, "nats", "nats", logger, natsClient, clock.NewClock(), fakeMetronClient)
 	})
 
 	AfterEach(func() {
@@ -65,6 +72,54 @@ var _ = Describe("Starting the NatsClientRunner process", func() {
 			startNATS()
 			Expect(natsClient.Ping()).To(BeTrue())
 		})
+
+		It("logs and measures the time spent disconnected", func() {
+			stopNATS()
+			Eventually(logger).Should(gbytes.Say("nats-disconnected"))
+
+			startNATS()
+			Eventually(logger).Should(gbytes.Say("nats-reconnected"))
+
+			Eventually(fakeMetronClient.SendDurationCallCount).Should(Equal(1))
+			name, duration, _ := fakeMetronClient.SendDurationArgsForCall(0)
+			Expect(name).To(Equal("NATSDisconnectedDuration"))
+			Expect(duration).To(BeNumerically(">", 0))
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(1))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("NATSReconnects"))
+		})
+	})
+
+	Describe("when the runner is restarted on the same client", func() {
+		var fakeNATSClient *FakeNATSClient
+
+		BeforeEach(func() {
+			fakeNATSClient = NewFakeClient()
+			natsClientRunner = NewClientRunner("127.0.0.1:4222", "nats", "nats", logger, fakeNATSClient, clock.NewClock(), fakeMetronClient)
+
+			process := ifrit.Invoke(natsClientRunner)
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait(), 5).Should(Receive())
+
+			natsClientProcess = ifrit.Invoke(natsClientRunner)
+		})
+
+		It("deregisters the handlers of the previous run", func() {
+			Expect(fakeNATSClient.HandlerCount()).To(Equal(2))
+
+			fakeNATSClient.Disconnect(errors.New("boom"))
+			fakeNATSClient.Reconnect()
+
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+			Consistently(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+		})
+
+		It("deregisters its handlers when it exits", func() {
+			natsClientProcess.Signal(os.Interrupt)
+			Eventually(natsClientProcess.Wait(), 5).Should(Receive())
+			natsClientProcess = nil
+
+			Expect(fakeNATSClient.HandlerCount()).To(Equal(0))
+		})
 	})
 
 	Describe("when NATS is not up", func() {
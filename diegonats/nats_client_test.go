@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/inigo/helpers/certauthority"
+	"code.cloudfoundry.org/lager/lagertest"
 	. "code.cloudfoundry.org/route-emitter/diegonats"
+	"code.cloudfoundry.org/route-emitter/diegonats/natsserverrunner"
 	"code.cloudfoundry.org/tlsconfig"
 	"github.com/nats-io/nats.go"
 	. "github.com/onsi/ginkgo"
@@ -182,4 +187,67 @@ var _ = Describe("NatsClient", func() {
 
 		verifySubscription()
 	})
+
+	Context("when configured with credentials", func() {
+		var credentialsDir string
+
+		newClient := func(credentials Credentials) NATSClient {
+			store, err := NewCredentialStore(lagertest.NewTestLogger("test"), fakeclock.NewFakeClock(time.Now()), credentials, 0)
+			Expect(err).NotTo(HaveOccurred())
+			return NewClientWithCredentials(nil, store)
+		}
+
+		BeforeEach(func() {
+			var err error
+			credentialsDir, err = ioutil.TempDir("", "nats-credentials")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(credentialsDir)).To(Succeed())
+		})
+
+		Context("with a token file", func() {
+			BeforeEach(func() {
+				tokenFile := filepath.Join(credentialsDir, "token")
+				Expect(ioutil.WriteFile(tokenFile, []byte("some-token\n"), 0600)).To(Succeed())
+				startNATSWithRunner(natsserverrunner.NewNatsServerWithTokenTestRunner(int(natsPort), "some-token"))
+				natsClient = newClient(Credentials{TokenFile: tokenFile})
+			})
+
+			verifySubscription()
+		})
+
+		Context("with an nkey seed file", func() {
+			BeforeEach(func() {
+				configFile, seedFile := natsserverrunner.WriteNKeyServerConfig(credentialsDir)
+				startNATSWithRunner(natsserverrunner.NewNatsServerWithConfigTestRunner(int(natsPort), configFile))
+				natsClient = newClient(Credentials{NKeySeedFile: seedFile})
+			})
+
+			verifySubscription()
+		})
+
+		Context("with a creds file", func() {
+			BeforeEach(func() {
+				configFile, credsFile, _ := natsserverrunner.WriteJWTServerConfig(credentialsDir)
+				startNATSWithRunner(natsserverrunner.NewNatsServerWithConfigTestRunner(int(natsPort), configFile))
+				natsClient = newClient(Credentials{CredsFile: credsFile})
+			})
+
+			verifySubscription()
+		})
+
+		Context("with the wrong token", func() {
+			BeforeEach(func() {
+				startNATSWithRunner(natsserverrunner.NewNatsServerWithTokenTestRunner(int(natsPort), "some-token"))
+				natsClient = newClient(Credentials{Token: "wrong-token"})
+			})
+
+			It("fails to connect", func() {
+				_, err := natsClient.Connect(natsUrls)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
 })
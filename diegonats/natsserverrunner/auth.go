@@ -0,0 +1,124 @@
+package natsserverrunner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit/ginkgomon"
+)
+
+// NewNatsServerWithTokenTestRunner returns a server that only accepts clients
+// authenticating with the given token
+func NewNatsServerWithTokenTestRunner(natsPort int, token string) *ginkgomon.Runner {
+	natsServerPath, err := exec.LookPath("nats-server")
+	Expect(err).NotTo(HaveOccurred(), "You need nats-server installed!")
+
+	return ginkgomon.New(ginkgomon.Config{
+		Name:              "nats-server",
+		AnsiColorCode:     "99m",
+		StartCheck:        "Server is ready",
+		StartCheckTimeout: 5 * time.Second,
+		Command: exec.Command(
+			natsServerPath,
+			"-p", strconv.Itoa(natsPort),
+			"--auth", token,
+		),
+	})
+}
+
+// NewNatsServerWithConfigTestRunner returns a server started with the given
+// configuration file, such as one written by WriteNKeyServerConfig or
+// WriteJWTServerConfig
+func NewNatsServerWithConfigTestRunner(natsPort int, configFile string) *ginkgomon.Runner {
+	natsServerPath, err := exec.LookPath("nats-server")
+	Expect(err).NotTo(HaveOccurred(), "You need nats-server installed!")
+
+	return ginkgomon.New(ginkgomon.Config{
+		Name:              "nats-server",
+		AnsiColorCode:     "99m",
+		StartCheck:        "Server is ready",
+		StartCheckTimeout: 5 * time.Second,
+		Command: exec.Command(
+			natsServerPath,
+			"-p", strconv.Itoa(natsPort),
+			"-c", configFile,
+		),
+	})
+}
+
+// WriteNKeyServerConfig generates a user nkey and writes to dir a server
+// configuration that only accepts that user, along with the user's seed file
+func WriteNKeyServerConfig(dir string) (configFile, seedFile string) {
+	user, err := nkeys.CreateUser()
+	Expect(err).NotTo(HaveOccurred())
+	publicKey, err := user.PublicKey()
+	Expect(err).NotTo(HaveOccurred())
+	seed, err := user.Seed()
+	Expect(err).NotTo(HaveOccurred())
+
+	seedFile = filepath.Join(dir, "user.nk")
+	Expect(ioutil.WriteFile(seedFile, seed, 0600)).To(Succeed())
+
+	configFile = filepath.Join(dir, "nkey.conf")
+	config := fmt.Sprintf("authorization {\n  users = [\n    { nkey: %s }\n  ]\n}\n", publicKey)
+	Expect(ioutil.WriteFile(configFile, []byte(config), 0600)).To(Succeed())
+
+	return configFile, seedFile
+}
+
+// WriteJWTServerConfig generates an operator, an account and a user and
+// writes to dir a server configuration trusting the operator, along with the
+// user's .creds file. The account key is returned so that tests can rotate
+// the user with WriteUserCreds.
+func WriteJWTServerConfig(dir string) (configFile, credsFile string, account nkeys.KeyPair) {
+	operator, err := nkeys.CreateOperator()
+	Expect(err).NotTo(HaveOccurred())
+	operatorPublicKey, err := operator.PublicKey()
+	Expect(err).NotTo(HaveOccurred())
+	operatorJWT, err := jwt.NewOperatorClaims(operatorPublicKey).Encode(operator)
+	Expect(err).NotTo(HaveOccurred())
+
+	account, err = nkeys.CreateAccount()
+	Expect(err).NotTo(HaveOccurred())
+	accountPublicKey, err := account.PublicKey()
+	Expect(err).NotTo(HaveOccurred())
+	accountJWT, err := jwt.NewAccountClaims(accountPublicKey).Encode(operator)
+	Expect(err).NotTo(HaveOccurred())
+
+	credsFile = WriteUserCreds(dir, account)
+
+	configFile = filepath.Join(dir, "jwt.conf")
+	config := fmt.Sprintf(
+		"operator: %s\nresolver: MEMORY\nresolver_preload: {\n  %s: %s\n}\n",
+		operatorJWT, accountPublicKey, accountJWT,
+	)
+	Expect(ioutil.WriteFile(configFile, []byte(config), 0600)).To(Succeed())
+
+	return configFile, credsFile, account
+}
+
+// WriteUserCreds generates a new user signed by the account and writes its
+// .creds file to dir, replacing any previous one
+func WriteUserCreds(dir string, account nkeys.KeyPair) string {
+	user, err := nkeys.CreateUser()
+	Expect(err).NotTo(HaveOccurred())
+	userPublicKey, err := user.PublicKey()
+	Expect(err).NotTo(HaveOccurred())
+	userJWT, err := jwt.NewUserClaims(userPublicKey).Encode(account)
+	Expect(err).NotTo(HaveOccurred())
+	seed, err := user.Seed()
+	Expect(err).NotTo(HaveOccurred())
+	creds, err := jwt.FormatUserConfig(userJWT, seed)
+	Expect(err).NotTo(HaveOccurred())
+
+	credsFile := filepath.Join(dir, "user.creds")
+	Expect(ioutil.WriteFile(credsFile, creds, 0600)).To(Succeed())
+	return credsFile
+}
@@ -0,0 +1,151 @@
+package emitter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	DefaultCircuitBreakerFailureThreshold = 10
+	DefaultCircuitBreakerCooldown         = 5 * time.Second
+)
+
+var ErrCircuitOpen = errors.New("nats circuit breaker is open")
+
+// CircuitBreaker stops publishing to a NATS connection that is down or keeps
+// failing. The NATS client buffers publishes while it reconnects without
+// returning errors, so the breaker opens as soon as the connection is lost
+// and stays open until it has been re-established, see Disconnected and
+// Reconnected. It also opens after failureThreshold consecutive publish
+// failures, and then rejects every publish until the cooldown has passed. A
+// single probe is then let through: if it succeeds the breaker closes; if it
+// fails the breaker stays open for another cooldown. Whenever the breaker
+// closes onRecover is called, so that the routes dropped while it was open
+// can be emitted again.
+type CircuitBreaker struct {
+	logger           lager.Logger
+	clock            clock.Clock
+	failureThreshold int
+	cooldown         time.Duration
+	onRecover        func()
+
+	lock                sync.Mutex
+	consecutiveFailures int
+	open                bool
+	disconnected        bool
+	probing             bool
+	openedAt            time.Time
+}
+
+func NewCircuitBreaker(logger lager.Logger, clock clock.Clock, failureThreshold int, cooldown time.Duration, onRecover func()) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = DefaultCircuitBreakerFailureThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCircuitBreakerCooldown
+	}
+
+	return &CircuitBreaker{
+		logger:           logger.Session("circuit-breaker"),
+		clock:            clock,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		onRecover:        onRecover,
+	}
+}
+
+// Allow reports whether a message may be published. Every allowed publish
+// must be followed by a call to Success or Failure.
+func (b *CircuitBreaker) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.open {
+		return true
+	}
+	if b.disconnected || b.probing || b.clock.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.lock.Lock()
+	b.consecutiveFailures = 0
+	// a publish let through before the connection was lost does not close
+	// the breaker
+	recovered := !b.disconnected && b.closeLocked()
+	b.lock.Unlock()
+
+	if recovered {
+		b.recovered()
+	}
+}
+
+func (b *CircuitBreaker) closeLocked() bool {
+	wasOpen := b.open
+	b.open = false
+	b.probing = false
+	b.consecutiveFailures = 0
+	return wasOpen
+}
+
+func (b *CircuitBreaker) recovered() {
+	b.logger.Info("closed")
+	if b.onRecover != nil {
+		b.onRecover()
+	}
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.consecutiveFailures++
+	if b.open {
+		b.probing = false
+		b.openedAt = b.clock.Now()
+		return
+	}
+	if b.consecutiveFailures >= b.failureThreshold {
+		b.open = true
+		b.openedAt = b.clock.Now()
+		b.logger.Info("opened", lager.Data{"consecutive-failures": b.consecutiveFailures, "cooldown": b.cooldown.String()})
+	}
+}
+
+// Disconnected opens the breaker until Reconnected is called
+func (b *CircuitBreaker) Disconnected() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.disconnected = true
+	if !b.open {
+		b.open = true
+		b.openedAt = b.clock.Now()
+		b.logger.Info("opened", lager.Data{"reason": "disconnected"})
+	}
+}
+
+// Reconnected closes a breaker opened by Disconnected
+func (b *CircuitBreaker) Reconnected() {
+	b.lock.Lock()
+	recovered := b.disconnected && b.closeLocked()
+	b.disconnected = false
+	b.lock.Unlock()
+
+	if recovered {
+		b.recovered()
+	}
+}
+
+func (b *CircuitBreaker) Open() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.open
+}
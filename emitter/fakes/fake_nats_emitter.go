@@ -9,22 +9,24 @@ import (
 )
 
 type FakeNATSEmitter struct {
-	EmitStub        func(routingtable.MessagesToEmit) error
+	EmitStub        func(routingtable.MessagesToEmit) (emitter.EmitResult, error)
 	emitMutex       sync.RWMutex
 	emitArgsForCall []struct {
 		arg1 routingtable.MessagesToEmit
 	}
 	emitReturns struct {
-		result1 error
+		result1 emitter.EmitResult
+		result2 error
 	}
 	emitReturnsOnCall map[int]struct {
-		result1 error
+		result1 emitter.EmitResult
+		result2 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeNATSEmitter) Emit(arg1 routingtable.MessagesToEmit) error {
+func (fake *FakeNATSEmitter) Emit(arg1 routingtable.MessagesToEmit) (emitter.EmitResult, error) {
 	fake.emitMutex.Lock()
 	ret, specificReturn := fake.emitReturnsOnCall[len(fake.emitArgsForCall)]
 	fake.emitArgsForCall = append(fake.emitArgsForCall, struct {
@@ -36,10 +38,10 @@ func (fake *FakeNATSEmitter) Emit(arg1 routingtable.MessagesToEmit) error {
 		return fake.EmitStub(arg1)
 	}
 	if specificReturn {
-		return ret.result1
+		return ret.result1, ret.result2
 	}
 	fakeReturns := fake.emitReturns
-	return fakeReturns.result1
+	return fakeReturns.result1, fakeReturns.result2
 }
 
 func (fake *FakeNATSEmitter) EmitCallCount() int {
@@ -48,7 +50,7 @@ func (fake *FakeNATSEmitter) EmitCallCount() int {
 	return len(fake.emitArgsForCall)
 }
 
-func (fake *FakeNATSEmitter) EmitCalls(stub func(routingtable.MessagesToEmit) error) {
+func (fake *FakeNATSEmitter) EmitCalls(stub func(routingtable.MessagesToEmit) (emitter.EmitResult, error)) {
 	fake.emitMutex.Lock()
 	defer fake.emitMutex.Unlock()
 	fake.EmitStub = stub
@@ -61,27 +63,30 @@ func (fake *FakeNATSEmitter) EmitArgsForCall(i int) routingtable.MessagesToEmit
 	return argsForCall.arg1
 }
 
-func (fake *FakeNATSEmitter) EmitReturns(result1 error) {
+func (fake *FakeNATSEmitter) EmitReturns(result1 emitter.EmitResult, result2 error) {
 	fake.emitMutex.Lock()
 	defer fake.emitMutex.Unlock()
 	fake.EmitStub = nil
 	fake.emitReturns = struct {
-		result1 error
-	}{result1}
+		result1 emitter.EmitResult
+		result2 error
+	}{result1, result2}
 }
 
-func (fake *FakeNATSEmitter) EmitReturnsOnCall(i int, result1 error) {
+func (fake *FakeNATSEmitter) EmitReturnsOnCall(i int, result1 emitter.EmitResult, result2 error) {
 	fake.emitMutex.Lock()
 	defer fake.emitMutex.Unlock()
 	fake.EmitStub = nil
 	if fake.emitReturnsOnCall == nil {
 		fake.emitReturnsOnCall = make(map[int]struct {
-			result1 error
+			result1 emitter.EmitResult
+			result2 error
 		})
 	}
 	fake.emitReturnsOnCall[i] = struct {
-		result1 error
-	}{result1}
+		result1 emitter.EmitResult
+		result2 error
+	}{result1, result2}
 }
 
 func (fake *FakeNATSEmitter) Invocations() map[string][][]interface{} {
@@ -0,0 +1,200 @@
+package emitter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+)
+
+const (
+	unhealthyNATSTargetsGauge = "UnhealthyNATSTargets"
+
+	// DefaultNATSTargetEmitTimeout is how long an emit waits for a single
+	// target when no timeout is configured
+	DefaultNATSTargetEmitTimeout = 10 * time.Second
+)
+
+var (
+	ErrNATSTargetEmitTimedOut   = errors.New("timed out publishing to nats target")
+	ErrNATSTargetEmitInProgress = errors.New("previous publish to nats target still in progress")
+)
+
+// NATSTarget is a named NATS cluster that routes are published to
+type NATSTarget struct {
+	Name    string
+	Emitter NATSEmitter
+}
+
+// MultiNATSEmitter publishes every message to several independent NATS
+// clusters. The clusters are published to concurrently so that a failing
+// cluster does not hold back the others, and the health of each cluster is
+// tracked from the outcome of its last publish. An emit waits at most
+// emitTimeout for a cluster; a cluster still busy with a previous emit is
+// skipped rather than queued.
+type MultiNATSEmitter struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	metronClient loggingclient.IngressClient
+	targets      []NATSTarget
+	emitTimeout  time.Duration
+
+	lock     sync.Mutex
+	healthy  map[string]bool
+	emitting map[string]bool
+}
+
+func NewMultiNATSEmitter(logger lager.Logger, clock clock.Clock, metronClient loggingclient.IngressClient, targets []NATSTarget, emitTimeout time.Duration) *MultiNATSEmitter {
+	if emitTimeout <= 0 {
+		emitTimeout = DefaultNATSTargetEmitTimeout
+	}
+
+	healthy := map[string]bool{}
+	for _, target := range targets {
+		healthy[target.Name] = true
+	}
+
+	return &MultiNATSEmitter{
+		logger:       logger.Session("multi-nats-emitter"),
+		clock:        clock,
+		metronClient: metronClient,
+		targets:      targets,
+		emitTimeout:  emitTimeout,
+		healthy:      healthy,
+		emitting:     map[string]bool{},
+	}
+}
+
+type targetOutcome struct {
+	index  int
+	result EmitResult
+	err    error
+}
+
+// Emit returns the combined result of all targets. Targets that do not
+// finish within the emit timeout are reported as failed; their publish
+// carries on in the background.
+func (m *MultiNATSEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) (EmitResult, error) {
+	results := make([]EmitResult, len(m.targets))
+	errs := make([]error, len(m.targets))
+	outcomes := make(chan targetOutcome, len(m.targets))
+
+	pending := 0
+	for i, target := range m.targets {
+		if !m.startEmitting(target.Name) {
+			errs[i] = ErrNATSTargetEmitInProgress
+			continue
+		}
+
+		errs[i] = ErrNATSTargetEmitTimedOut
+		pending++
+		go func(i int, target NATSTarget) {
+			result, err := target.Emitter.Emit(messagesToEmit)
+			m.stopEmitting(target.Name)
+			outcomes <- targetOutcome{index: i, result: result, err: err}
+		}(i, target)
+	}
+
+	timer := m.clock.NewTimer(m.emitTimeout)
+	defer timer.Stop()
+
+WAIT:
+	for pending > 0 {
+		select {
+		case outcome := <-outcomes:
+			results[outcome.index], errs[outcome.index] = outcome.result, outcome.err
+			pending--
+		case <-timer.C():
+			break WAIT
+		}
+	}
+
+	result := EmitResult{}
+	failed := []string{}
+	for i, target := range m.targets {
+		result.Add(results[i])
+		// an emit without any message says nothing about the target
+		if errs[i] != nil || results[i].Succeeded+results[i].Failed > 0 {
+			m.updateHealth(target.Name, errs[i])
+		}
+		if errs[i] != nil {
+			failed = append(failed, target.Name)
+		}
+	}
+
+	m.sendUnhealthyTargets()
+
+	if len(failed) > 0 {
+		return result, fmt.Errorf("failed to emit to nats targets: %s", strings.Join(failed, ", "))
+	}
+	return result, nil
+}
+
+// TargetFailed marks a target unhealthy without publishing to it, e.g. when
+// it cannot be connected to. It becomes healthy again after a successful
+// publish.
+func (m *MultiNATSEmitter) TargetFailed(name string, err error) {
+	m.updateHealth(name, err)
+	m.sendUnhealthyTargets()
+}
+
+// UnhealthyTargets returns the sorted names of the targets whose last
+// publish failed
+func (m *MultiNATSEmitter) UnhealthyTargets() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	unhealthy := []string{}
+	for name, healthy := range m.healthy {
+		if !healthy {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+	sort.Strings(unhealthy)
+	return unhealthy
+}
+
+func (m *MultiNATSEmitter) startEmitting(name string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.emitting[name] {
+		return false
+	}
+	m.emitting[name] = true
+	return true
+}
+
+func (m *MultiNATSEmitter) stopEmitting(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.emitting, name)
+}
+
+func (m *MultiNATSEmitter) sendUnhealthyTargets() {
+	err := m.metronClient.SendMetric(unhealthyNATSTargetsGauge, len(m.UnhealthyTargets()))
+	if err != nil {
+		m.logger.Error("cannot-send-unhealthy-nats-targets-metric", err)
+	}
+}
+
+func (m *MultiNATSEmitter) updateHealth(name string, err error) {
+	m.lock.Lock()
+	wasHealthy := m.healthy[name]
+	m.healthy[name] = err == nil
+	m.lock.Unlock()
+
+	switch {
+	case wasHealthy && err != nil:
+		m.logger.Error("nats-target-unhealthy", err, lager.Data{"target": name})
+	case !wasHealthy && err == nil:
+		m.logger.Info("nats-target-recovered", lager.Data{"target": name})
+	}
+}
@@ -0,0 +1,181 @@
+package emitter_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/emitter"
+	"code.cloudfoundry.org/route-emitter/emitter/fakes"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("MultiNATSEmitter", func() {
+	var (
+		logger           *lagertest.TestLogger
+		fakeMetronClient *mfakes.FakeIngressClient
+		fakeClock        *fakeclock.FakeClock
+		oldFleet         *fakes.FakeNATSEmitter
+		newFleet         *fakes.FakeNATSEmitter
+		multiEmitter     *emitter.MultiNATSEmitter
+		messagesToEmit   routingtable.MessagesToEmit
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		oldFleet = &fakes.FakeNATSEmitter{}
+		newFleet = &fakes.FakeNATSEmitter{}
+		multiEmitter = emitter.NewMultiNATSEmitter(logger, fakeClock, fakeMetronClient, []emitter.NATSTarget{
+			{Name: "old-fleet", Emitter: oldFleet},
+			{Name: "new-fleet", Emitter: newFleet},
+		}, 5*time.Second)
+		messagesToEmit = routingtable.MessagesToEmit{
+			RegistrationMessages: []routingtable.RegistryMessage{
+				{URIs: []string{"foo.com"}, Host: "1.1.1.1", Port: 11},
+			},
+		}
+	})
+
+	It("publishes the messages to every target", func() {
+		oldFleet.EmitReturns(emitter.EmitResult{Succeeded: 1}, nil)
+		newFleet.EmitReturns(emitter.EmitResult{Succeeded: 1}, nil)
+
+		result, err := multiEmitter.Emit(messagesToEmit)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(emitter.EmitResult{Succeeded: 2}))
+
+		Expect(oldFleet.EmitCallCount()).To(Equal(1))
+		Expect(oldFleet.EmitArgsForCall(0)).To(Equal(messagesToEmit))
+		Expect(newFleet.EmitCallCount()).To(Equal(1))
+		Expect(newFleet.EmitArgsForCall(0)).To(Equal(messagesToEmit))
+		Expect(multiEmitter.UnhealthyTargets()).To(BeEmpty())
+	})
+
+	Context("when one target fails", func() {
+		BeforeEach(func() {
+			oldFleet.EmitReturns(emitter.EmitResult{Succeeded: 1}, nil)
+			newFleet.EmitReturns(emitter.EmitResult{Failed: 1, FailedBySubject: map[string]int{"router.register": 1}}, errors.New("boom"))
+		})
+
+		It("still publishes to the other targets and reports the failed one", func() {
+			result, err := multiEmitter.Emit(messagesToEmit)
+			Expect(err).To(MatchError(ContainSubstring("new-fleet")))
+			Expect(result).To(Equal(emitter.EmitResult{
+				Succeeded:       1,
+				Failed:          1,
+				FailedBySubject: map[string]int{"router.register": 1},
+			}))
+			Expect(oldFleet.EmitCallCount()).To(Equal(1))
+
+			Expect(multiEmitter.UnhealthyTargets()).To(Equal([]string{"new-fleet"}))
+			Expect(logger).To(gbytes.Say("nats-target-unhealthy"))
+		})
+
+		It("emits the number of unhealthy targets", func() {
+			multiEmitter.Emit(messagesToEmit)
+
+			Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(1))
+			name, value, _ := fakeMetronClient.SendMetricArgsForCall(0)
+			Expect(name).To(Equal("UnhealthyNATSTargets"))
+			Expect(value).To(Equal(1))
+		})
+
+		Context("and then recovers", func() {
+			It("marks it healthy again", func() {
+				multiEmitter.Emit(messagesToEmit)
+
+				newFleet.EmitReturns(emitter.EmitResult{Succeeded: 1}, nil)
+				_, err := multiEmitter.Emit(messagesToEmit)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(multiEmitter.UnhealthyTargets()).To(BeEmpty())
+				Expect(logger).To(gbytes.Say("nats-target-recovered"))
+			})
+		})
+	})
+
+	Context("when a target is slow", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			oldFleet.EmitReturns(emitter.EmitResult{Succeeded: 1}, nil)
+			newFleet.EmitStub = func(routingtable.MessagesToEmit) (emitter.EmitResult, error) {
+				<-release
+				return emitter.EmitResult{Succeeded: 1}, nil
+			}
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("does not wait for it longer than the emit timeout", func() {
+			errCh := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				result, err := multiEmitter.Emit(messagesToEmit)
+				Expect(result).To(Equal(emitter.EmitResult{Succeeded: 1}))
+				errCh <- err
+			}()
+
+			Consistently(errCh).ShouldNot(Receive())
+			fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+
+			var err error
+			Eventually(errCh).Should(Receive(&err))
+			Expect(err).To(MatchError(ContainSubstring("new-fleet")))
+			Expect(multiEmitter.UnhealthyTargets()).To(Equal([]string{"new-fleet"}))
+		})
+
+		It("skips it while its previous emit is in progress", func() {
+			go multiEmitter.Emit(messagesToEmit)
+			Eventually(newFleet.EmitCallCount).Should(Equal(1))
+			fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+
+			Eventually(oldFleet.EmitCallCount).Should(Equal(1))
+			errCh := make(chan error)
+			go func() {
+				_, err := multiEmitter.Emit(messagesToEmit)
+				errCh <- err
+			}()
+			Eventually(oldFleet.EmitCallCount).Should(Equal(2))
+
+			var err error
+			Eventually(errCh).Should(Receive(&err))
+			Expect(err).To(MatchError(ContainSubstring("new-fleet")))
+			Expect(newFleet.EmitCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when there is nothing to emit", func() {
+		It("keeps the health of the targets", func() {
+			multiEmitter.TargetFailed("new-fleet", errors.New("connection refused"))
+
+			_, err := multiEmitter.Emit(routingtable.MessagesToEmit{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(multiEmitter.UnhealthyTargets()).To(Equal([]string{"new-fleet"}))
+		})
+	})
+
+	Describe("TargetFailed", func() {
+		It("marks the target unhealthy until it is published to", func() {
+			multiEmitter.TargetFailed("new-fleet", errors.New("connection refused"))
+			Expect(multiEmitter.UnhealthyTargets()).To(Equal([]string{"new-fleet"}))
+			Expect(logger).To(gbytes.Say("nats-target-unhealthy"))
+
+			oldFleet.EmitReturns(emitter.EmitResult{Succeeded: 1}, nil)
+			newFleet.EmitReturns(emitter.EmitResult{Succeeded: 1}, nil)
+			_, err := multiEmitter.Emit(messagesToEmit)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(multiEmitter.UnhealthyTargets()).To(BeEmpty())
+		})
+	})
+})
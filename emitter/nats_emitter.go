@@ -2,23 +2,45 @@ package emitter
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/route-emitter/diegonats"
 	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/signing"
 	"code.cloudfoundry.org/workpool"
 )
 
 const (
 	httpRouteNATSMessagesEmittedCounter     = "HTTPRouteNATSMessagesEmitted"
 	internalRouteNATSMessagesEmittedCounter = "InternalRouteNATSMessagesEmitted"
+	natsPublishErrorsCounter                = "NATSPublishErrors"
 )
 
 //go:generate counterfeiter -o fakes/fake_nats_emitter.go . NATSEmitter
 type NATSEmitter interface {
-	Emit(messagesToEmit routingtable.MessagesToEmit) error
+	Emit(messagesToEmit routingtable.MessagesToEmit) (EmitResult, error)
+}
+
+// EmitResult reports how many messages were published and how many failed.
+// FailedBySubject breaks the failures down by NATS subject.
+type EmitResult struct {
+	Succeeded       int
+	Failed          int
+	FailedBySubject map[string]int
+}
+
+func (r *EmitResult) Add(other EmitResult) {
+	r.Succeeded += other.Succeeded
+	r.Failed += other.Failed
+	for subject, failed := range other.FailedBySubject {
+		if r.FailedBySubject == nil {
+			r.FailedBySubject = map[string]int{}
+		}
+		r.FailedBySubject[subject] += failed
+	}
 }
 
 type natsEmitter struct {
@@ -27,82 +49,143 @@ type natsEmitter struct {
 	logger             lager.Logger
 	metronClient       loggingclient.IngressClient
 	emitInternalRoutes bool
+	externalSubjects   routingtable.SubjectLayout
+	internalSubjects   routingtable.SubjectLayout
+	signer             *signing.Signer
+	breaker            *CircuitBreaker
+}
+
+// NATSEmitterOptions are the optional settings of a NATS emitter. Subject
+// layouts without a service publish on the default "router" and
+// "service-discovery" subjects, and a nil Signer or Breaker disables message
+// signing or the circuit breaker.
+type NATSEmitterOptions struct {
+	ExternalSubjects routingtable.SubjectLayout
+	InternalSubjects routingtable.SubjectLayout
+	Signer           *signing.Signer
+	Breaker          *CircuitBreaker
 }
 
-func NewNATSEmitter(natsClient diegonats.NATSClient, workPool *workpool.WorkPool, logger lager.Logger, metronClient loggingclient.IngressClient, emitInternalRoutes bool) NATSEmitter {
+// NewNATSEmitter returns an emitter publishing on natsClient
+func NewNATSEmitter(
+	natsClient diegonats.NATSClient,
+	workPool *workpool.WorkPool,
+	logger lager.Logger,
+	metronClient loggingclient.IngressClient,
+	emitInternalRoutes bool,
+	opts NATSEmitterOptions,
+) NATSEmitter {
+	if opts.ExternalSubjects.Service == "" {
+		opts.ExternalSubjects = routingtable.NewSubjectLayout("", "router", nil)
+	}
+	if opts.InternalSubjects.Service == "" {
+		opts.InternalSubjects = routingtable.NewSubjectLayout("", "service-discovery", nil)
+	}
 	return &natsEmitter{
 		natsClient:         natsClient,
 		workPool:           workPool,
 		logger:             logger.Session("nats-emitter"),
 		metronClient:       metronClient,
 		emitInternalRoutes: emitInternalRoutes,
+		externalSubjects:   opts.ExternalSubjects,
+		internalSubjects:   opts.InternalSubjects,
+		signer:             opts.Signer,
+		breaker:            opts.Breaker,
+	}
+}
+
+// emitTally collects the outcome of the publishes of a single Emit
+type emitTally struct {
+	lock              sync.Mutex
+	result            EmitResult
+	internalSucceeded int
+	firstErr          error
+}
+
+func (t *emitTally) record(subject string, internal bool, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err == nil {
+		t.result.Succeeded++
+		if internal {
+			t.internalSucceeded++
+		}
+		return
+	}
+
+	t.result.Failed++
+	if t.result.FailedBySubject == nil {
+		t.result.FailedBySubject = map[string]int{}
+	}
+	t.result.FailedBySubject[subject]++
+	if t.firstErr == nil {
+		t.firstErr = err
 	}
 }
 
-func (n *natsEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) error {
-	errors := make(chan error, 1)
+func (n *natsEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) (EmitResult, error) {
+	tally := &emitTally{}
 	var wg sync.WaitGroup
 	wg.Add(len(messagesToEmit.RegistrationMessages))
 	for _, message := range messagesToEmit.RegistrationMessages {
-		n.emit("router.register", message, &wg, errors)
+		n.emit(n.externalSubjects.RegisterSubject(message), false, message, &wg, tally)
 	}
 
 	wg.Add(len(messagesToEmit.UnregistrationMessages))
 	for _, message := range messagesToEmit.UnregistrationMessages {
-		n.emit("router.unregister", message, &wg, errors)
+		n.emit(n.externalSubjects.UnregisterSubject(message), false, message, &wg, tally)
 	}
 
-	var numberOfInternalMessages uint64
-	numberOfMessages := uint64(len(messagesToEmit.RegistrationMessages) + len(messagesToEmit.UnregistrationMessages))
-	numberOfHTTPMessages := uint64(len(messagesToEmit.RegistrationMessages) + len(messagesToEmit.UnregistrationMessages))
 	if n.emitInternalRoutes {
 		wg.Add(len(messagesToEmit.InternalRegistrationMessages))
 		for _, message := range messagesToEmit.InternalRegistrationMessages {
-			n.emit("service-discovery.register", message, &wg, errors)
+			n.emit(n.internalSubjects.RegisterSubject(message), true, message, &wg, tally)
 		}
 
 		wg.Add(len(messagesToEmit.InternalUnregistrationMessages))
 		for _, message := range messagesToEmit.InternalUnregistrationMessages {
-			n.emit("service-discovery.unregister", message, &wg, errors)
+			n.emit(n.internalSubjects.UnregisterSubject(message), true, message, &wg, tally)
 		}
-
-		numberOfInternalMessages = uint64(len(messagesToEmit.InternalRegistrationMessages) + len(messagesToEmit.InternalUnregistrationMessages))
-		numberOfMessages += numberOfInternalMessages
 	}
 
 	wg.Wait()
 
-	select {
-	case finalError := <-errors:
-		return finalError
-	default:
-	}
-
-	err := n.metronClient.IncrementCounterWithDelta(httpRouteNATSMessagesEmittedCounter, numberOfHTTPMessages)
+	result := tally.result
+	err := n.metronClient.IncrementCounterWithDelta(httpRouteNATSMessagesEmittedCounter, uint64(result.Succeeded-tally.internalSucceeded))
 	if err != nil {
 		n.logger.Error("cannot-emit-number-of-http-messages", err)
 	}
 
 	if n.emitInternalRoutes {
-		err := n.metronClient.IncrementCounterWithDelta(internalRouteNATSMessagesEmittedCounter, numberOfInternalMessages)
+		err := n.metronClient.IncrementCounterWithDelta(internalRouteNATSMessagesEmittedCounter, uint64(tally.internalSucceeded))
 		if err != nil {
 			n.logger.Error("cannot-emit-number-of-internal-messages", err)
 		}
 	}
 
-	return nil
+	if result.Failed == 0 {
+		return result, nil
+	}
+
+	err = n.metronClient.IncrementCounterWithDelta(natsPublishErrorsCounter, uint64(result.Failed))
+	if err != nil {
+		n.logger.Error("cannot-emit-number-of-publish-errors", err)
+	}
+
+	n.logger.Error("failed-to-publish-messages", tally.firstErr, lager.Data{
+		"succeeded":         result.Succeeded,
+		"failed":            result.Failed,
+		"failed-by-subject": result.FailedBySubject,
+	})
+	return result, fmt.Errorf("failed to publish %d of %d messages: %s", result.Failed, result.Succeeded+result.Failed, tally.firstErr)
 }
 
-func (n *natsEmitter) emit(subject string, message routingtable.RegistryMessage, wg *sync.WaitGroup, errors chan error) {
+func (n *natsEmitter) emit(subject string, internal bool, message routingtable.RegistryMessage, wg *sync.WaitGroup, tally *emitTally) {
 	n.workPool.Submit(func() {
 		var err error
 		defer func() {
-			if err != nil {
-				select {
-				case errors <- err:
-				default:
-				}
-			}
+			tally.record(subject, internal, err)
 			wg.Done()
 		}()
 
@@ -117,9 +200,33 @@ func (n *natsEmitter) emit(subject string, message routingtable.RegistryMessage,
 				"message": message,
 				"subject": subject,
 			})
+			return
+		}
+
+		if n.signer != nil {
+			payload, err = n.signer.Sign(payload)
+			if err != nil {
+				n.logger.Error("failed-to-sign", err, lager.Data{
+					"message": message,
+					"subject": subject,
+				})
+				return
+			}
+		}
+
+		if n.breaker != nil && !n.breaker.Allow() {
+			err = ErrCircuitOpen
+			return
 		}
 
 		err = n.natsClient.Publish(subject, payload)
+		if n.breaker != nil {
+			if err != nil {
+				n.breaker.Failure()
+			} else {
+				n.breaker.Success()
+			}
+		}
 		if err != nil {
 			n.logger.Error("failed-to-publish", err, lager.Data{
 				"message": message,
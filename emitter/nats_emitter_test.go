@@ -1,13 +1,17 @@
 package emitter_test
 
 import (
+	"encoding/json"
 	"errors"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/route-emitter/diegonats"
 	"code.cloudfoundry.org/route-emitter/emitter"
 	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/signing"
 	"code.cloudfoundry.org/workpool"
 	"github.com/nats-io/nats.go"
 
@@ -47,12 +51,12 @@ var _ = Describe("NatsEmitter", func() {
 		workPool, err := workpool.NewWorkPool(1)
 		Expect(err).NotTo(HaveOccurred())
 		fakeMetronClient = &mfakes.FakeIngressClient{}
-		natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, true)
+		natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, true, emitter.NATSEmitterOptions{})
 	})
 
 	Describe("Emitting", func() {
 		It("should emit register and unregister messages", func() {
-			err := natsEmitter.Emit(messagesToEmit)
+			_, err := natsEmitter.Emit(messagesToEmit)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(natsClient.PublishedMessages("router.register")).To(HaveLen(2))
@@ -155,16 +159,96 @@ var _ = Describe("NatsEmitter", func() {
 			Expect(delta).To(BeEquivalentTo(4))
 		})
 
+		Context("when the subjects are namespaced and routed by isolation segment", func() {
+			BeforeEach(func() {
+				workPool, err := workpool.NewWorkPool(1)
+				Expect(err).NotTo(HaveOccurred())
+				natsEmitter = emitter.NewNATSEmitter(
+					natsClient,
+					workPool,
+					logger,
+					fakeMetronClient,
+					true,
+					emitter.NATSEmitterOptions{
+						ExternalSubjects: routingtable.NewSubjectLayout("tenant-a", "router", map[string]string{"segment-a": "router-segment-a"}),
+						InternalSubjects: routingtable.NewSubjectLayout("tenant-a", "service-discovery", nil),
+					},
+				)
+			})
+
+			It("publishes on the namespaced subjects", func() {
+				_, err := natsEmitter.Emit(messagesToEmit)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(natsClient.PublishedMessages("tenant-a.router.register")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("tenant-a.router.unregister")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("tenant-a.service-discovery.register")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("tenant-a.service-discovery.unregister")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("router.register")).To(BeEmpty())
+			})
+
+			It("publishes the routes of a routed isolation segment on its own subjects", func() {
+				_, err := natsEmitter.Emit(routingtable.MessagesToEmit{
+					RegistrationMessages: []routingtable.RegistryMessage{
+						{URIs: []string{"foo.com"}, Host: "1.1.1.1", Port: 11, IsolationSegment: "segment-a"},
+						{URIs: []string{"bar.com"}, Host: "1.1.1.1", Port: 12, IsolationSegment: "segment-b"},
+					},
+					UnregistrationMessages: []routingtable.RegistryMessage{
+						{URIs: []string{"baz.com"}, Host: "1.1.1.1", Port: 13, IsolationSegment: "segment-a"},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(natsClient.PublishedMessages("tenant-a.router-segment-a.register")).To(HaveLen(1))
+				Expect(natsClient.PublishedMessages("tenant-a.router-segment-a.unregister")).To(HaveLen(1))
+				Expect(natsClient.PublishedMessages("tenant-a.router.register")).To(HaveLen(1))
+			})
+		})
+
+		Context("when a signer is configured", func() {
+			var verifier *signing.Verifier
+
+			BeforeEach(func() {
+				clock := fakeclock.NewFakeClock(time.Now())
+				signer, err := signing.NewSigner(signing.NewHMACKey("key-1", []byte("secret")), clock)
+				Expect(err).NotTo(HaveOccurred())
+				verifier = signing.NewVerifier([]signing.Key{signing.NewHMACKey("key-1", []byte("secret"))}, time.Minute, clock)
+
+				workPool, err := workpool.NewWorkPool(1)
+				Expect(err).NotTo(HaveOccurred())
+				natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, true, emitter.NATSEmitterOptions{Signer: signer})
+			})
+
+			It("signs every published message", func() {
+				_, err := natsEmitter.Emit(messagesToEmit)
+				Expect(err).NotTo(HaveOccurred())
+
+				messages := natsClient.PublishedMessages("router.register")
+				messages = append(messages, natsClient.PublishedMessages("router.unregister")...)
+				messages = append(messages, natsClient.PublishedMessages("service-discovery.register")...)
+				messages = append(messages, natsClient.PublishedMessages("service-discovery.unregister")...)
+				Expect(messages).To(HaveLen(8))
+
+				for _, message := range messages {
+					Expect(verifier.Verify(message.Data)).To(Equal("key-1"))
+
+					registryMessage := routingtable.RegistryMessage{}
+					Expect(json.Unmarshal(message.Data, &registryMessage)).To(Succeed())
+					Expect(registryMessage.Host).NotTo(BeEmpty())
+				}
+			})
+		})
+
 		Context("when the nats emitter is configured to not emit internal routes", func() {
 			BeforeEach(func() {
 				logger := lagertest.NewTestLogger("test")
 				workPool, err := workpool.NewWorkPool(1)
 				Expect(err).NotTo(HaveOccurred())
-				natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, false)
+				natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, false, emitter.NATSEmitterOptions{})
 			})
 
 			It("only emits http routes", func() {
-				err := natsEmitter.Emit(messagesToEmit)
+				_, err := natsEmitter.Emit(messagesToEmit)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(natsClient.PublishedMessages("router.register")).To(HaveLen(2))
@@ -229,8 +313,134 @@ var _ = Describe("NatsEmitter", func() {
 				})
 			})
 
-			It("should error", func() {
-				Expect(natsEmitter.Emit(messagesToEmit)).To(MatchError(errors.New("bam")))
+			It("reports how many messages succeeded and failed", func() {
+				result, err := natsEmitter.Emit(messagesToEmit)
+				Expect(err).To(MatchError(ContainSubstring("failed to publish 2 of 8 messages: bam")))
+				Expect(result).To(Equal(emitter.EmitResult{
+					Succeeded:       6,
+					Failed:          2,
+					FailedBySubject: map[string]int{"router.register": 2},
+				}))
+			})
+
+			It("counts the publish errors", func() {
+				natsEmitter.Emit(messagesToEmit)
+
+				counters := map[string]uint64{}
+				for i := 0; i < fakeMetronClient.IncrementCounterWithDeltaCallCount(); i++ {
+					name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(i)
+					counters[name] = delta
+				}
+				Expect(counters).To(HaveKeyWithValue("NATSPublishErrors", BeEquivalentTo(2)))
+				Expect(counters).To(HaveKeyWithValue("HTTPRouteNATSMessagesEmitted", BeEquivalentTo(2)))
+			})
+		})
+
+		Context("with a circuit breaker", func() {
+			var (
+				clock     *fakeclock.FakeClock
+				recovered chan struct{}
+				failing   bool
+				breaker   *emitter.CircuitBreaker
+			)
+
+			BeforeEach(func() {
+				clock = fakeclock.NewFakeClock(time.Now())
+				recovered = make(chan struct{}, 1)
+				breaker = emitter.NewCircuitBreaker(logger, clock, 2, 5*time.Second, func() {
+					recovered <- struct{}{}
+				})
+
+				failing = true
+				natsClient.WhenPublishing("router.register", func(*nats.Msg) error {
+					if failing {
+						return errors.New("disconnected")
+					}
+					return nil
+				})
+
+				workPool, err := workpool.NewWorkPool(1)
+				Expect(err).NotTo(HaveOccurred())
+				natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, false, emitter.NATSEmitterOptions{Breaker: breaker})
+			})
+
+			registrations := func(count int) routingtable.MessagesToEmit {
+				messages := routingtable.MessagesToEmit{}
+				for i := 0; i < count; i++ {
+					messages.RegistrationMessages = append(messages.RegistrationMessages, routingtable.RegistryMessage{URIs: []string{"foo.com"}, Host: "1.1.1.1", Port: uint32(i)})
+				}
+				return messages
+			}
+
+			It("stops publishing once the failure threshold is reached", func() {
+				result, err := natsEmitter.Emit(registrations(5))
+				Expect(err).To(HaveOccurred())
+				Expect(result.Failed).To(Equal(5))
+				Expect(err).To(MatchError(ContainSubstring("disconnected")))
+
+				_, err = natsEmitter.Emit(registrations(1))
+				Expect(err).To(MatchError(ContainSubstring(emitter.ErrCircuitOpen.Error())))
+				Expect(logger).To(gbytes.Say("circuit-breaker.opened"))
+			})
+
+			It("triggers a full emit once a probe succeeds after the cooldown", func() {
+				natsEmitter.Emit(registrations(2))
+
+				failing = false
+				_, err := natsEmitter.Emit(registrations(1))
+				Expect(err).To(MatchError(ContainSubstring(emitter.ErrCircuitOpen.Error())))
+				Consistently(recovered).ShouldNot(Receive())
+
+				clock.Increment(5 * time.Second)
+				result, err := natsEmitter.Emit(registrations(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Succeeded).To(Equal(1))
+				Expect(recovered).To(Receive())
+				Expect(logger).To(gbytes.Say("circuit-breaker.closed"))
+			})
+
+			Context("when the connection is lost", func() {
+				BeforeEach(func() {
+					failing = false
+				})
+
+				It("stops publishing until the connection is re-established", func() {
+					breaker.Disconnected()
+					Expect(logger).To(gbytes.Say("circuit-breaker.opened.*disconnected"))
+
+					_, err := natsEmitter.Emit(registrations(1))
+					Expect(err).To(MatchError(ContainSubstring(emitter.ErrCircuitOpen.Error())))
+
+					clock.Increment(5 * time.Second)
+					_, err = natsEmitter.Emit(registrations(1))
+					Expect(err).To(MatchError(ContainSubstring(emitter.ErrCircuitOpen.Error())))
+					Expect(recovered).NotTo(Receive())
+
+					breaker.Reconnected()
+					Expect(recovered).To(Receive())
+
+					result, err := natsEmitter.Emit(registrations(1))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.Succeeded).To(Equal(1))
+				})
+
+				It("does nothing on a reconnect that follows no disconnect", func() {
+					breaker.Reconnected()
+					Expect(recovered).NotTo(Receive())
+					Expect(breaker.Open()).To(BeFalse())
+				})
+			})
+
+			It("stays open when the probe fails", func() {
+				natsEmitter.Emit(registrations(2))
+
+				clock.Increment(5 * time.Second)
+				_, err := natsEmitter.Emit(registrations(1))
+				Expect(err).To(MatchError(ContainSubstring("disconnected")))
+
+				_, err = natsEmitter.Emit(registrations(1))
+				Expect(err).To(MatchError(ContainSubstring(emitter.ErrCircuitOpen.Error())))
+				Expect(recovered).NotTo(Receive())
 			})
 		})
 
@@ -240,7 +450,7 @@ var _ = Describe("NatsEmitter", func() {
 			})
 
 			It("should log the error message", func() {
-				err := natsEmitter.Emit(messagesToEmit)
+				_, err := natsEmitter.Emit(messagesToEmit)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(logger).To(gbytes.Say("cannot-emit-number-of-internal-messages.*boo"))
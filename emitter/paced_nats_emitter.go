@@ -0,0 +1,410 @@
+package emitter
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+)
+
+// pacedEmitTick is how often a batch of messages is handed to the underlying
+// emitter while a paced emit is in progress
+const pacedEmitTick = 100 * time.Millisecond
+
+// PacedNATSEmitter spreads the periodic re-registration of the full routing
+// table over a fraction of the register interval instead of publishing every
+// message at once. Emit only queues the messages; they are published by Run.
+// External and internal routes are paced independently, and a newer snapshot
+// of either replaces the one still waiting to be published. Emit therefore
+// returns the results of the batches published since the previous call to
+// Emit, failing if any of them failed.
+// Event driven changes are published right away through the emitter returned
+// by Immediate, which keeps routes it unregisters from being registered again
+// by the remaining batches of a snapshot taken before.
+type PacedNATSEmitter struct {
+	natsEmitter          NATSEmitter
+	clock                clock.Clock
+	logger               lager.Logger
+	fraction             float64
+	maxMessagesPerSecond int
+
+	external *pacedLane
+	internal *pacedLane
+}
+
+type pacedLane struct {
+	name     string
+	interval func() time.Duration
+
+	lock     sync.Mutex
+	pending  *pacedSnapshot
+	inFlight *pacedSnapshot
+	notify   chan struct{}
+
+	// results of the batches published since they were last collected
+	result   EmitResult
+	firstErr error
+}
+
+// pacedSnapshot is a snapshot of the routing table waiting to be or being
+// paced, along with the routes unregistered since it was taken
+type pacedSnapshot struct {
+	messages     routingtable.MessagesToEmit
+	unregistered map[pacedRouteKey]struct{}
+}
+
+type pacedRouteKey struct {
+	uri     string
+	host    string
+	port    uint32
+	tlsPort uint32
+}
+
+func NewPacedNATSEmitter(
+	natsEmitter NATSEmitter,
+	clock clock.Clock,
+	logger lager.Logger,
+	externalInterval func() time.Duration,
+	internalInterval func() time.Duration,
+	fraction float64,
+	maxMessagesPerSecond int,
+) *PacedNATSEmitter {
+	return &PacedNATSEmitter{
+		natsEmitter:          natsEmitter,
+		clock:                clock,
+		logger:               logger.Session("paced-nats-emitter"),
+		fraction:             fraction,
+		maxMessagesPerSecond: maxMessagesPerSecond,
+
+		external: newPacedLane("external", externalInterval),
+		internal: newPacedLane("internal", internalInterval),
+	}
+}
+
+func newPacedLane(name string, interval func() time.Duration) *pacedLane {
+	return &pacedLane{
+		name:     name,
+		interval: interval,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+func (p *PacedNATSEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) (EmitResult, error) {
+	external := routingtable.MessagesToEmit{
+		RegistrationMessages:   messagesToEmit.RegistrationMessages,
+		UnregistrationMessages: messagesToEmit.UnregistrationMessages,
+	}
+	if messageCount(external) > 0 {
+		p.external.offer(external)
+	}
+
+	internal := routingtable.MessagesToEmit{
+		InternalRegistrationMessages:   messagesToEmit.InternalRegistrationMessages,
+		InternalUnregistrationMessages: messagesToEmit.InternalUnregistrationMessages,
+	}
+	if messageCount(internal) > 0 {
+		p.internal.offer(internal)
+	}
+
+	result := EmitResult{}
+	var firstErr error
+	for _, lane := range []*pacedLane{p.external, p.internal} {
+		laneResult, err := lane.collect()
+		result.Add(laneResult)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return result, fmt.Errorf("failed to publish %d of %d paced messages: %s", result.Failed, result.Succeeded+result.Failed, firstErr)
+	}
+	return result, nil
+}
+
+// Immediate returns an emitter publishing through the underlying emitter
+// right away. Routes it unregisters are dropped from the snapshots waiting to
+// be or being paced, until it registers them again.
+func (p *PacedNATSEmitter) Immediate() NATSEmitter {
+	return immediateNATSEmitter{paced: p}
+}
+
+type immediateNATSEmitter struct {
+	paced *PacedNATSEmitter
+}
+
+func (e immediateNATSEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) (EmitResult, error) {
+	e.paced.external.track(messagesToEmit.RegistrationMessages, messagesToEmit.UnregistrationMessages)
+	e.paced.internal.track(messagesToEmit.InternalRegistrationMessages, messagesToEmit.InternalUnregistrationMessages)
+	return e.paced.natsEmitter.Emit(messagesToEmit)
+}
+
+func (p *PacedNATSEmitter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	p.logger.Info("starting")
+	defer p.logger.Info("finished")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, lane := range []*pacedLane{p.external, p.internal} {
+		wg.Add(1)
+		go func(lane *pacedLane) {
+			defer wg.Done()
+			p.runLane(lane, done)
+		}(lane)
+	}
+
+	close(ready)
+	p.logger.Info("started")
+
+	<-signals
+	p.logger.Info("stopping")
+	close(done)
+	wg.Wait()
+	return nil
+}
+
+func (p *PacedNATSEmitter) runLane(lane *pacedLane, done <-chan struct{}) {
+	for {
+		select {
+		case <-lane.notify:
+			if messages, ok := lane.take(); ok {
+				p.emit(lane, messages, done)
+				lane.finish()
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func (p *PacedNATSEmitter) emit(lane *pacedLane, messages routingtable.MessagesToEmit, done <-chan struct{}) {
+	total := messageCount(messages)
+	batchSize := p.batchSize(total, lane.interval())
+	logger := p.logger.Session("emit", lager.Data{
+		"lane":       lane.name,
+		"messages":   total,
+		"batch-size": batchSize,
+	})
+	logger.Debug("starting")
+	defer logger.Debug("complete")
+
+	for start := 0; start < total; start += batchSize {
+		end := start + batchSize
+		if end > total {
+			end = total
+		}
+
+		batch := lane.withoutUnregistered(sliceMessages(messages, start, end))
+		if messageCount(batch) > 0 {
+			result, err := p.natsEmitter.Emit(batch)
+			if err != nil {
+				logger.Error("failed-to-emit-batch", err, lager.Data{"start": start, "end": end, "failed": result.Failed})
+			}
+			lane.record(result, err)
+		}
+
+		if end == total {
+			return
+		}
+
+		timer := p.clock.NewTimer(pacedEmitTick)
+		select {
+		case <-timer.C():
+		case <-done:
+			timer.Stop()
+			logger.Info("aborted", lager.Data{"remaining": total - end})
+			return
+		}
+	}
+}
+
+// batchSize returns how many messages to publish every pacedEmitTick so that
+// the messages are spread over the configured fraction of the interval
+// without exceeding the maximum rate
+func (p *PacedNATSEmitter) batchSize(total int, interval time.Duration) int {
+	if total == 0 {
+		return 1
+	}
+
+	batchSize := total
+	window := time.Duration(p.fraction * float64(interval))
+	if ticks := int(window / pacedEmitTick); ticks > 1 {
+		batchSize = (total + ticks - 1) / ticks
+	}
+
+	if p.maxMessagesPerSecond > 0 {
+		maxBatchSize := int(int64(p.maxMessagesPerSecond) * int64(pacedEmitTick) / int64(time.Second))
+		if maxBatchSize < 1 {
+			maxBatchSize = 1
+		}
+		if batchSize > maxBatchSize {
+			batchSize = maxBatchSize
+		}
+	}
+
+	return batchSize
+}
+
+func (l *pacedLane) offer(messages routingtable.MessagesToEmit) {
+	l.lock.Lock()
+	l.pending = &pacedSnapshot{
+		messages:     messages,
+		unregistered: map[pacedRouteKey]struct{}{},
+	}
+	l.lock.Unlock()
+
+	select {
+	case l.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (l *pacedLane) take() (routingtable.MessagesToEmit, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.pending == nil {
+		return routingtable.MessagesToEmit{}, false
+	}
+	l.inFlight = l.pending
+	l.pending = nil
+	return l.inFlight.messages, true
+}
+
+func (l *pacedLane) finish() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.inFlight = nil
+}
+
+func (l *pacedLane) record(result EmitResult, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.result.Add(result)
+	if l.firstErr == nil {
+		l.firstErr = err
+	}
+}
+
+// collect returns and resets the results recorded since the last call
+func (l *pacedLane) collect() (EmitResult, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	result, err := l.result, l.firstErr
+	l.result, l.firstErr = EmitResult{}, nil
+	return result, err
+}
+
+// track records routes unregistered, or registered again, outside of the
+// paced snapshots
+func (l *pacedLane) track(registrations, unregistrations []routingtable.RegistryMessage) {
+	if len(registrations) == 0 && len(unregistrations) == 0 {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, snapshot := range []*pacedSnapshot{l.pending, l.inFlight} {
+		if snapshot == nil {
+			continue
+		}
+		for _, message := range unregistrations {
+			for _, key := range pacedRouteKeys(message) {
+				snapshot.unregistered[key] = struct{}{}
+			}
+		}
+		for _, message := range registrations {
+			for _, key := range pacedRouteKeys(message) {
+				delete(snapshot.unregistered, key)
+			}
+		}
+	}
+}
+
+// withoutUnregistered drops the routes unregistered since the snapshot being
+// paced was taken from the registrations of a batch of it
+func (l *pacedLane) withoutUnregistered(batch routingtable.MessagesToEmit) routingtable.MessagesToEmit {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight == nil || len(l.inFlight.unregistered) == 0 {
+		return batch
+	}
+
+	unregistered := l.inFlight.unregistered
+	batch.RegistrationMessages = withoutRoutes(batch.RegistrationMessages, unregistered)
+	batch.InternalRegistrationMessages = withoutRoutes(batch.InternalRegistrationMessages, unregistered)
+	return batch
+}
+
+func withoutRoutes(messages []routingtable.RegistryMessage, routes map[pacedRouteKey]struct{}) []routingtable.RegistryMessage {
+	var result []routingtable.RegistryMessage
+	for _, message := range messages {
+		uris := []string{}
+		for _, key := range pacedRouteKeys(message) {
+			if _, ok := routes[key]; !ok {
+				uris = append(uris, key.uri)
+			}
+		}
+		if len(uris) == 0 {
+			continue
+		}
+		message.URIs = uris
+		result = append(result, message)
+	}
+	return result
+}
+
+func pacedRouteKeys(message routingtable.RegistryMessage) []pacedRouteKey {
+	keys := make([]pacedRouteKey, 0, len(message.URIs))
+	for _, uri := range message.URIs {
+		keys = append(keys, pacedRouteKey{
+			uri:     uri,
+			host:    message.Host,
+			port:    message.Port,
+			tlsPort: message.TlsPort,
+		})
+	}
+	return keys
+}
+
+func messageCount(m routingtable.MessagesToEmit) int {
+	return len(m.RegistrationMessages) +
+		len(m.UnregistrationMessages) +
+		len(m.InternalRegistrationMessages) +
+		len(m.InternalUnregistrationMessages)
+}
+
+// sliceMessages returns the messages in [start, end) of the concatenation of
+// the registration, unregistration, internal registration and internal
+// unregistration messages
+func sliceMessages(m routingtable.MessagesToEmit, start, end int) routingtable.MessagesToEmit {
+	var result routingtable.MessagesToEmit
+	offset := 0
+	slice := func(messages []routingtable.RegistryMessage) []routingtable.RegistryMessage {
+		from, to := start-offset, end-offset
+		offset += len(messages)
+		if from < 0 {
+			from = 0
+		}
+		if to > len(messages) {
+			to = len(messages)
+		}
+		if from >= to {
+			return nil
+		}
+		return messages[from:to]
+	}
+
+	result.RegistrationMessages = slice(m.RegistrationMessages)
+	result.UnregistrationMessages = slice(m.UnregistrationMessages)
+	result.InternalRegistrationMessages = slice(m.InternalRegistrationMessages)
+	result.InternalUnregistrationMessages = slice(m.InternalUnregistrationMessages)
+	return result
+}
@@ -0,0 +1,205 @@
+package emitter_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/emitter"
+	"code.cloudfoundry.org/route-emitter/emitter/fakes"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PacedNATSEmitter", func() {
+	var (
+		natsEmitter          *fakes.FakeNATSEmitter
+		clock                *fakeclock.FakeClock
+		pacedEmitter         *emitter.PacedNATSEmitter
+		process              ifrit.Process
+		externalInterval     time.Duration
+		maxMessagesPerSecond int
+	)
+
+	registrations := func(n int) []routingtable.RegistryMessage {
+		messages := make([]routingtable.RegistryMessage, n)
+		for i := range messages {
+			messages[i] = routingtable.RegistryMessage{URIs: []string{"foo.com"}, Host: "1.1.1.1", Port: uint32(i)}
+		}
+		return messages
+	}
+
+	emittedCount := func() int {
+		count := 0
+		for i := 0; i < natsEmitter.EmitCallCount(); i++ {
+			messages := natsEmitter.EmitArgsForCall(i)
+			count += len(messages.RegistrationMessages) + len(messages.InternalRegistrationMessages)
+		}
+		return count
+	}
+
+	BeforeEach(func() {
+		natsEmitter = &fakes.FakeNATSEmitter{}
+		clock = fakeclock.NewFakeClock(time.Now())
+		externalInterval = 2 * time.Second
+		maxMessagesPerSecond = 0
+	})
+
+	JustBeforeEach(func() {
+		logger := lagertest.NewTestLogger("test")
+		pacedEmitter = emitter.NewPacedNATSEmitter(
+			natsEmitter,
+			clock,
+			logger,
+			func() time.Duration { return externalInterval },
+			func() time.Duration { return time.Second },
+			0.5,
+			maxMessagesPerSecond,
+		)
+		process = ifrit.Invoke(pacedEmitter)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("spreads the messages over a fraction of the interval", func() {
+		_, err := pacedEmitter.Emit(routingtable.MessagesToEmit{RegistrationMessages: registrations(20)})
+		Expect(err).NotTo(HaveOccurred())
+
+		// 50% of 2s is 10 ticks of 100ms, so 2 messages per tick
+		Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+		Expect(natsEmitter.EmitArgsForCall(0).RegistrationMessages).To(HaveLen(2))
+		Consistently(natsEmitter.EmitCallCount).Should(Equal(1))
+
+		for i := 2; i <= 10; i++ {
+			clock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(i))
+		}
+		Expect(emittedCount()).To(Equal(20))
+	})
+
+	Context("when the rate would exceed the maximum messages per second", func() {
+		BeforeEach(func() {
+			maxMessagesPerSecond = 10
+		})
+
+		It("publishes at most the maximum rate", func() {
+			_, err := pacedEmitter.Emit(routingtable.MessagesToEmit{RegistrationMessages: registrations(3)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+			Expect(natsEmitter.EmitArgsForCall(0).RegistrationMessages).To(HaveLen(1))
+
+			clock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+			clock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(3))
+			Expect(emittedCount()).To(Equal(3))
+		})
+	})
+
+	Context("when the interval is too short to pace", func() {
+		BeforeEach(func() {
+			externalInterval = 0
+		})
+
+		It("publishes the messages at once", func() {
+			_, err := pacedEmitter.Emit(routingtable.MessagesToEmit{RegistrationMessages: registrations(20)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+			Expect(natsEmitter.EmitArgsForCall(0).RegistrationMessages).To(HaveLen(20))
+		})
+	})
+
+	Context("when publishing the batches fails", func() {
+		BeforeEach(func() {
+			externalInterval = 0
+			natsEmitter.EmitReturns(emitter.EmitResult{Succeeded: 18, Failed: 2}, errors.New("bam"))
+		})
+
+		It("returns the results of the batches published since the previous emit", func() {
+			_, err := pacedEmitter.Emit(routingtable.MessagesToEmit{RegistrationMessages: registrations(20)})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+
+			var result emitter.EmitResult
+			Eventually(func() error {
+				result, err = pacedEmitter.Emit(routingtable.MessagesToEmit{})
+				return err
+			}).Should(MatchError("failed to publish 2 of 20 paced messages: bam"))
+			Expect(result).To(Equal(emitter.EmitResult{Succeeded: 18, Failed: 2}))
+
+			result, err = pacedEmitter.Emit(routingtable.MessagesToEmit{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(emitter.EmitResult{}))
+		})
+	})
+
+	It("paces external and internal messages independently", func() {
+		_, err := pacedEmitter.Emit(routingtable.MessagesToEmit{
+			RegistrationMessages:         registrations(20),
+			InternalRegistrationMessages: registrations(1),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+		Expect(emittedCount()).To(Equal(3))
+	})
+
+	Describe("Immediate", func() {
+		It("publishes right away", func() {
+			messages := routingtable.MessagesToEmit{UnregistrationMessages: registrations(1)}
+			_, err := pacedEmitter.Immediate().Emit(messages)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(natsEmitter.EmitCallCount()).To(Equal(1))
+			Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(messages))
+		})
+
+		It("keeps the snapshot being paced from registering routes it unregistered", func() {
+			_, err := pacedEmitter.Emit(routingtable.MessagesToEmit{RegistrationMessages: registrations(20)})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+
+			unregistered := registrations(20)[5]
+			_, err = pacedEmitter.Immediate().Emit(routingtable.MessagesToEmit{
+				UnregistrationMessages: []routingtable.RegistryMessage{unregistered},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(natsEmitter.EmitCallCount()).To(Equal(2))
+
+			for i := 3; i <= 11; i++ {
+				clock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(i))
+			}
+			Expect(emittedCount()).To(Equal(19))
+			for i := 0; i < natsEmitter.EmitCallCount(); i++ {
+				Expect(natsEmitter.EmitArgsForCall(i).RegistrationMessages).NotTo(ContainElement(unregistered))
+			}
+		})
+
+		It("lets the snapshot register routes it registered again", func() {
+			_, err := pacedEmitter.Emit(routingtable.MessagesToEmit{RegistrationMessages: registrations(20)})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+
+			route := []routingtable.RegistryMessage{registrations(20)[5]}
+			pacedEmitter.Immediate().Emit(routingtable.MessagesToEmit{UnregistrationMessages: route})
+			pacedEmitter.Immediate().Emit(routingtable.MessagesToEmit{RegistrationMessages: route})
+
+			for i := 4; i <= 12; i++ {
+				clock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(i))
+			}
+			Expect(emittedCount()).To(Equal(21))
+		})
+	})
+})
@@ -0,0 +1,217 @@
+package emitter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
+	"code.cloudfoundry.org/routing-api"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+const (
+	invalidTCPRouteMappingsCounter = "InvalidTCPRouteMappings"
+
+	// unknownRouterGroupRefetchInterval limits how often the router groups are
+	// fetched again because a mapping refers to a group that is not cached
+	unknownRouterGroupRefetchInterval = 10 * time.Second
+)
+
+// RouterGroupValidator drops TCP route mappings that the routing API would
+// reject: mappings of unknown or non-TCP router groups, and mappings whose
+// external port is outside the reservable ports of their group. Router
+// groups are fetched from the routing API and cached for refreshInterval.
+// When the router groups cannot be fetched, mappings are not validated.
+type RouterGroupValidator struct {
+	logger           lager.Logger
+	clock            clock.Clock
+	routingAPIClient routing_api.Client
+	tokenProvider    tokenprovider.TokenProvider
+	metronClient     loggingclient.IngressClient
+	refreshInterval  time.Duration
+
+	lock      sync.Mutex
+	groups    map[string]routerGroup
+	fetchedAt time.Time
+}
+
+type routerGroup struct {
+	name  string
+	tcp   bool
+	ports []portRange
+}
+
+type portRange struct {
+	start, end uint64
+}
+
+func NewRouterGroupValidator(
+	logger lager.Logger,
+	clock clock.Clock,
+	routingAPIClient routing_api.Client,
+	tokenProvider tokenprovider.TokenProvider,
+	metronClient loggingclient.IngressClient,
+	refreshInterval time.Duration,
+) *RouterGroupValidator {
+	return &RouterGroupValidator{
+		logger:           logger.Session("router-group-validator"),
+		clock:            clock,
+		routingAPIClient: routingAPIClient,
+		tokenProvider:    tokenProvider,
+		metronClient:     metronClient,
+		refreshInterval:  refreshInterval,
+	}
+}
+
+// Filter returns the valid mappings, logging every dropped one
+func (v *RouterGroupValidator) Filter(mappings []models.TcpRouteMapping) []models.TcpRouteMapping {
+	if len(mappings) == 0 {
+		return mappings
+	}
+
+	groups, ok := v.routerGroups(mappings)
+	if !ok {
+		return mappings
+	}
+
+	valid := make([]models.TcpRouteMapping, 0, len(mappings))
+	invalid := 0
+	for _, mapping := range mappings {
+		reason := validate(groups, mapping)
+		if reason == "" {
+			valid = append(valid, mapping)
+			continue
+		}
+
+		invalid++
+		data := lager.Data{
+			"router-group-guid": mapping.RouterGroupGuid,
+			"external-port":     mapping.ExternalPort,
+			"host-ip":           mapping.HostIP,
+			"host-port":         mapping.HostPort,
+		}
+		if sniHostname := routingtable.MappingSniHostname(mapping); sniHostname != "" {
+			data["sni-hostname"] = sniHostname
+		}
+		v.logger.Error("dropping-invalid-tcp-route-mapping", errors.New(reason), data)
+	}
+
+	if invalid > 0 {
+		err := v.metronClient.IncrementCounterWithDelta(invalidTCPRouteMappingsCounter, uint64(invalid))
+		if err != nil {
+			v.logger.Error("cannot-send-invalid-tcp-route-mappings-metric", err)
+		}
+	}
+
+	return valid
+}
+
+func validate(groups map[string]routerGroup, mapping models.TcpRouteMapping) string {
+	group, ok := groups[mapping.RouterGroupGuid]
+	if !ok {
+		return "unknown router group"
+	}
+	if !group.tcp {
+		return fmt.Sprintf("router group %s is not a tcp router group", group.name)
+	}
+	for _, r := range group.ports {
+		if uint64(mapping.ExternalPort) >= r.start && uint64(mapping.ExternalPort) <= r.end {
+			return ""
+		}
+	}
+	return fmt.Sprintf("port is not reservable in router group %s", group.name)
+}
+
+// routerGroups returns the cached router groups, fetching them when the cache
+// is stale or does not know a router group of the mappings
+func (v *RouterGroupValidator) routerGroups(mappings []models.TcpRouteMapping) (map[string]routerGroup, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	age := v.clock.Since(v.fetchedAt)
+	refresh := v.groups == nil || age >= v.refreshInterval
+	if !refresh && age >= unknownRouterGroupRefetchInterval {
+		for _, mapping := range mappings {
+			if _, ok := v.groups[mapping.RouterGroupGuid]; !ok {
+				refresh = true
+				break
+			}
+		}
+	}
+
+	if refresh {
+		groups, err := v.fetch()
+		if err != nil {
+			v.logger.Error("failed-to-fetch-router-groups", err)
+		} else {
+			v.groups = groups
+			v.fetchedAt = v.clock.Now()
+		}
+	}
+
+	return v.groups, v.groups != nil
+}
+
+func (v *RouterGroupValidator) fetch() (map[string]routerGroup, error) {
+	var routerGroups []models.RouterGroup
+	err := withRoutingAPIToken(v.tokenProvider, v.routingAPIClient, func() error {
+		var err error
+		routerGroups, err = v.routingAPIClient.RouterGroups()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]routerGroup{}
+	for _, group := range routerGroups {
+		ports, err := parseReservablePorts(string(group.ReservablePorts))
+		if err != nil {
+			v.logger.Error("invalid-reservable-ports", err, lager.Data{"router-group": group.Name, "reservable-ports": group.ReservablePorts})
+		}
+		groups[group.Guid] = routerGroup{
+			name:  group.Name,
+			tcp:   group.Type == models.RouterGroupType("tcp"),
+			ports: ports,
+		}
+	}
+	return groups, nil
+}
+
+// parseReservablePorts parses a comma separated list of ports and port
+// ranges, e.g. "1024-1033,2000"
+func parseReservablePorts(reservablePorts string) ([]portRange, error) {
+	ranges := []portRange{}
+	for _, entry := range strings.Split(reservablePorts, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(entry, "-", 2)
+		start, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 16)
+		if err != nil {
+			return ranges, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 16)
+			if err != nil {
+				return ranges, err
+			}
+		}
+		if end < start {
+			return ranges, fmt.Errorf("invalid port range %q", entry)
+		}
+		ranges = append(ranges, portRange{start: start, end: end})
+	}
+	return ranges, nil
+}
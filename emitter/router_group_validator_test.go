@@ -0,0 +1,119 @@
+package emitter_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/emitter"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	tpfakes "code.cloudfoundry.org/route-emitter/tokenprovider/fakes"
+	"code.cloudfoundry.org/routing-api/fake_routing_api"
+	apimodels "code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("RouterGroupValidator", func() {
+	var (
+		logger           *lagertest.TestLogger
+		clock            *fakeclock.FakeClock
+		routingAPIClient *fake_routing_api.FakeClient
+		tokenProvider    *tpfakes.FakeTokenProvider
+		fakeMetronClient *mfakes.FakeIngressClient
+		validator        *emitter.RouterGroupValidator
+
+		valid, unknownGroup, httpGroup, outOfRange apimodels.TcpRouteMapping
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		routingAPIClient = new(fake_routing_api.FakeClient)
+		tokenProvider = &tpfakes.FakeTokenProvider{}
+		tokenProvider.AccessTokenReturns("accesstoken", nil)
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+
+		routingAPIClient.RouterGroupsReturns([]apimodels.RouterGroup{
+			{Guid: "tcp-1", Name: "default-tcp", Type: "tcp", ReservablePorts: "1024-1033, 2000"},
+			{Guid: "http-1", Name: "default-http", Type: "http"},
+		}, nil)
+
+		valid = apimodels.NewTcpRouteMapping("tcp-1", 2000, "1.1.1.1", 61000, 0)
+		unknownGroup = apimodels.NewTcpRouteMapping("typo", 1024, "1.1.1.1", 61001, 0)
+		httpGroup = apimodels.NewTcpRouteMapping("http-1", 1024, "1.1.1.1", 61002, 0)
+		outOfRange = apimodels.NewTcpRouteMapping("tcp-1", 1034, "1.1.1.1", 61003, 0)
+
+		validator = emitter.NewRouterGroupValidator(logger, clock, routingAPIClient, tokenProvider, fakeMetronClient, time.Minute)
+	})
+
+	It("drops the mappings the routing API would reject", func() {
+		Expect(validator.Filter([]apimodels.TcpRouteMapping{valid, unknownGroup, httpGroup, outOfRange})).To(Equal([]apimodels.TcpRouteMapping{valid}))
+
+		Expect(logger).To(gbytes.Say("dropping-invalid-tcp-route-mapping.*unknown router group"))
+		Expect(logger).To(gbytes.Say("dropping-invalid-tcp-route-mapping.*not a tcp router group"))
+		Expect(logger).To(gbytes.Say("dropping-invalid-tcp-route-mapping.*port is not reservable"))
+
+		Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+		name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+		Expect(name).To(Equal("InvalidTCPRouteMappings"))
+		Expect(delta).To(BeEquivalentTo(3))
+	})
+
+	It("caches the router groups", func() {
+		validator.Filter([]apimodels.TcpRouteMapping{valid})
+		validator.Filter([]apimodels.TcpRouteMapping{valid})
+		Expect(routingAPIClient.RouterGroupsCallCount()).To(Equal(1))
+
+		clock.Increment(time.Minute)
+		validator.Filter([]apimodels.TcpRouteMapping{valid})
+		Expect(routingAPIClient.RouterGroupsCallCount()).To(Equal(2))
+	})
+
+	It("fetches the router groups again when a mapping refers to an unknown group", func() {
+		validator.Filter([]apimodels.TcpRouteMapping{valid})
+
+		routingAPIClient.RouterGroupsReturns([]apimodels.RouterGroup{
+			{Guid: "tcp-1", Name: "default-tcp", Type: "tcp", ReservablePorts: "1024-1033"},
+			{Guid: "tcp-2", Name: "new-tcp", Type: "tcp", ReservablePorts: "3000-3010"},
+		}, nil)
+		newGroup := apimodels.NewTcpRouteMapping("tcp-2", 3000, "1.1.1.1", 61004, 0)
+
+		Expect(validator.Filter([]apimodels.TcpRouteMapping{newGroup})).To(BeEmpty())
+
+		clock.Increment(10 * time.Second)
+		Expect(validator.Filter([]apimodels.TcpRouteMapping{newGroup})).To(Equal([]apimodels.TcpRouteMapping{newGroup}))
+		Expect(routingAPIClient.RouterGroupsCallCount()).To(Equal(2))
+	})
+
+	Context("when the router groups cannot be fetched", func() {
+		BeforeEach(func() {
+			routingAPIClient.RouterGroupsReturns(nil, errors.New("boom"))
+		})
+
+		It("does not drop any mapping", func() {
+			mappings := []apimodels.TcpRouteMapping{valid, unknownGroup}
+			Expect(validator.Filter(mappings)).To(Equal(mappings))
+			Expect(logger).To(gbytes.Say("failed-to-fetch-router-groups"))
+		})
+	})
+
+	Context("when used by the routing API emitter", func() {
+		It("emits only the valid mappings", func() {
+			routingAPIEmitter := emitter.NewRoutingAPIEmitter(logger, routingAPIClient, tokenProvider, 60, validator)
+			err := routingAPIEmitter.Emit(routingtable.TCPRouteMappings{
+				Registrations: []apimodels.TcpRouteMapping{valid, outOfRange},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(routingAPIClient.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+			Expect(routingAPIClient.UpsertTcpRouteMappingsArgsForCall(0)).To(Equal([]apimodels.TcpRouteMapping{
+				apimodels.NewTcpRouteMapping("tcp-1", 2000, "1.1.1.1", 61000, 60),
+			}))
+		})
+	})
+})
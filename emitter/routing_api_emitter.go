@@ -3,9 +3,9 @@ package emitter
 import (
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
 	"code.cloudfoundry.org/routing-api"
 	"code.cloudfoundry.org/routing-api/models"
-	uaaclient "code.cloudfoundry.org/uaa-go-client"
 )
 
 //go:generate counterfeiter -o fakes/fake_routing_api_emitter.go . RoutingAPIEmitter
@@ -17,21 +17,30 @@ type routingAPIEmitter struct {
 	logger           lager.Logger
 	routingAPIClient routing_api.Client
 	ttl              int
-	uaaClient        uaaclient.Client
+	tokenProvider    tokenprovider.TokenProvider
+	validator        *RouterGroupValidator
 }
 
-func NewRoutingAPIEmitter(logger lager.Logger, routingAPIClient routing_api.Client, uaaClient uaaclient.Client, routeTTL int) RoutingAPIEmitter {
+// NewRoutingAPIEmitter returns an emitter for the routing API. When a
+// validator is given, mappings it rejects are dropped before emitting.
+func NewRoutingAPIEmitter(logger lager.Logger, routingAPIClient routing_api.Client, tokenProvider tokenprovider.TokenProvider, routeTTL int, validator *RouterGroupValidator) RoutingAPIEmitter {
 	return &routingAPIEmitter{
 		logger:           logger,
 		routingAPIClient: routingAPIClient,
 		ttl:              routeTTL,
-		uaaClient:        uaaClient,
+		tokenProvider:    tokenProvider,
+		validator:        validator,
 	}
 }
 
 func (t *routingAPIEmitter) Emit(tcpEvents routingtable.TCPRouteMappings) error {
 	defer t.logger.Debug("complete-emit")
 
+	if t.validator != nil {
+		tcpEvents.Registrations = t.validator.Filter(tcpEvents.Registrations)
+		tcpEvents.Unregistrations = t.validator.Filter(tcpEvents.Unregistrations)
+	}
+
 	if len(tcpEvents.Registrations) <= 0 && len(tcpEvents.Unregistrations) <= 0 {
 		return nil
 	}
@@ -45,26 +54,37 @@ func (t *routingAPIEmitter) Emit(tcpEvents routingtable.TCPRouteMappings) error
 }
 
 func (t *routingAPIEmitter) emit(registrationMappingRequests, unregistrationMappingRequests []models.TcpRouteMapping) error {
-	var forceUpdate bool
+	err := withRoutingAPIToken(t.tokenProvider, t.routingAPIClient, func() error {
+		return t.emitRoutingAPI(registrationMappingRequests, unregistrationMappingRequests)
+	})
+	if err != nil {
+		return err
+	}
 
+	t.logger.Debug("successfully-emitted-events")
+	return nil
+}
+
+// withRoutingAPIToken calls the routing API with the current token, and
+// retries once with a freshly fetched token when the call fails, e.g.
+// because the token was revoked
+func withRoutingAPIToken(tokenProvider tokenprovider.TokenProvider, routingAPIClient routing_api.Client, call func() error) error {
 	for count := 0; count < 2; count++ {
-		forceUpdate = count > 0
-		token, err := t.uaaClient.FetchToken(forceUpdate)
+		forceUpdate := count > 0
+		token, err := tokenProvider.AccessToken(forceUpdate)
 		if err != nil {
 			return err
 		}
 
-		t.routingAPIClient.SetToken(token.AccessToken)
+		routingAPIClient.SetToken(token)
 
-		err = t.emitRoutingAPI(registrationMappingRequests, unregistrationMappingRequests)
+		err = call()
 		if err != nil && count > 0 {
 			return err
 		} else if err == nil {
 			break
 		}
 	}
-
-	t.logger.Debug("successfully-emitted-events")
 	return nil
 }
 
@@ -7,10 +7,9 @@ import (
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/route-emitter/emitter"
 	"code.cloudfoundry.org/route-emitter/routingtable"
+	tpfakes "code.cloudfoundry.org/route-emitter/tokenprovider/fakes"
 	"code.cloudfoundry.org/routing-api/fake_routing_api"
 	apimodels "code.cloudfoundry.org/routing-api/models"
-	fakeuaa "code.cloudfoundry.org/uaa-go-client/fakes"
-	"code.cloudfoundry.org/uaa-go-client/schema"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -21,7 +20,7 @@ var _ = Describe("RoutingAPIEmitter", func() {
 
 	var (
 		routingApiClient      *fake_routing_api.FakeClient
-		uaaClient             *fakeuaa.FakeClient
+		tokenProvider         *tpfakes.FakeTokenProvider
 		routingEvents         routingtable.TCPRouteMappings
 		expectedRoutingEvents routingtable.TCPRouteMappings
 		routingAPIEmitter     emitter.RoutingAPIEmitter
@@ -33,8 +32,8 @@ var _ = Describe("RoutingAPIEmitter", func() {
 		routingApiClient = new(fake_routing_api.FakeClient)
 		ttl = 60
 		logger = lagertest.NewTestLogger("test")
-		uaaClient = &fakeuaa.FakeClient{}
-		routingAPIEmitter = emitter.NewRoutingAPIEmitter(logger, routingApiClient, uaaClient, ttl)
+		tokenProvider = &tpfakes.FakeTokenProvider{}
+		routingAPIEmitter = emitter.NewRoutingAPIEmitter(logger, routingApiClient, tokenProvider, ttl, nil)
 
 		routingEvents = routingtable.TCPRouteMappings{
 			Registrations: []apimodels.TcpRouteMapping{apimodels.NewTcpRouteMapping("123", 61000, "some-ip-1", 62003, 0)},
@@ -44,23 +43,20 @@ var _ = Describe("RoutingAPIEmitter", func() {
 			Registrations: []apimodels.TcpRouteMapping{apimodels.NewTcpRouteMapping("123", 61000, "some-ip-1", 62003, int(ttl))},
 		}
 
-		token := &schema.Token{
-			AccessToken: "accesstoken",
-		}
-		uaaClient.FetchTokenReturns(token, nil)
+		tokenProvider.AccessTokenReturns("accesstoken", nil)
 	})
 
-	It("fetches a client token from UAA", func() {
+	It("fetches a token from the token provider", func() {
 		err := routingAPIEmitter.Emit(routingEvents)
 		Expect(err).ShouldNot(HaveOccurred())
-		Expect(uaaClient.FetchTokenCallCount()).To(Equal(1))
+		Expect(tokenProvider.AccessTokenCallCount()).To(Equal(1))
 	})
 
 	It("uses a cached token if available", func() {
 		err := routingAPIEmitter.Emit(routingEvents)
 		Expect(err).ShouldNot(HaveOccurred())
-		Expect(uaaClient.FetchTokenCallCount()).To(Equal(1))
-		Expect(uaaClient.FetchTokenArgsForCall(0)).To(BeFalse())
+		Expect(tokenProvider.AccessTokenCallCount()).To(Equal(1))
+		Expect(tokenProvider.AccessTokenArgsForCall(0)).To(BeFalse())
 	})
 
 	It("authorizes the routing API call with its bearer token", func() {
@@ -69,9 +65,9 @@ var _ = Describe("RoutingAPIEmitter", func() {
 		Expect(routingApiClient.SetTokenCallCount()).To(Equal(1))
 	})
 
-	Context("when UAA communication fails", func() {
+	Context("when fetching the token fails", func() {
 		BeforeEach(func() {
-			uaaClient.FetchTokenReturns(nil, errors.New("blam"))
+			tokenProvider.AccessTokenReturns("", errors.New("blam"))
 		})
 
 		It("returns an error and emits nothing", func() {
@@ -126,12 +122,12 @@ var _ = Describe("RoutingAPIEmitter", func() {
 				Expect(logger).To(gbytes.Say("test.unable-to-upsert.*unauthorized"))
 			})
 
-			It("refreshes the cached UAA token", func() {
+			It("refreshes the cached token", func() {
 				err := routingAPIEmitter.Emit(routingEvents)
 				Expect(err).To(HaveOccurred())
 
-				Expect(uaaClient.FetchTokenCallCount()).To(Equal(2))
-				Expect(uaaClient.FetchTokenArgsForCall(1)).To(BeTrue())
+				Expect(tokenProvider.AccessTokenCallCount()).To(Equal(2))
+				Expect(tokenProvider.AccessTokenArgsForCall(1)).To(BeTrue())
 			})
 
 			Context("when refreshing the cached token authorizes the emitter", func() {
@@ -153,7 +149,7 @@ var _ = Describe("RoutingAPIEmitter", func() {
 					err := routingAPIEmitter.Emit(routingEvents)
 					Expect(err).ToNot(HaveOccurred())
 
-					Expect(uaaClient.FetchTokenCallCount()).To(Equal(2))
+					Expect(tokenProvider.AccessTokenCallCount()).To(Equal(2))
 					Expect(routingApiClient.UpsertTcpRouteMappingsCallCount()).To(Equal(2))
 				})
 			})
@@ -173,12 +169,12 @@ var _ = Describe("RoutingAPIEmitter", func() {
 				Expect(logger).To(gbytes.Say("test.unable-to-delete.*unauthorized"))
 			})
 
-			It("refreshes the cached UAA token", func() {
+			It("refreshes the cached token", func() {
 				err := routingAPIEmitter.Emit(routingEvents)
 				Expect(err).To(HaveOccurred())
 
-				Expect(uaaClient.FetchTokenCallCount()).To(Equal(2))
-				Expect(uaaClient.FetchTokenArgsForCall(1)).To(BeTrue())
+				Expect(tokenProvider.AccessTokenCallCount()).To(Equal(2))
+				Expect(tokenProvider.AccessTokenArgsForCall(1)).To(BeTrue())
 			})
 
 			Context("when refreshing the cached token authorizes the emitter", func() {
@@ -200,7 +196,7 @@ var _ = Describe("RoutingAPIEmitter", func() {
 					err := routingAPIEmitter.Emit(routingEvents)
 					Expect(err).ToNot(HaveOccurred())
 
-					Expect(uaaClient.FetchTokenCallCount()).To(Equal(2))
+					Expect(tokenProvider.AccessTokenCallCount()).To(Equal(2))
 					Expect(routingApiClient.DeleteTcpRouteMappingsCallCount()).To(Equal(2))
 				})
 			})
@@ -0,0 +1,237 @@
+package emitter
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
+	"code.cloudfoundry.org/routing-api"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+const (
+	orphanedTCPRouteMappingsGauge  = "OrphanedTCPRouteMappings"
+	deletedOrphanedMappingsCounter = "OrphanedTCPRouteMappingsDeleted"
+)
+
+// TCPRouteReconciler periodically removes TCP route mappings that are left in
+// the routing API although the routing table no longer has a matching
+// endpoint, e.g. because their delete failed. Only mappings of router groups
+// used by the routing table or explicitly listed are considered, so mappings
+// owned by other emitters sharing the routing API are left alone. Nothing is
+// reconciled until the routing table has been synced with the BBS once.
+// A mapping is only deleted once it has been found orphaned in two
+// consecutive reconciliations, so a mapping registered by the watcher while
+// the routing table and the routing API are being read is left alone.
+type TCPRouteReconciler struct {
+	logger           lager.Logger
+	clock            clock.Clock
+	interval         time.Duration
+	routingTable     routingtable.RoutingTable
+	synced           func() bool
+	routingAPIClient routing_api.Client
+	tokenProvider    tokenprovider.TokenProvider
+	metronClient     loggingclient.IngressClient
+	routerGroups     []string
+	maxDeletes       int
+	reportOnly       bool
+
+	// suspects holds the mappings found orphaned in the previous reconciliation
+	suspects map[tcpMappingKey]struct{}
+}
+
+// ReconcileResult lists the orphaned mappings found in a reconciliation, how
+// many of them were already orphaned in the previous one and how many of
+// those were deleted
+type ReconcileResult struct {
+	Orphaned  []models.TcpRouteMapping
+	Confirmed int
+	Deleted   int
+}
+
+func NewTCPRouteReconciler(
+	logger lager.Logger,
+	clock clock.Clock,
+	interval time.Duration,
+	routingTable routingtable.RoutingTable,
+	synced func() bool,
+	routingAPIClient routing_api.Client,
+	tokenProvider tokenprovider.TokenProvider,
+	metronClient loggingclient.IngressClient,
+	routerGroups []string,
+	maxDeletes int,
+	reportOnly bool,
+) *TCPRouteReconciler {
+	return &TCPRouteReconciler{
+		logger:           logger.Session("tcp-route-reconciler"),
+		clock:            clock,
+		interval:         interval,
+		routingTable:     routingTable,
+		synced:           synced,
+		routingAPIClient: routingAPIClient,
+		tokenProvider:    tokenProvider,
+		metronClient:     metronClient,
+		routerGroups:     routerGroups,
+		maxDeletes:       maxDeletes,
+		reportOnly:       reportOnly,
+		suspects:         map[tcpMappingKey]struct{}{},
+	}
+}
+
+func (r *TCPRouteReconciler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.logger.Info("starting", lager.Data{"interval": r.interval.String(), "max-deletes": r.maxDeletes, "report-only": r.reportOnly})
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	close(ready)
+	r.logger.Info("started")
+
+	for {
+		select {
+		case <-ticker.C():
+			_, err := r.Reconcile()
+			if err != nil {
+				r.logger.Error("failed-to-reconcile", err)
+			}
+		case <-signals:
+			r.logger.Info("stopping")
+			return nil
+		}
+	}
+}
+
+// Reconcile compares the mappings in the routing API with the routing table
+// and deletes up to maxDeletes mappings that were orphaned in this and the
+// previous reconciliation, unless in report-only mode. It is not safe for
+// concurrent use.
+func (r *TCPRouteReconciler) Reconcile() (ReconcileResult, error) {
+	logger := r.logger.Session("reconcile")
+
+	if !r.synced() {
+		logger.Info("skipping-until-synced")
+		r.suspects = map[tcpMappingKey]struct{}{}
+		return ReconcileResult{}, nil
+	}
+
+	desired, _ := r.routingTable.GetExternalRoutingEvents()
+	expected := map[tcpMappingKey]struct{}{}
+	knownRouterGroups := map[string]struct{}{}
+	for _, guid := range r.routerGroups {
+		knownRouterGroups[guid] = struct{}{}
+	}
+	for _, mapping := range desired.Registrations {
+		expected[keyForTCPMapping(mapping)] = struct{}{}
+		knownRouterGroups[mapping.RouterGroupGuid] = struct{}{}
+	}
+
+	var actual []models.TcpRouteMapping
+	err := withRoutingAPIToken(r.tokenProvider, r.routingAPIClient, func() error {
+		var err error
+		actual, err = r.routingAPIClient.TcpRouteMappings()
+		return err
+	})
+	if err != nil {
+		r.suspects = map[tcpMappingKey]struct{}{}
+		return ReconcileResult{}, err
+	}
+
+	result := ReconcileResult{Orphaned: []models.TcpRouteMapping{}}
+	for _, mapping := range actual {
+		if _, ok := knownRouterGroups[mapping.RouterGroupGuid]; !ok {
+			continue
+		}
+		if _, ok := expected[keyForTCPMapping(mapping)]; !ok {
+			result.Orphaned = append(result.Orphaned, mapping)
+		}
+	}
+	sort.Slice(result.Orphaned, func(i, j int) bool {
+		return keyForTCPMapping(result.Orphaned[i]).less(keyForTCPMapping(result.Orphaned[j]))
+	})
+
+	confirmed := []models.TcpRouteMapping{}
+	suspects := map[tcpMappingKey]struct{}{}
+	for _, mapping := range result.Orphaned {
+		key := keyForTCPMapping(mapping)
+		if _, ok := r.suspects[key]; ok {
+			confirmed = append(confirmed, mapping)
+		}
+		suspects[key] = struct{}{}
+	}
+	r.suspects = suspects
+	result.Confirmed = len(confirmed)
+
+	err = r.metronClient.SendMetric(orphanedTCPRouteMappingsGauge, len(result.Orphaned))
+	if err != nil {
+		logger.Error("cannot-send-orphaned-mappings-metric", err)
+	}
+
+	if len(result.Orphaned) == 0 {
+		return result, nil
+	}
+
+	logger.Info("found-orphaned-mappings", lager.Data{"count": len(result.Orphaned), "confirmed": result.Confirmed, "mappings": result.Orphaned, "report-only": r.reportOnly})
+	if r.reportOnly || len(confirmed) == 0 {
+		return result, nil
+	}
+
+	toDelete := confirmed
+	if r.maxDeletes > 0 && len(toDelete) > r.maxDeletes {
+		logger.Info("delete-cap-reached", lager.Data{"orphaned": len(toDelete), "max-deletes": r.maxDeletes})
+		toDelete = toDelete[:r.maxDeletes]
+	}
+
+	err = withRoutingAPIToken(r.tokenProvider, r.routingAPIClient, func() error {
+		return r.routingAPIClient.DeleteTcpRouteMappings(toDelete)
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Deleted = len(toDelete)
+	logger.Info("deleted-orphaned-mappings", lager.Data{"count": result.Deleted})
+
+	err = r.metronClient.IncrementCounterWithDelta(deletedOrphanedMappingsCounter, uint64(result.Deleted))
+	if err != nil {
+		logger.Error("cannot-send-deleted-orphaned-mappings-metric", err)
+	}
+
+	return result, nil
+}
+
+type tcpMappingKey struct {
+	routerGroupGUID string
+	externalPort    uint16
+	hostIP          string
+	hostPort        uint16
+	sniHostname     string
+}
+
+func keyForTCPMapping(mapping models.TcpRouteMapping) tcpMappingKey {
+	return tcpMappingKey{
+		routerGroupGUID: mapping.RouterGroupGuid,
+		externalPort:    mapping.ExternalPort,
+		hostIP:          mapping.HostIP,
+		hostPort:        mapping.HostPort,
+		sniHostname:     routingtable.MappingSniHostname(mapping),
+	}
+}
+
+func (k tcpMappingKey) less(other tcpMappingKey) bool {
+	if k.routerGroupGUID != other.routerGroupGUID {
+		return k.routerGroupGUID < other.routerGroupGUID
+	}
+	if k.externalPort != other.externalPort {
+		return k.externalPort < other.externalPort
+	}
+	if k.hostIP != other.hostIP {
+		return k.hostIP < other.hostIP
+	}
+	if k.hostPort != other.hostPort {
+		return k.hostPort < other.hostPort
+	}
+	return k.sniHostname < other.sniHostname
+}
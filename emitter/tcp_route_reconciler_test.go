@@ -0,0 +1,254 @@
+package emitter_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/emitter"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/routingtable/fakeroutingtable"
+	tpfakes "code.cloudfoundry.org/route-emitter/tokenprovider/fakes"
+	"code.cloudfoundry.org/routing-api/fake_routing_api"
+	apimodels "code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("TCPRouteReconciler", func() {
+	var (
+		logger           *lagertest.TestLogger
+		clock            *fakeclock.FakeClock
+		routingAPIClient *fake_routing_api.FakeClient
+		tokenProvider    *tpfakes.FakeTokenProvider
+		fakeMetronClient *mfakes.FakeIngressClient
+		table            *fakeroutingtable.FakeRoutingTable
+		synced           bool
+		routerGroups     []string
+		maxDeletes       int
+		reportOnly       bool
+		reconciler       *emitter.TCPRouteReconciler
+
+		desired, orphanA, orphanB, foreign apimodels.TcpRouteMapping
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		routingAPIClient = new(fake_routing_api.FakeClient)
+		tokenProvider = &tpfakes.FakeTokenProvider{}
+		tokenProvider.AccessTokenReturns("accesstoken", nil)
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		table = &fakeroutingtable.FakeRoutingTable{}
+		synced = true
+		routerGroups = nil
+		maxDeletes = 0
+		reportOnly = false
+
+		desired = apimodels.NewTcpRouteMapping("rg-1", 61000, "1.1.1.1", 62000, 120)
+		orphanA = apimodels.NewTcpRouteMapping("rg-1", 61001, "1.1.1.1", 62001, 120)
+		orphanB = apimodels.NewTcpRouteMapping("rg-1", 61002, "1.1.1.1", 62002, 120)
+		foreign = apimodels.NewTcpRouteMapping("rg-other", 61003, "1.1.1.1", 62003, 120)
+
+		table.GetExternalRoutingEventsReturns(routingtable.TCPRouteMappings{
+			Registrations: []apimodels.TcpRouteMapping{apimodels.NewTcpRouteMapping("rg-1", 61000, "1.1.1.1", 62000, 0)},
+		}, routingtable.MessagesToEmit{})
+		routingAPIClient.TcpRouteMappingsReturns([]apimodels.TcpRouteMapping{orphanB, desired, foreign, orphanA}, nil)
+	})
+
+	JustBeforeEach(func() {
+		reconciler = emitter.NewTCPRouteReconciler(
+			logger,
+			clock,
+			time.Minute,
+			table,
+			func() bool { return synced },
+			routingAPIClient,
+			tokenProvider,
+			fakeMetronClient,
+			routerGroups,
+			maxDeletes,
+			reportOnly,
+		)
+	})
+
+	It("reports the mappings of known router groups without a matching endpoint", func() {
+		result, err := reconciler.Reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Orphaned).To(Equal([]apimodels.TcpRouteMapping{orphanA, orphanB}))
+	})
+
+	It("does not delete mappings found orphaned for the first time", func() {
+		result, err := reconciler.Reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Confirmed).To(Equal(0))
+		Expect(result.Deleted).To(Equal(0))
+		Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+	})
+
+	It("deletes mappings found orphaned in two consecutive reconciliations", func() {
+		_, err := reconciler.Reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		result, err := reconciler.Reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Orphaned).To(Equal([]apimodels.TcpRouteMapping{orphanA, orphanB}))
+		Expect(result.Confirmed).To(Equal(2))
+		Expect(result.Deleted).To(Equal(2))
+
+		Expect(routingAPIClient.SetTokenArgsForCall(0)).To(Equal("accesstoken"))
+		Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+		Expect(routingAPIClient.DeleteTcpRouteMappingsArgsForCall(0)).To(Equal([]apimodels.TcpRouteMapping{orphanA, orphanB}))
+	})
+
+	Context("when an orphaned mapping is found in the routing table by the next reconciliation", func() {
+		It("is not deleted", func() {
+			_, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+
+			table.GetExternalRoutingEventsReturns(routingtable.TCPRouteMappings{
+				Registrations: []apimodels.TcpRouteMapping{
+					apimodels.NewTcpRouteMapping("rg-1", 61000, "1.1.1.1", 62000, 0),
+					apimodels.NewTcpRouteMapping("rg-1", 61001, "1.1.1.1", 62001, 0),
+				},
+			}, routingtable.MessagesToEmit{})
+
+			result, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Orphaned).To(Equal([]apimodels.TcpRouteMapping{orphanB}))
+			Expect(routingAPIClient.DeleteTcpRouteMappingsArgsForCall(0)).To(Equal([]apimodels.TcpRouteMapping{orphanB}))
+		})
+	})
+
+	Context("when a reconciliation fails in between", func() {
+		It("starts confirming the orphaned mappings over", func() {
+			_, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+
+			routingAPIClient.TcpRouteMappingsReturns(nil, errors.New("boom"))
+			_, err = reconciler.Reconcile()
+			Expect(err).To(HaveOccurred())
+
+			routingAPIClient.TcpRouteMappingsReturns([]apimodels.TcpRouteMapping{orphanB, desired, foreign, orphanA}, nil)
+			result, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Deleted).To(Equal(0))
+			Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+		})
+	})
+
+	It("emits the number of orphaned and deleted mappings", func() {
+		_, err := reconciler.Reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconciler.Reconcile()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(2))
+		name, value, _ := fakeMetronClient.SendMetricArgsForCall(1)
+		Expect(name).To(Equal("OrphanedTCPRouteMappings"))
+		Expect(value).To(Equal(2))
+
+		Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+		name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+		Expect(name).To(Equal("OrphanedTCPRouteMappingsDeleted"))
+		Expect(delta).To(BeEquivalentTo(2))
+	})
+
+	Context("when a router group is listed explicitly", func() {
+		BeforeEach(func() {
+			routerGroups = []string{"rg-other"}
+		})
+
+		It("reconciles its mappings as well", func() {
+			result, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Orphaned).To(Equal([]apimodels.TcpRouteMapping{orphanA, orphanB, foreign}))
+		})
+	})
+
+	Context("when more mappings are orphaned than may be deleted", func() {
+		BeforeEach(func() {
+			maxDeletes = 1
+		})
+
+		It("deletes only up to the cap", func() {
+			_, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			result, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Deleted).To(Equal(1))
+			Expect(routingAPIClient.DeleteTcpRouteMappingsArgsForCall(0)).To(Equal([]apimodels.TcpRouteMapping{orphanA}))
+			Expect(logger).To(gbytes.Say("delete-cap-reached"))
+		})
+	})
+
+	Context("in report-only mode", func() {
+		BeforeEach(func() {
+			reportOnly = true
+		})
+
+		It("reports the orphaned mappings without deleting them", func() {
+			_, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			result, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Orphaned).To(HaveLen(2))
+			Expect(result.Deleted).To(Equal(0))
+			Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+			Expect(logger).To(gbytes.Say("found-orphaned-mappings"))
+		})
+	})
+
+	Context("when the routing table has not been synced yet", func() {
+		BeforeEach(func() {
+			synced = false
+		})
+
+		It("does nothing", func() {
+			result, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Orphaned).To(BeEmpty())
+			Expect(routingAPIClient.TcpRouteMappingsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when listing the mappings fails", func() {
+		BeforeEach(func() {
+			routingAPIClient.TcpRouteMappingsReturns(nil, errors.New("boom"))
+		})
+
+		It("retries with a fresh token and returns the error", func() {
+			_, err := reconciler.Reconcile()
+			Expect(err).To(MatchError("boom"))
+			Expect(tokenProvider.AccessTokenCallCount()).To(Equal(2))
+			Expect(tokenProvider.AccessTokenArgsForCall(1)).To(BeTrue())
+			Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Run", func() {
+		It("reconciles every interval", func() {
+			signals := make(chan os.Signal)
+			ready := make(chan struct{})
+			done := make(chan error)
+			go func() {
+				done <- reconciler.Run(signals, ready)
+			}()
+			Eventually(ready).Should(BeClosed())
+
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(routingAPIClient.TcpRouteMappingsCallCount).Should(Equal(1))
+			Consistently(routingAPIClient.DeleteTcpRouteMappingsCallCount).Should(Equal(0))
+
+			clock.Increment(time.Minute)
+			Eventually(routingAPIClient.DeleteTcpRouteMappingsCallCount).Should(Equal(1))
+
+			signals <- os.Interrupt
+			Eventually(done).Should(Receive(BeNil()))
+		})
+	})
+})
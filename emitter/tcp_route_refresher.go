@@ -0,0 +1,243 @@
+package emitter
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+const (
+	refreshedTCPRouteMappingsCounter = "TCPRouteMappingsRefreshed"
+	tcpRouteRefreshDuration          = "TCPRouteRefreshDuration"
+
+	// tcpRouteRefreshBatchSize is the number of mappings upserted per
+	// routing API request
+	tcpRouteRefreshBatchSize = 100
+
+	// tcpRouteRefreshRetries is how many times batches that failed to be
+	// upserted are retried before the next refresh. The retries are spread
+	// evenly over the refresh interval.
+	tcpRouteRefreshRetries = 2
+)
+
+// TCPRouteRefresher re-upserts the TCP route mappings of the routing table at
+// a fixed interval, a fraction of the mappings' TTL, so that they do not
+// expire when the NATS based emit cycle stalls. Batches of mappings are
+// upserted by at most concurrency workers at a time, and batches that fail
+// are retried within the interval.
+//
+// Only the registrations of the external routing events are refreshed, TCP
+// mappings of internal routes are not. Mappings are not validated against
+// the router groups here, that is left to the routing API emitter, which
+// drops invalid mappings when it was created with a RouterGroupValidator.
+type TCPRouteRefresher struct {
+	logger            lager.Logger
+	clock             clock.Clock
+	interval          time.Duration
+	routingTable      routingtable.RoutingTable
+	synced            func() bool
+	routingAPIEmitter RoutingAPIEmitter
+	metronClient      loggingclient.IngressClient
+	concurrency       int
+
+	failed  [][]models.TcpRouteMapping
+	retries int
+}
+
+func NewTCPRouteRefresher(
+	logger lager.Logger,
+	clock clock.Clock,
+	interval time.Duration,
+	routingTable routingtable.RoutingTable,
+	synced func() bool,
+	routingAPIEmitter RoutingAPIEmitter,
+	metronClient loggingclient.IngressClient,
+	concurrency int,
+) *TCPRouteRefresher {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &TCPRouteRefresher{
+		logger:            logger.Session("tcp-route-refresher"),
+		clock:             clock,
+		interval:          interval,
+		routingTable:      routingTable,
+		synced:            synced,
+		routingAPIEmitter: routingAPIEmitter,
+		metronClient:      metronClient,
+		concurrency:       concurrency,
+	}
+}
+
+func (r *TCPRouteRefresher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.logger.Info("starting", lager.Data{"interval": r.interval.String(), "concurrency": r.concurrency})
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var retryTimer clock.Timer
+	var retryC <-chan time.Time
+	stopRetrying := func() {
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+		retryTimer, retryC = nil, nil
+	}
+	defer stopRetrying()
+
+	scheduleRetry := func() {
+		if len(r.failed) == 0 || r.retries >= tcpRouteRefreshRetries {
+			return
+		}
+		retryTimer = r.clock.NewTimer(r.interval / (tcpRouteRefreshRetries + 1))
+		retryC = retryTimer.C()
+	}
+
+	close(ready)
+	r.logger.Info("started")
+
+	for {
+		select {
+		case <-ticker.C():
+			stopRetrying()
+			_, err := r.Refresh()
+			if err != nil {
+				r.logger.Error("failed-to-refresh", err)
+			}
+			scheduleRetry()
+		case <-retryC:
+			stopRetrying()
+			_, err := r.Retry()
+			if err != nil {
+				r.logger.Error("failed-to-retry", err, lager.Data{"retry": r.retries})
+			}
+			scheduleRetry()
+		case <-signals:
+			r.logger.Info("stopping")
+			return nil
+		}
+	}
+}
+
+// Refresh upserts all the TCP route mappings of the routing table and returns
+// how many were refreshed. The batches that failed are remembered for Retry.
+// Refresh and Retry are not safe for concurrent use.
+func (r *TCPRouteRefresher) Refresh() (int, error) {
+	logger := r.logger.Session("refresh")
+	r.failed = nil
+	r.retries = 0
+
+	if !r.synced() {
+		logger.Info("skipping-until-synced")
+		return 0, nil
+	}
+
+	mappings, _ := r.routingTable.GetExternalRoutingEvents()
+	if len(mappings.Registrations) == 0 {
+		return 0, nil
+	}
+
+	batches := [][]models.TcpRouteMapping{}
+	registrations := mappings.Registrations
+	for len(registrations) > 0 {
+		size := tcpRouteRefreshBatchSize
+		if size > len(registrations) {
+			size = len(registrations)
+		}
+		batches = append(batches, registrations[:size])
+		registrations = registrations[size:]
+	}
+
+	start := r.clock.Now()
+	refreshed, err := r.upsert(logger, batches)
+
+	sendErr := r.metronClient.SendDuration(tcpRouteRefreshDuration, r.clock.Since(start))
+	if sendErr != nil {
+		logger.Error("cannot-send-refresh-duration-metric", sendErr)
+	}
+
+	return refreshed, err
+}
+
+// Retry upserts the batches that failed during the last Refresh or Retry
+// again and returns how many mappings were refreshed
+func (r *TCPRouteRefresher) Retry() (int, error) {
+	if len(r.failed) == 0 {
+		return 0, nil
+	}
+
+	r.retries++
+	logger := r.logger.Session("retry", lager.Data{"retry": r.retries})
+	return r.upsert(logger, r.failed)
+}
+
+func (r *TCPRouteRefresher) upsert(logger lager.Logger, batches [][]models.TcpRouteMapping) (int, error) {
+	queue := make(chan []models.TcpRouteMapping)
+	go func() {
+		defer close(queue)
+		for _, batch := range batches {
+			queue <- batch
+		}
+	}()
+
+	var (
+		lock   sync.Mutex
+		wg     sync.WaitGroup
+		failed [][]models.TcpRouteMapping
+		errs   = map[string]struct{}{}
+	)
+
+	for i := 0; i < r.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				err := r.routingAPIEmitter.Emit(routingtable.TCPRouteMappings{Registrations: batch})
+				if err == nil {
+					continue
+				}
+
+				lock.Lock()
+				failed = append(failed, batch)
+				errs[err.Error()] = struct{}{}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	r.failed = failed
+
+	total, failedCount := 0, 0
+	for _, batch := range batches {
+		total += len(batch)
+	}
+	for _, batch := range failed {
+		failedCount += len(batch)
+	}
+	refreshed := total - failedCount
+
+	err := r.metronClient.IncrementCounterWithDelta(refreshedTCPRouteMappingsCounter, uint64(refreshed))
+	if err != nil {
+		logger.Error("cannot-send-refreshed-mappings-metric", err)
+	}
+
+	if len(failed) > 0 {
+		messages := make([]string, 0, len(errs))
+		for message := range errs {
+			messages = append(messages, message)
+		}
+		sort.Strings(messages)
+		return refreshed, fmt.Errorf("failed to refresh %d of %d tcp route mappings: %s", failedCount, total, strings.Join(messages, "; "))
+	}
+
+	logger.Debug("refreshed-mappings", lager.Data{"count": refreshed})
+	return refreshed, nil
+}
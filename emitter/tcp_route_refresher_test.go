@@ -0,0 +1,238 @@
+package emitter_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/emitter"
+	"code.cloudfoundry.org/route-emitter/emitter/fakes"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/routingtable/fakeroutingtable"
+	apimodels "code.cloudfoundry.org/routing-api/models"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("TCPRouteRefresher", func() {
+	var (
+		logger            *lagertest.TestLogger
+		clock             *fakeclock.FakeClock
+		table             *fakeroutingtable.FakeRoutingTable
+		routingAPIEmitter *fakes.FakeRoutingAPIEmitter
+		fakeMetronClient  *mfakes.FakeIngressClient
+		synced            bool
+		concurrency       int
+		refresher         *emitter.TCPRouteRefresher
+		mappings          []apimodels.TcpRouteMapping
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		table = &fakeroutingtable.FakeRoutingTable{}
+		routingAPIEmitter = &fakes.FakeRoutingAPIEmitter{}
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		synced = true
+		concurrency = 2
+
+		mappings = []apimodels.TcpRouteMapping{}
+		for i := 0; i < 250; i++ {
+			mappings = append(mappings, apimodels.NewTcpRouteMapping("rg-1", uint16(61000+i), "1.1.1.1", uint16(62000+i), 0))
+		}
+		table.GetExternalRoutingEventsReturns(routingtable.TCPRouteMappings{Registrations: mappings}, routingtable.MessagesToEmit{})
+	})
+
+	JustBeforeEach(func() {
+		refresher = emitter.NewTCPRouteRefresher(
+			logger,
+			clock,
+			time.Minute,
+			table,
+			func() bool { return synced },
+			routingAPIEmitter,
+			fakeMetronClient,
+			concurrency,
+		)
+	})
+
+	It("upserts every mapping of the routing table in batches", func() {
+		refreshed, err := refresher.Refresh()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refreshed).To(Equal(250))
+
+		Expect(routingAPIEmitter.EmitCallCount()).To(Equal(3))
+		emitted := []apimodels.TcpRouteMapping{}
+		for i := 0; i < 3; i++ {
+			batch := routingAPIEmitter.EmitArgsForCall(i)
+			Expect(len(batch.Registrations)).To(BeNumerically("<=", 100))
+			Expect(batch.Unregistrations).To(BeEmpty())
+			emitted = append(emitted, batch.Registrations...)
+		}
+		Expect(emitted).To(ConsistOf(mappings))
+
+		Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+		name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+		Expect(name).To(Equal("TCPRouteMappingsRefreshed"))
+		Expect(delta).To(BeEquivalentTo(250))
+		Expect(fakeMetronClient.SendDurationCallCount()).To(Equal(1))
+		name, _, _ = fakeMetronClient.SendDurationArgsForCall(0)
+		Expect(name).To(Equal("TCPRouteRefreshDuration"))
+	})
+
+	It("upserts at most concurrency batches at a time", func() {
+		var (
+			lock             sync.Mutex
+			inFlight, maxRun int
+		)
+		release := make(chan struct{})
+		routingAPIEmitter.EmitStub = func(routingtable.TCPRouteMappings) error {
+			lock.Lock()
+			inFlight++
+			if inFlight > maxRun {
+				maxRun = inFlight
+			}
+			lock.Unlock()
+
+			<-release
+
+			lock.Lock()
+			inFlight--
+			lock.Unlock()
+			return nil
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			refresher.Refresh()
+		}()
+
+		Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(2))
+		Consistently(routingAPIEmitter.EmitCallCount).Should(Equal(2))
+		close(release)
+		Eventually(done).Should(BeClosed())
+
+		Expect(routingAPIEmitter.EmitCallCount()).To(Equal(3))
+		Expect(maxRun).To(Equal(2))
+	})
+
+	Context("when upserting a batch fails", func() {
+		BeforeEach(func() {
+			routingAPIEmitter.EmitReturnsOnCall(0, errors.New("boom"))
+			concurrency = 1
+		})
+
+		It("keeps refreshing the other batches and reports the failures", func() {
+			refreshed, err := refresher.Refresh()
+			Expect(err).To(MatchError("failed to refresh 100 of 250 tcp route mappings: boom"))
+			Expect(refreshed).To(Equal(150))
+			Expect(routingAPIEmitter.EmitCallCount()).To(Equal(3))
+		})
+
+		It("reports every distinct failure", func() {
+			routingAPIEmitter.EmitReturnsOnCall(2, errors.New("bang"))
+
+			refreshed, err := refresher.Refresh()
+			Expect(err).To(MatchError("failed to refresh 150 of 250 tcp route mappings: bang; boom"))
+			Expect(refreshed).To(Equal(100))
+		})
+
+		It("upserts only the failed batches when retrying", func() {
+			_, err := refresher.Refresh()
+			Expect(err).To(HaveOccurred())
+
+			refreshed, err := refresher.Retry()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refreshed).To(Equal(100))
+			Expect(routingAPIEmitter.EmitCallCount()).To(Equal(4))
+			Expect(routingAPIEmitter.EmitArgsForCall(3).Registrations).To(Equal(routingAPIEmitter.EmitArgsForCall(0).Registrations))
+
+			refreshed, err = refresher.Retry()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refreshed).To(Equal(0))
+			Expect(routingAPIEmitter.EmitCallCount()).To(Equal(4))
+		})
+	})
+
+	Context("when the routing table has not been synced yet", func() {
+		BeforeEach(func() {
+			synced = false
+		})
+
+		It("does nothing", func() {
+			refreshed, err := refresher.Refresh()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refreshed).To(Equal(0))
+			Expect(routingAPIEmitter.EmitCallCount()).To(Equal(0))
+			Expect(logger).To(gbytes.Say("skipping-until-synced"))
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(refresher)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("refreshes the mappings every interval", func() {
+			Consistently(routingAPIEmitter.EmitCallCount).Should(Equal(0))
+
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(3))
+
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(6))
+		})
+
+		Context("when upserting batches fails", func() {
+			BeforeEach(func() {
+				routingAPIEmitter.EmitReturns(errors.New("boom"))
+			})
+
+			It("retries the failed batches within the interval", func() {
+				clock.WaitForWatcherAndIncrement(time.Minute)
+				Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(3))
+				Eventually(logger).Should(gbytes.Say("failed-to-refresh"))
+
+				clock.WaitForNWatchersAndIncrement(20*time.Second, 2)
+				Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(6))
+				Eventually(logger).Should(gbytes.Say("failed-to-retry"))
+
+				clock.WaitForNWatchersAndIncrement(20*time.Second, 2)
+				Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(9))
+
+				clock.WaitForWatcherAndIncrement(10 * time.Second)
+				Consistently(routingAPIEmitter.EmitCallCount).Should(Equal(9))
+
+				clock.WaitForWatcherAndIncrement(10 * time.Second)
+				Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(12))
+			})
+
+			It("stops retrying once the batches have been upserted", func() {
+				clock.WaitForWatcherAndIncrement(time.Minute)
+				Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(3))
+
+				routingAPIEmitter.EmitReturns(nil)
+				clock.WaitForNWatchersAndIncrement(20*time.Second, 2)
+				Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(6))
+
+				clock.WaitForWatcherAndIncrement(20 * time.Second)
+				Consistently(routingAPIEmitter.EmitCallCount).Should(Equal(6))
+			})
+		})
+	})
+})
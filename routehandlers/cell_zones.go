@@ -0,0 +1,44 @@
+package routehandlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"code.cloudfoundry.org/bbs/models"
+)
+
+// CellZones maps cell IDs to availability zones. It fills in the zone of
+// actual LRPs running on cells that do not report one.
+type CellZones map[string]string
+
+// LoadCellZones reads a JSON object of cell IDs to availability zones
+func LoadCellZones(path string) (CellZones, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	zones := CellZones{}
+	err = json.Unmarshal(data, &zones)
+	if err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+// resolve returns the actual LRP with its availability zone looked up by its
+// cell ID, if it has none. The actual LRP is copied rather than modified.
+func (zones CellZones) resolve(actualLRP *models.ActualLRP) *models.ActualLRP {
+	if actualLRP == nil || actualLRP.AvailabilityZone != "" {
+		return actualLRP
+	}
+
+	zone, ok := zones[actualLRP.CellId]
+	if !ok {
+		return actualLRP
+	}
+
+	resolved := *actualLRP
+	resolved.AvailabilityZone = zone
+	return &resolved
+}
@@ -0,0 +1,109 @@
+package routehandlers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/bbs/models"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/emitter/fakes"
+	"code.cloudfoundry.org/route-emitter/routehandlers"
+	"code.cloudfoundry.org/route-emitter/routingtable/fakeroutingtable"
+	ufakes "code.cloudfoundry.org/route-emitter/unregistration/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CellZones", func() {
+	Describe("LoadCellZones", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "cell-zones")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("reads the zone of every cell", func() {
+			path := filepath.Join(dir, "cell_zones.json")
+			Expect(ioutil.WriteFile(path, []byte(`{"cell-1": "z1", "cell-2": "z2"}`), 0644)).To(Succeed())
+
+			zones, err := routehandlers.LoadCellZones(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zones).To(Equal(routehandlers.CellZones{"cell-1": "z1", "cell-2": "z2"}))
+		})
+
+		It("fails when the file is not valid json", func() {
+			path := filepath.Join(dir, "cell_zones.json")
+			Expect(ioutil.WriteFile(path, []byte(`cell-1: z1`), 0644)).To(Succeed())
+
+			_, err := routehandlers.LoadCellZones(path)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails when the file does not exist", func() {
+			_, err := routehandlers.LoadCellZones(filepath.Join(dir, "missing.json"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("resolving zones of actual LRP events", func() {
+		var (
+			fakeTable    *fakeroutingtable.FakeRoutingTable
+			routeHandler *routehandlers.Handler
+			actualLRP    *models.ActualLRP
+		)
+
+		BeforeEach(func() {
+			fakeTable = &fakeroutingtable.FakeRoutingTable{}
+			routeHandler = routehandlers.NewHandler(
+				fakeTable,
+				&fakes.FakeNATSEmitter{},
+				nil,
+				false,
+				&mfakes.FakeIngressClient{},
+				&ufakes.FakeCache{},
+				routehandlers.HandlerOptions{CellZones: routehandlers.CellZones{"cell-1": "z1"}},
+			)
+
+			actualLRP = &models.ActualLRP{
+				ActualLRPKey:         models.NewActualLRPKey("process-guid", 0, "domain"),
+				ActualLRPInstanceKey: models.NewActualLRPInstanceKey("instance-guid", "cell-1"),
+				ActualLRPNetInfo:     models.NewActualLRPNetInfo("1.1.1.1", "2.2.2.2", models.ActualLRPNetInfo_PreferredAddressHost, models.NewPortMapping(11000, 11)),
+				State:                models.ActualLRPStateRunning,
+			}
+		})
+
+		It("sets the zone of the cell on actual LRPs without one", func() {
+			routeHandler.HandleEvent(lagertest.NewTestLogger("test"), models.NewActualLRPInstanceCreatedEvent(actualLRP))
+
+			Expect(fakeTable.AddEndpointCallCount()).To(Equal(1))
+			_, lrp := fakeTable.AddEndpointArgsForCall(0)
+			Expect(lrp.AvailabilityZone).To(Equal("z1"))
+			Expect(actualLRP.AvailabilityZone).To(BeEmpty())
+		})
+
+		It("keeps the zone reported by the actual LRP", func() {
+			actualLRP.AvailabilityZone = "z2"
+			routeHandler.HandleEvent(lagertest.NewTestLogger("test"), models.NewActualLRPInstanceCreatedEvent(actualLRP))
+
+			_, lrp := fakeTable.AddEndpointArgsForCall(0)
+			Expect(lrp.AvailabilityZone).To(Equal("z2"))
+		})
+
+		It("leaves actual LRPs on unknown cells without a zone", func() {
+			actualLRP.ActualLRPInstanceKey = models.NewActualLRPInstanceKey("instance-guid", "cell-2")
+			routeHandler.HandleEvent(lagertest.NewTestLogger("test"), models.NewActualLRPInstanceCreatedEvent(actualLRP))
+
+			_, lrp := fakeTable.AddEndpointArgsForCall(0)
+			Expect(lrp.AvailabilityZone).To(BeEmpty())
+		})
+	})
+})
@@ -2,6 +2,7 @@ package routehandlers
 
 import (
 	"errors"
+	"sync/atomic"
 
 	"code.cloudfoundry.org/bbs/models"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
@@ -24,14 +25,32 @@ const (
 type Handler struct {
 	routingTable        routingtable.RoutingTable
 	natsEmitter         emitter.NATSEmitter
+	periodicNATSEmitter emitter.NATSEmitter
 	routingAPIEmitter   emitter.RoutingAPIEmitter
 	localMode           bool
 	metronClient        loggingclient.IngressClient
 	unregistrationCache unregistration.Cache
+	cellZones           CellZones
+	resendInternal      bool
+	resendTCP           bool
+	synced              int32
 }
 
 var _ watcher.RouteHandler = new(Handler)
 
+// HandlerOptions are the optional dependencies of a Handler.
+// PeriodicNATSEmitter re-registers the whole routing table, the NATS emitter
+// is used when it is nil. CellZones fills in the zone of actual LRPs on cells
+// that do not report one. Internal and TCP unregistrations are only added to
+// the unregistration cache when they are resent, otherwise nothing would
+// ever take them out again.
+type HandlerOptions struct {
+	PeriodicNATSEmitter           emitter.NATSEmitter
+	CellZones                     CellZones
+	ResendInternalUnregistrations bool
+	ResendTCPUnregistrations      bool
+}
+
 func NewHandler(
 	routingTable routingtable.RoutingTable,
 	natsEmitter emitter.NATSEmitter,
@@ -39,14 +58,19 @@ func NewHandler(
 	localMode bool,
 	metronClient loggingclient.IngressClient,
 	unregistrationCache unregistration.Cache,
+	opts HandlerOptions,
 ) *Handler {
 	return &Handler{
 		routingTable:        routingTable,
 		natsEmitter:         natsEmitter,
+		periodicNATSEmitter: opts.PeriodicNATSEmitter,
 		routingAPIEmitter:   routingAPIEmitter,
 		localMode:           localMode,
 		metronClient:        metronClient,
 		unregistrationCache: unregistrationCache,
+		cellZones:           opts.CellZones,
+		resendInternal:      opts.ResendInternalUnregistrations,
+		resendTCP:           opts.ResendTCPUnregistrations,
 	}
 }
 
@@ -67,7 +91,7 @@ func (handler *Handler) HandleEvent(logger lager.Logger, event models.Event) {
 			logger.Error("nil-actual-lrp", nil, lager.Data{"event-type": event.EventType()})
 			return
 		}
-		handler.handleActualCreate(logger, event.ActualLrp)
+		handler.handleActualCreate(logger, handler.cellZones.resolve(event.ActualLrp))
 	case *models.ActualLRPInstanceChangedEvent:
 		before := event.Before.ToActualLRP(event.ActualLRPKey, event.ActualLRPInstanceKey)
 		after := event.After.ToActualLRP(event.ActualLRPKey, event.ActualLRPInstanceKey)
@@ -76,7 +100,7 @@ func (handler *Handler) HandleEvent(logger lager.Logger, event models.Event) {
 			logger.Error("nil-actual-lrp", nil, lager.Data{"event-type": event.EventType()})
 			return
 		}
-		err := handler.handleActualUpdate(logger, before, after)
+		err := handler.handleActualUpdate(logger, handler.cellZones.resolve(before), handler.cellZones.resolve(after))
 		if err != nil {
 			logger.Error("failed-to-handle-actual-update", err)
 		}
@@ -86,7 +110,7 @@ func (handler *Handler) HandleEvent(logger lager.Logger, event models.Event) {
 			logger.Error("nil-actual-lrp", nil, lager.Data{"event-type": event.EventType()})
 			return
 		}
-		handler.handleActualDelete(logger, event.ActualLrp)
+		handler.handleActualDelete(logger, handler.cellZones.resolve(event.ActualLrp))
 	default:
 		logger.Error("did-not-handle-unrecognizable-event", errors.New("unrecognizable-event"), lager.Data{"event-type": event.EventType()})
 	}
@@ -96,10 +120,10 @@ func (handler *Handler) EmitExternal(logger lager.Logger) {
 	routingEvents, messagesToEmit := handler.routingTable.GetExternalRoutingEvents()
 
 	logger.Debug("emitting-nats-messages", lager.Data{"messages": messagesToEmit})
-	if handler.natsEmitter != nil {
-		err := handler.natsEmitter.Emit(messagesToEmit)
+	if natsEmitter := handler.fullTableEmitter(); natsEmitter != nil {
+		result, err := natsEmitter.Emit(messagesToEmit)
 		if err != nil {
-			logger.Error("failed-to-emit-nats-routes", err)
+			logger.Error("failed-to-emit-nats-routes", err, lager.Data{"succeeded": result.Succeeded, "failed": result.Failed})
 		}
 	}
 
@@ -121,14 +145,25 @@ func (handler *Handler) EmitExternal(logger lager.Logger) {
 	}
 }
 
+// fullTableEmitter returns the emitter used to periodically re-register the
+// whole routing table. Messages caused by events are always emitted right away
+// through the nats emitter. When the periodic emitter paces the messages, the
+// result of an emit is that of the batches published since the previous emit.
+func (handler *Handler) fullTableEmitter() emitter.NATSEmitter {
+	if handler.natsEmitter == nil || handler.periodicNATSEmitter == nil {
+		return handler.natsEmitter
+	}
+	return handler.periodicNATSEmitter
+}
+
 func (handler *Handler) EmitInternal(logger lager.Logger) {
 	_, messagesToEmit := handler.routingTable.GetInternalRoutingEvents()
 
 	logger.Debug("emitting-nats-messages", lager.Data{"messages": messagesToEmit})
-	if handler.natsEmitter != nil {
-		err := handler.natsEmitter.Emit(messagesToEmit)
+	if natsEmitter := handler.fullTableEmitter(); natsEmitter != nil {
+		result, err := natsEmitter.Emit(messagesToEmit)
 		if err != nil {
-			logger.Error("failed-to-emit-nats-routes", err)
+			logger.Error("failed-to-emit-nats-routes", err, lager.Data{"succeeded": result.Succeeded, "failed": result.Failed})
 		}
 	}
 }
@@ -145,14 +180,14 @@ func (handler *Handler) Sync(
 	defer logger.Debug("completed")
 
 	nullLogger := lager.NewLogger("null-logger") // ignore log messsages from the routing table
-	newTable := routingtable.NewRoutingTable(false, handler.metronClient)
+	newTable := routingtable.NewRoutingTable(false, handler.metronClient, routingtable.TCPPortConflictNone, nil)
 
 	for _, lrp := range desired {
 		newTable.SetRoutes(nullLogger, nil, lrp)
 	}
 
 	for _, lrp := range actuals {
-		newTable.AddEndpoint(nullLogger, lrp)
+		newTable.AddEndpoint(nullLogger, handler.cellZones.resolve(lrp))
 	}
 
 	natsEmitter := handler.natsEmitter
@@ -178,14 +213,16 @@ func (handler *Handler) Sync(
 		"num-internal-registration-messages":   len(messages.InternalRegistrationMessages),
 		"num-internal-unregistration-messages": len(messages.InternalUnregistrationMessages),
 	})
-	err := handler.unregistrationCache.Add(messages.UnregistrationMessages)
+	err := handler.cacheUnregistrations(messages, routeMappings)
 	if err != nil {
 		logger.Error("failed-to-add-messages-to-cache", err, lager.Data{"messages": messages.UnregistrationMessages})
 	}
-	err = handler.unregistrationCache.Remove(messages.RegistrationMessages)
+	err = handler.uncacheRegistrations(messages, routeMappings)
 	if err != nil {
 		logger.Error("failed-to-remove-messages-from-cache", err, lager.Data{"messages": messages.RegistrationMessages})
 	}
+	handler.unregistrationCache.SyncCompleted()
+	atomic.StoreInt32(&handler.synced, 1)
 	handler.emitMessages(logger, messages, routeMappings)
 	logger.Debug("done-emitting-messages", lager.Data{
 		"num-registration-messages":            len(messages.RegistrationMessages),
@@ -206,6 +243,12 @@ func (handler *Handler) Sync(
 	}
 }
 
+// Synced reports whether the routing table has been synced with the BBS at
+// least once
+func (handler *Handler) Synced() bool {
+	return atomic.LoadInt32(&handler.synced) == 1
+}
+
 func (handler *Handler) RefreshDesired(logger lager.Logger, desiredLRPs []*models.DesiredLRP) {
 	for _, desiredLRP := range desiredLRPs {
 		routeMappings, messagesToEmit := handler.routingTable.SetRoutes(logger, nil, desiredLRP)
@@ -213,6 +256,17 @@ func (handler *Handler) RefreshDesired(logger lager.Logger, desiredLRPs []*model
 	}
 }
 
+// PruneProcess removes the endpoints of a process that are no longer running,
+// and its routes that are no longer desired
+func (handler *Handler) PruneProcess(logger lager.Logger, processGUID string, desiredLRP *models.DesiredLRP, runningActual []*models.ActualLRP) {
+	routeMappings, messagesToEmit := handler.routingTable.PruneProcess(logger, processGUID, desiredLRP, runningActual)
+	err := handler.cacheUnregistrations(messagesToEmit, routeMappings)
+	if err != nil {
+		logger.Error("failed-to-add-messages-to-cache", err, lager.Data{"messages": messagesToEmit.UnregistrationMessages})
+	}
+	handler.emitMessages(logger, messagesToEmit, routeMappings)
+}
+
 func (handler *Handler) ShouldRefreshDesired(actualLRP *models.ActualLRP) bool {
 	return !handler.routingTable.HasExternalRoutes(actualLRP)
 }
@@ -224,11 +278,11 @@ func (handler *Handler) handleDesiredCreate(logger lager.Logger, desiredLRP *mod
 
 func (handler *Handler) handleDesiredUpdate(logger lager.Logger, before, after *models.DesiredLRP) error {
 	routeMappings, messagesToEmit := handler.routingTable.SetRoutes(logger, before, after)
-	err := handler.unregistrationCache.Add(messagesToEmit.UnregistrationMessages)
+	err := handler.cacheUnregistrations(messagesToEmit, routeMappings)
 	if err != nil {
 		return err
 	}
-	err = handler.unregistrationCache.Remove(messagesToEmit.RegistrationMessages)
+	err = handler.uncacheRegistrations(messagesToEmit, routeMappings)
 	if err != nil {
 		return err
 	}
@@ -266,7 +320,7 @@ func (handler *Handler) handleActualUpdate(logger lager.Logger, before, after *m
 	case before.State == models.ActualLRPStateRunning && after.State != models.ActualLRPStateRunning:
 		routeMappings, messagesToEmit = handler.routingTable.RemoveEndpoint(logger, before)
 	}
-	err := handler.unregistrationCache.Remove(messagesToEmit.RegistrationMessages)
+	err := handler.uncacheRegistrations(messagesToEmit, routeMappings)
 	if err != nil {
 		return err
 	}
@@ -282,12 +336,45 @@ func (handler *Handler) handleActualDelete(logger lager.Logger, actualLRP *model
 	handler.emitMessages(logger, messagesToEmit, routeMappings)
 }
 
+// cacheUnregistrations records the unregistrations so that they are resent
+// by the unregistration sender
+func (handler *Handler) cacheUnregistrations(messagesToEmit routingtable.MessagesToEmit, routeMappings routingtable.TCPRouteMappings) error {
+	err := handler.unregistrationCache.Add(messagesToEmit.UnregistrationMessages)
+	if err != nil {
+		return err
+	}
+	if handler.resendInternal {
+		err = handler.unregistrationCache.AddInternal(messagesToEmit.InternalUnregistrationMessages)
+		if err != nil {
+			return err
+		}
+	}
+	if handler.resendTCP {
+		return handler.unregistrationCache.AddTCP(routeMappings.Unregistrations)
+	}
+	return nil
+}
+
+// uncacheRegistrations cancels the pending unregistrations of routes that
+// are registered again
+func (handler *Handler) uncacheRegistrations(messagesToEmit routingtable.MessagesToEmit, routeMappings routingtable.TCPRouteMappings) error {
+	err := handler.unregistrationCache.Remove(messagesToEmit.RegistrationMessages)
+	if err != nil {
+		return err
+	}
+	err = handler.unregistrationCache.RemoveInternal(messagesToEmit.InternalRegistrationMessages)
+	if err != nil {
+		return err
+	}
+	return handler.unregistrationCache.RemoveTCP(routeMappings.Registrations)
+}
+
 func (handler *Handler) emitMessages(logger lager.Logger, messagesToEmit routingtable.MessagesToEmit, routeMappings routingtable.TCPRouteMappings) {
 	if handler.natsEmitter != nil {
 		logger.Debug("emit-messages", lager.Data{"messages": messagesToEmit})
-		err := handler.natsEmitter.Emit(messagesToEmit)
+		result, err := handler.natsEmitter.Emit(messagesToEmit)
 		if err != nil {
-			logger.Error("failed-to-emit-http-routes", err)
+			logger.Error("failed-to-emit-http-routes", err, lager.Data{"succeeded": result.Succeeded, "failed": result.Failed})
 		}
 		err = handler.metronClient.IncrementCounterWithDelta(routesRegisteredCounter, messagesToEmit.RouteRegistrationCount())
 		if err != nil {
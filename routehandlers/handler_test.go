@@ -121,7 +121,10 @@ var _ = Describe("Handler", func() {
 
 		fakeUnregistrationCache = &ufakes.FakeCache{}
 
-		routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache)
+		routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, routehandlers.HandlerOptions{
+			ResendInternalUnregistrations: true,
+			ResendTCPUnregistrations:      true,
+		})
 	})
 
 	Context("when an unrecognized event is received", func() {
@@ -308,6 +311,46 @@ var _ = Describe("Handler", func() {
 				})
 			})
 
+			Context("when messages to emit contain internal and tcp unregistrations", func() {
+				var mapping1, mapping2 tcpmodels.TcpRouteMapping
+
+				BeforeEach(func() {
+					mapping1 = tcpmodels.NewTcpRouteMapping("router-group", 61000, "1.1.1.1", 62000, 0)
+					mapping2 = tcpmodels.NewTcpRouteMapping("router-group", 61001, "1.1.1.1", 62001, 0)
+					messagesToEmit := routingtable.MessagesToEmit{
+						InternalUnregistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+						InternalRegistrationMessages:   []routingtable.RegistryMessage{dummyMessageBar},
+					}
+					routeMappings := routingtable.TCPRouteMappings{
+						Registrations:   []tcpmodels.TcpRouteMapping{mapping1},
+						Unregistrations: []tcpmodels.TcpRouteMapping{mapping2},
+					}
+					fakeTable.SetRoutesReturns(routeMappings, messagesToEmit)
+				})
+
+				It("caches them with their own kind", func() {
+					Eventually(fakeUnregistrationCache.AddInternalCallCount).Should(Equal(1))
+					Expect(fakeUnregistrationCache.AddInternalArgsForCall(0)).Should(ConsistOf(dummyMessageFoo))
+					Expect(fakeUnregistrationCache.RemoveInternalArgsForCall(0)).Should(ConsistOf(dummyMessageBar))
+					Expect(fakeUnregistrationCache.AddTCPArgsForCall(0)).Should(ConsistOf(mapping2))
+					Expect(fakeUnregistrationCache.RemoveTCPArgsForCall(0)).Should(ConsistOf(mapping1))
+				})
+
+				Context("when internal and tcp unregistrations are not resent", func() {
+					BeforeEach(func() {
+						routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, routehandlers.HandlerOptions{})
+					})
+
+					It("does not cache them", func() {
+						Eventually(fakeUnregistrationCache.AddCallCount).Should(Equal(1))
+						Expect(fakeUnregistrationCache.AddInternalCallCount()).To(Equal(0))
+						Expect(fakeUnregistrationCache.AddTCPCallCount()).To(Equal(0))
+						Expect(fakeUnregistrationCache.RemoveInternalArgsForCall(0)).Should(ConsistOf(dummyMessageBar))
+						Expect(fakeUnregistrationCache.RemoveTCPArgsForCall(0)).Should(ConsistOf(mapping1))
+					})
+				})
+			})
+
 			Context("when there are diego ssh-keys on the route", func() {
 				BeforeEach(func() {
 					diegoSSHInfo := json.RawMessage([]byte(`{"ssh-key": "ssh-value"}`))
@@ -1075,6 +1118,12 @@ var _ = Describe("Handler", func() {
 				Expect(natsEmitter.EmitCallCount()).Should(Equal(1))
 			})
 
+			It("reports the routing table as synced", func() {
+				Expect(routeHandler.Synced()).To(BeFalse())
+				routeHandler.Sync(logger, desiredLRPs, actualLRPs, domains, nil)
+				Expect(routeHandler.Synced()).To(BeTrue())
+			})
+
 			Context("swapping the new route table", func() {
 				var (
 					registrationMessages, unregistrationMessages []routingtable.RegistryMessage
@@ -1134,11 +1183,20 @@ var _ = Describe("Handler", func() {
 						Expect(fakeUnregistrationCache.AddArgsForCall(0)).Should(BeEmpty())
 					})
 				})
+
+				It("tells the unregistration cache the sync completed after updating it", func() {
+					fakeUnregistrationCache.SyncCompletedStub = func() {
+						defer GinkgoRecover()
+						Expect(fakeUnregistrationCache.RemoveCallCount()).To(Equal(1))
+					}
+					routeHandler.Sync(logger, desiredLRPs, actualLRPs, domains, nil)
+					Expect(fakeUnregistrationCache.SyncCompletedCallCount()).To(Equal(1))
+				})
 			})
 
 			Context("when emitting metrics in localMode", func() {
 				BeforeEach(func() {
-					routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, nil, true, fakeMetronClient, fakeUnregistrationCache)
+					routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, nil, true, fakeMetronClient, fakeUnregistrationCache, routehandlers.HandlerOptions{})
 					fakeTable.HTTPAssociationsCountReturns(5)
 				})
 
@@ -1255,6 +1313,22 @@ var _ = Describe("Handler", func() {
 			Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(registrationMsgs))
 		})
 
+		Context("when a periodic emitter is configured", func() {
+			var periodicEmitter *fakes.FakeNATSEmitter
+
+			BeforeEach(func() {
+				periodicEmitter = &fakes.FakeNATSEmitter{}
+				routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, routehandlers.HandlerOptions{PeriodicNATSEmitter: periodicEmitter})
+			})
+
+			It("emits the registration events through the periodic emitter", func() {
+				routeHandler.EmitExternal(logger)
+				Expect(periodicEmitter.EmitCallCount()).To(Equal(1))
+				Expect(periodicEmitter.EmitArgsForCall(0)).To(Equal(registrationMsgs))
+				Expect(natsEmitter.EmitCallCount()).To(Equal(0))
+			})
+		})
+
 		It("sends a 'routes total' metric", func() {
 			routeHandler.EmitExternal(logger)
 			Eventually(metricChan).Should(Receive(Equal(metric{
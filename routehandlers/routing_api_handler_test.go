@@ -36,7 +36,7 @@ var _ = Describe("RoutingAPIHandler", func() {
 		fakeRoutingAPIEmitter = new(emitterfakes.FakeRoutingAPIEmitter)
 		fakeMetronClient = &mfakes.FakeIngressClient{}
 		fakeUnregistrationCache = &ufakes.FakeCache{}
-		routeHandler = routehandlers.NewHandler(fakeRoutingTable, nil, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache)
+		routeHandler = routehandlers.NewHandler(fakeRoutingTable, nil, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, routehandlers.HandlerOptions{})
 	})
 
 	Describe("DesiredLRP Event", func() {
@@ -566,7 +566,7 @@ var _ = Describe("RoutingAPIHandler", func() {
 						}
 						return nil
 					}
-					routeHandler = routehandlers.NewHandler(fakeRoutingTable, nil, fakeRoutingAPIEmitter, true, fakeMetronClient, fakeUnregistrationCache)
+					routeHandler = routehandlers.NewHandler(fakeRoutingTable, nil, fakeRoutingAPIEmitter, true, fakeMetronClient, fakeUnregistrationCache, routehandlers.HandlerOptions{})
 					fakeRoutingTable.TCPAssociationsCountReturns(1)
 				})
 
@@ -2,6 +2,8 @@ package routingtable
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager"
@@ -44,6 +46,8 @@ type Endpoint struct {
 	Since                 int64
 	ModificationTag       *models.ModificationTag
 	PreferredAddress      models.ActualLRPNetInfo_PreferredAddress
+	CellID                string
+	AvailabilityZone      string
 }
 
 func (e Endpoint) key() EndpointKey {
@@ -83,16 +87,20 @@ func NewEndpoint(
 	}
 }
 
+// ExternalEndpointInfo is a TCP route. Routes with an SNI hostname share
+// their external port with other routes, the router picks the backends by the
+// server name the client sends in its TLS handshake.
 type ExternalEndpointInfo struct {
 	RouterGroupGUID string
 	Port            uint32
+	SniHostname     string
 }
 
 func (info ExternalEndpointInfo) Hash() interface{} {
 	return info
 }
 
-func (info ExternalEndpointInfo) MessageFor(e Endpoint, directInstanceRoute, _ bool) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage) {
+func (info ExternalEndpointInfo) MessageFor(e Endpoint, directInstanceRoute, _ bool, _ *MetricTagResolver) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage) {
 	mapping := tcpmodels.NewTcpRouteMapping(
 		info.RouterGroupGUID,
 		uint16(info.Port),
@@ -109,9 +117,22 @@ func (info ExternalEndpointInfo) MessageFor(e Endpoint, directInstanceRoute, _ b
 			0,
 		)
 	}
+	if info.SniHostname != "" {
+		sniHostname := info.SniHostname
+		mapping.SniHostname = &sniHostname
+	}
 	return nil, &mapping, nil
 }
 
+// MappingSniHostname returns the SNI hostname of a TCP route mapping, or an
+// empty string if it has none
+func MappingSniHostname(mapping tcpmodels.TcpRouteMapping) string {
+	if mapping.SniHostname == nil {
+		return ""
+	}
+	return *mapping.SniHostname
+}
+
 type ExternalEndpointInfos []ExternalEndpointInfo
 
 func NewExternalEndpointInfo(routerGroupGUID string, port uint32) ExternalEndpointInfo {
@@ -121,12 +142,33 @@ func NewExternalEndpointInfo(routerGroupGUID string, port uint32) ExternalEndpoi
 	}
 }
 
+func NewSniExternalEndpointInfo(routerGroupGUID string, port uint32, sniHostname string) ExternalEndpointInfo {
+	return ExternalEndpointInfo{
+		RouterGroupGUID: routerGroupGUID,
+		Port:            port,
+		SniHostname:     sniHostname,
+	}
+}
+
 type Route struct {
 	Hostname         string
 	RouteServiceUrl  string
 	IsolationSegment string
 	LogGUID          string
 	MetricTags       map[string]*models.MetricTagValue
+	// Protocol is the protocol the router speaks to the backends, e.g. http2
+	Protocol string
+	// Options are per route router settings such as the load balancing
+	// algorithm
+	Options map[string]string
+	// Weight is the share of the traffic of the hostname the route gets
+	// relative to the other routes of the hostname, 0 means
+	// DefaultRouteWeight
+	Weight uint32
+	// ProcessGUID and Domain of the desired LRP, they are only used to
+	// resolve metric tags
+	ProcessGUID string
+	Domain      string
 }
 
 type routeHash struct {
@@ -134,6 +176,9 @@ type routeHash struct {
 	RouteServiceUrl  string
 	IsolationSegment string
 	LogGUID          string
+	Protocol         string
+	Options          string
+	Weight           uint32
 }
 
 // route hash is used to find route differences
@@ -144,34 +189,96 @@ func (r Route) Hash() interface{} {
 		RouteServiceUrl:  r.RouteServiceUrl,
 		IsolationSegment: r.IsolationSegment,
 		LogGUID:          r.LogGUID,
+		Protocol:         r.Protocol,
+		Options:          optionsHash(r.Options),
+		Weight:           r.Weight,
 	}
 }
 
-func (r Route) MessageFor(endpoint Endpoint, directInstanceAddress, emitEndpointUpdatedAt bool) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage) {
-	generator := RegistryMessageFor
+// identityHash identifies the route regardless of its weight, protocol and
+// options, a route whose settings change is re-registered rather than
+// unregistered
+func (r Route) identityHash() interface{} {
+	r.Weight = 0
+	r.Protocol = ""
+	r.Options = nil
+	return r.Hash()
+}
+
+// optionsHash flattens route options into a comparable value, keys are
+// sorted so that equal options always hash the same
+func optionsHash(options map[string]string) string {
+	if len(options) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(options))
+	for key, value := range options {
+		pairs = append(pairs, fmt.Sprintf("%q=%q", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (r Route) MessageFor(endpoint Endpoint, directInstanceAddress, emitEndpointUpdatedAt bool, metricTags *MetricTagResolver) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage) {
+	generator := registryMessageFor
 	if endpoint.IsDirectInstanceRoute(directInstanceAddress) {
-		generator = InternalAddressRegistryMessageFor
+		generator = internalAddressRegistryMessageFor
 	}
-	msg := generator(endpoint, r, emitEndpointUpdatedAt)
+	msg := generator(endpoint, r, emitEndpointUpdatedAt, metricTags)
 	return &msg, nil, nil
 }
 
+func (r Route) metricTagContext(endpoint Endpoint) MetricTagContext {
+	return MetricTagContext{
+		Endpoint:         endpoint,
+		ProcessGUID:      r.ProcessGUID,
+		LogGUID:          r.LogGUID,
+		Domain:           r.Domain,
+		IsolationSegment: r.IsolationSegment,
+	}
+}
+
 type InternalRoute struct {
 	Hostname    string
 	ContainerIP string
 	LogGUID     string
+	MetricTags  map[string]*models.MetricTagValue
+	// ProcessGUID and Domain of the desired LRP, they are only used to
+	// resolve metric tags
+	ProcessGUID string
+	Domain      string
+}
+
+type internalRouteHash struct {
+	Hostname    string
+	ContainerIP string
+	LogGUID     string
 }
 
 func (r InternalRoute) Hash() interface{} {
-	return r
+	return internalRouteHash{
+		Hostname:    r.Hostname,
+		ContainerIP: r.ContainerIP,
+		LogGUID:     r.LogGUID,
+	}
 }
 
-func (r InternalRoute) MessageFor(endpoint Endpoint, _, emitEndpointUpdatedAt bool) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage) {
-	generator := InternalEndpointRegistryMessageFor
-	msg := generator(endpoint, r, emitEndpointUpdatedAt)
+func (r InternalRoute) MessageFor(endpoint Endpoint, _, emitEndpointUpdatedAt bool, metricTags *MetricTagResolver) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage) {
+	generator := internalEndpointRegistryMessageFor
+	msg := generator(endpoint, r, emitEndpointUpdatedAt, metricTags)
 	return nil, nil, &msg
 }
 
+func (r InternalRoute) metricTagContext(endpoint Endpoint) MetricTagContext {
+	return MetricTagContext{
+		Endpoint:    endpoint,
+		ProcessGUID: r.ProcessGUID,
+		LogGUID:     r.LogGUID,
+		Domain:      r.Domain,
+	}
+}
+
 func (entry RoutableEndpoints) copy() RoutableEndpoints {
 
 	clone := RoutableEndpoints{
@@ -223,6 +330,8 @@ func NewEndpointsFromActual(actualLRP *models.ActualLRP) []Endpoint {
 				ContainerTlsProxyPort: portMapping.ContainerTlsProxyPort,
 				Since:                 actualLRP.Since,
 				PreferredAddress:      actualLRP.PreferredAddress,
+				CellID:                actualLRP.CellId,
+				AvailabilityZone:      actualLRP.AvailabilityZone,
 			}
 			endpoints = append(endpoints, endpoint)
 		}
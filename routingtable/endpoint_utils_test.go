@@ -31,10 +31,10 @@ var _ = Describe("LRP Utils", func() {
 
 				endpoints := routingtable.NewEndpointsFromActual(actualInfo)
 
-				Expect(endpoints).To(ConsistOf([]routingtable.Endpoint{
+				Expect(endpoints).To(ConsistOf(inCell("cell-id",
 					routingtable.NewEndpoint("instance-guid", models.ActualLRP_Ordinary, "1.1.1.1", "2.2.2.2", 11, 44, models.ActualLRPNetInfo_PreferredAddressHost, &tag),
 					routingtable.NewEndpoint("instance-guid", models.ActualLRP_Ordinary, "1.1.1.1", "2.2.2.2", 66, 99, models.ActualLRPNetInfo_PreferredAddressHost, &tag),
-				}))
+				)))
 			})
 
 			Context("with TLS proxy ports", func() {
@@ -57,14 +57,38 @@ var _ = Describe("LRP Utils", func() {
 
 					endpoints := routingtable.NewEndpointsFromActual(actualInfo)
 
-					Expect(endpoints).To(ConsistOf([]routingtable.Endpoint{
+					Expect(endpoints).To(ConsistOf(inCell("cell-id",
 						newEndpointWithTlsProxyPort("instance-guid", models.ActualLRP_Ordinary, "1.1.1.1", "2.2.2.2", 11, 44, 61004, 61005, models.ActualLRPNetInfo_PreferredAddressInstance, &tag),
 						newEndpointWithTlsProxyPort("instance-guid", models.ActualLRP_Ordinary, "1.1.1.1", "2.2.2.2", 66, 99, 61006, 61007, models.ActualLRPNetInfo_PreferredAddressInstance, &tag),
-					}))
+					)))
 				})
 			})
 		})
 
+		Context("when the actual has an availability zone", func() {
+			It("sets the cell id and availability zone of the endpoints", func() {
+				actualInfo := &models.ActualLRP{
+					ActualLRPKey:         models.NewActualLRPKey("process-guid", 0, "domain"),
+					ActualLRPInstanceKey: models.NewActualLRPInstanceKey("instance-guid", "cell-id"),
+					ActualLRPNetInfo: models.NewActualLRPNetInfo(
+						"1.1.1.1",
+						"2.2.2.2",
+						models.ActualLRPNetInfo_PreferredAddressHost,
+						models.NewPortMapping(11, 44),
+					),
+					Presence:         models.ActualLRP_Ordinary,
+					State:            models.ActualLRPStateRunning,
+					AvailabilityZone: "z1",
+				}
+
+				endpoints := routingtable.NewEndpointsFromActual(actualInfo)
+
+				Expect(endpoints).To(HaveLen(1))
+				Expect(endpoints[0].CellID).To(Equal("cell-id"))
+				Expect(endpoints[0].AvailabilityZone).To(Equal("z1"))
+			})
+		})
+
 		Context("when actual is evacuating", func() {
 			It("builds a map of container port to endpoint", func() {
 				tag := models.ModificationTag{Epoch: "abc", Index: 0}
@@ -86,10 +110,10 @@ var _ = Describe("LRP Utils", func() {
 
 				endpoints := routingtable.NewEndpointsFromActual(actualInfo)
 
-				Expect(endpoints).To(ConsistOf([]routingtable.Endpoint{
+				Expect(endpoints).To(ConsistOf(inCell("cell-id",
 					routingtable.NewEndpoint("instance-guid", models.ActualLRP_Evacuating, "1.1.1.1", "2.2.2.2", 11, 44, models.ActualLRPNetInfo_PreferredAddressHost, &tag),
 					routingtable.NewEndpoint("instance-guid", models.ActualLRP_Evacuating, "1.1.1.1", "2.2.2.2", 66, 99, models.ActualLRPNetInfo_PreferredAddressHost, &tag),
-				}))
+				)))
 			})
 		})
 	})
@@ -215,3 +239,10 @@ func newEndpointWithTlsProxyPort(
 		ModificationTag:       modificationTag,
 	}
 }
+
+func inCell(cellID string, endpoints ...routingtable.Endpoint) []routingtable.Endpoint {
+	for i := range endpoints {
+		endpoints[i].CellID = cellID
+	}
+	return endpoints
+}
@@ -58,6 +58,16 @@ type FakeRoutingTable struct {
 	hTTPAssociationsCountReturnsOnCall map[int]struct {
 		result1 int
 	}
+	HTTPRouteWeightsStub        func() map[string][]routingtable.RouteWeight
+	hTTPRouteWeightsMutex       sync.RWMutex
+	hTTPRouteWeightsArgsForCall []struct {
+	}
+	hTTPRouteWeightsReturns struct {
+		result1 map[string][]routingtable.RouteWeight
+	}
+	hTTPRouteWeightsReturnsOnCall map[int]struct {
+		result1 map[string][]routingtable.RouteWeight
+	}
 	HasExternalRoutesStub        func(*models.ActualLRP) bool
 	hasExternalRoutesMutex       sync.RWMutex
 	hasExternalRoutesArgsForCall []struct {
@@ -79,6 +89,22 @@ type FakeRoutingTable struct {
 	internalAssociationsCountReturnsOnCall map[int]struct {
 		result1 int
 	}
+	PruneProcessStub        func(lager.Logger, string, *models.DesiredLRP, []*models.ActualLRP) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
+	pruneProcessMutex       sync.RWMutex
+	pruneProcessArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 *models.DesiredLRP
+		arg4 []*models.ActualLRP
+	}
+	pruneProcessReturns struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
+	pruneProcessReturnsOnCall map[int]struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
 	RemoveEndpointStub        func(lager.Logger, *models.ActualLRP) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
 	removeEndpointMutex       sync.RWMutex
 	removeEndpointArgsForCall []struct {
@@ -387,6 +413,58 @@ func (fake *FakeRoutingTable) HTTPAssociationsCountReturnsOnCall(i int, result1
 	}{result1}
 }
 
+func (fake *FakeRoutingTable) HTTPRouteWeights() map[string][]routingtable.RouteWeight {
+	fake.hTTPRouteWeightsMutex.Lock()
+	ret, specificReturn := fake.hTTPRouteWeightsReturnsOnCall[len(fake.hTTPRouteWeightsArgsForCall)]
+	fake.hTTPRouteWeightsArgsForCall = append(fake.hTTPRouteWeightsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("HTTPRouteWeights", []interface{}{})
+	fake.hTTPRouteWeightsMutex.Unlock()
+	if fake.HTTPRouteWeightsStub != nil {
+		return fake.HTTPRouteWeightsStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.hTTPRouteWeightsReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeRoutingTable) HTTPRouteWeightsCallCount() int {
+	fake.hTTPRouteWeightsMutex.RLock()
+	defer fake.hTTPRouteWeightsMutex.RUnlock()
+	return len(fake.hTTPRouteWeightsArgsForCall)
+}
+
+func (fake *FakeRoutingTable) HTTPRouteWeightsCalls(stub func() map[string][]routingtable.RouteWeight) {
+	fake.hTTPRouteWeightsMutex.Lock()
+	defer fake.hTTPRouteWeightsMutex.Unlock()
+	fake.HTTPRouteWeightsStub = stub
+}
+
+func (fake *FakeRoutingTable) HTTPRouteWeightsReturns(result1 map[string][]routingtable.RouteWeight) {
+	fake.hTTPRouteWeightsMutex.Lock()
+	defer fake.hTTPRouteWeightsMutex.Unlock()
+	fake.HTTPRouteWeightsStub = nil
+	fake.hTTPRouteWeightsReturns = struct {
+		result1 map[string][]routingtable.RouteWeight
+	}{result1}
+}
+
+func (fake *FakeRoutingTable) HTTPRouteWeightsReturnsOnCall(i int, result1 map[string][]routingtable.RouteWeight) {
+	fake.hTTPRouteWeightsMutex.Lock()
+	defer fake.hTTPRouteWeightsMutex.Unlock()
+	fake.HTTPRouteWeightsStub = nil
+	if fake.hTTPRouteWeightsReturnsOnCall == nil {
+		fake.hTTPRouteWeightsReturnsOnCall = make(map[int]struct {
+			result1 map[string][]routingtable.RouteWeight
+		})
+	}
+	fake.hTTPRouteWeightsReturnsOnCall[i] = struct {
+		result1 map[string][]routingtable.RouteWeight
+	}{result1}
+}
+
 func (fake *FakeRoutingTable) HasExternalRoutes(arg1 *models.ActualLRP) bool {
 	fake.hasExternalRoutesMutex.Lock()
 	ret, specificReturn := fake.hasExternalRoutesReturnsOnCall[len(fake.hasExternalRoutesArgsForCall)]
@@ -499,6 +577,77 @@ func (fake *FakeRoutingTable) InternalAssociationsCountReturnsOnCall(i int, resu
 	}{result1}
 }
 
+func (fake *FakeRoutingTable) PruneProcess(arg1 lager.Logger, arg2 string, arg3 *models.DesiredLRP, arg4 []*models.ActualLRP) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
+	var arg4Copy []*models.ActualLRP
+	if arg4 != nil {
+		arg4Copy = make([]*models.ActualLRP, len(arg4))
+		copy(arg4Copy, arg4)
+	}
+	fake.pruneProcessMutex.Lock()
+	ret, specificReturn := fake.pruneProcessReturnsOnCall[len(fake.pruneProcessArgsForCall)]
+	fake.pruneProcessArgsForCall = append(fake.pruneProcessArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 *models.DesiredLRP
+		arg4 []*models.ActualLRP
+	}{arg1, arg2, arg3, arg4Copy})
+	fake.recordInvocation("PruneProcess", []interface{}{arg1, arg2, arg3, arg4Copy})
+	fake.pruneProcessMutex.Unlock()
+	if fake.PruneProcessStub != nil {
+		return fake.PruneProcessStub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.pruneProcessReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRoutingTable) PruneProcessCallCount() int {
+	fake.pruneProcessMutex.RLock()
+	defer fake.pruneProcessMutex.RUnlock()
+	return len(fake.pruneProcessArgsForCall)
+}
+
+func (fake *FakeRoutingTable) PruneProcessCalls(stub func(lager.Logger, string, *models.DesiredLRP, []*models.ActualLRP) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)) {
+	fake.pruneProcessMutex.Lock()
+	defer fake.pruneProcessMutex.Unlock()
+	fake.PruneProcessStub = stub
+}
+
+func (fake *FakeRoutingTable) PruneProcessArgsForCall(i int) (lager.Logger, string, *models.DesiredLRP, []*models.ActualLRP) {
+	fake.pruneProcessMutex.RLock()
+	defer fake.pruneProcessMutex.RUnlock()
+	argsForCall := fake.pruneProcessArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeRoutingTable) PruneProcessReturns(result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.pruneProcessMutex.Lock()
+	defer fake.pruneProcessMutex.Unlock()
+	fake.PruneProcessStub = nil
+	fake.pruneProcessReturns = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
+func (fake *FakeRoutingTable) PruneProcessReturnsOnCall(i int, result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.pruneProcessMutex.Lock()
+	defer fake.pruneProcessMutex.Unlock()
+	fake.PruneProcessStub = nil
+	if fake.pruneProcessReturnsOnCall == nil {
+		fake.pruneProcessReturnsOnCall = make(map[int]struct {
+			result1 routingtable.TCPRouteMappings
+			result2 routingtable.MessagesToEmit
+		})
+	}
+	fake.pruneProcessReturnsOnCall[i] = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
 func (fake *FakeRoutingTable) RemoveEndpoint(arg1 lager.Logger, arg2 *models.ActualLRP) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
 	fake.removeEndpointMutex.Lock()
 	ret, specificReturn := fake.removeEndpointReturnsOnCall[len(fake.removeEndpointArgsForCall)]
@@ -872,10 +1021,14 @@ func (fake *FakeRoutingTable) Invocations() map[string][][]interface{} {
 	defer fake.getInternalRoutingEventsMutex.RUnlock()
 	fake.hTTPAssociationsCountMutex.RLock()
 	defer fake.hTTPAssociationsCountMutex.RUnlock()
+	fake.hTTPRouteWeightsMutex.RLock()
+	defer fake.hTTPRouteWeightsMutex.RUnlock()
 	fake.hasExternalRoutesMutex.RLock()
 	defer fake.hasExternalRoutesMutex.RUnlock()
 	fake.internalAssociationsCountMutex.RLock()
 	defer fake.internalAssociationsCountMutex.RUnlock()
+	fake.pruneProcessMutex.RLock()
+	defer fake.pruneProcessMutex.RUnlock()
 	fake.removeEndpointMutex.RLock()
 	defer fake.removeEndpointMutex.RUnlock()
 	fake.removeRoutesMutex.RLock()
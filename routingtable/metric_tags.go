@@ -0,0 +1,158 @@
+package routingtable
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"code.cloudfoundry.org/bbs/models"
+)
+
+// Keys of the dynamic metric tag values resolved by the emitter. Operators
+// add tags with these values to every registration by mapping tag names to
+// them, see NewMetricTagResolver. They are independent of the dynamic values
+// of the BBS, of which only INDEX and INSTANCE_GUID exist.
+const (
+	MetricTagValueIndex            = "index"
+	MetricTagValueInstanceGUID     = "instance_guid"
+	MetricTagValueCellID           = "cell_id"
+	MetricTagValueAvailabilityZone = "availability_zone"
+	MetricTagValueProcessGUID      = "process_guid"
+	MetricTagValueLogGUID          = "log_guid"
+	MetricTagValueDomain           = "domain"
+	MetricTagValueContainerPort    = "container_port"
+	MetricTagValueIsolationSegment = "isolation_segment"
+)
+
+const componentTag = "component"
+
+// MetricTagContext is what dynamic metric tag values are resolved from
+type MetricTagContext struct {
+	Endpoint         Endpoint
+	ProcessGUID      string
+	LogGUID          string
+	Domain           string
+	IsolationSegment string
+}
+
+// MetricTagValueFunc returns the value of a dynamic metric tag
+type MetricTagValueFunc func(MetricTagContext) string
+
+// MetricTagResolver fills in the tags of registry messages. The dynamic
+// values of the metric tags of a desired LRP are resolved first. Then the
+// operator defined dynamic tags, resolved by the function registered for
+// their value key, and the operator defined static tags are added; they
+// cannot be overridden by the metric tags of a desired LRP.
+type MetricTagResolver struct {
+	values      map[string]MetricTagValueFunc
+	staticTags  map[string]string
+	dynamicTags map[string]string
+}
+
+var defaultMetricTagResolver = NewMetricTagResolver(nil, nil)
+
+// NewMetricTagResolver returns a resolver adding staticTags and dynamicTags,
+// which map tag names to the key of their value, e.g. "zone" to
+// MetricTagValueAvailabilityZone, to every registry message
+func NewMetricTagResolver(staticTags, dynamicTags map[string]string) *MetricTagResolver {
+	return &MetricTagResolver{
+		values: map[string]MetricTagValueFunc{
+			MetricTagValueIndex: func(c MetricTagContext) string {
+				return strconv.FormatInt(int64(c.Endpoint.Index), 10)
+			},
+			MetricTagValueInstanceGUID: func(c MetricTagContext) string {
+				return c.Endpoint.InstanceGUID
+			},
+			MetricTagValueCellID: func(c MetricTagContext) string {
+				return c.Endpoint.CellID
+			},
+			MetricTagValueAvailabilityZone: func(c MetricTagContext) string {
+				return c.Endpoint.AvailabilityZone
+			},
+			MetricTagValueProcessGUID: func(c MetricTagContext) string {
+				return c.ProcessGUID
+			},
+			MetricTagValueLogGUID: func(c MetricTagContext) string {
+				return c.LogGUID
+			},
+			MetricTagValueDomain: func(c MetricTagContext) string {
+				return c.Domain
+			},
+			MetricTagValueContainerPort: func(c MetricTagContext) string {
+				return strconv.FormatUint(uint64(c.Endpoint.ContainerPort), 10)
+			},
+			MetricTagValueIsolationSegment: func(c MetricTagContext) string {
+				return c.IsolationSegment
+			},
+		},
+		staticTags:  staticTags,
+		dynamicTags: dynamicTags,
+	}
+}
+
+// Register resolves the value key with valueFunc, replacing the function
+// registered for it before, so that operators can map tags to it. It must
+// not be called once the resolver is in use.
+func (r *MetricTagResolver) Register(key string, valueFunc MetricTagValueFunc) {
+	r.values[key] = valueFunc
+}
+
+// Validate returns an error if an operator defined dynamic tag refers to a
+// value key that is not registered
+func (r *MetricTagResolver) Validate() error {
+	unknown := []string{}
+	for name, key := range r.dynamicTags {
+		if _, ok := r.values[key]; !ok {
+			unknown = append(unknown, fmt.Sprintf("%s: %s", name, key))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown dynamic metric tag values %v", unknown)
+	}
+	return nil
+}
+
+// Tags resolves the metric tags of a desired LRP. Dynamic values unknown to
+// the BBS resolve to an empty string. A nil resolver resolves the tags
+// without operator defined tags.
+func (r *MetricTagResolver) Tags(input map[string]*models.MetricTagValue, context MetricTagContext) map[string]string {
+	if r == nil {
+		r = defaultMetricTagResolver
+	}
+
+	tags := map[string]string{}
+	for k, v := range input {
+		if v == nil {
+			continue
+		}
+
+		var value string
+		switch v.Dynamic {
+		case models.MetricTagDynamicValueIndex:
+			value = r.value(MetricTagValueIndex, context)
+		case models.MetricTagDynamicValueInstanceGuid:
+			value = r.value(MetricTagValueInstanceGUID, context)
+		default:
+			if v.Dynamic <= 0 {
+				value = v.Static
+			}
+		}
+		tags[k] = value
+	}
+	for k, key := range r.dynamicTags {
+		tags[k] = r.value(key, context)
+	}
+	for k, v := range r.staticTags {
+		tags[k] = v
+	}
+	tags[componentTag] = "route-emitter"
+	return tags
+}
+
+func (r *MetricTagResolver) value(key string, context MetricTagContext) string {
+	if valueFunc, ok := r.values[key]; ok {
+		return valueFunc(context)
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package routingtable_test
+
+import (
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetricTagResolver", func() {
+	var (
+		context routingtable.MetricTagContext
+		input   map[string]*models.MetricTagValue
+	)
+
+	BeforeEach(func() {
+		context = routingtable.MetricTagContext{
+			Endpoint: routingtable.Endpoint{
+				InstanceGUID:     "instance-guid",
+				Index:            2,
+				ContainerPort:    8080,
+				CellID:           "cell-id",
+				AvailabilityZone: "z1",
+			},
+			ProcessGUID:      "process-guid",
+			LogGUID:          "log-guid",
+			Domain:           "domain",
+			IsolationSegment: "isolation-segment",
+		}
+
+		input = map[string]*models.MetricTagValue{
+			"static":        {Static: "value"},
+			"index":         {Dynamic: models.MetricTagDynamicValueIndex},
+			"instance_guid": {Dynamic: models.MetricTagDynamicValueInstanceGuid},
+		}
+	})
+
+	It("resolves the dynamic values of the BBS", func() {
+		tags := routingtable.NewMetricTagResolver(nil, nil).Tags(input, context)
+		Expect(tags).To(Equal(map[string]string{
+			"static":        "value",
+			"index":         "2",
+			"instance_guid": "instance-guid",
+			"component":     "route-emitter",
+		}))
+	})
+
+	It("resolves the dynamic values without a resolver", func() {
+		var resolver *routingtable.MetricTagResolver
+		Expect(resolver.Tags(input, context)).To(Equal(routingtable.NewMetricTagResolver(nil, nil).Tags(input, context)))
+	})
+
+	It("adds the operator defined dynamic tags, overriding the tags of the desired LRP", func() {
+		resolver := routingtable.NewMetricTagResolver(nil, map[string]string{
+			"index":             routingtable.MetricTagValueIndex,
+			"instance":          routingtable.MetricTagValueInstanceGUID,
+			"cell":              routingtable.MetricTagValueCellID,
+			"zone":              routingtable.MetricTagValueAvailabilityZone,
+			"process_guid":      routingtable.MetricTagValueProcessGUID,
+			"log_guid":          routingtable.MetricTagValueLogGUID,
+			"domain":            routingtable.MetricTagValueDomain,
+			"container_port":    routingtable.MetricTagValueContainerPort,
+			"isolation_segment": routingtable.MetricTagValueIsolationSegment,
+			"static":            routingtable.MetricTagValueDomain,
+		})
+		Expect(resolver.Validate()).To(Succeed())
+
+		tags := resolver.Tags(input, context)
+		Expect(tags).To(Equal(map[string]string{
+			"static":            "domain",
+			"index":             "2",
+			"instance_guid":     "instance-guid",
+			"instance":          "instance-guid",
+			"cell":              "cell-id",
+			"zone":              "z1",
+			"process_guid":      "process-guid",
+			"log_guid":          "log-guid",
+			"domain":            "domain",
+			"container_port":    "8080",
+			"isolation_segment": "isolation-segment",
+			"component":         "route-emitter",
+		}))
+	})
+
+	It("adds the static tags, overriding the tags of the desired LRP", func() {
+		resolver := routingtable.NewMetricTagResolver(map[string]string{
+			"deployment": "cf",
+			"static":     "operator-value",
+		}, nil)
+		tags := resolver.Tags(map[string]*models.MetricTagValue{"static": {Static: "value"}}, context)
+		Expect(tags).To(Equal(map[string]string{
+			"deployment": "cf",
+			"static":     "operator-value",
+			"component":  "route-emitter",
+		}))
+	})
+
+	It("always sets the component tag", func() {
+		resolver := routingtable.NewMetricTagResolver(map[string]string{"component": "other"}, map[string]string{"component": routingtable.MetricTagValueDomain})
+		tags := resolver.Tags(map[string]*models.MetricTagValue{"component": {Static: "app"}}, context)
+		Expect(tags).To(Equal(map[string]string{"component": "route-emitter"}))
+	})
+
+	It("resolves registered value keys", func() {
+		resolver := routingtable.NewMetricTagResolver(nil, map[string]string{
+			"custom": "process_instance",
+			"domain": routingtable.MetricTagValueDomain,
+		})
+		Expect(resolver.Validate()).NotTo(Succeed())
+
+		resolver.Register("process_instance", func(c routingtable.MetricTagContext) string {
+			return c.ProcessGUID + "/" + c.Endpoint.InstanceGUID
+		})
+		resolver.Register(routingtable.MetricTagValueDomain, func(c routingtable.MetricTagContext) string {
+			return "custom-" + c.Domain
+		})
+		Expect(resolver.Validate()).To(Succeed())
+
+		tags := resolver.Tags(nil, context)
+		Expect(tags).To(Equal(map[string]string{
+			"custom":    "process-guid/instance-guid",
+			"domain":    "custom-domain",
+			"component": "route-emitter",
+		}))
+	})
+
+	It("rejects dynamic tags with unknown value keys", func() {
+		resolver := routingtable.NewMetricTagResolver(nil, map[string]string{"zone": "az"})
+		Expect(resolver.Validate()).To(MatchError("unknown dynamic metric tag values [zone: az]"))
+	})
+
+	It("resolves dynamic values unknown to the BBS to an empty string", func() {
+		tags := routingtable.NewMetricTagResolver(nil, nil).Tags(map[string]*models.MetricTagValue{
+			"unknown": {Dynamic: 300},
+		}, context)
+		Expect(tags).To(HaveKeyWithValue("unknown", ""))
+	})
+})
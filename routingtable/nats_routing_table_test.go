@@ -1,6 +1,7 @@
 package routingtable_test
 
 import (
+	"encoding/json"
 	"fmt"
 
 	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
@@ -47,6 +48,7 @@ var _ = Describe("RoutingTable", func() {
 		ContainerPort:   8080,
 		Presence:        models.ActualLRP_Ordinary,
 		Since:           1,
+		CellID:          "cell-id",
 		ModificationTag: currentTag,
 	}
 	endpoint2 := routingtable.Endpoint{
@@ -58,6 +60,7 @@ var _ = Describe("RoutingTable", func() {
 		ContainerPort:   8080,
 		Presence:        models.ActualLRP_Ordinary,
 		Since:           2,
+		CellID:          "cell-id",
 		ModificationTag: currentTag,
 	}
 	endpoint3 := routingtable.Endpoint{
@@ -69,6 +72,7 @@ var _ = Describe("RoutingTable", func() {
 		ContainerPort:   8080,
 		Presence:        models.ActualLRP_Ordinary,
 		Since:           3,
+		CellID:          "cell-id",
 		ModificationTag: currentTag,
 	}
 	collisionEndpoint := routingtable.Endpoint{
@@ -79,6 +83,7 @@ var _ = Describe("RoutingTable", func() {
 		Port:            11,
 		ContainerPort:   8080,
 		Presence:        models.ActualLRP_Ordinary,
+		CellID:          "cell-id",
 		ModificationTag: currentTag,
 	}
 	newInstanceEndpointAfterEvacuation := routingtable.Endpoint{
@@ -89,6 +94,7 @@ var _ = Describe("RoutingTable", func() {
 		Port:            55,
 		ContainerPort:   8080,
 		Presence:        models.ActualLRP_Ordinary,
+		CellID:          "cell-id",
 		ModificationTag: currentTag,
 	}
 	evacuating1 := routingtable.Endpoint{
@@ -99,6 +105,7 @@ var _ = Describe("RoutingTable", func() {
 		Port:            11,
 		ContainerPort:   8080,
 		Presence:        models.ActualLRP_Evacuating,
+		CellID:          "cell-id",
 		ModificationTag: currentTag,
 	}
 
@@ -111,7 +118,7 @@ var _ = Describe("RoutingTable", func() {
 		logger = lagertest.NewTestLogger("test-route-emitter")
 
 		fakeMetronClient = &mfakes.FakeIngressClient{}
-		table = routingtable.NewRoutingTable(false, fakeMetronClient)
+		table = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 	})
 
 	runInfo := models.DesiredLRPRunInfo{}
@@ -140,6 +147,33 @@ var _ = Describe("RoutingTable", func() {
 		return createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 	}
 
+	createDesiredLRPWithProtocol := func(protocol string, options map[string]string) *models.DesiredLRP {
+		routingInfo, err := json.Marshal([]map[string]interface{}{{
+			"hostnames": []string{hostname1, hostname2},
+			"port":      key.ContainerPort,
+			"protocol":  protocol,
+			"options":   options,
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		message := json.RawMessage(routingInfo)
+		routes := models.Routes{cfroutes.CF_ROUTER: &message}
+
+		return createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
+	}
+
+	createWeightedDesiredLRP := func(processGUID string, weight uint32) *models.DesiredLRP {
+		routingInfo, err := json.Marshal([]map[string]interface{}{{
+			"hostnames": []string{hostname1, hostname2},
+			"port":      key.ContainerPort,
+			"weight":    weight,
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		message := json.RawMessage(routingInfo)
+		routes := models.Routes{cfroutes.CF_ROUTER: &message}
+
+		return createDesiredLRPWithRoutes(processGUID, 3, routes, logGuid, *currentTag, runInfo)
+	}
+
 	Describe("Evacuating endpoints", func() {
 		BeforeEach(func() {
 			desiredLRP := createDesiredLRP(key.ProcessGUID, int32(3), key.ContainerPort, logGuid, "", *currentTag, models.DesiredLRPRunInfo{}, hostname1)
@@ -193,7 +227,7 @@ var _ = Describe("RoutingTable", func() {
 
 	Context("when internal address message builder is used", func() {
 		BeforeEach(func() {
-			table = routingtable.NewRoutingTable(true, fakeMetronClient)
+			table = routingtable.NewRoutingTable(true, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 			desiredLRP := createDesiredLRP(key.ProcessGUID, int32(3), key.ContainerPort, logGuid, "", *currentTag, models.DesiredLRPRunInfo{}, hostname1)
 			desiredLRP.MetricTags = map[string]*models.MetricTagValue{"foo": &models.MetricTagValue{Static: "bar"}, "doo": &models.MetricTagValue{Dynamic: models.MetricTagDynamicValueIndex}}
 			table.SetRoutes(logger, nil, desiredLRP)
@@ -282,7 +316,7 @@ var _ = Describe("RoutingTable", func() {
 	Describe("Swap", func() {
 		Context("when we have existing stuff in the table and an unfresh domain", func() {
 			BeforeEach(func() {
-				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 
 				routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 				desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
@@ -292,7 +326,7 @@ var _ = Describe("RoutingTable", func() {
 
 				table.Swap(logger, tempTable, domains)
 
-				tempTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				routes = createRoutingInfo(key.ContainerPort, []string{hostname1, hostname3}, []string{internalHostname2}, "", []uint32{}, "")
 				desiredLRP = createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 				tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -323,7 +357,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("subsequent swaps with still not fresh domain", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					desiredLRP := createDesiredLRP(key.ProcessGUID, int32(3), key.ContainerPort, logGuid, "", *currentTag, models.DesiredLRPRunInfo{}, hostname1, hostname3)
 					lrp := createActualLRP(key, endpoint1, domain)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -340,7 +374,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("subsequent swaps with fresh", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					desiredLRP := createDesiredLRP(key.ProcessGUID, int32(3), key.ContainerPort, logGuid, "", *currentTag, models.DesiredLRPRunInfo{}, hostname1, hostname3)
 					lrp := createActualLRP(key, endpoint1, domain)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -362,7 +396,7 @@ var _ = Describe("RoutingTable", func() {
 		Context("when a new routing key arrives", func() {
 			Context("when the routing key has both routes and endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
@@ -411,7 +445,7 @@ var _ = Describe("RoutingTable", func() {
 			Context("when the process only has routes", func() {
 				var desiredLRP *models.DesiredLRP
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{internalHostname1}, "", []uint32{}, "")
 					desiredLRP = createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -425,7 +459,7 @@ var _ = Describe("RoutingTable", func() {
 
 				Context("when the endpoints subsequently arrive", func() {
 					BeforeEach(func() {
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						lrp := createActualLRP(key, endpoint1, domain)
 						tempTable.SetRoutes(logger, nil, desiredLRP)
 						tempTable.AddEndpoint(logger, lrp)
@@ -457,7 +491,7 @@ var _ = Describe("RoutingTable", func() {
 
 				Context("when the routing key subsequently disappears", func() {
 					BeforeEach(func() {
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						_, messagesToEmit = table.Swap(logger, tempTable, domains)
 					})
 
@@ -469,7 +503,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the process only has endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					lrp := createActualLRP(key, endpoint1, domain)
 					tempTable.AddEndpoint(logger, lrp)
 
@@ -482,7 +516,7 @@ var _ = Describe("RoutingTable", func() {
 
 				Context("when the routes subsequently arrive", func() {
 					BeforeEach(func() {
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{internalHostname1}, "", []uint32{}, "")
 						desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 						lrp := createActualLRP(key, endpoint1, domain)
@@ -515,7 +549,7 @@ var _ = Describe("RoutingTable", func() {
 
 				Context("when the endpoint subsequently disappears", func() {
 					BeforeEach(func() {
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						_, messagesToEmit = table.Swap(logger, tempTable, domains)
 					})
 
@@ -532,7 +566,7 @@ var _ = Describe("RoutingTable", func() {
 			)
 
 			BeforeEach(func() {
-				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				desiredLRP = createDesiredLRPWithIS("isolation-segment-1")
 				tempTable.SetRoutes(logger, nil, desiredLRP)
 				lrp := createActualLRP(key, endpoint1, domain)
@@ -564,7 +598,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the isolation segment changes in sync", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					desiredLRP := createDesiredLRPWithIS("isolation-segment-2")
 					tempTable.SetRoutes(logger, nil, desiredLRP)
 					lrp := createActualLRP(key, endpoint1, domain)
@@ -588,13 +622,187 @@ var _ = Describe("RoutingTable", func() {
 			})
 		})
 
+		Context("when there is an existing routing key with a protocol and options", func() {
+			var (
+				desiredLRP *models.DesiredLRP
+				options    map[string]string
+			)
+
+			BeforeEach(func() {
+				options = map[string]string{"loadbalancing": "least-connection"}
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
+				desiredLRP = createDesiredLRPWithProtocol("http1", options)
+				tempTable.SetRoutes(logger, nil, desiredLRP)
+				lrp := createActualLRP(key, endpoint1, domain)
+				tempTable.AddEndpoint(logger, lrp)
+				table.Swap(logger, tempTable, domains)
+			})
+
+			It("includes them in the registrations", func() {
+				_, messagesToEmit = table.GetExternalRoutingEvents()
+				Expect(messagesToEmit.RegistrationMessages).To(HaveLen(2))
+				for _, message := range messagesToEmit.RegistrationMessages {
+					Expect(message.Protocol).To(Equal("http1"))
+					Expect(message.Options).To(Equal(options))
+				}
+			})
+
+			Context("when the protocol changes in an event", func() {
+				BeforeEach(func() {
+					afterDesiredLRP := createDesiredLRPWithProtocol("http2", options)
+					afterDesiredLRP.ModificationTag.Index++
+					_, messagesToEmit = table.SetRoutes(logger, desiredLRP, afterDesiredLRP)
+				})
+
+				It("re-registers the routes without unregistering them", func() {
+					expected := routingtable.MessagesToEmit{
+						RegistrationMessages: []routingtable.RegistryMessage{
+							routingtable.RegistryMessageFor(endpoint1, routingtable.Route{Hostname: hostname1, LogGUID: logGuid, Protocol: "http2", Options: options}, false),
+							routingtable.RegistryMessageFor(endpoint1, routingtable.Route{Hostname: hostname2, LogGUID: logGuid, Protocol: "http2", Options: options}, false),
+						},
+					}
+					Expect(messagesToEmit).To(MatchMessagesToEmit(expected))
+				})
+			})
+
+			Context("when the options change in an event", func() {
+				BeforeEach(func() {
+					afterDesiredLRP := createDesiredLRPWithProtocol("http1", map[string]string{"loadbalancing": "round-robin"})
+					afterDesiredLRP.ModificationTag.Index++
+					_, messagesToEmit = table.SetRoutes(logger, desiredLRP, afterDesiredLRP)
+				})
+
+				It("re-registers the routes without unregistering them", func() {
+					Expect(messagesToEmit.RegistrationMessages).To(HaveLen(2))
+					Expect(messagesToEmit.UnregistrationMessages).To(BeEmpty())
+					Expect(messagesToEmit.RegistrationMessages[0].Options).To(Equal(map[string]string{"loadbalancing": "round-robin"}))
+				})
+			})
+
+			Context("when the routes do not change", func() {
+				BeforeEach(func() {
+					afterDesiredLRP := createDesiredLRPWithProtocol("http1", map[string]string{"loadbalancing": "least-connection"})
+					afterDesiredLRP.ModificationTag.Index++
+					_, messagesToEmit = table.SetRoutes(logger, desiredLRP, afterDesiredLRP)
+				})
+
+				It("emits nothing", func() {
+					Expect(messagesToEmit).To(BeZero())
+				})
+			})
+		})
+
+		Context("when there is an existing routing key with a weighted route", func() {
+			var (
+				desiredLRP *models.DesiredLRP
+			)
+
+			BeforeEach(func() {
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
+				desiredLRP = createWeightedDesiredLRP(key.ProcessGUID, 9)
+				tempTable.SetRoutes(logger, nil, desiredLRP)
+				lrp := createActualLRP(key, endpoint1, domain)
+				tempTable.AddEndpoint(logger, lrp)
+				table.Swap(logger, tempTable, domains)
+			})
+
+			Context("when the weight changes in an event", func() {
+				BeforeEach(func() {
+					afterDesiredLRP := createWeightedDesiredLRP(key.ProcessGUID, 5)
+					afterDesiredLRP.ModificationTag.Index++
+					_, messagesToEmit = table.SetRoutes(logger, desiredLRP, afterDesiredLRP)
+				})
+
+				It("re-registers the routes without unregistering them", func() {
+					expected := routingtable.MessagesToEmit{
+						RegistrationMessages: []routingtable.RegistryMessage{
+							routingtable.RegistryMessageFor(endpoint1, routingtable.Route{Hostname: hostname1, LogGUID: logGuid, Weight: 5}, false),
+							routingtable.RegistryMessageFor(endpoint1, routingtable.Route{Hostname: hostname2, LogGUID: logGuid, Weight: 5}, false),
+						},
+					}
+					Expect(messagesToEmit).To(MatchMessagesToEmit(expected))
+					Expect(messagesToEmit.RegistrationMessages[0].Weight).To(BeEquivalentTo(5))
+				})
+			})
+
+			Context("when another process guid maps the same hostnames", func() {
+				canaryKey := routingtable.RoutingKey{ProcessGUID: "canary-process-guid", ContainerPort: 8080}
+
+				BeforeEach(func() {
+					table.SetRoutes(logger, nil, createWeightedDesiredLRP(canaryKey.ProcessGUID, 1))
+					table.AddEndpoint(logger, createActualLRP(canaryKey, endpoint2, domain))
+					table.AddEndpoint(logger, createActualLRP(canaryKey, endpoint3, domain))
+				})
+
+				It("reports the share of the traffic of each process guid", func() {
+					weights := table.HTTPRouteWeights()
+					Expect(weights).To(HaveKey(hostname1))
+					Expect(weights).To(HaveKey(hostname2))
+
+					hostnameWeights := weights[hostname1]
+					Expect(hostnameWeights).To(HaveLen(2))
+
+					Expect(hostnameWeights[0].ProcessGUID).To(Equal(canaryKey.ProcessGUID))
+					Expect(hostnameWeights[0].Weight).To(BeEquivalentTo(1))
+					Expect(hostnameWeights[0].Instances).To(Equal(2))
+					Expect(hostnameWeights[0].Percentage).To(BeNumerically("~", 18.18, 0.01))
+
+					Expect(hostnameWeights[1].ProcessGUID).To(Equal(key.ProcessGUID))
+					Expect(hostnameWeights[1].Weight).To(BeEquivalentTo(9))
+					Expect(hostnameWeights[1].Instances).To(Equal(1))
+					Expect(hostnameWeights[1].Percentage).To(BeNumerically("~", 81.82, 0.01))
+				})
+			})
+
+			Context("when routes of the hostname have context paths", func() {
+				pathKey := routingtable.RoutingKey{ProcessGUID: "path-process-guid", ContainerPort: 8080}
+				otherPathKey := routingtable.RoutingKey{ProcessGUID: "other-path-process-guid", ContainerPort: 8080}
+
+				BeforeEach(func() {
+					table.SetRoutes(logger, nil, createDesiredLRP(pathKey.ProcessGUID, 3, pathKey.ContainerPort, logGuid, "", *currentTag, runInfo, hostname1+"/api"))
+					table.AddEndpoint(logger, createActualLRP(pathKey, endpoint2, domain))
+					table.SetRoutes(logger, nil, createDesiredLRP(otherPathKey.ProcessGUID, 3, otherPathKey.ContainerPort, logGuid, "", *currentTag, runInfo, "FOO.example.com/API/"))
+					table.AddEndpoint(logger, createActualLRP(otherPathKey, endpoint3, domain))
+				})
+
+				It("reports the share of the traffic per hostname and context path", func() {
+					weights := table.HTTPRouteWeights()
+					Expect(weights).To(HaveKey(hostname1))
+					Expect(weights).To(HaveKey(hostname1 + "/api"))
+					Expect(weights).NotTo(HaveKey("FOO.example.com/API/"))
+
+					hostnameWeights := weights[hostname1]
+					Expect(hostnameWeights).To(HaveLen(1))
+					Expect(hostnameWeights[0].ProcessGUID).To(Equal(key.ProcessGUID))
+					Expect(hostnameWeights[0].Percentage).To(BeNumerically("~", 100, 0.01))
+
+					pathWeights := weights[hostname1+"/api"]
+					Expect(pathWeights).To(HaveLen(2))
+					Expect(pathWeights[0].ProcessGUID).To(Equal(otherPathKey.ProcessGUID))
+					Expect(pathWeights[0].Percentage).To(BeNumerically("~", 50, 0.01))
+					Expect(pathWeights[1].ProcessGUID).To(Equal(pathKey.ProcessGUID))
+					Expect(pathWeights[1].Percentage).To(BeNumerically("~", 50, 0.01))
+				})
+			})
+
+			It("uses the default weight for routes that do not set one", func() {
+				table.SetRoutes(logger, nil, createWeightedDesiredLRP("other-process-guid", 0))
+				table.AddEndpoint(logger, createActualLRP(routingtable.RoutingKey{ProcessGUID: "other-process-guid", ContainerPort: 8080}, endpoint2, domain))
+
+				hostnameWeights := table.HTTPRouteWeights()[hostname1]
+				Expect(hostnameWeights).To(HaveLen(2))
+				Expect(hostnameWeights[0].Weight).To(BeEquivalentTo(routingtable.DefaultRouteWeight))
+				Expect(hostnameWeights[0].Percentage).To(BeNumerically("~", 10, 0.01))
+			})
+		})
+
 		Context("when there is an existing routing key with a route service url", func() {
 			var (
 				desiredLRP *models.DesiredLRP
 			)
 
 			BeforeEach(func() {
-				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				desiredLRP = createDesiredLRPWithFixtures("https://rs.example.com")
 				tempTable.SetRoutes(logger, nil, desiredLRP)
 				lrp := createActualLRP(key, endpoint1, domain)
@@ -626,7 +834,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the route service url changes during sync", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					desiredLRP := createDesiredLRPWithFixtures("https://rs.new.example.com")
 					tempTable.SetRoutes(logger, nil, desiredLRP)
 					lrp1 := createActualLRP(key, endpoint1, domain)
@@ -652,7 +860,7 @@ var _ = Describe("RoutingTable", func() {
 
 		Context("when the routing key has an evacuating and instance endpoint", func() {
 			BeforeEach(func() {
-				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 				desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 				tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -699,7 +907,7 @@ var _ = Describe("RoutingTable", func() {
 
 		Context("when there is an existing routing key", func() {
 			BeforeEach(func() {
-				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 				desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 				tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -713,7 +921,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when nothing changes", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -732,7 +940,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key gets new routes", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2, hostname3}, []string{internalHostname1, internalHostname2}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -777,7 +985,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key without any route service url gets routes with a new route service url", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "https://rs.example.com", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -810,7 +1018,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key gets new endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -849,7 +1057,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key gets a new evacuating endpoint", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -869,7 +1077,7 @@ var _ = Describe("RoutingTable", func() {
 
 				Context("when running instance is removed", func() {
 					BeforeEach(func() {
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 						desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 						tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -889,7 +1097,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key gets new routes and endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2, hostname3}, []string{internalHostname1, internalHostname2}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -958,7 +1166,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key loses routes", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -1003,7 +1211,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key loses endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -1037,7 +1245,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key loses http/internal routes and endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -1081,7 +1289,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key gains routes but loses endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2, hostname3}, []string{internalHostname1, internalHostname2}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -1129,7 +1337,7 @@ var _ = Describe("RoutingTable", func() {
 
 			Context("when the routing key loses routes but gains endpoints", func() {
 				BeforeEach(func() {
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{}, "", []uint32{}, "")
 					desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 					tempTable.SetRoutes(logger, nil, desiredLRP)
@@ -1182,7 +1390,7 @@ var _ = Describe("RoutingTable", func() {
 				var domainSet models.DomainSet
 
 				BeforeEach(func() {
-					tempTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				})
 
 				JustBeforeEach(func() {
@@ -1300,7 +1508,7 @@ var _ = Describe("RoutingTable", func() {
 				Context("when the original registration had no routes, and then the routing key loses endpoints", func() {
 					BeforeEach(func() {
 						//override previous set up
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						lrp1 := createActualLRP(key, endpoint1, domain)
 						tempTable.AddEndpoint(logger, lrp1)
 						lrp2 := createActualLRP(key, endpoint2, domain)
@@ -1308,7 +1516,7 @@ var _ = Describe("RoutingTable", func() {
 						_, messagesToEmit = table.Swap(logger, tempTable, domains)
 						Expect(messagesToEmit.InternalUnregistrationMessages).To(HaveLen(2))
 
-						tempTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						lrp1 = createActualLRP(key, endpoint1, domain)
 						tempTable.AddEndpoint(logger, lrp1)
 						_, messagesToEmit = table.Swap(logger, tempTable, domains)
@@ -1322,12 +1530,12 @@ var _ = Describe("RoutingTable", func() {
 				Context("when the original registration had no endpoints, and then the routing key loses a route", func() {
 					BeforeEach(func() {
 						//override previous set up
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						desiredLRP := createDesiredLRP(key.ProcessGUID, int32(3), key.ContainerPort, logGuid, "", *currentTag, models.DesiredLRPRunInfo{}, hostname1, hostname2)
 						tempTable.SetRoutes(logger, nil, desiredLRP)
 						table.Swap(logger, tempTable, domains)
 
-						tempTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						desiredLRP = createDesiredLRP(key.ProcessGUID, int32(3), key.ContainerPort, logGuid, "", *currentTag, models.DesiredLRPRunInfo{}, hostname1)
 						tempTable.SetRoutes(logger, nil, desiredLRP)
 						_, messagesToEmit = table.Swap(logger, tempTable, domains)
@@ -1379,7 +1587,7 @@ var _ = Describe("RoutingTable", func() {
 		Context("when there are both endpoints and routes in the table", func() {
 			var beforeLRP *models.DesiredLRP
 			BeforeEach(func() {
-				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				routes := createRoutingInfo(key.ContainerPort, []string{hostname1, hostname2}, []string{internalHostname1}, "", []uint32{}, "")
 
 				beforeLRP = createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
@@ -1765,7 +1973,7 @@ var _ = Describe("RoutingTable", func() {
 				Context("when there are internal routes", func() {
 					var internalHostname string
 					BeforeEach(func() {
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						internalHostname = "internal"
 						routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{internalHostname}, "", []uint32{}, "")
 
@@ -1914,7 +2122,7 @@ var _ = Describe("RoutingTable", func() {
 					)
 
 					BeforeEach(func() {
-						table = routingtable.NewRoutingTable(false, fakeMetronClient)
+						table = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{internalHostname1}, "", []uint32{}, "")
 
 						beforeLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
@@ -1,11 +1,6 @@
 package routingtable
 
-import (
-	"fmt"
-	"strconv"
-
-	"code.cloudfoundry.org/bbs/models"
-)
+import "fmt"
 
 type RegistryMessage struct {
 	Host                 string            `json:"host"`
@@ -20,9 +15,18 @@ type RegistryMessage struct {
 	IsolationSegment     string            `json:"isolation_segment,omitempty" hash:"ignore"`
 	EndpointUpdatedAtNs  int64             `json:"endpoint_updated_at_ns,omitempty" hash:"ignore"`
 	Tags                 map[string]string `json:"tags,omitempty" hash:"ignore"`
+	Protocol             string            `json:"protocol,omitempty" hash:"ignore"`
+	Options              map[string]string `json:"options,omitempty" hash:"ignore"`
+	Weight               uint32            `json:"weight,omitempty" hash:"ignore"`
+	CellID               string            `json:"cell_id,omitempty" hash:"ignore"`
+	AvailabilityZone     string            `json:"availability_zone,omitempty" hash:"ignore"`
 }
 
 func RegistryMessageFor(endpoint Endpoint, route Route, emitEndpointUpdatedAt bool) RegistryMessage {
+	return registryMessageFor(endpoint, route, emitEndpointUpdatedAt, nil)
+}
+
+func registryMessageFor(endpoint Endpoint, route Route, emitEndpointUpdatedAt bool, metricTags *MetricTagResolver) RegistryMessage {
 	var index string
 	if endpoint.InstanceGUID != "" {
 		index = fmt.Sprintf("%d", endpoint.Index)
@@ -31,7 +35,6 @@ func RegistryMessageFor(endpoint Endpoint, route Route, emitEndpointUpdatedAt bo
 	if !emitEndpointUpdatedAt {
 		since = 0
 	}
-	// route.MetricTags -> Populate Tags
 	return RegistryMessage{
 		URIs:                []string{route.Hostname},
 		Host:                endpoint.Host,
@@ -39,18 +42,27 @@ func RegistryMessageFor(endpoint Endpoint, route Route, emitEndpointUpdatedAt bo
 		TlsPort:             endpoint.TlsProxyPort,
 		App:                 route.LogGUID,
 		IsolationSegment:    route.IsolationSegment,
-		Tags:                populateMetricTags(route.MetricTags, endpoint),
+		Tags:                metricTags.Tags(route.MetricTags, route.metricTagContext(endpoint)),
 		EndpointUpdatedAtNs: since,
 
 		PrivateInstanceId:    endpoint.InstanceGUID,
 		PrivateInstanceIndex: index,
 		ServerCertDomainSAN:  endpoint.InstanceGUID,
 		RouteServiceUrl:      route.RouteServiceUrl,
+		Protocol:             route.Protocol,
+		Options:              route.Options,
+		Weight:               route.Weight,
+		CellID:               endpoint.CellID,
+		AvailabilityZone:     endpoint.AvailabilityZone,
 	}
 }
 
 // This is used when RE is emitting container ip addr/port as opposed to host ip add/port
 func InternalAddressRegistryMessageFor(endpoint Endpoint, route Route, emitEndpointUpdatedAt bool) RegistryMessage {
+	return internalAddressRegistryMessageFor(endpoint, route, emitEndpointUpdatedAt, nil)
+}
+
+func internalAddressRegistryMessageFor(endpoint Endpoint, route Route, emitEndpointUpdatedAt bool, metricTags *MetricTagResolver) RegistryMessage {
 	var index string
 	if endpoint.InstanceGUID != "" {
 		index = fmt.Sprintf("%d", endpoint.Index)
@@ -66,18 +78,27 @@ func InternalAddressRegistryMessageFor(endpoint Endpoint, route Route, emitEndpo
 		TlsPort:          endpoint.ContainerTlsProxyPort,
 		App:              route.LogGUID,
 		IsolationSegment: route.IsolationSegment,
-		Tags:             populateMetricTags(route.MetricTags, endpoint),
+		Tags:             metricTags.Tags(route.MetricTags, route.metricTagContext(endpoint)),
 
 		ServerCertDomainSAN:  endpoint.InstanceGUID,
 		PrivateInstanceId:    endpoint.InstanceGUID,
 		PrivateInstanceIndex: index,
 		EndpointUpdatedAtNs:  since,
 		RouteServiceUrl:      route.RouteServiceUrl,
+		Protocol:             route.Protocol,
+		Options:              route.Options,
+		Weight:               route.Weight,
+		CellID:               endpoint.CellID,
+		AvailabilityZone:     endpoint.AvailabilityZone,
 	}
 }
 
 // This is used to generate registry messages for Internal routes
 func InternalEndpointRegistryMessageFor(endpoint Endpoint, route InternalRoute, emitEndpointUpdatedAt bool) RegistryMessage {
+	return internalEndpointRegistryMessageFor(endpoint, route, emitEndpointUpdatedAt, nil)
+}
+
+func internalEndpointRegistryMessageFor(endpoint Endpoint, route InternalRoute, emitEndpointUpdatedAt bool, metricTags *MetricTagResolver) RegistryMessage {
 	var index string
 	if endpoint.InstanceGUID != "" {
 		index = fmt.Sprintf("%d", endpoint.Index)
@@ -90,7 +111,7 @@ func InternalEndpointRegistryMessageFor(endpoint Endpoint, route InternalRoute,
 		URIs:                []string{route.Hostname, fmt.Sprintf("%s.%s", index, route.Hostname)},
 		Host:                endpoint.ContainerIP,
 		App:                 route.LogGUID,
-		Tags:                map[string]string{"component": "route-emitter"},
+		Tags:                metricTags.Tags(route.MetricTags, route.metricTagContext(endpoint)),
 		EndpointUpdatedAtNs: since,
 
 		PrivateInstanceIndex: index,
@@ -98,28 +119,8 @@ func InternalEndpointRegistryMessageFor(endpoint Endpoint, route InternalRoute,
 }
 
 type ExternalServiceGreetingMessage struct {
-	MinimumRegisterInterval int `json:"minimumRegisterIntervalInSeconds"`
-	PruneThresholdInSeconds int `json:"pruneThresholdInSeconds"`
-}
-
-func populateMetricTags(input map[string]*models.MetricTagValue, endpoint Endpoint) map[string]string {
-	tags := map[string]string{}
-	if input != nil {
-		for k, v := range input {
-			var value string
-			if v.Dynamic > 0 {
-				switch v.Dynamic {
-				case models.MetricTagDynamicValueIndex:
-					value = strconv.FormatInt(int64(endpoint.Index), 10)
-				case models.MetricTagDynamicValueInstanceGuid:
-					value = endpoint.InstanceGUID
-				}
-			} else {
-				value = v.Static
-			}
-			tags[k] = value
-		}
-	}
-	tags["component"] = "route-emitter"
-	return tags
+	ID                      string   `json:"id,omitempty"`
+	Hosts                   []string `json:"hosts,omitempty"`
+	MinimumRegisterInterval int      `json:"minimumRegisterIntervalInSeconds"`
+	PruneThresholdInSeconds int      `json:"pruneThresholdInSeconds"`
 }
@@ -61,6 +61,34 @@ var _ = Describe("RegistryMessage", func() {
 			Expect(message).To(Equal(expectedMessage))
 		})
 
+		Context("when the placement of the endpoint is set", func() {
+			BeforeEach(func() {
+				expectedMessage.CellID = "cell-1"
+				expectedMessage.AvailabilityZone = "z1"
+
+				expectedJSON = `{
+				"host": "1.1.1.1",
+				"port": 61001,
+				"uris": ["host-1.example.com"],
+				"app" : "app-guid",
+				"private_instance_id": "instance-guid",
+				"private_instance_index": "0",
+				"server_cert_domain_san": "instance-guid",
+				"route_service_url": "https://hello.com",
+				"endpoint_updated_at_ns": 1000,
+				"tags": {"component":"route-emitter", "doo": "0", "foo": "bar", "goo": "instance-guid"},
+				"cell_id": "cell-1",
+				"availability_zone": "z1"
+			}`
+			})
+
+			It("marshals the cell id and availability zone", func() {
+				payload, err := json.Marshal(expectedMessage)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(payload).To(MatchJSON(expectedJSON))
+			})
+		})
+
 		Context("when TLS port is set", func() {
 			BeforeEach(func() {
 				expectedMessage.TlsPort = 61007
@@ -137,6 +165,26 @@ var _ = Describe("RegistryMessage", func() {
 			Expect(message).To(Equal(expectedMessage))
 		})
 
+		It("sets the cell id and availability zone of the endpoint", func() {
+			endpoint.CellID = "cell-1"
+			endpoint.AvailabilityZone = "z1"
+			expectedMessage.CellID = "cell-1"
+			expectedMessage.AvailabilityZone = "z1"
+
+			message := routingtable.RegistryMessageFor(endpoint, route, true)
+			Expect(message).To(Equal(expectedMessage))
+		})
+
+		It("sets the protocol and options of the route", func() {
+			route.Protocol = "http2"
+			route.Options = map[string]string{"loadbalancing": "least-connection"}
+			expectedMessage.Protocol = "http2"
+			expectedMessage.Options = map[string]string{"loadbalancing": "least-connection"}
+
+			message := routingtable.RegistryMessageFor(endpoint, route, true)
+			Expect(message).To(Equal(expectedMessage))
+		})
+
 		Context("when instance index is greater than 0", func() {
 			BeforeEach(func() {
 				expectedMessage.PrivateInstanceIndex = "2"
@@ -260,5 +308,19 @@ var _ = Describe("RegistryMessage", func() {
 			message := routingtable.InternalEndpointRegistryMessageFor(endpoint, route, true)
 			Expect(message).To(Equal(expectedMessage))
 		})
+
+		It("resolves the metric tags of the route", func() {
+			route.MetricTags = map[string]*models.MetricTagValue{
+				"app_name": {Static: "some-app"},
+				"index":    {Dynamic: models.MetricTagDynamicValueIndex},
+			}
+
+			message := routingtable.InternalEndpointRegistryMessageFor(endpoint, route, true)
+			Expect(message.Tags).To(Equal(map[string]string{
+				"app_name":  "some-app",
+				"index":     "0",
+				"component": "route-emitter",
+			}))
+		})
 	})
 })
@@ -0,0 +1,84 @@
+package routingtable
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultRouteWeight is the weight of http routes that do not set one
+const DefaultRouteWeight = 1
+
+// RouteWeight is the share of the traffic of a route, a hostname and context
+// path, that the instances of a routing key get. Every instance is registered
+// with the weight of the route, so the share of a routing key is its weight
+// times its instances relative to the other routing keys of the route.
+type RouteWeight struct {
+	ProcessGUID   string  `json:"process_guid"`
+	ContainerPort uint32  `json:"container_port"`
+	Weight        uint32  `json:"weight"`
+	Instances     int     `json:"instances"`
+	Percentage    float64 `json:"percentage"`
+}
+
+// RouteWeightKey returns the key of a route URI in HTTPRouteWeights: its
+// hostname and context path the way the router pools them, case insensitive
+// and without a trailing slash
+func RouteWeightKey(uri string) string {
+	hostname, contextPath := uri, ""
+	if i := strings.Index(uri, "/"); i >= 0 {
+		hostname, contextPath = uri[:i], uri[i:]
+	}
+	return strings.ToLower(hostname) + strings.ToLower(strings.TrimRight(contextPath, "/"))
+}
+
+func (t *routingTable) HTTPRouteWeights() map[string][]RouteWeight {
+	return t.httpRoutesRoutingTable.routeWeights()
+}
+
+func (t *internalRoutingTable) routeWeights() map[string][]RouteWeight {
+	t.Lock()
+	defer t.Unlock()
+
+	weights := map[string][]RouteWeight{}
+	for key, entry := range t.entries {
+		for _, mapping := range entry.Routes {
+			route, ok := mapping.(Route)
+			if !ok {
+				continue
+			}
+
+			weight := route.Weight
+			if weight == 0 {
+				weight = DefaultRouteWeight
+			}
+			routeKey := RouteWeightKey(route.Hostname)
+			weights[routeKey] = append(weights[routeKey], RouteWeight{
+				ProcessGUID:   key.ProcessGUID,
+				ContainerPort: key.ContainerPort,
+				Weight:        weight,
+				Instances:     len(entry.Endpoints),
+			})
+		}
+	}
+
+	for _, routeWeights := range weights {
+		var total uint64
+		for _, w := range routeWeights {
+			total += uint64(w.Weight) * uint64(w.Instances)
+		}
+		for i := range routeWeights {
+			if total > 0 {
+				share := uint64(routeWeights[i].Weight) * uint64(routeWeights[i].Instances)
+				routeWeights[i].Percentage = float64(share) * 100 / float64(total)
+			}
+		}
+		sort.Slice(routeWeights, func(i, j int) bool {
+			if routeWeights[i].ProcessGUID != routeWeights[j].ProcessGUID {
+				return routeWeights[i].ProcessGUID < routeWeights[j].ProcessGUID
+			}
+			return routeWeights[i].ContainerPort < routeWeights[j].ContainerPort
+		})
+	}
+
+	return weights
+}
@@ -1,6 +1,7 @@
 package routingtable
 
 import (
+	"encoding/json"
 	"sync"
 
 	"code.cloudfoundry.org/bbs/models"
@@ -33,6 +34,10 @@ type RoutingTable interface {
 	RemoveRoutes(logger lager.Logger, desiredLRP *models.DesiredLRP) (TCPRouteMappings, MessagesToEmit)
 	AddEndpoint(logger lager.Logger, actualLRP *models.ActualLRP) (TCPRouteMappings, MessagesToEmit)
 	RemoveEndpoint(logger lager.Logger, actualLRP *models.ActualLRP) (TCPRouteMappings, MessagesToEmit)
+	// PruneProcess removes the endpoints of a process that are not among
+	// runningActual, and the routes that desiredLRP, nil when the process is
+	// no longer desired, does not have
+	PruneProcess(logger lager.Logger, processGUID string, desiredLRP *models.DesiredLRP, runningActual []*models.ActualLRP) (TCPRouteMappings, MessagesToEmit)
 	Swap(logger lager.Logger, t RoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit)
 	GetInternalRoutingEvents() (TCPRouteMappings, MessagesToEmit)
 	GetExternalRoutingEvents() (TCPRouteMappings, MessagesToEmit)
@@ -44,6 +49,10 @@ type RoutingTable interface {
 	InternalAssociationsCount() int // return number of associations desired-lrp-internal-routes * 2 * actual-lrps
 	TCPAssociationsCount() int      // return number of associations desired-lrp-tcp-routes * actual-lrps
 	TableSize() int
+
+	// HTTPRouteWeights returns the share of the traffic of every http route
+	// each routing key gets, keyed by RouteWeightKey
+	HTTPRouteWeights() map[string][]RouteWeight
 }
 
 type internalRoutingTable struct {
@@ -55,6 +64,8 @@ type internalRoutingTable struct {
 	directInstanceRoute      bool
 	metronClient             loggingclient.IngressClient
 	suppressAddressCollision bool
+	portClaims               *tcpPortClaims
+	metricTags               *MetricTagResolver
 	sync.Locker
 }
 
@@ -64,7 +75,7 @@ type routingTable struct {
 	internalRoutesRoutingTable *internalRoutingTable
 }
 
-func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.IngressClient) RoutingTable {
+func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.IngressClient, tcpPortConflictPolicy TCPPortConflictPolicy, metricTags *MetricTagResolver) RoutingTable {
 	addressGenerator := func(endpoint Endpoint) Address {
 		if endpoint.IsDirectInstanceRoute(directInstanceRoute) {
 			return Address{Host: endpoint.ContainerIP, Port: endpoint.ContainerPort}
@@ -80,6 +91,7 @@ func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.Ingres
 		directInstanceRoute: directInstanceRoute,
 		addressGenerator:    addressGenerator,
 		metronClient:        metronClient,
+		metricTags:          metricTags,
 		Locker:              &sync.Mutex{},
 	}
 	tcpRoutingTable := &internalRoutingTable{
@@ -91,6 +103,7 @@ func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.Ingres
 		addressGenerator:         addressGenerator,
 		metronClient:             metronClient,
 		suppressAddressCollision: true,
+		portClaims:               newTCPPortClaims(tcpPortConflictPolicy, metronClient),
 		Locker:                   &sync.Mutex{},
 	}
 	internalRoutingTable := &internalRoutingTable{
@@ -102,6 +115,7 @@ func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.Ingres
 		addressGenerator:         addressGenerator,
 		metronClient:             metronClient,
 		suppressAddressCollision: true,
+		metricTags:               metricTags,
 		Locker:                   &sync.Mutex{},
 	}
 
@@ -115,13 +129,15 @@ func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.Ingres
 func internalEndpointsFromActualLRP(actualLRP *models.ActualLRP) []Endpoint {
 	return []Endpoint{
 		{
-			InstanceGUID:    actualLRP.InstanceGuid,
-			Index:           actualLRP.Index,
-			Host:            actualLRP.Address,
-			ContainerIP:     actualLRP.InstanceAddress,
-			Presence:        actualLRP.Presence,
-			Since:           actualLRP.Since,
-			ModificationTag: &actualLRP.ModificationTag,
+			InstanceGUID:     actualLRP.InstanceGuid,
+			Index:            actualLRP.Index,
+			Host:             actualLRP.Address,
+			ContainerIP:      actualLRP.InstanceAddress,
+			Presence:         actualLRP.Presence,
+			Since:            actualLRP.Since,
+			ModificationTag:  &actualLRP.ModificationTag,
+			CellID:           actualLRP.CellId,
+			AvailabilityZone: actualLRP.AvailabilityZone,
 		},
 	}
 }
@@ -158,6 +174,21 @@ func (table *routingTable) RemoveEndpoint(logger lager.Logger, actualLRP *models
 	return mappings, messages
 }
 
+func (t *routingTable) PruneProcess(logger lager.Logger, processGUID string, desiredLRP *models.DesiredLRP, runningActual []*models.ActualLRP) (TCPRouteMappings, MessagesToEmit) {
+	httpMappings, httpMessages, httpChanged := t.httpRoutesRoutingTable.PruneProcess(logger, processGUID, desiredLRP, runningActual)
+	tcpMappings, tcpMessages, tcpChanged := t.tcpRoutesRoutingTable.PruneProcess(logger, processGUID, desiredLRP, runningActual)
+	internalMappings, internalMessages, internalChanged := t.internalRoutesRoutingTable.PruneProcess(logger, processGUID, desiredLRP, runningActual)
+
+	mappings := httpMappings.Merge(tcpMappings).Merge(internalMappings)
+	messages := httpMessages.Merge(tcpMessages).Merge(internalMessages)
+
+	if httpChanged || tcpChanged || internalChanged {
+		logger.Info("pruned-process", lager.Data{"process-guid": processGUID})
+	}
+
+	return mappings, messages
+}
+
 func (t *routingTable) Swap(logger lager.Logger, other RoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit) {
 	table, ok := other.(*routingTable)
 	if !ok {
@@ -168,9 +199,9 @@ func (t *routingTable) Swap(logger lager.Logger, other RoutingTable, domains mod
 	logger.Info("starting", lager.Data{"domains": domains})
 	defer logger.Info("finished")
 
-	httpMappings, httpMessages := t.httpRoutesRoutingTable.Swap(table.httpRoutesRoutingTable, domains)
-	tcpMappings, tcpMessages := t.tcpRoutesRoutingTable.Swap(table.tcpRoutesRoutingTable, domains)
-	internalMappings, internalMessages := t.internalRoutesRoutingTable.Swap(table.internalRoutesRoutingTable, domains)
+	httpMappings, httpMessages := t.httpRoutesRoutingTable.Swap(logger, table.httpRoutesRoutingTable, domains)
+	tcpMappings, tcpMessages := t.tcpRoutesRoutingTable.Swap(logger, table.tcpRoutesRoutingTable, domains)
+	internalMappings, internalMessages := t.internalRoutesRoutingTable.Swap(logger, table.internalRoutesRoutingTable, domains)
 
 	mappings := httpMappings.Merge(tcpMappings).Merge(internalMappings)
 	messages := httpMessages.Merge(tcpMessages).Merge(internalMessages)
@@ -191,9 +222,9 @@ func (t *routingTable) GetInternalRoutingEvents() (TCPRouteMappings, MessagesToE
 }
 
 func (t *routingTable) SetRoutes(logger lager.Logger, before, after *models.DesiredLRP) (TCPRouteMappings, MessagesToEmit) {
-	httpMappings, httpMessages, httpChanged := t.httpRoutesRoutingTable.SetRoutes(before, after)
-	tcpMappings, tcpMessages, tcpChanged := t.tcpRoutesRoutingTable.SetRoutes(before, after)
-	internalMappings, internalMessages, internalChanged := t.internalRoutesRoutingTable.SetRoutes(before, after)
+	httpMappings, httpMessages, httpChanged := t.httpRoutesRoutingTable.SetRoutes(logger, before, after)
+	tcpMappings, tcpMessages, tcpChanged := t.tcpRoutesRoutingTable.SetRoutes(logger, before, after)
+	internalMappings, internalMessages, internalChanged := t.internalRoutesRoutingTable.SetRoutes(logger, before, after)
 
 	mappings := httpMappings.Merge(tcpMappings).Merge(internalMappings)
 	messages := httpMessages.Merge(tcpMessages).Merge(internalMessages)
@@ -206,9 +237,9 @@ func (t *routingTable) SetRoutes(logger lager.Logger, before, after *models.Desi
 }
 
 func (t *routingTable) RemoveRoutes(logger lager.Logger, desiredLRP *models.DesiredLRP) (TCPRouteMappings, MessagesToEmit) {
-	httpMappings, httpMessages, httpChanged := t.httpRoutesRoutingTable.RemoveRoutes(desiredLRP)
-	tcpMappings, tcpMessages, tcpChanged := t.tcpRoutesRoutingTable.RemoveRoutes(desiredLRP)
-	internalMappings, internalMessages, internalChanged := t.internalRoutesRoutingTable.RemoveRoutes(desiredLRP)
+	httpMappings, httpMessages, httpChanged := t.httpRoutesRoutingTable.RemoveRoutes(logger, desiredLRP)
+	tcpMappings, tcpMessages, tcpChanged := t.tcpRoutesRoutingTable.RemoveRoutes(logger, desiredLRP)
+	internalMappings, internalMessages, internalChanged := t.internalRoutesRoutingTable.RemoveRoutes(logger, desiredLRP)
 
 	mappings := httpMappings.Merge(tcpMappings).Merge(internalMappings)
 	messages := httpMessages.Merge(tcpMessages).Merge(internalMessages)
@@ -337,7 +368,7 @@ func (table *internalRoutingTable) RemoveEndpoint(logger lager.Logger, actualLRP
 	return mappings, messagesToEmit, changeDetected
 }
 
-func (t *internalRoutingTable) Swap(otherTable *internalRoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit) {
+func (t *internalRoutingTable) Swap(logger lager.Logger, otherTable *internalRoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit) {
 	t.Lock()
 	defer t.Unlock()
 
@@ -356,20 +387,20 @@ func (t *internalRoutingTable) Swap(otherTable *internalRoutingTable, domains mo
 
 	for key := range mergedRoutingKeys {
 		existingEntry, ok := t.entries[key]
-		newEntry := otherTable.entries[key]
 		if !ok {
 			// routing key only exist in the new table
-			mapping, message, _ := t.emitDiffMessages(key, RoutableEndpoints{}, newEntry)
-			messagesToEmit = messagesToEmit.Merge(message)
-			mappings = mappings.Merge(mapping)
 			continue
 		}
 
 		// entry exists in both tables or in old table, merge the two entries to ensure non-fresh domain endpoints aren't removed
-		merged := mergeUnfreshRoutes(existingEntry, newEntry, domains)
+		merged := mergeUnfreshRoutes(existingEntry, otherTable.entries[key], domains)
 		otherTable.entries[key] = merged
 		otherTable.deleteEntryIfEmpty(key)
-		mapping, message, _ := t.emitDiffMessages(key, existingEntry, merged)
+	}
+
+	previousClaims := t.portClaims.swap(logger, otherTable.entries)
+	for key := range mergedRoutingKeys {
+		mapping, message, _ := t.emitClaimedDiffMessages(key, t.entries[key], otherTable.entries[key], previousClaims)
 		messagesToEmit = messagesToEmit.Merge(message)
 		mappings = mappings.Merge(mapping)
 	}
@@ -389,7 +420,7 @@ func mergeUnfreshRoutes(before, after RoutableEndpoints, domains models.DomainSe
 		for _, oldRoute := range before.Routes {
 			routeExistInNewLRP := func() bool {
 				for _, newRoute := range after.Routes {
-					if newRoute.Hash() == oldRoute.Hash() {
+					if routeIdentity(newRoute) == routeIdentity(oldRoute) {
 						return true
 					}
 				}
@@ -421,20 +452,35 @@ func (t *internalRoutingTable) GetRoutingEvents() (TCPRouteMappings, MessagesToE
 }
 
 type routeMapping interface {
-	MessageFor(endpoint Endpoint, directInstanceAddress, emitEndpointUpdatedAt bool) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage)
+	MessageFor(endpoint Endpoint, directInstanceAddress, emitEndpointUpdatedAt bool, metricTags *MetricTagResolver) (*RegistryMessage, *tcpmodels.TcpRouteMapping, *RegistryMessage)
 	Hash() interface{}
 }
 
+// routeIdentity identifies a route regardless of its settings
+func routeIdentity(route routeMapping) interface{} {
+	if identified, ok := route.(interface{ identityHash() interface{} }); ok {
+		return identified.identityHash()
+	}
+	return route.Hash()
+}
+
 func httpRoutesFrom(lrp *models.DesiredLRP) map[RoutingKey][]routeMapping {
 	if lrp == nil || lrp.Routes == nil {
 		return nil
 	}
 
 	routes, _ := cfroutes.CFRoutesFromRoutingInfo(*lrp.Routes)
+	settings := httpRouteSettingsFrom(lrp.Routes)
+
 	routeEntries := make(map[RoutingKey][]routeMapping)
-	for _, route := range routes {
+	for i, route := range routes {
 		key := RoutingKey{ProcessGUID: lrp.ProcessGuid, ContainerPort: route.Port}
 
+		var setting httpRouteSettings
+		if len(settings) == len(routes) {
+			setting = settings[i]
+		}
+
 		routes := []routeMapping{}
 		for _, hostname := range route.Hostnames {
 			route := Route{
@@ -443,6 +489,11 @@ func httpRoutesFrom(lrp *models.DesiredLRP) map[RoutingKey][]routeMapping {
 				RouteServiceUrl:  route.RouteServiceUrl,
 				IsolationSegment: route.IsolationSegment,
 				MetricTags:       lrp.MetricTags,
+				Protocol:         setting.Protocol,
+				Options:          setting.Options,
+				Weight:           setting.Weight,
+				ProcessGUID:      lrp.ProcessGuid,
+				Domain:           lrp.Domain,
 			}
 			routes = append(routes, route)
 		}
@@ -451,25 +502,80 @@ func httpRoutesFrom(lrp *models.DesiredLRP) map[RoutingKey][]routeMapping {
 	return routeEntries
 }
 
+type httpRouteSettings struct {
+	Protocol string            `json:"protocol"`
+	Options  map[string]string `json:"options"`
+	Weight   uint32            `json:"weight"`
+}
+
+// httpRouteSettingsFrom returns the backend protocol, options and weight of
+// the http routes, in the same order as cfroutes.CFRoutesFromRoutingInfo returns the
+// routes
+func httpRouteSettingsFrom(routingInfo *models.Routes) []httpRouteSettings {
+	data, ok := (*routingInfo)[cfroutes.CF_ROUTER]
+	if !ok || data == nil {
+		return nil
+	}
+
+	var settings []httpRouteSettings
+	err := json.Unmarshal(*data, &settings)
+	if err != nil {
+		return nil
+	}
+	return settings
+}
+
 func tcpRoutesFrom(lrp *models.DesiredLRP) map[RoutingKey][]routeMapping {
 	if lrp == nil {
 		return nil
 	}
 
 	routes, _ := tcp_routes.TCPRoutesFromRoutingInfo(lrp.Routes)
+	sniHostnames := tcpRouteSniHostnames(lrp.Routes)
 
 	routeEntries := make(map[RoutingKey][]routeMapping)
-	for _, route := range routes {
+	for i, route := range routes {
 		key := RoutingKey{ProcessGUID: lrp.ProcessGuid, ContainerPort: route.ContainerPort}
 
-		routeEntries[key] = append(routeEntries[key], ExternalEndpointInfo{
+		info := ExternalEndpointInfo{
 			RouterGroupGUID: route.RouterGroupGuid,
 			Port:            route.ExternalPort,
-		})
+		}
+		if len(sniHostnames) == len(routes) {
+			info.SniHostname = sniHostnames[i]
+		}
+		routeEntries[key] = append(routeEntries[key], info)
 	}
 	return routeEntries
 }
 
+// tcpRouteSniHostnames returns the optional SNI hostnames of the tcp routes,
+// in the same order as tcp_routes.TCPRoutesFromRoutingInfo returns the routes
+func tcpRouteSniHostnames(routingInfo *models.Routes) []string {
+	if routingInfo == nil {
+		return nil
+	}
+
+	data, ok := (*routingInfo)[tcp_routes.TCP_ROUTER]
+	if !ok || data == nil {
+		return nil
+	}
+
+	var routes []struct {
+		SniHostname string `json:"sni_hostname"`
+	}
+	err := json.Unmarshal(*data, &routes)
+	if err != nil {
+		return nil
+	}
+
+	sniHostnames := make([]string, len(routes))
+	for i, route := range routes {
+		sniHostnames[i] = route.SniHostname
+	}
+	return sniHostnames
+}
+
 func internalRoutesFrom(lrp *models.DesiredLRP) map[RoutingKey][]routeMapping {
 	if lrp == nil || lrp.Routes == nil {
 		return nil
@@ -481,14 +587,17 @@ func internalRoutesFrom(lrp *models.DesiredLRP) map[RoutingKey][]routeMapping {
 	for _, route := range routes {
 		key := RoutingKey{ProcessGUID: lrp.ProcessGuid}
 		routeEntries[key] = append(routeEntries[key], InternalRoute{
-			Hostname: route.Hostname,
-			LogGUID:  lrp.LogGuid,
+			Hostname:    route.Hostname,
+			LogGUID:     lrp.LogGuid,
+			MetricTags:  lrp.MetricTags,
+			ProcessGUID: lrp.ProcessGuid,
+			Domain:      lrp.Domain,
 		})
 	}
 	return routeEntries
 }
 
-func (table *internalRoutingTable) SetRoutes(before, after *models.DesiredLRP) (TCPRouteMappings, MessagesToEmit, bool) {
+func (table *internalRoutingTable) SetRoutes(logger lager.Logger, before, after *models.DesiredLRP) (TCPRouteMappings, MessagesToEmit, bool) {
 	table.Lock()
 	defer table.Unlock()
 
@@ -501,6 +610,8 @@ func (table *internalRoutingTable) SetRoutes(before, after *models.DesiredLRP) (
 	var mappings TCPRouteMappings
 
 	changedDetected := false
+	changedEntries := map[RoutingKey]RoutableEndpoints{}
+	previousClaims := map[tcpPort][]tcpPortClaim{}
 
 	for key, routes := range routeEntries {
 		currentEntry := table.entries[key]
@@ -528,11 +639,8 @@ func (table *internalRoutingTable) SetRoutes(before, after *models.DesiredLRP) (
 		}
 
 		table.entries[key] = newEntry
-
-		mapping, message, changed := table.emitDiffMessages(key, currentEntry, newEntry)
-		messagesToEmit = messagesToEmit.Merge(message)
-		mappings = mappings.Merge(mapping)
-		changedDetected = changedDetected || changed
+		table.portClaims.update(logger, key, currentEntry.Routes, newEntry.Routes, previousClaims)
+		changedEntries[key] = currentEntry
 	}
 
 	for key := range removedRouteEntries {
@@ -562,13 +670,99 @@ func (table *internalRoutingTable) SetRoutes(before, after *models.DesiredLRP) (
 		table.entries[key] = newEntry
 
 		table.deleteEntryIfEmpty(key)
+		table.portClaims.update(logger, key, currentEntry.Routes, nil, previousClaims)
+		changedEntries[key] = currentEntry
+	}
 
-		mapping, message, changed := table.emitDiffMessages(key, currentEntry, newEntry)
+	for key, currentEntry := range changedEntries {
+		mapping, message, changed := table.emitClaimedDiffMessages(key, currentEntry, table.entries[key], previousClaims)
 		messagesToEmit = messagesToEmit.Merge(message)
 		mappings = mappings.Merge(mapping)
 		changedDetected = changedDetected || changed
 	}
 
+	// routes of other process guids may have won or lost a tcp port
+	for _, key := range table.portClaims.affected(previousClaims) {
+		if _, ok := changedEntries[key]; ok {
+			continue
+		}
+		entry := table.entries[key]
+		mapping, message, _ := table.emitClaimedDiffMessages(key, entry, entry, previousClaims)
+		messagesToEmit = messagesToEmit.Merge(message)
+		mappings = mappings.Merge(mapping)
+	}
+
+	return mappings, messagesToEmit, changedDetected
+}
+
+func (table *internalRoutingTable) PruneProcess(logger lager.Logger, processGUID string, desiredLRP *models.DesiredLRP, runningActual []*models.ActualLRP) (TCPRouteMappings, MessagesToEmit, bool) {
+	table.Lock()
+	defer table.Unlock()
+
+	running := map[EndpointKey]struct{}{}
+	for _, actualLRP := range runningActual {
+		for _, endpoint := range table.endpointGenerator(actualLRP) {
+			running[endpoint.key()] = struct{}{}
+		}
+	}
+	desiredRoutes := table.routesGenerator(desiredLRP)
+
+	var messagesToEmit MessagesToEmit
+	var mappings TCPRouteMappings
+	changedDetected := false
+	changedEntries := map[RoutingKey]RoutableEndpoints{}
+	previousClaims := map[tcpPort][]tcpPortClaim{}
+
+	for key, currentEntry := range table.entries {
+		if key.ProcessGUID != processGUID {
+			continue
+		}
+
+		newEntry := currentEntry.copy()
+		for endpointKey, endpoint := range currentEntry.Endpoints {
+			if _, ok := running[endpointKey]; ok {
+				continue
+			}
+			delete(newEntry.Endpoints, endpointKey)
+
+			if !table.suppressAddressCollision {
+				address := table.addressGenerator(endpoint)
+				if addressEntry, ok := table.addressEntries[address]; ok && addressEntry.InstanceGUID == endpoint.InstanceGUID {
+					delete(table.addressEntries, address)
+				}
+			}
+		}
+		if _, ok := desiredRoutes[key]; !ok {
+			newEntry.Routes = nil
+		}
+
+		if len(newEntry.Endpoints) == len(currentEntry.Endpoints) && len(newEntry.Routes) == len(currentEntry.Routes) {
+			continue
+		}
+
+		table.entries[key] = newEntry
+		table.deleteEntryIfEmpty(key)
+		table.portClaims.update(logger, key, currentEntry.Routes, newEntry.Routes, previousClaims)
+		changedEntries[key] = currentEntry
+	}
+
+	for key, currentEntry := range changedEntries {
+		mapping, message, changed := table.emitClaimedDiffMessages(key, currentEntry, table.entries[key], previousClaims)
+		messagesToEmit = messagesToEmit.Merge(message)
+		mappings = mappings.Merge(mapping)
+		changedDetected = changedDetected || changed
+	}
+
+	for _, key := range table.portClaims.affected(previousClaims) {
+		if _, ok := changedEntries[key]; ok {
+			continue
+		}
+		entry := table.entries[key]
+		mapping, message, _ := table.emitClaimedDiffMessages(key, entry, entry, previousClaims)
+		messagesToEmit = messagesToEmit.Merge(message)
+		mappings = mappings.Merge(mapping)
+	}
+
 	return mappings, messagesToEmit, changedDetected
 }
 
@@ -580,6 +774,15 @@ func (table *internalRoutingTable) deleteEntryIfEmpty(key RoutingKey) {
 }
 
 func (table *internalRoutingTable) emitDiffMessages(key RoutingKey, oldEntry, newEntry RoutableEndpoints) (TCPRouteMappings, MessagesToEmit, bool) {
+	return table.emitClaimedDiffMessages(key, oldEntry, newEntry, nil)
+}
+
+// emitClaimedDiffMessages leaves out the tcp routes key does not own, checking
+// the ports in previousClaims against their claimants before the change
+func (table *internalRoutingTable) emitClaimedDiffMessages(key RoutingKey, oldEntry, newEntry RoutableEndpoints, previousClaims map[tcpPort][]tcpPortClaim) (TCPRouteMappings, MessagesToEmit, bool) {
+	oldEntry.Routes = table.portClaims.routesFor(key, oldEntry.Routes, previousClaims)
+	newEntry.Routes = table.portClaims.routesFor(key, newEntry.Routes, nil)
+
 	routesDiff := diffRoutes(oldEntry.Routes, newEntry.Routes)
 	endpointsDiff := diffEndpoints(oldEntry.Endpoints, newEntry.Endpoints)
 
@@ -611,15 +814,28 @@ func diffRoutes(before, after []routeMapping) routesDiff {
 		newRoutes[route.Hash()] = route
 	}
 
+	// routes that only changed their weight, protocol or options are
+	// registered again with the new settings but not unregistered
+	updated := map[interface{}]struct{}{}
+	for routeHash, route := range newRoutes {
+		if _, ok := existingRoutes[routeHash]; !ok {
+			updated[routeIdentity(route)] = struct{}{}
+		}
+	}
+
 	diff := routesDiff{
 		before: before,
 		after:  after,
 	}
 	// generate the diff
-	for routeHash := range existingRoutes {
-		if _, ok := newRoutes[routeHash]; !ok {
-			diff.removed = append(diff.removed, existingRoutes[routeHash])
+	for routeHash, route := range existingRoutes {
+		if _, ok := newRoutes[routeHash]; ok {
+			continue
+		}
+		if _, ok := updated[routeIdentity(route)]; ok {
+			continue
 		}
+		diff.removed = append(diff.removed, route)
 	}
 
 	for routeHash := range newRoutes {
@@ -760,7 +976,7 @@ func (table *internalRoutingTable) messages(routesDiff routesDiff, endpointDiff
 
 	for _, es := range registrations {
 		for e, metadata := range es {
-			msg, mapping, internalMsg := metadata.route.MessageFor(e, table.directInstanceRoute, metadata.emitEndpointUpdatedAt)
+			msg, mapping, internalMsg := metadata.route.MessageFor(e, table.directInstanceRoute, metadata.emitEndpointUpdatedAt, table.metricTags)
 			if msg != nil {
 				messages.RegistrationMessages = append(messages.RegistrationMessages, *msg)
 			}
@@ -775,7 +991,7 @@ func (table *internalRoutingTable) messages(routesDiff routesDiff, endpointDiff
 
 	for _, es := range unregistrations {
 		for e, metadata := range es {
-			msg, mapping, internalMsg := metadata.route.MessageFor(e, table.directInstanceRoute, false)
+			msg, mapping, internalMsg := metadata.route.MessageFor(e, table.directInstanceRoute, false, table.metricTags)
 			if msg != nil {
 				messages.UnregistrationMessages = append(messages.UnregistrationMessages, *msg)
 			}
@@ -790,8 +1006,8 @@ func (table *internalRoutingTable) messages(routesDiff routesDiff, endpointDiff
 	return mappings, messages
 }
 
-func (table *internalRoutingTable) RemoveRoutes(desiredLRP *models.DesiredLRP) (TCPRouteMappings, MessagesToEmit, bool) {
-	return table.SetRoutes(desiredLRP, nil)
+func (table *internalRoutingTable) RemoveRoutes(logger lager.Logger, desiredLRP *models.DesiredLRP) (TCPRouteMappings, MessagesToEmit, bool) {
+	return table.SetRoutes(logger, desiredLRP, nil)
 }
 
 func (t *internalRoutingTable) AssociationsCount() int {
@@ -799,8 +1015,8 @@ func (t *internalRoutingTable) AssociationsCount() int {
 	defer t.Unlock()
 
 	count := 0
-	for _, entry := range t.entries {
-		count += len(entry.Routes) * len(entry.Endpoints)
+	for key, entry := range t.entries {
+		count += len(t.portClaims.routesFor(key, entry.Routes, nil)) * len(entry.Endpoints)
 	}
 
 	return count
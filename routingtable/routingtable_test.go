@@ -186,7 +186,7 @@ var _ = Describe("RoutingTable", func() {
 	BeforeEach(func() {
 		logger = lagertest.NewTestLogger("test-route-emitter")
 		fakeMetronClient = &mfakes.FakeIngressClient{}
-		table = routingtable.NewRoutingTable(false, fakeMetronClient)
+		table = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 
 		endpoint1 = routingtable.Endpoint{
 			InstanceGUID:     "ig-1",
@@ -198,6 +198,7 @@ var _ = Describe("RoutingTable", func() {
 			Presence:         models.ActualLRP_Ordinary,
 			PreferredAddress: models.ActualLRPNetInfo_PreferredAddressInstance,
 			Since:            1,
+			CellID:           "cell-id",
 			ModificationTag:  currentTag,
 		}
 		endpoint2 = routingtable.Endpoint{
@@ -210,6 +211,7 @@ var _ = Describe("RoutingTable", func() {
 			Presence:         models.ActualLRP_Ordinary,
 			PreferredAddress: models.ActualLRPNetInfo_PreferredAddressHost,
 			Since:            2,
+			CellID:           "cell-id",
 			ModificationTag:  currentTag,
 		}
 		endpoint3 = routingtable.Endpoint{
@@ -222,6 +224,7 @@ var _ = Describe("RoutingTable", func() {
 			Presence:         models.ActualLRP_Ordinary,
 			PreferredAddress: models.ActualLRPNetInfo_PreferredAddressUnknown,
 			Since:            3,
+			CellID:           "cell-id",
 			ModificationTag:  currentTag,
 		}
 
@@ -498,13 +501,13 @@ var _ = Describe("RoutingTable", func() {
 			table.AddEndpoint(logger, actualLRP)
 
 			By("removing the route and making the domains unfresh")
-			tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+			tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 			actualLRP = createActualLRP(key, endpoint1, domain)
 			tempTable.AddEndpoint(logger, actualLRP)
 			table.Swap(logger, tempTable, noFreshDomains)
 
 			By("making the domain fresh again")
-			tempTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+			tempTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 			actualLRP = createActualLRP(key, endpoint1, domain)
 			tempTable.AddEndpoint(logger, actualLRP)
 			tcpRouteMappings, messagesToEmit = table.Swap(logger, tempTable, freshDomains)
@@ -542,7 +545,7 @@ var _ = Describe("RoutingTable", func() {
 			Context("and the domain is not fresh", func() {
 				It("saves the previous tables routes and emits them when an endpoint is added", func() {
 					actualLRP := createActualLRP(key, endpoint1, domain)
-					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					tempTable.AddEndpoint(logger, actualLRP)
 					_, messagesToEmit := table.Swap(logger, tempTable, noFreshDomains)
 					Expect(messagesToEmit.InternalUnregistrationMessages).To(BeEmpty())
@@ -575,7 +578,7 @@ var _ = Describe("RoutingTable", func() {
 			Context("when the domain is not fresh", func() {
 				Context("and the new table has nothing in it", func() {
 					BeforeEach(func() {
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						tcpRouteMappings, messagesToEmit = table.Swap(logger, tempTable, noFreshDomains)
 					})
 
@@ -602,7 +605,7 @@ var _ = Describe("RoutingTable", func() {
 
 					It("saves the previous tables routes and emits them when an endpoint is added", func() {
 						actualLRP := createActualLRP(key, endpoint1, domain)
-						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						tempTable.AddEndpoint(logger, actualLRP)
 						tcpRouteMappings, messagesToEmit = table.Swap(logger, tempTable, noFreshDomains)
 
@@ -630,6 +633,79 @@ var _ = Describe("RoutingTable", func() {
 		})
 	})
 
+	Describe("PruneProcess", func() {
+		var (
+			desiredLRP             *models.DesiredLRP
+			actualLRP1, actualLRP2 *models.ActualLRP
+		)
+
+		BeforeEach(func() {
+			routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, nil, "", []uint32{9999}, "router-group-guid")
+			desiredLRP = createDesiredLRPWithRoutes(key.ProcessGUID, 2, routes, logGuid, *currentTag, runInfo)
+			actualLRP1 = createActualLRP(key, endpoint1, domain)
+			actualLRP2 = createActualLRP(key, endpoint2, domain)
+
+			table.SetRoutes(logger, nil, desiredLRP)
+			table.AddEndpoint(logger, actualLRP1)
+			table.AddEndpoint(logger, actualLRP2)
+		})
+
+		Context("when every endpoint is still running", func() {
+			It("emits nothing", func() {
+				tcpRouteMappings, messagesToEmit = table.PruneProcess(logger, key.ProcessGUID, desiredLRP, []*models.ActualLRP{actualLRP1, actualLRP2})
+				Expect(tcpRouteMappings).To(Equal(routingtable.TCPRouteMappings{}))
+				Expect(messagesToEmit).To(Equal(routingtable.MessagesToEmit{}))
+			})
+		})
+
+		Context("when an endpoint is no longer running", func() {
+			BeforeEach(func() {
+				tcpRouteMappings, messagesToEmit = table.PruneProcess(logger, key.ProcessGUID, desiredLRP, []*models.ActualLRP{actualLRP1})
+			})
+
+			It("unregisters the stale endpoint", func() {
+				Expect(messagesToEmit.RegistrationMessages).To(BeEmpty())
+				Expect(messagesToEmit.UnregistrationMessages).To(HaveLen(1))
+				Expect(messagesToEmit.UnregistrationMessages[0].Host).To(Equal(endpoint2.Host))
+				Expect(messagesToEmit.UnregistrationMessages[0].URIs).To(ConsistOf(hostname1))
+
+				Expect(tcpRouteMappings.Registrations).To(BeEmpty())
+				Expect(tcpRouteMappings.Unregistrations).To(HaveLen(1))
+				Expect(tcpRouteMappings.Unregistrations[0].HostIP).To(Equal(endpoint2.Host))
+			})
+
+			It("removes the endpoint from the table", func() {
+				Expect(table.HTTPAssociationsCount()).To(Equal(1))
+				Expect(table.TCPAssociationsCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the desired lrp no longer exists", func() {
+			BeforeEach(func() {
+				tcpRouteMappings, messagesToEmit = table.PruneProcess(logger, key.ProcessGUID, nil, nil)
+			})
+
+			It("unregisters every route of the process", func() {
+				Expect(messagesToEmit.RegistrationMessages).To(BeEmpty())
+				Expect(messagesToEmit.UnregistrationMessages).To(HaveLen(2))
+				Expect(tcpRouteMappings.Unregistrations).To(HaveLen(2))
+			})
+
+			It("removes the process from the table", func() {
+				Expect(table.TableSize()).To(Equal(0))
+			})
+		})
+
+		Context("when another process is pruned", func() {
+			It("leaves this process alone", func() {
+				tcpRouteMappings, messagesToEmit = table.PruneProcess(logger, "other-process-guid", nil, nil)
+				Expect(tcpRouteMappings).To(Equal(routingtable.TCPRouteMappings{}))
+				Expect(messagesToEmit).To(Equal(routingtable.MessagesToEmit{}))
+				Expect(table.HTTPAssociationsCount()).To(Equal(2))
+			})
+		})
+	})
+
 	Describe("TableSize", func() {
 		var (
 			desiredLRP *models.DesiredLRP
@@ -690,7 +766,7 @@ var _ = Describe("RoutingTable", func() {
 
 		Context("when the table is swaped and the lrp is deleted", func() {
 			BeforeEach(func() {
-				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				table.Swap(logger, tempTable, freshDomains)
 			})
 
@@ -738,7 +814,7 @@ var _ = Describe("RoutingTable", func() {
 
 		Context("when the routing table is configured to use direct instance route", func() {
 			BeforeEach(func() {
-				table = routingtable.NewRoutingTable(true, fakeMetronClient)
+				table = routingtable.NewRoutingTable(true, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{internalHostname}, "", []uint32{9999}, "")
 				afterDesiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 				table.SetRoutes(logger, nil, afterDesiredLRP)
@@ -807,7 +883,7 @@ var _ = Describe("RoutingTable", func() {
 
 		Context("when the routing table is configured not to use direct instance route", func() {
 			BeforeEach(func() {
-				table = routingtable.NewRoutingTable(false, fakeMetronClient)
+				table = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				routes := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{internalHostname}, "", []uint32{9999}, "")
 				afterDesiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routes, logGuid, *currentTag, runInfo)
 				table.SetRoutes(logger, nil, afterDesiredLRP)
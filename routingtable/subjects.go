@@ -0,0 +1,71 @@
+package routingtable
+
+import (
+	"sort"
+	"strings"
+)
+
+// SubjectLayout determines the NATS subjects that registry messages are
+// published on and that the external service greets on. Subjects have the
+// form "<namespace>.<service>.<action>", where the namespace is omitted when
+// empty. Registry messages for an isolation segment listed in
+// IsolationSegmentServices use that segment's service name instead of the
+// default one, so that the segment's routers only receive their own routes.
+type SubjectLayout struct {
+	Namespace                string
+	Service                  string
+	IsolationSegmentServices map[string]string
+}
+
+func NewSubjectLayout(namespace, service string, isolationSegmentServices map[string]string) SubjectLayout {
+	return SubjectLayout{
+		Namespace:                strings.Trim(namespace, "."),
+		Service:                  service,
+		IsolationSegmentServices: isolationSegmentServices,
+	}
+}
+
+func (l SubjectLayout) RegisterSubject(message RegistryMessage) string {
+	return l.subject(l.serviceFor(message), "register")
+}
+
+func (l SubjectLayout) UnregisterSubject(message RegistryMessage) string {
+	return l.subject(l.serviceFor(message), "unregister")
+}
+
+// Services returns the default service name followed by the sorted service
+// names of the isolation segments
+func (l SubjectLayout) Services() []string {
+	seen := map[string]bool{l.Service: true}
+	segmentServices := []string{}
+	for _, service := range l.IsolationSegmentServices {
+		if !seen[service] {
+			seen[service] = true
+			segmentServices = append(segmentServices, service)
+		}
+	}
+	sort.Strings(segmentServices)
+	return append([]string{l.Service}, segmentServices...)
+}
+
+func (l SubjectLayout) GreetSubject(service string) string {
+	return l.subject(service, "greet")
+}
+
+func (l SubjectLayout) StartSubject(service string) string {
+	return l.subject(service, "start")
+}
+
+func (l SubjectLayout) serviceFor(message RegistryMessage) string {
+	if service, ok := l.IsolationSegmentServices[message.IsolationSegment]; ok && message.IsolationSegment != "" {
+		return service
+	}
+	return l.Service
+}
+
+func (l SubjectLayout) subject(service, action string) string {
+	if l.Namespace == "" {
+		return service + "." + action
+	}
+	return l.Namespace + "." + service + "." + action
+}
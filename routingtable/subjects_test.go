@@ -0,0 +1,64 @@
+package routingtable_test
+
+import (
+	"code.cloudfoundry.org/route-emitter/routingtable"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SubjectLayout", func() {
+	var (
+		subjects routingtable.SubjectLayout
+		message  routingtable.RegistryMessage
+	)
+
+	BeforeEach(func() {
+		subjects = routingtable.NewSubjectLayout("", "router", nil)
+		message = routingtable.RegistryMessage{URIs: []string{"foo.com"}, IsolationSegment: "segment-a"}
+	})
+
+	It("uses the service name without a namespace", func() {
+		Expect(subjects.RegisterSubject(message)).To(Equal("router.register"))
+		Expect(subjects.UnregisterSubject(message)).To(Equal("router.unregister"))
+		Expect(subjects.GreetSubject("router")).To(Equal("router.greet"))
+		Expect(subjects.StartSubject("router")).To(Equal("router.start"))
+		Expect(subjects.Services()).To(Equal([]string{"router"}))
+	})
+
+	Context("with a namespace", func() {
+		BeforeEach(func() {
+			subjects = routingtable.NewSubjectLayout("tenant-a.", "router", nil)
+		})
+
+		It("prefixes every subject", func() {
+			Expect(subjects.RegisterSubject(message)).To(Equal("tenant-a.router.register"))
+			Expect(subjects.GreetSubject("router")).To(Equal("tenant-a.router.greet"))
+		})
+	})
+
+	Context("with isolation segment services", func() {
+		BeforeEach(func() {
+			subjects = routingtable.NewSubjectLayout("", "router", map[string]string{
+				"segment-b": "router-segment-b",
+				"segment-a": "router-segment-a",
+			})
+		})
+
+		It("uses the segment service for the segment's messages", func() {
+			Expect(subjects.RegisterSubject(message)).To(Equal("router-segment-a.register"))
+			Expect(subjects.UnregisterSubject(message)).To(Equal("router-segment-a.unregister"))
+		})
+
+		It("uses the default service for other messages", func() {
+			message.IsolationSegment = "segment-c"
+			Expect(subjects.RegisterSubject(message)).To(Equal("router.register"))
+			message.IsolationSegment = ""
+			Expect(subjects.RegisterSubject(message)).To(Equal("router.register"))
+		})
+
+		It("lists the default service first", func() {
+			Expect(subjects.Services()).To(Equal([]string{"router", "router-segment-a", "router-segment-b"}))
+		})
+	})
+})
@@ -0,0 +1,310 @@
+package routingtable
+
+import (
+	"sort"
+
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+)
+
+// TCPPortConflictPolicy decides which process GUIDs keep an external port of
+// a router group that is claimed by more than one process GUID
+type TCPPortConflictPolicy string
+
+const (
+	// TCPPortConflictFirstWins keeps the port routed to the first claimant
+	TCPPortConflictFirstWins TCPPortConflictPolicy = "first-wins"
+	// TCPPortConflictRefuseBoth routes the port to none of the claimants
+	// until only one of them is left
+	TCPPortConflictRefuseBoth TCPPortConflictPolicy = "refuse-both"
+	// TCPPortConflictNone disables conflict detection
+	TCPPortConflictNone TCPPortConflictPolicy = "none"
+)
+
+const tcpPortConflictsCounter = "TCPPortConflicts"
+
+// Valid reports whether p is one of the known policies
+func (p TCPPortConflictPolicy) Valid() bool {
+	switch p {
+	case TCPPortConflictFirstWins, TCPPortConflictRefuseBoth, TCPPortConflictNone:
+		return true
+	}
+	return false
+}
+
+// tcpPort is an external port of a router group
+type tcpPort struct {
+	routerGroupGUID string
+	port            uint32
+}
+
+func tcpPortOf(endpoint ExternalEndpointInfo) tcpPort {
+	return tcpPort{routerGroupGUID: endpoint.RouterGroupGUID, port: endpoint.Port}
+}
+
+// tcpPortClaim is a routing key requesting a port for an SNI hostname, empty
+// if the route matches any connection
+type tcpPortClaim struct {
+	key         RoutingKey
+	sniHostname string
+}
+
+// conflicts reports whether c and other request the same connections for
+// different process GUIDs. Only routes with different, non-empty SNI
+// hostnames can share a port.
+func (c tcpPortClaim) conflicts(other tcpPortClaim) bool {
+	if c.key.ProcessGUID == other.key.ProcessGUID {
+		return false
+	}
+	return c.sniHostname == "" || other.sniHostname == "" || c.sniHostname == other.sniHostname
+}
+
+// tcpPortClaims tracks the claims on every (router group, port) pair in the
+// order they were made. A nil *tcpPortClaims disables conflict detection.
+type tcpPortClaims struct {
+	policy       TCPPortConflictPolicy
+	metronClient loggingclient.IngressClient
+	claimants    map[tcpPort][]tcpPortClaim
+}
+
+func newTCPPortClaims(policy TCPPortConflictPolicy, metronClient loggingclient.IngressClient) *tcpPortClaims {
+	if policy != TCPPortConflictFirstWins && policy != TCPPortConflictRefuseBoth {
+		return nil
+	}
+	return &tcpPortClaims{
+		policy:       policy,
+		metronClient: metronClient,
+		claimants:    make(map[tcpPort][]tcpPortClaim),
+	}
+}
+
+// update records the change of the routes requested by key. The claims on a
+// port before its first change are saved in previous.
+func (c *tcpPortClaims) update(logger lager.Logger, key RoutingKey, before, after []routeMapping, previous map[tcpPort][]tcpPortClaim) {
+	if c == nil {
+		return
+	}
+
+	beforeEndpoints := externalEndpoints(before)
+	afterEndpoints := externalEndpoints(after)
+
+	for endpoint := range beforeEndpoints {
+		if _, ok := afterEndpoints[endpoint]; ok {
+			continue
+		}
+		port := tcpPortOf(endpoint)
+		c.save(port, previous)
+		claimants := removeClaim(c.claimants[port], tcpPortClaim{key: key, sniHostname: endpoint.SniHostname})
+		if len(claimants) == 0 {
+			delete(c.claimants, port)
+		} else {
+			c.claimants[port] = claimants
+		}
+	}
+
+	for endpoint := range afterEndpoints {
+		if _, ok := beforeEndpoints[endpoint]; ok {
+			continue
+		}
+		port := tcpPortOf(endpoint)
+		c.save(port, previous)
+		c.claim(logger, port, tcpPortClaim{key: key, sniHostname: endpoint.SniHostname})
+	}
+}
+
+// swap replaces the claims by the ports requested in entries. Claims already
+// known keep their order, new ones are appended. The replaced claims are
+// returned.
+func (c *tcpPortClaims) swap(logger lager.Logger, entries map[RoutingKey]RoutableEndpoints) map[tcpPort][]tcpPortClaim {
+	if c == nil {
+		return nil
+	}
+
+	requested := map[tcpPort]map[tcpPortClaim]struct{}{}
+	for key, entry := range entries {
+		for endpoint := range externalEndpoints(entry.Routes) {
+			port := tcpPortOf(endpoint)
+			if requested[port] == nil {
+				requested[port] = map[tcpPortClaim]struct{}{}
+			}
+			requested[port][tcpPortClaim{key: key, sniHostname: endpoint.SniHostname}] = struct{}{}
+		}
+	}
+
+	previous := c.claimants
+	c.claimants = make(map[tcpPort][]tcpPortClaim)
+	for port, claims := range requested {
+		for _, claim := range previous[port] {
+			if _, ok := claims[claim]; ok {
+				c.claimants[port] = append(c.claimants[port], claim)
+				delete(claims, claim)
+			}
+		}
+
+		newClaims := make([]tcpPortClaim, 0, len(claims))
+		for claim := range claims {
+			newClaims = append(newClaims, claim)
+		}
+		sort.Slice(newClaims, func(i, j int) bool {
+			a, b := newClaims[i], newClaims[j]
+			if a.key.ProcessGUID != b.key.ProcessGUID {
+				return a.key.ProcessGUID < b.key.ProcessGUID
+			}
+			if a.key.ContainerPort != b.key.ContainerPort {
+				return a.key.ContainerPort < b.key.ContainerPort
+			}
+			return a.sniHostname < b.sniHostname
+		})
+		for _, claim := range newClaims {
+			c.claim(logger, port, claim)
+		}
+	}
+
+	return previous
+}
+
+// claim appends claim to the claims on port, reporting a conflict when it
+// conflicts with the claim of another process GUID
+func (c *tcpPortClaims) claim(logger lager.Logger, port tcpPort, claim tcpPortClaim) {
+	claimants := c.claimants[port]
+	other := ""
+	for _, claimant := range claimants {
+		if claimant == claim {
+			return
+		}
+		if other == "" && claim.conflicts(claimant) {
+			other = claimant.key.ProcessGUID
+		}
+	}
+	c.claimants[port] = append(claimants, claim)
+
+	if other == "" {
+		return
+	}
+
+	data := lager.Data{
+		"router_group_guid": port.routerGroupGUID,
+		"port":              port.port,
+		"process_guid_a":    other,
+		"process_guid_b":    claim.key.ProcessGUID,
+		"policy":            c.policy,
+	}
+	if claim.sniHostname != "" {
+		data["sni_hostname"] = claim.sniHostname
+	}
+	logger.Info("tcp-port-conflict-detected", data)
+	err := c.metronClient.IncrementCounter(tcpPortConflictsCounter)
+	if err != nil {
+		logger.Error("cannot-send-tcp-port-conflicts-metric", err)
+	}
+}
+
+func (c *tcpPortClaims) save(port tcpPort, previous map[tcpPort][]tcpPortClaim) {
+	if _, ok := previous[port]; ok {
+		return
+	}
+	previous[port] = append([]tcpPortClaim{}, c.claimants[port]...)
+}
+
+// routesFor drops the tcp routes key does not own. Ports in previous are
+// checked against the claims saved there instead of the current ones.
+func (c *tcpPortClaims) routesFor(key RoutingKey, routes []routeMapping, previous map[tcpPort][]tcpPortClaim) []routeMapping {
+	if c == nil {
+		return routes
+	}
+
+	var owned []routeMapping
+	for _, route := range routes {
+		if endpoint, ok := route.(ExternalEndpointInfo); ok {
+			port := tcpPortOf(endpoint)
+			claimants, saved := previous[port]
+			if !saved {
+				claimants = c.claimants[port]
+			}
+			if !c.owns(tcpPortClaim{key: key, sniHostname: endpoint.SniHostname}, claimants) {
+				continue
+			}
+		}
+		owned = append(owned, route)
+	}
+	return owned
+}
+
+// owns reports whether claim is honoured. With the first-wins policy a claim
+// is honoured unless it conflicts with an earlier honoured claim, with the
+// refuse-both policy unless it conflicts with any other claim.
+func (c *tcpPortClaims) owns(claim tcpPortClaim, claimants []tcpPortClaim) bool {
+	if c.policy == TCPPortConflictRefuseBoth {
+		for _, claimant := range claimants {
+			if claim.conflicts(claimant) {
+				return false
+			}
+		}
+		return true
+	}
+
+	honoured := []tcpPortClaim{}
+	for _, claimant := range claimants {
+		if claimant == claim {
+			break
+		}
+		if !conflictsWithAny(claimant, honoured) {
+			honoured = append(honoured, claimant)
+		}
+	}
+	return !conflictsWithAny(claim, honoured)
+}
+
+func conflictsWithAny(claim tcpPortClaim, claims []tcpPortClaim) bool {
+	for _, other := range claims {
+		if claim.conflicts(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// affected returns the routing keys claiming, now or before, a port in
+// previous
+func (c *tcpPortClaims) affected(previous map[tcpPort][]tcpPortClaim) []RoutingKey {
+	if c == nil {
+		return nil
+	}
+
+	seen := map[RoutingKey]struct{}{}
+	keys := []RoutingKey{}
+	add := func(claimants []tcpPortClaim) {
+		for _, claim := range claimants {
+			if _, ok := seen[claim.key]; ok {
+				continue
+			}
+			seen[claim.key] = struct{}{}
+			keys = append(keys, claim.key)
+		}
+	}
+	for port, claimants := range previous {
+		add(claimants)
+		add(c.claimants[port])
+	}
+	return keys
+}
+
+func externalEndpoints(routes []routeMapping) map[ExternalEndpointInfo]struct{} {
+	endpoints := map[ExternalEndpointInfo]struct{}{}
+	for _, route := range routes {
+		if endpoint, ok := route.(ExternalEndpointInfo); ok {
+			endpoints[endpoint] = struct{}{}
+		}
+	}
+	return endpoints
+}
+
+func removeClaim(claims []tcpPortClaim, claim tcpPortClaim) []tcpPortClaim {
+	result := []tcpPortClaim{}
+	for _, c := range claims {
+		if c != claim {
+			result = append(result, c)
+		}
+	}
+	return result
+}
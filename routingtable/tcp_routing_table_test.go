@@ -2,6 +2,7 @@ package routingtable_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"code.cloudfoundry.org/bbs/models"
@@ -98,7 +99,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 	Context("when no entry exist for route", func() {
 		BeforeEach(func() {
-			routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+			routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 			modificationTag = &models.ModificationTag{Epoch: "abc", Index: 0}
 		})
 
@@ -198,7 +199,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 			BeforeEach(func() {
 				logGuid = "log-guid-1"
-				tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+				tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				beforeLRP := getDesiredLRP("process-guid-1", logGuid, tcpRoutes, modificationTag)
 				tempRoutingTable.SetRoutes(logger, nil, beforeLRP)
 				tempRoutingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -233,7 +234,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 			Context("when the table is configured to emit direct instance route", func() {
 				BeforeEach(func() {
-					routingTable = routingtable.NewRoutingTable(true, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(true, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				})
 
 				It("emits routing events for new routes", func() {
@@ -263,7 +264,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 				Context("when instance prefers host address", func() {
 					It("emits routing events for new routes", func() {
-						tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+						tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						beforeLRP := getDesiredLRP("process-guid-1", logGuid, tcpRoutes, modificationTag)
 						tempRoutingTable.SetRoutes(logger, nil, beforeLRP)
 						actualLRP := getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag)
@@ -300,7 +301,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 		Context("when the routing tables are of different type", func() {
 			It("should not swap the tables", func() {
-				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				fakeTable := &fakeroutingtable.FakeRoutingTable{}
 				routingEvents, _ := routingTable.Swap(logger, fakeTable, models.DomainSet{})
 				Expect(routingEvents.Registrations).To(HaveLen(0))
@@ -322,7 +323,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 		Describe("HasExternalRoutes", func() {
 			It("returns the associated desired state", func() {
-				routingTable = routingtable.NewRoutingTable(true, fakeMetronClient)
+				routingTable = routingtable.NewRoutingTable(true, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				beforeLRP := getDesiredLRP("process-guid-1", logGuid, tcpRoutes, modificationTag)
 				routingTable.SetRoutes(logger, nil, beforeLRP)
 				routingInfo := getActualLRP("process-guid-1", "instance-guid-2", "some-ip-2", "container-ip-2", 62004, 5222, modificationTag)
@@ -333,7 +334,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 		Describe("AddRoutes", func() {
 			BeforeEach(func() {
-				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				beforeLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 				routingTable.SetRoutes(logger, nil, beforeLRP)
 				routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -512,7 +513,7 @@ var _ = Describe("TCPRoutingTable", func() {
 					}
 
 					desiredLRP := getDesiredLRP("process-guid-1", "log-guid-1", currentTcpRoutes, modificationTag)
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routingTable.SetRoutes(logger, nil, desiredLRP)
 					routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
 					routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-2", "some-ip-2", "container-ip-2", 62004, 5222, modificationTag))
@@ -633,7 +634,7 @@ var _ = Describe("TCPRoutingTable", func() {
 			Context("when two disjoint (external port, container port) pairs are given", func() {
 				BeforeEach(func() {
 					beforeLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					routingTable.SetRoutes(logger, nil, beforeLRP)
 					routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
 					routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 63004, 5223, modificationTag))
@@ -723,7 +724,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 			BeforeEach(func() {
 				newModificationTag = &models.ModificationTag{Epoch: "abc", Index: 2}
-				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				beforeLRP = getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 				routingTable.SetRoutes(logger, nil, beforeLRP)
 				routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -1127,7 +1128,7 @@ var _ = Describe("TCPRoutingTable", func() {
 							ContainerPort:   5222,
 						},
 					}
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					beforeLRP = getDesiredLRP("process-guid-1", "log-guid-1", newTcpRoutes, modificationTag)
 					routingTable.SetRoutes(logger, nil, beforeLRP)
 					routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -1163,7 +1164,7 @@ var _ = Describe("TCPRoutingTable", func() {
 				)
 
 				BeforeEach(func() {
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					desiredLRP = getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 					routingTable.SetRoutes(logger, nil, desiredLRP)
 					Expect(routingTable.TCPAssociationsCount()).Should(Equal(0))
@@ -1187,7 +1188,7 @@ var _ = Describe("TCPRoutingTable", func() {
 							ContainerPort:   5222,
 						},
 					}
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					modificationTag := &models.ModificationTag{Epoch: "abc", Index: 1}
 					desiredLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 					routingTable.SetRoutes(logger, nil, desiredLRP)
@@ -1215,7 +1216,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 				Context("when there are no external endpoints", func() {
 					BeforeEach(func() {
-						routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+						routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 						modificationTag := &models.ModificationTag{Epoch: "abc", Index: 1}
 						desiredLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 						routingTable.SetRoutes(logger, nil, desiredLRP)
@@ -1237,7 +1238,7 @@ var _ = Describe("TCPRoutingTable", func() {
 		Describe("AddEndpoint", func() {
 			Context("with no existing endpoints", func() {
 				BeforeEach(func() {
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					beforeLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 					routingTable.SetRoutes(logger, nil, beforeLRP)
 					Expect(routingTable.TCPAssociationsCount()).Should(Equal(0))
@@ -1264,7 +1265,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 			Context("with existing endpoints", func() {
 				BeforeEach(func() {
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					beforeLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 					routingTable.SetRoutes(logger, nil, beforeLRP)
 					routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -1327,7 +1328,7 @@ var _ = Describe("TCPRoutingTable", func() {
 		Describe("RemoveEndpoint", func() {
 			Context("with no existing endpoints", func() {
 				BeforeEach(func() {
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					beforeLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 					routingTable.SetRoutes(logger, nil, beforeLRP)
 					Expect(routingTable.TCPAssociationsCount()).Should(Equal(0))
@@ -1344,7 +1345,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 			Context("with existing endpoints", func() {
 				BeforeEach(func() {
-					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					beforeLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 					routingTable.SetRoutes(logger, nil, beforeLRP)
 					routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -1415,7 +1416,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 		Describe("GetRoutingEvents", func() {
 			BeforeEach(func() {
-				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				beforeLRP := getDesiredLRP("process-guid-1", "log-guid-1", tcpRoutes, modificationTag)
 				routingTable.SetRoutes(logger, nil, beforeLRP)
 				routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -1449,7 +1450,7 @@ var _ = Describe("TCPRoutingTable", func() {
 			BeforeEach(func() {
 				existingLogGuid = "log-guid-1"
 				newModificationTag = &models.ModificationTag{Epoch: "abc", Index: 2}
-				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+				routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 				beforeLRP := getDesiredLRP("process-guid-1", existingLogGuid, tcpRoutes, modificationTag)
 				routingTable.SetRoutes(logger, nil, beforeLRP)
 				routingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
@@ -1461,7 +1462,7 @@ var _ = Describe("TCPRoutingTable", func() {
 
 				BeforeEach(func() {
 					logGuid = "log-guid-2"
-					tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					beforeLRP := getDesiredLRP("process-guid-2", logGuid, tcpRoutes, newModificationTag)
 					tempRoutingTable.SetRoutes(logger, nil, beforeLRP)
 					tempRoutingTable.AddEndpoint(logger, getActualLRP("process-guid-2", "instance-guid-1", "some-ip-3", "container-ip-3", 63004, 5222, newModificationTag))
@@ -1513,7 +1514,7 @@ var _ = Describe("TCPRoutingTable", func() {
 			Context("when updating an existing routing key (process-guid, container-port)", func() {
 				BeforeEach(func() {
 					logGuid = "log-guid-2"
-					tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					beforeLRP := getDesiredLRP("process-guid-1", logGuid, tcpRoutes, newModificationTag)
 					tempRoutingTable.SetRoutes(logger, nil, beforeLRP)
 					tempRoutingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-3", "container-ip-3", 63004, 5222, newModificationTag))
@@ -1575,7 +1576,7 @@ var _ = Describe("TCPRoutingTable", func() {
 						},
 					}
 					beforeLRP := getDesiredLRP("process-guid-1", existingLogGuid, newTcpRoutes, newModificationTag)
-					tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempRoutingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 					tempRoutingTable.SetRoutes(logger, nil, beforeLRP)
 					tempRoutingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-1", "some-ip-1", "container-ip-1", 62004, 5222, modificationTag))
 					tempRoutingTable.AddEndpoint(logger, getActualLRP("process-guid-1", "instance-guid-2", "some-ip-2", "container-ip-2", 62004, 5222, modificationTag))
@@ -1627,4 +1628,188 @@ var _ = Describe("TCPRoutingTable", func() {
 			})
 		})
 	})
+
+	Context("when two process guids claim the same external port", func() {
+		var (
+			policy           routingtable.TCPPortConflictPolicy
+			lrpA, lrpB       *models.DesiredLRP
+			actualA, actualB *models.ActualLRP
+			mappingA         tcpmodels.TcpRouteMapping
+			mappingB         tcpmodels.TcpRouteMapping
+			conflictMappings routingtable.TCPRouteMappings
+		)
+
+		BeforeEach(func() {
+			policy = routingtable.TCPPortConflictFirstWins
+			modificationTag = &models.ModificationTag{Epoch: "abc", Index: 1}
+			lrpA = getDesiredLRP("process-guid-a", "log-guid-a", tcpRoutes, modificationTag)
+			lrpB = getDesiredLRP("process-guid-b", "log-guid-b", tcpRoutes, modificationTag)
+			actualA = getActualLRP("process-guid-a", "instance-guid-a", "some-ip-a", "container-ip-a", 62004, 5222, modificationTag)
+			actualB = getActualLRP("process-guid-b", "instance-guid-b", "some-ip-b", "container-ip-b", 62005, 5222, modificationTag)
+			mappingA = tcpmodels.NewTcpRouteMapping("router-group-guid", 61000, "some-ip-a", 62004, 0)
+			mappingB = tcpmodels.NewTcpRouteMapping("router-group-guid", 61000, "some-ip-b", 62005, 0)
+		})
+
+		JustBeforeEach(func() {
+			routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, policy, nil)
+			routingTable.SetRoutes(logger, nil, lrpA)
+			routingTable.AddEndpoint(logger, actualA)
+
+			routingTable.AddEndpoint(logger, actualB)
+			conflictMappings, _ = routingTable.SetRoutes(logger, nil, lrpB)
+		})
+
+		It("logs both process guids and emits an alert metric", func() {
+			Expect(logger).To(gbytes.Say(`tcp-port-conflict-detected.*"policy":"first-wins","port":61000,"process_guid_a":"process-guid-a","process_guid_b":"process-guid-b","router_group_guid":"router-group-guid"`))
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(1))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("TCPPortConflicts"))
+		})
+
+		Context("with the first-wins policy", func() {
+			It("keeps the port routed to the first claimant", func() {
+				Expect(conflictMappings.Registrations).To(BeEmpty())
+				Expect(conflictMappings.Unregistrations).To(BeEmpty())
+
+				mappings, _ := routingTable.GetExternalRoutingEvents()
+				Expect(mappings.Registrations).To(ConsistOf(mappingA))
+				Expect(routingTable.TCPAssociationsCount()).To(Equal(1))
+			})
+
+			It("hands the port to the next claimant when the first one releases it", func() {
+				mappings, _ := routingTable.RemoveRoutes(logger, lrpA)
+				Expect(mappings.Unregistrations).To(ConsistOf(mappingA))
+				Expect(mappings.Registrations).To(ConsistOf(mappingB))
+			})
+
+			It("keeps the first claimant across a swap", func() {
+				tempRoutingTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictNone, nil)
+				tempRoutingTable.SetRoutes(logger, nil, lrpB)
+				tempRoutingTable.SetRoutes(logger, nil, lrpA)
+				tempRoutingTable.AddEndpoint(logger, actualB)
+				tempRoutingTable.AddEndpoint(logger, actualA)
+
+				domains := models.DomainSet{}
+				domains.Add("domain")
+				mappings, _ := routingTable.Swap(logger, tempRoutingTable, domains)
+				Expect(mappings.Registrations).To(BeEmpty())
+				Expect(mappings.Unregistrations).To(BeEmpty())
+
+				mappings, _ = routingTable.GetExternalRoutingEvents()
+				Expect(mappings.Registrations).To(ConsistOf(mappingA))
+			})
+		})
+
+		Context("with the refuse-both policy", func() {
+			BeforeEach(func() {
+				policy = routingtable.TCPPortConflictRefuseBoth
+			})
+
+			It("unregisters the port of the first claimant", func() {
+				Expect(conflictMappings.Registrations).To(BeEmpty())
+				Expect(conflictMappings.Unregistrations).To(ConsistOf(mappingA))
+
+				mappings, _ := routingTable.GetExternalRoutingEvents()
+				Expect(mappings.Registrations).To(BeEmpty())
+				Expect(routingTable.TCPAssociationsCount()).To(Equal(0))
+			})
+
+			It("routes the port again once only one claimant is left", func() {
+				mappings, _ := routingTable.RemoveRoutes(logger, lrpB)
+				Expect(mappings.Unregistrations).To(BeEmpty())
+				Expect(mappings.Registrations).To(ConsistOf(mappingA))
+			})
+		})
+
+		Context("when the policy is none", func() {
+			BeforeEach(func() {
+				policy = routingtable.TCPPortConflictNone
+			})
+
+			It("routes the port to both claimants", func() {
+				Expect(conflictMappings.Registrations).To(ConsistOf(mappingB))
+				Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when tcp routes have SNI hostnames", func() {
+		var (
+			lrpA, lrpB       *models.DesiredLRP
+			actualA, actualB *models.ActualLRP
+			sniMappingsA     routingtable.TCPRouteMappings
+			sniMappingsB     routingtable.TCPRouteMappings
+		)
+
+		withSniHostname := func(lrp *models.DesiredLRP, sniHostname string) *models.DesiredLRP {
+			routingInfo := json.RawMessage(fmt.Sprintf(
+				`[{"router_group_guid":"router-group-guid","external_port":61000,"container_port":5222,"sni_hostname":%q}]`,
+				sniHostname,
+			))
+			(*lrp.Routes)[tcp_routes.TCP_ROUTER] = &routingInfo
+			return lrp
+		}
+
+		sniMapping := func(hostIP string, hostPort uint16, sniHostname string) tcpmodels.TcpRouteMapping {
+			mapping := tcpmodels.NewTcpRouteMapping("router-group-guid", 61000, hostIP, hostPort, 0)
+			mapping.SniHostname = &sniHostname
+			return mapping
+		}
+
+		BeforeEach(func() {
+			modificationTag = &models.ModificationTag{Epoch: "abc", Index: 1}
+			lrpA = withSniHostname(getDesiredLRP("process-guid-a", "log-guid-a", tcpRoutes, modificationTag), "a.example.com")
+			lrpB = withSniHostname(getDesiredLRP("process-guid-b", "log-guid-b", tcpRoutes, modificationTag), "b.example.com")
+			actualA = getActualLRP("process-guid-a", "instance-guid-a", "some-ip-a", "container-ip-a", 62004, 5222, modificationTag)
+			actualB = getActualLRP("process-guid-b", "instance-guid-b", "some-ip-b", "container-ip-b", 62005, 5222, modificationTag)
+
+			routingTable = routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
+			routingTable.AddEndpoint(logger, actualA)
+			routingTable.AddEndpoint(logger, actualB)
+			sniMappingsA, _ = routingTable.SetRoutes(logger, nil, lrpA)
+			sniMappingsB, _ = routingTable.SetRoutes(logger, nil, lrpB)
+		})
+
+		It("sends the SNI hostname in the mappings", func() {
+			Expect(sniMappingsA.Registrations).To(ConsistOf(sniMapping("some-ip-a", 62004, "a.example.com")))
+			Expect(sniMappingsB.Registrations).To(ConsistOf(sniMapping("some-ip-b", 62005, "b.example.com")))
+		})
+
+		It("shares the external port between process guids with different SNI hostnames", func() {
+			Expect(logger).NotTo(gbytes.Say("tcp-port-conflict-detected"))
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(0))
+			Expect(routingTable.TCPAssociationsCount()).To(Equal(2))
+		})
+
+		It("reports a conflict when another process guid claims the port for the same SNI hostname", func() {
+			lrpC := withSniHostname(getDesiredLRP("process-guid-c", "log-guid-c", tcpRoutes, modificationTag), "a.example.com")
+			actualC := getActualLRP("process-guid-c", "instance-guid-c", "some-ip-c", "container-ip-c", 62006, 5222, modificationTag)
+			routingTable.AddEndpoint(logger, actualC)
+			mappings, _ := routingTable.SetRoutes(logger, nil, lrpC)
+
+			Expect(logger).To(gbytes.Say(`tcp-port-conflict-detected.*"process_guid_a":"process-guid-a","process_guid_b":"process-guid-c"`))
+			Expect(mappings.Registrations).To(BeEmpty())
+			Expect(routingTable.TCPAssociationsCount()).To(Equal(2))
+		})
+
+		It("reports a conflict when another process guid claims the port without an SNI hostname", func() {
+			lrpC := getDesiredLRP("process-guid-c", "log-guid-c", tcpRoutes, modificationTag)
+			actualC := getActualLRP("process-guid-c", "instance-guid-c", "some-ip-c", "container-ip-c", 62006, 5222, modificationTag)
+			routingTable.AddEndpoint(logger, actualC)
+			mappings, _ := routingTable.SetRoutes(logger, nil, lrpC)
+
+			Expect(logger).To(gbytes.Say(`tcp-port-conflict-detected.*"process_guid_a":"process-guid-a","process_guid_b":"process-guid-c"`))
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(1))
+			Expect(mappings.Registrations).To(BeEmpty())
+		})
+
+		It("unregisters the old mapping when only the SNI hostname changes", func() {
+			updated := withSniHostname(
+				getDesiredLRP("process-guid-a", "log-guid-a", tcpRoutes, &models.ModificationTag{Epoch: "abc", Index: 2}),
+				"c.example.com",
+			)
+			mappings, _ := routingTable.SetRoutes(logger, lrpA, updated)
+			Expect(mappings.Registrations).To(ConsistOf(sniMapping("some-ip-a", 62004, "c.example.com")))
+			Expect(mappings.Unregistrations).To(ConsistOf(sniMapping("some-ip-a", 62004, "a.example.com")))
+		})
+	})
 })
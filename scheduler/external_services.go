@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// routerExpiryGreetings is the number of greeting cycles an external service
+// may miss before it is no longer taken into account
+const routerExpiryGreetings = 2
+
+type externalServiceGreeting struct {
+	id               string
+	registerInterval time.Duration
+	pruneThreshold   time.Duration
+	started          bool
+}
+
+// externalServiceID identifies the instance that sent a greeting. Instances
+// that do not send an id are told apart by the subject they expect replies on
+// and otherwise by their hosts, so that they do not all share one entry.
+func externalServiceID(id, reply string, hosts []string) string {
+	if id != "" {
+		return id
+	}
+	if reply != "" {
+		return "reply:" + reply
+	}
+	if len(hosts) > 0 {
+		sorted := append([]string{}, hosts...)
+		sort.Strings(sorted)
+		return "hosts:" + strings.Join(sorted, ",")
+	}
+	return ""
+}
+
+type externalService struct {
+	registerInterval time.Duration
+	pruneThreshold   time.Duration
+	lastSeen         time.Time
+}
+
+// externalServices tracks the intervals advertised by every instance of the
+// external service (e.g. each gorouter) so that routes are emitted often
+// enough for the most demanding live instance
+type externalServices struct {
+	services map[string]*externalService
+}
+
+func newExternalServices() *externalServices {
+	return &externalServices{services: map[string]*externalService{}}
+}
+
+// update records the greeting and returns true if the instance was not known
+// before or changed its intervals
+func (e *externalServices) update(greeting externalServiceGreeting, now time.Time) bool {
+	service, ok := e.services[greeting.id]
+	if !ok {
+		e.services[greeting.id] = &externalService{
+			registerInterval: greeting.registerInterval,
+			pruneThreshold:   greeting.pruneThreshold,
+			lastSeen:         now,
+		}
+		return true
+	}
+
+	changed := service.registerInterval != greeting.registerInterval ||
+		service.pruneThreshold != greeting.pruneThreshold
+	service.registerInterval = greeting.registerInterval
+	service.pruneThreshold = greeting.pruneThreshold
+	service.lastSeen = now
+	return changed
+}
+
+// expire removes the instances that have not advertised themselves within
+// routerExpiryGreetings prune thresholds and returns their ids
+func (e *externalServices) expire(now time.Time) []string {
+	var expired []string
+	for id, service := range e.services {
+		ttl := routerExpiryGreetings * service.pruneThreshold
+		if ttl <= 0 {
+			ttl = routerExpiryGreetings * service.registerInterval
+		}
+		if now.Sub(service.lastSeen) > ttl {
+			delete(e.services, id)
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
+
+func (e *externalServices) len() int {
+	return len(e.services)
+}
+
+// registerInterval returns the smallest register interval among the live
+// instances, or zero if there are none
+func (e *externalServices) registerInterval() time.Duration {
+	var interval time.Duration
+	for _, service := range e.services {
+		if service.registerInterval <= 0 {
+			continue
+		}
+		if interval == 0 || service.registerInterval < interval {
+			interval = service.registerInterval
+		}
+	}
+	return interval
+}
+
+// pruneThreshold returns the smallest prune threshold among the live
+// instances, or zero if there are none
+func (e *externalServices) pruneThreshold() time.Duration {
+	var threshold time.Duration
+	for _, service := range e.services {
+		if service.pruneThreshold <= 0 {
+			continue
+		}
+		if threshold == 0 || service.pruneThreshold < threshold {
+			threshold = service.pruneThreshold
+		}
+	}
+	return threshold
+}
@@ -2,9 +2,9 @@ package scheduler
 
 import (
 	"encoding/json"
-	"fmt"
 	"math/rand"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/clock"
@@ -17,10 +17,15 @@ import (
 
 type RouteBroadcastScheduler struct {
 	natsClient           diegonats.NATSClient
-	externalServiceName  string
+	subjects             routingtable.SubjectLayout
 	clock                clock.Clock
 	emitCh               chan struct{}
-	externalServiceStart chan time.Duration
+	externalServiceStart chan externalServiceGreeting
+	reconnected          chan struct{}
+
+	services         *externalServices
+	lastEmitted      time.Time
+	registerInterval int64
 
 	logger lager.Logger
 }
@@ -29,19 +34,21 @@ func NewRouteBroadcastScheduler(
 	clock clock.Clock,
 	natsClient diegonats.NATSClient,
 	logger lager.Logger,
-	externalServiceName string,
+	subjects routingtable.SubjectLayout,
 	emitCh chan struct{},
 ) *RouteBroadcastScheduler {
 	return &RouteBroadcastScheduler{
-		natsClient:          natsClient,
-		externalServiceName: externalServiceName,
+		natsClient: natsClient,
+		subjects:   subjects,
 
 		clock:  clock,
 		emitCh: emitCh,
 
-		externalServiceStart: make(chan time.Duration),
+		externalServiceStart: make(chan externalServiceGreeting),
+		reconnected:          make(chan struct{}, 1),
+		services:             newExternalServices(),
 
-		logger: logger.Session("route-broadcast-scheduler", lager.Data{"name": externalServiceName}),
+		logger: logger.Session("route-broadcast-scheduler", lager.Data{"name": subjects.Service}),
 	}
 }
 
@@ -57,6 +64,16 @@ func (s *RouteBroadcastScheduler) Run(signals <-chan os.Signal, ready chan<- str
 		return err
 	}
 
+	// routes published while disconnected were dropped and routers may have
+	// pruned ours in the meantime, so greet and emit right after reconnecting
+	deregisterReconnect := s.natsClient.OnReconnect(func() {
+		select {
+		case s.reconnected <- struct{}{}:
+		default:
+		}
+	})
+	defer deregisterReconnect()
+
 	close(ready)
 	s.logger.Info("started")
 
@@ -74,27 +91,57 @@ GREET_LOOP:
 		}
 
 		select {
-		case registerInterval = <-s.externalServiceStart:
-			s.logger.Info("received-external-service-registry-interval", lager.Data{"interval": registerInterval.String()})
+		case greeting := <-s.externalServiceStart:
+			s.services.update(greeting, s.clock.Now())
+			registerInterval = s.services.registerInterval()
+			if registerInterval <= 0 {
+				s.logger.Info("ignoring-invalid-external-service-registry-interval", lager.Data{"id": greeting.id})
+				continue
+			}
+			s.logger.Info("received-external-service-registry-interval", lager.Data{"interval": registerInterval.String(), "id": greeting.id})
 			break GREET_LOOP
 		case <-retryGreetingTicker.C():
 			s.logger.Info("retrying")
+		case <-s.reconnected:
+			s.logger.Info("nats-reconnected-retrying")
 		case <-signals:
 			s.logger.Info("stopping")
 			return nil
 		}
 	}
 	retryGreetingTicker.Stop()
+	s.checkPruneThreshold(registerInterval)
+	s.setRegisterInterval(registerInterval)
 
 	// now keep emitting at the desired interval
 	emitTicker := s.clock.NewTicker(registerInterval)
+	s.lastEmitted = s.clock.Now()
+
+	// keep greeting the external service so that instances which stop
+	// answering can be expired
+	greetInterval := s.greetInterval()
+	greetTicker := s.clock.NewTicker(greetInterval)
 
 	randSource := rand.New(rand.NewSource(time.Now().UnixNano()))
 	s.logger.Info("for loop")
 	for {
 		select {
-		case registerInterval = <-s.externalServiceStart:
-			s.logger.Info("received-new-external-service-prune-interval", lager.Data{"interval": registerInterval.String()})
+		case greeting := <-s.externalServiceStart:
+			changed := s.services.update(greeting, s.clock.Now())
+			if !changed && !greeting.started {
+				continue
+			}
+
+			if interval := s.services.registerInterval(); interval > 0 {
+				registerInterval = interval
+			}
+			s.logger.Info("received-new-external-service-prune-interval", lager.Data{
+				"interval":          registerInterval.String(),
+				"id":                greeting.id,
+				"external-services": s.services.len(),
+			})
+			s.checkPruneThreshold(registerInterval)
+			s.setRegisterInterval(registerInterval)
 			jitterInterval := randSource.Int63n(int64(0.2 * float64(registerInterval)))
 			s.clock.Sleep(time.Duration(jitterInterval))
 			emitTicker.Stop()
@@ -103,9 +150,44 @@ GREET_LOOP:
 		case <-emitTicker.C():
 			s.logger.Info("emitting-routes")
 			s.emit()
+		case <-s.reconnected:
+			s.logger.Info("nats-reconnected-emitting-routes")
+			err := s.greetExternalService(replyUuid.String())
+			if err != nil {
+				s.logger.Error("failed-to-greet-external-service", err)
+			}
+			emitTicker.Stop()
+			emitTicker = s.clock.NewTicker(registerInterval)
+			s.emit()
+		case <-greetTicker.C():
+			if expired := s.services.expire(s.clock.Now()); len(expired) > 0 {
+				s.logger.Info("expired-external-services", lager.Data{
+					"ids":               expired,
+					"external-services": s.services.len(),
+				})
+				if interval := s.services.registerInterval(); interval > 0 && interval != registerInterval {
+					registerInterval = interval
+					s.logger.Info("adjusting-register-interval", lager.Data{"interval": registerInterval.String()})
+					s.setRegisterInterval(registerInterval)
+					emitTicker.Stop()
+					emitTicker = s.clock.NewTicker(registerInterval)
+				}
+			}
+
+			if interval := s.greetInterval(); interval != greetInterval {
+				greetInterval = interval
+				greetTicker.Stop()
+				greetTicker = s.clock.NewTicker(greetInterval)
+			}
+
+			err := s.greetExternalService(replyUuid.String())
+			if err != nil {
+				s.logger.Error("failed-to-greet-external-service", err)
+			}
 		case <-signals:
 			s.logger.Info("stopping")
 			emitTicker.Stop()
+			greetTicker.Stop()
 			return nil
 		}
 	}
@@ -113,39 +195,82 @@ GREET_LOOP:
 	return nil
 }
 
+// greetInterval is the smallest prune threshold among the live instances of
+// the external service, falling back to the register interval
+func (s *RouteBroadcastScheduler) greetInterval() time.Duration {
+	if threshold := s.services.pruneThreshold(); threshold > 0 {
+		return threshold
+	}
+	if interval := s.services.registerInterval(); interval > 0 {
+		return interval
+	}
+	return time.Minute
+}
+
+func (s *RouteBroadcastScheduler) checkPruneThreshold(registerInterval time.Duration) {
+	pruneThreshold := s.services.pruneThreshold()
+	if pruneThreshold > 0 && registerInterval >= pruneThreshold {
+		s.logger.Info("register-interval-exceeds-prune-threshold", lager.Data{
+			"interval":        registerInterval.String(),
+			"prune-threshold": pruneThreshold.String(),
+		})
+	}
+}
+
 func (s *RouteBroadcastScheduler) emit() {
 	select {
 	case s.emitCh <- struct{}{}:
+		s.lastEmitted = s.clock.Now()
 	default:
 		s.logger.Debug("emit-already-in-progress")
+		pruneThreshold := s.services.pruneThreshold()
+		if pruneThreshold > 0 && s.clock.Since(s.lastEmitted) >= pruneThreshold {
+			s.logger.Info("emit-cycle-exceeds-prune-threshold", lager.Data{
+				"since-last-emit": s.clock.Since(s.lastEmitted).String(),
+				"prune-threshold": pruneThreshold.String(),
+			})
+		}
 	}
 }
 
+// listenForExternalService subscribes to the start subjects of the default
+// service and of every isolation segment service
 func (s *RouteBroadcastScheduler) listenForExternalService(replyUUID string) error {
-	_, err := s.natsClient.Subscribe(fmt.Sprintf("%s.start", s.externalServiceName), s.handleExternalServiceStart)
-	if err != nil {
-		return err
+	for _, service := range s.subjects.Services() {
+		_, err := s.natsClient.Subscribe(s.subjects.StartSubject(service), s.handleExternalServiceStart)
+		if err != nil {
+			return err
+		}
 	}
 
-	sub, err := s.natsClient.Subscribe(replyUUID, s.handleExternalServiceStart)
+	_, err := s.natsClient.Subscribe(replyUUID, s.handleExternalServiceGreetingReply)
 	if err != nil {
 		return err
 	}
-	sub.AutoUnsubscribe(1)
 
 	return nil
 }
 
 func (s *RouteBroadcastScheduler) greetExternalService(replyUUID string) error {
-	err := s.natsClient.PublishRequest(fmt.Sprintf("%s.greet", s.externalServiceName), replyUUID, []byte{})
-	if err != nil {
-		return err
+	for _, service := range s.subjects.Services() {
+		err := s.natsClient.PublishRequest(s.subjects.GreetSubject(service), replyUUID, []byte{})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 func (s *RouteBroadcastScheduler) handleExternalServiceStart(msg *nats.Msg) {
+	s.handleExternalServiceGreeting(msg, true)
+}
+
+func (s *RouteBroadcastScheduler) handleExternalServiceGreetingReply(msg *nats.Msg) {
+	s.handleExternalServiceGreeting(msg, false)
+}
+
+func (s *RouteBroadcastScheduler) handleExternalServiceGreeting(msg *nats.Msg, started bool) {
 	var response routingtable.ExternalServiceGreetingMessage
 
 	err := json.Unmarshal(msg.Data, &response)
@@ -156,8 +281,22 @@ func (s *RouteBroadcastScheduler) handleExternalServiceStart(msg *nats.Msg) {
 		return
 	}
 
-	greetInterval := response.MinimumRegisterInterval
-	s.externalServiceStart <- time.Duration(greetInterval) * time.Second
+	s.externalServiceStart <- externalServiceGreeting{
+		id:               externalServiceID(response.ID, msg.Reply, response.Hosts),
+		registerInterval: time.Duration(response.MinimumRegisterInterval) * time.Second,
+		pruneThreshold:   time.Duration(response.PruneThresholdInSeconds) * time.Second,
+		started:          started,
+	}
+}
+
+// RegisterInterval returns the interval at which routes are currently
+// emitted, or zero until the external service has been heard from
+func (s *RouteBroadcastScheduler) RegisterInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.registerInterval))
+}
+
+func (s *RouteBroadcastScheduler) setRegisterInterval(interval time.Duration) {
+	atomic.StoreInt64(&s.registerInterval, int64(interval))
 }
 
 func (s *RouteBroadcastScheduler) EmitCh() chan struct{} {
@@ -8,10 +8,12 @@ import (
 	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/route-emitter/diegonats"
+	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/scheduler"
 	"github.com/nats-io/nats.go"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/tedsuo/ifrit"
 )
 
@@ -22,6 +24,7 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 		process         ifrit.Process
 		clock           *fakeclock.FakeClock
 		emitCh          chan struct{}
+		logger          *lagertest.TestLogger
 
 		shutdown chan struct{}
 
@@ -51,8 +54,8 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 			})
 
 			JustBeforeEach(func() {
-				logger := lagertest.NewTestLogger("test")
-				schedulerRunner = scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, prefix, emitCh)
+				logger = lagertest.NewTestLogger("test")
+				schedulerRunner = scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, routingtable.NewSubjectLayout("", prefix, nil), emitCh)
 
 				shutdown = make(chan struct{})
 
@@ -98,10 +101,25 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 							Eventually(schedulerRunner.EmitCh()).Should(Receive())
 						})
 
+						It("reports the register interval", func() {
+							Eventually(schedulerRunner.RegisterInterval).Should(Equal(2 * time.Second))
+						})
+
 						It("should only greet the external service once", func() {
 							Eventually(greetings).Should(Receive())
 							Consistently(greetings, 1).ShouldNot(Receive())
 						})
+
+						Context("when nats reconnects", func() {
+							It("greets the external service and emits right away", func() {
+								Eventually(greetings).Should(Receive())
+								Eventually(schedulerRunner.RegisterInterval).Should(Equal(2 * time.Second))
+
+								natsClient.Reconnect()
+								Eventually(greetings).Should(Receive())
+								Eventually(schedulerRunner.EmitCh()).Should(Receive())
+							})
+						})
 					})
 				})
 
@@ -202,6 +220,92 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 					})
 				})
 
+				Context("when several instances of the external service advertise different intervals", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-1", "minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 3}`),
+						}
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-2", "minimumRegisterIntervalInSeconds":5, "pruneThresholdInSeconds": 30}`),
+						}
+
+						// the second instance starting triggers an emit after a jitter
+						Consistently(schedulerRunner.EmitCh()).ShouldNot(Receive())
+						clock.Increment(200 * time.Millisecond)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+					})
+
+					It("emits at the smallest interval among the instances", func() {
+						clock.WaitForWatcherAndIncrement(time.Second)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+
+						clock.WaitForWatcherAndIncrement(time.Second)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+					})
+
+					It("greets the external service again every prune threshold", func() {
+						Eventually(greetings).Should(Receive())
+						Consistently(greetings).ShouldNot(Receive())
+
+						clock.WaitForWatcherAndIncrement(3 * time.Second)
+						Eventually(greetings).Should(Receive())
+					})
+
+					Context("when an instance stops advertising", func() {
+						It("is expired and the interval of the remaining instances is used", func() {
+							for i := 0; i < 3; i++ {
+								Eventually(greetings).Should(Receive())
+								clock.WaitForWatcherAndIncrement(3 * time.Second)
+							}
+
+							Eventually(logger).Should(gbytes.Say("expired-external-services.*router-1"))
+							Eventually(logger).Should(gbytes.Say(`adjusting-register-interval.*"interval":"5s"`))
+						})
+					})
+				})
+
+				Context("when instances of the external service do not send an id", func() {
+					It("tells them apart by their hosts", func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"hosts":["10.0.0.1"], "minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 3}`),
+						}
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"hosts":["10.0.0.2"], "minimumRegisterIntervalInSeconds":5, "pruneThresholdInSeconds": 30}`),
+						}
+
+						Eventually(logger).Should(gbytes.Say(`received-new-external-service-prune-interval.*"external-services":2,"id":"hosts:10.0.0.2","interval":"1s"`))
+						clock.Increment(200 * time.Millisecond)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+					})
+
+					It("tells them apart by their reply subjects", func() {
+						natsStartMessages <- &nats.Msg{
+							Reply: "inbox-1",
+							Data:  []byte(`{"minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 3}`),
+						}
+						natsStartMessages <- &nats.Msg{
+							Reply: "inbox-2",
+							Data:  []byte(`{"minimumRegisterIntervalInSeconds":5, "pruneThresholdInSeconds": 30}`),
+						}
+
+						Eventually(logger).Should(gbytes.Say(`received-new-external-service-prune-interval.*"external-services":2,"id":"reply:inbox-2","interval":"1s"`))
+						clock.Increment(200 * time.Millisecond)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+					})
+				})
+
+				Context("when the register interval is not below the prune threshold", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"minimumRegisterIntervalInSeconds":3, "pruneThresholdInSeconds": 2}`),
+						}
+					})
+
+					It("logs a warning", func() {
+						Eventually(logger).Should(gbytes.Say("register-interval-exceeds-prune-threshold"))
+					})
+				})
+
 				Context("if it never hears anything from a external service anywhere", func() {
 					It("should still be able to shutdown", func() {
 						process.Signal(os.Interrupt)
@@ -214,4 +318,51 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 
 	testRouteBroadcastScheduler("router")
 	testRouteBroadcastScheduler("service-discovery")
+
+	Context("with a subject namespace and isolation segment services", func() {
+		BeforeEach(func() {
+			natsClient = diegonats.NewFakeClient()
+			clock = fakeclock.NewFakeClock(time.Now())
+			emitCh = make(chan struct{}, 1)
+			logger = lagertest.NewTestLogger("test")
+
+			subjects := routingtable.NewSubjectLayout("tenant-a", "router", map[string]string{"segment-a": "router-segment-a"})
+			schedulerRunner = scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, subjects, emitCh)
+			process = ifrit.Invoke(schedulerRunner)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("listens for the start message of every service", func() {
+			Expect(natsClient.SubjectCallbacks("tenant-a.router.start")).To(HaveLen(1))
+			Expect(natsClient.SubjectCallbacks("tenant-a.router-segment-a.start")).To(HaveLen(1))
+		})
+
+		It("greets every service", func() {
+			Eventually(func() int { return len(natsClient.PublishedMessages("tenant-a.router.greet")) }).Should(Equal(1))
+			Eventually(func() int { return len(natsClient.PublishedMessages("tenant-a.router-segment-a.greet")) }).Should(Equal(1))
+		})
+
+		It("deregisters its reconnect handler when it exits", func() {
+			Expect(natsClient.HandlerCount()).To(Equal(1))
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(natsClient.HandlerCount()).To(Equal(0))
+
+			process = ifrit.Invoke(schedulerRunner)
+			Expect(natsClient.HandlerCount()).To(Equal(1))
+		})
+
+		It("uses the register interval of a segment router", func() {
+			callbacks := natsClient.SubjectCallbacks("tenant-a.router-segment-a.start")
+			Expect(callbacks).To(HaveLen(1))
+			go callbacks[0](&nats.Msg{Data: []byte(`{"minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 3}`)})
+
+			Eventually(schedulerRunner.RegisterInterval).Should(Equal(time.Second))
+		})
+	})
 })
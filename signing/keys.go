@@ -0,0 +1,129 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	AlgorithmEd25519    = "ed25519"
+	AlgorithmHMACSHA256 = "hmac-sha256"
+)
+
+var (
+	ErrEmptyKeyID           = errors.New("signing key id is empty")
+	ErrUnsupportedKeyType   = errors.New("key file does not contain an ed25519 key")
+	ErrEmptyHMACSecret      = errors.New("hmac secret is empty")
+	ErrKeyCannotSign        = errors.New("key cannot be used for signing")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// Key is a named ed25519 or HMAC key. Ed25519 keys loaded from a public key
+// can only verify signatures, all other keys can both sign and verify.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	secret     []byte
+}
+
+func NewEd25519SigningKey(id string, privateKey ed25519.PrivateKey) Key {
+	return Key{
+		ID:         id,
+		Algorithm:  AlgorithmEd25519,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}
+}
+
+func NewEd25519VerificationKey(id string, publicKey ed25519.PublicKey) Key {
+	return Key{
+		ID:        id,
+		Algorithm: AlgorithmEd25519,
+		publicKey: publicKey,
+	}
+}
+
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{
+		ID:        id,
+		Algorithm: AlgorithmHMACSHA256,
+		secret:    secret,
+	}
+}
+
+// LoadKey reads a key from a file. Ed25519 keys are PEM encoded, either as a
+// PKCS #8 "PRIVATE KEY" or a PKIX "PUBLIC KEY". HMAC secrets are read as is,
+// ignoring surrounding whitespace.
+func LoadKey(id, algorithm, path string) (Key, error) {
+	if id == "" {
+		return Key{}, ErrEmptyKeyID
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch algorithm {
+	case AlgorithmEd25519:
+		return parseEd25519Key(id, data)
+	case AlgorithmHMACSHA256:
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return Key{}, ErrEmptyHMACSecret
+		}
+		return NewHMACKey(id, secret), nil
+	default:
+		return Key{}, fmt.Errorf("%s: %q", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
+
+func (k Key) canSign() bool {
+	switch k.Algorithm {
+	case AlgorithmEd25519:
+		return k.privateKey != nil
+	case AlgorithmHMACSHA256:
+		return len(k.secret) > 0
+	}
+	return false
+}
+
+func parseEd25519Key(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("key file does not contain a PEM block")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return Key{}, ErrUnsupportedKeyType
+		}
+		return NewEd25519SigningKey(id, privateKey), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return Key{}, ErrUnsupportedKeyType
+		}
+		return NewEd25519VerificationKey(id, publicKey), nil
+	default:
+		return Key{}, fmt.Errorf("unexpected PEM block type %q", block.Type)
+	}
+}
@@ -0,0 +1,94 @@
+package signing_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/route-emitter/signing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadKey", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "signing-keys")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, data, 0600)).To(Succeed())
+		return path
+	}
+
+	It("loads a PEM encoded ed25519 key pair", func() {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+		publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		privatePath := writeFile("private.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+		publicPath := writeFile("public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+		signingKey, err := signing.LoadKey("key-1", signing.AlgorithmEd25519, privatePath)
+		Expect(err).NotTo(HaveOccurred())
+		verificationKey, err := signing.LoadKey("key-1", signing.AlgorithmEd25519, publicPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		clock := fakeclock.NewFakeClock(time.Now())
+		signer, err := signing.NewSigner(signingKey, clock)
+		Expect(err).NotTo(HaveOccurred())
+		signed, err := signer.Sign([]byte(`{"host":"1.1.1.1"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = signing.NewVerifier([]signing.Key{verificationKey}, time.Minute, clock).Verify(signed)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("loads an HMAC secret, ignoring surrounding whitespace", func() {
+		path := writeFile("secret", []byte("  secret\n"))
+
+		key, err := signing.LoadKey("hmac-1", signing.AlgorithmHMACSHA256, path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(signing.NewHMACKey("hmac-1", []byte("secret"))))
+	})
+
+	It("rejects an empty HMAC secret", func() {
+		path := writeFile("secret", []byte("\n"))
+
+		_, err := signing.LoadKey("hmac-1", signing.AlgorithmHMACSHA256, path)
+		Expect(err).To(Equal(signing.ErrEmptyHMACSecret))
+	})
+
+	It("rejects an unknown algorithm", func() {
+		path := writeFile("secret", []byte("secret"))
+
+		_, err := signing.LoadKey("key-1", "rsa", path)
+		Expect(err).To(MatchError(ContainSubstring("unsupported signing algorithm")))
+	})
+
+	It("requires a key id", func() {
+		path := writeFile("secret", []byte("secret"))
+
+		_, err := signing.LoadKey("", signing.AlgorithmHMACSHA256, path)
+		Expect(err).To(Equal(signing.ErrEmptyKeyID))
+	})
+})
@@ -0,0 +1 @@
+package signing // import "code.cloudfoundry.org/route-emitter/signing"
@@ -0,0 +1,159 @@
+package signing
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+// DefaultKeyReloadInterval is how often the key files are checked for
+// rotation when no interval is configured
+const DefaultKeyReloadInterval = 10 * time.Second
+
+// KeyFiles locates a signing key. The key id is read from KeyIDFile when it is
+// set, so that it can rotate together with the key, and is KeyID otherwise.
+type KeyFiles struct {
+	KeyID     string
+	KeyIDFile string
+	Algorithm string
+	KeyFile   string
+}
+
+// Load reads the key id and the key
+func (f KeyFiles) Load() (Key, error) {
+	keyID := f.KeyID
+	if f.KeyIDFile != "" {
+		data, err := ioutil.ReadFile(f.KeyIDFile)
+		if err != nil {
+			return Key{}, err
+		}
+		keyID = strings.TrimSpace(string(data))
+	}
+	return LoadKey(keyID, f.Algorithm, f.KeyFile)
+}
+
+func (f KeyFiles) files() []string {
+	if f.KeyIDFile == "" {
+		return []string{f.KeyFile}
+	}
+	return []string{f.KeyIDFile, f.KeyFile}
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// KeyReloader is an ifrit runner that watches the key files of a signer and
+// swaps in the new key and key id when they rotate. A change is only applied
+// once the files have not changed for a poll interval, so the key file and
+// the key id file can be replaced one after the other. A key that fails to
+// load keeps the previous key in place.
+type KeyReloader struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	signer       *Signer
+	keyFiles     KeyFiles
+	pollInterval time.Duration
+
+	// applied holds the stats of the files the current key was loaded from,
+	// pending the stats of changed files waiting to settle
+	applied map[string]fileStat
+	pending map[string]fileStat
+}
+
+func NewKeyReloader(logger lager.Logger, clock clock.Clock, signer *Signer, keyFiles KeyFiles, pollInterval time.Duration) *KeyReloader {
+	if pollInterval <= 0 {
+		pollInterval = DefaultKeyReloadInterval
+	}
+
+	reloader := &KeyReloader{
+		logger:       logger.Session("signing-key-reloader"),
+		clock:        clock,
+		signer:       signer,
+		keyFiles:     keyFiles,
+		pollInterval: pollInterval,
+	}
+	reloader.applied, _ = reloader.stat()
+	return reloader
+}
+
+func (r *KeyReloader) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.logger.Info("started", lager.Data{"files": r.keyFiles.files(), "poll-interval": r.pollInterval.String()})
+	defer r.logger.Info("finished")
+
+	ticker := r.clock.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C():
+			r.check()
+		}
+	}
+}
+
+func (r *KeyReloader) check() {
+	stats, err := r.stat()
+	if err != nil {
+		r.logger.Error("failed-to-stat-key-files", err)
+		return
+	}
+
+	if sameStats(stats, r.applied) {
+		r.pending = nil
+		return
+	}
+	if !sameStats(stats, r.pending) {
+		r.logger.Info("key-files-changed")
+		r.pending = stats
+		return
+	}
+
+	r.applied = stats
+	r.pending = nil
+
+	key, err := r.keyFiles.Load()
+	if err != nil {
+		r.logger.Error("failed-to-reload-key", err)
+		return
+	}
+	err = r.signer.SetKey(key)
+	if err != nil {
+		r.logger.Error("failed-to-reload-key", err)
+		return
+	}
+	r.logger.Info("reloaded-key", lager.Data{"key-id": key.ID})
+}
+
+func (r *KeyReloader) stat() (map[string]fileStat, error) {
+	stats := map[string]fileStat{}
+	for _, file := range r.keyFiles.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		stats[file] = fileStat{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stats, nil
+}
+
+func sameStats(a, b map[string]fileStat) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, stat := range a {
+		if b[file] != stat {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package signing_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/signing"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("KeyReloader", func() {
+	var (
+		dir       string
+		logger    *lagertest.TestLogger
+		clock     *fakeclock.FakeClock
+		keyFiles  signing.KeyFiles
+		signer    *signing.Signer
+		process   ifrit.Process
+		writeFile func(path, data string)
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "signing-keys")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+
+		writeFile = func(path, data string) {
+			Expect(ioutil.WriteFile(path, []byte(data), 0600)).To(Succeed())
+		}
+
+		keyFiles = signing.KeyFiles{
+			KeyIDFile: filepath.Join(dir, "key-id"),
+			Algorithm: signing.AlgorithmHMACSHA256,
+			KeyFile:   filepath.Join(dir, "secret"),
+		}
+		writeFile(keyFiles.KeyIDFile, "key-1\n")
+		writeFile(keyFiles.KeyFile, "secret-1")
+
+		key, err := keyFiles.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(signing.NewHMACKey("key-1", []byte("secret-1"))))
+
+		signer, err = signing.NewSigner(key, clock)
+		Expect(err).NotTo(HaveOccurred())
+
+		process = ifrit.Invoke(signing.NewKeyReloader(logger, clock, signer, keyFiles, time.Second))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		os.RemoveAll(dir)
+	})
+
+	It("swaps in the rotated key and key id once the files settle", func() {
+		writeFile(keyFiles.KeyFile, "secret-2")
+		clock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(logger).Should(gbytes.Say("key-files-changed"))
+
+		writeFile(keyFiles.KeyIDFile, "key-2")
+		clock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(logger).Should(gbytes.Say("key-files-changed"))
+		Consistently(signer.KeyID).Should(Equal("key-1"))
+
+		clock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(logger).Should(gbytes.Say("reloaded-key"))
+		Expect(signer.KeyID()).To(Equal("key-2"))
+
+		signed, err := signer.Sign([]byte(`{}`))
+		Expect(err).NotTo(HaveOccurred())
+		verifier := signing.NewVerifier([]signing.Key{signing.NewHMACKey("key-2", []byte("secret-2"))}, time.Minute, clock)
+		keyID, err := verifier.Verify(signed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keyID).To(Equal("key-2"))
+	})
+
+	It("keeps the previous key when the new one fails to load", func() {
+		writeFile(keyFiles.KeyFile, "\n")
+		clock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(logger).Should(gbytes.Say("key-files-changed"))
+		clock.WaitForWatcherAndIncrement(time.Second)
+
+		Eventually(logger).Should(gbytes.Say("failed-to-reload-key"))
+		Expect(signer.KeyID()).To(Equal("key-1"))
+	})
+})
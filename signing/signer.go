@@ -0,0 +1,125 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+
+	"code.cloudfoundry.org/clock"
+)
+
+// Signed payloads are JSON objects extended with three fields. The key id and
+// the timestamp (unix nanoseconds) are appended to the original object, and
+// the resulting bytes are signed. The base64 encoded signature is then
+// appended as the last field, so verifying a payload only requires removing
+// that trailing field; no canonical re-encoding of the JSON is needed.
+const (
+	KeyIDField     = "signature_key_id"
+	TimestampField = "signature_timestamp"
+	SignatureField = "signature"
+)
+
+var ErrNotJSONObject = errors.New("payload is not a JSON object")
+
+type Signer struct {
+	lock  sync.RWMutex
+	key   Key
+	clock clock.Clock
+}
+
+func NewSigner(key Key, clock clock.Clock) (*Signer, error) {
+	err := validateSigningKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{key: key, clock: clock}, nil
+}
+
+func validateSigningKey(key Key) error {
+	if key.ID == "" {
+		return ErrEmptyKeyID
+	}
+	if !key.canSign() {
+		return ErrKeyCannotSign
+	}
+	return nil
+}
+
+func (s *Signer) KeyID() string {
+	return s.currentKey().ID
+}
+
+// SetKey replaces the key and key id used for the following signatures
+func (s *Signer) SetKey(key Key) error {
+	err := validateSigningKey(key)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.key = key
+	return nil
+}
+
+func (s *Signer) currentKey() Key {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.key
+}
+
+// Sign returns the payload with the key id, timestamp and signature fields
+// added. The payload must be a JSON encoded object.
+func (s *Signer) Sign(payload []byte) ([]byte, error) {
+	key := s.currentKey()
+	keyID, err := json.Marshal(key.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := appendField(payload, KeyIDField, keyID)
+	if err != nil {
+		return nil, err
+	}
+	signed, err = appendField(signed, TimestampField, []byte(strconv.FormatInt(s.clock.Now().UnixNano(), 10)))
+	if err != nil {
+		return nil, err
+	}
+
+	signature := base64.StdEncoding.EncodeToString(sign(key, signed))
+	return appendField(signed, SignatureField, []byte(`"`+signature+`"`))
+}
+
+func sign(key Key, data []byte) []byte {
+	if key.Algorithm == AlgorithmEd25519 {
+		return ed25519.Sign(key.privateKey, data)
+	}
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func appendField(object []byte, name string, value []byte) ([]byte, error) {
+	object = bytes.TrimSpace(object)
+	if len(object) < 2 || object[0] != '{' || object[len(object)-1] != '}' {
+		return nil, ErrNotJSONObject
+	}
+
+	body := object[:len(object)-1]
+	result := make([]byte, 0, len(object)+len(name)+len(value)+4)
+	result = append(result, body...)
+	if len(bytes.TrimSpace(body[1:])) > 0 {
+		result = append(result, ',')
+	}
+	result = append(result, '"')
+	result = append(result, name...)
+	result = append(result, '"', ':')
+	result = append(result, value...)
+	return append(result, '}'), nil
+}
@@ -0,0 +1,173 @@
+package signing_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/route-emitter/signing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signer and Verifier", func() {
+	var (
+		clock      *fakeclock.FakeClock
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+		signer     *signing.Signer
+		verifier   *signing.Verifier
+		payload    []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		clock = fakeclock.NewFakeClock(time.Now())
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		signer, err = signing.NewSigner(signing.NewEd25519SigningKey("key-1", privateKey), clock)
+		Expect(err).NotTo(HaveOccurred())
+		verifier = signing.NewVerifier([]signing.Key{signing.NewEd25519VerificationKey("key-1", publicKey)}, time.Minute, clock)
+
+		payload = []byte(`{"host":"1.1.1.1","port":61000,"uris":["foo.example.com"]}`)
+	})
+
+	It("adds the key id, timestamp and signature to the payload", func() {
+		signed, err := signer.Sign(payload)
+		Expect(err).NotTo(HaveOccurred())
+
+		fields := map[string]interface{}{}
+		Expect(json.Unmarshal(signed, &fields)).To(Succeed())
+		Expect(fields).To(HaveKeyWithValue("host", "1.1.1.1"))
+		Expect(fields).To(HaveKeyWithValue("signature_key_id", "key-1"))
+		Expect(fields).To(HaveKeyWithValue("signature_timestamp", BeNumerically("==", clock.Now().UnixNano())))
+		Expect(fields).To(HaveKey("signature"))
+	})
+
+	It("signs with the key it is switched to", func() {
+		Expect(signer.SetKey(signing.NewHMACKey("key-2", []byte("secret")))).To(Succeed())
+		Expect(signer.KeyID()).To(Equal("key-2"))
+
+		signed, err := signer.Sign(payload)
+		Expect(err).NotTo(HaveOccurred())
+		verifier = signing.NewVerifier([]signing.Key{signing.NewHMACKey("key-2", []byte("secret"))}, time.Minute, clock)
+		keyID, err := verifier.Verify(signed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keyID).To(Equal("key-2"))
+	})
+
+	It("refuses to switch to a key that cannot sign", func() {
+		Expect(signer.SetKey(signing.NewEd25519VerificationKey("key-2", publicKey))).To(Equal(signing.ErrKeyCannotSign))
+		Expect(signer.KeyID()).To(Equal("key-1"))
+	})
+
+	It("verifies its own signatures", func() {
+		signed, err := signer.Sign(payload)
+		Expect(err).NotTo(HaveOccurred())
+
+		keyID, err := verifier.Verify(signed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keyID).To(Equal("key-1"))
+	})
+
+	It("rejects tampered payloads", func() {
+		signed, err := signer.Sign(payload)
+		Expect(err).NotTo(HaveOccurred())
+
+		tampered := bytes.Replace(signed, []byte("foo.example.com"), []byte("bar.example.com"), 1)
+		_, err = verifier.Verify(tampered)
+		Expect(err).To(Equal(signing.ErrInvalidSignature))
+	})
+
+	It("rejects unsigned payloads", func() {
+		_, err := verifier.Verify(payload)
+		Expect(err).To(Equal(signing.ErrUnsigned))
+	})
+
+	It("rejects payloads signed with an unknown key", func() {
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		otherSigner, err := signing.NewSigner(signing.NewEd25519SigningKey("key-2", otherKey), clock)
+		Expect(err).NotTo(HaveOccurred())
+
+		signed, err := otherSigner.Sign(payload)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = verifier.Verify(signed)
+		Expect(err).To(Equal(signing.ErrUnknownKey))
+	})
+
+	It("rejects stale payloads", func() {
+		signed, err := signer.Sign(payload)
+		Expect(err).NotTo(HaveOccurred())
+
+		clock.Increment(time.Minute + time.Second)
+		_, err = verifier.Verify(signed)
+		Expect(err).To(Equal(signing.ErrStale))
+	})
+
+	It("rejects payloads that are not JSON objects", func() {
+		_, err := signer.Sign([]byte(`["foo"]`))
+		Expect(err).To(Equal(signing.ErrNotJSONObject))
+	})
+
+	It("refuses to sign with a verification key", func() {
+		_, err := signing.NewSigner(signing.NewEd25519VerificationKey("key-1", publicKey), clock)
+		Expect(err).To(Equal(signing.ErrKeyCannotSign))
+	})
+
+	Context("with HMAC keys", func() {
+		BeforeEach(func() {
+			var err error
+			signer, err = signing.NewSigner(signing.NewHMACKey("hmac-1", []byte("secret")), clock)
+			Expect(err).NotTo(HaveOccurred())
+			verifier = signing.NewVerifier([]signing.Key{signing.NewHMACKey("hmac-1", []byte("secret"))}, time.Minute, clock)
+		})
+
+		It("verifies signatures made with the shared secret", func() {
+			signed, err := signer.Sign(payload)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = verifier.Verify(signed)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects signatures made with another secret", func() {
+			otherSigner, err := signing.NewSigner(signing.NewHMACKey("hmac-1", []byte("other-secret")), clock)
+			Expect(err).NotTo(HaveOccurred())
+
+			signed, err := otherSigner.Sign(payload)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = verifier.Verify(signed)
+			Expect(err).To(Equal(signing.ErrInvalidSignature))
+		})
+	})
+
+	Context("while rotating keys", func() {
+		It("accepts both the old and the new key id", func() {
+			newPublicKey, newPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			newSigner, err := signing.NewSigner(signing.NewEd25519SigningKey("key-2", newPrivateKey), clock)
+			Expect(err).NotTo(HaveOccurred())
+
+			verifier = signing.NewVerifier([]signing.Key{
+				signing.NewEd25519VerificationKey("key-1", publicKey),
+				signing.NewEd25519VerificationKey("key-2", newPublicKey),
+			}, time.Minute, clock)
+
+			oldSigned, err := signer.Sign(payload)
+			Expect(err).NotTo(HaveOccurred())
+			newSigned, err := newSigner.Sign(payload)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(oldSigned)).To(Equal("key-1"))
+			Expect(verifier.Verify(newSigned)).To(Equal("key-2"))
+		})
+	})
+})
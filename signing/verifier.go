@@ -0,0 +1,97 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+var (
+	ErrUnsigned         = errors.New("payload is not signed")
+	ErrUnknownKey       = errors.New("payload is signed with an unknown key")
+	ErrInvalidSignature = errors.New("payload signature is invalid")
+	ErrStale            = errors.New("payload signature timestamp is outside the allowed age")
+)
+
+// Verifier checks payloads produced by a Signer. It accepts any of its keys,
+// so during a rotation routers can trust both the old and the new key id
+// until every emitter signs with the new one.
+type Verifier struct {
+	keys   map[string]Key
+	maxAge time.Duration
+	clock  clock.Clock
+}
+
+// NewVerifier returns a Verifier trusting the given keys. Payloads whose
+// timestamp differs from the current time by more than maxAge are rejected;
+// a zero maxAge disables the freshness check.
+func NewVerifier(keys []Key, maxAge time.Duration, clock clock.Clock) *Verifier {
+	keysByID := map[string]Key{}
+	for _, key := range keys {
+		keysByID[key.ID] = key
+	}
+	return &Verifier{keys: keysByID, maxAge: maxAge, clock: clock}
+}
+
+// Verify checks the signature and freshness of a signed payload and returns
+// the id of the key it was signed with.
+func (v *Verifier) Verify(payload []byte) (string, error) {
+	payload = bytes.TrimSpace(payload)
+	marker := []byte(`,"` + SignatureField + `":"`)
+	index := bytes.LastIndex(payload, marker)
+	if index < 0 || !bytes.HasSuffix(payload, []byte(`"}`)) {
+		return "", ErrUnsigned
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(string(payload[index+len(marker) : len(payload)-2]))
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	signed := make([]byte, 0, index+1)
+	signed = append(signed, payload[:index]...)
+	signed = append(signed, '}')
+
+	fields := struct {
+		KeyID     string `json:"signature_key_id"`
+		Timestamp int64  `json:"signature_timestamp"`
+	}{}
+	err = json.Unmarshal(signed, &fields)
+	if err != nil || fields.KeyID == "" {
+		return "", ErrUnsigned
+	}
+
+	key, ok := v.keys[fields.KeyID]
+	if !ok {
+		return fields.KeyID, ErrUnknownKey
+	}
+
+	if !verify(key, signed, signature) {
+		return fields.KeyID, ErrInvalidSignature
+	}
+
+	if v.maxAge > 0 {
+		age := v.clock.Now().Sub(time.Unix(0, fields.Timestamp))
+		if age > v.maxAge || age < -v.maxAge {
+			return fields.KeyID, ErrStale
+		}
+	}
+
+	return fields.KeyID, nil
+}
+
+func verify(key Key, data, signature []byte) bool {
+	switch key.Algorithm {
+	case AlgorithmEd25519:
+		return len(key.publicKey) == ed25519.PublicKeySize && ed25519.Verify(key.publicKey, data, signature)
+	case AlgorithmHMACSHA256:
+		return len(key.secret) > 0 && hmac.Equal(sign(key, data), signature)
+	}
+	return false
+}
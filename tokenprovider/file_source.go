@@ -0,0 +1,60 @@
+package tokenprovider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var ErrEmptyTokenFile = errors.New("token file is empty")
+
+// FileSource reads a static bearer token from a file, e.g. one rotated by
+// an external agent. The expiry of JWTs is read from their exp claim; the
+// signature is not verified, that is up to the routing API.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) Fetch() (Token, error) {
+	contents, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return Token{}, err
+	}
+
+	accessToken := strings.TrimSpace(string(contents))
+	if accessToken == "" {
+		return Token{}, ErrEmptyTokenFile
+	}
+
+	return Token{AccessToken: accessToken, ExpiresAt: jwtExpiry(accessToken)}, nil
+}
+
+// jwtExpiry returns the time in the exp claim of a JWT, or the zero time if
+// the token is not a JWT or has no expiry
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil || claims.Exp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,61 @@
+package tokenprovider_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileSource", func() {
+	var (
+		dir    string
+		path   string
+		source *tokenprovider.FileSource
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "token-file")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "token")
+		source = tokenprovider.NewFileSource(path)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads the token from the file", func() {
+		Expect(ioutil.WriteFile(path, []byte("some-token\n"), 0600)).To(Succeed())
+		Expect(source.Fetch()).To(Equal(tokenprovider.Token{AccessToken: "some-token"}))
+	})
+
+	It("reads the expiry of a JWT", func() {
+		claims := base64.RawURLEncoding.EncodeToString([]byte(`{"exp":1700000000,"scope":["routing.routes.write"]}`))
+		jwt := "eyJhbGciOiJSUzI1NiJ9." + claims + ".c2lnbmF0dXJl"
+		Expect(ioutil.WriteFile(path, []byte(jwt), 0600)).To(Succeed())
+
+		Expect(source.Fetch()).To(Equal(tokenprovider.Token{
+			AccessToken: jwt,
+			ExpiresAt:   time.Unix(1700000000, 0),
+		}))
+	})
+
+	It("fails when the file is empty", func() {
+		Expect(ioutil.WriteFile(path, []byte(" \n"), 0600)).To(Succeed())
+		_, err := source.Fetch()
+		Expect(err).To(Equal(tokenprovider.ErrEmptyTokenFile))
+	})
+
+	It("fails when the file does not exist", func() {
+		_, err := source.Fetch()
+		Expect(err).To(HaveOccurred())
+	})
+})
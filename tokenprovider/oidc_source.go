@@ -0,0 +1,148 @@
+package tokenprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+var ErrNoTokenEndpoint = errors.New("either a token url or an issuer url is required")
+
+// OIDCConfig configures the client credentials grant against a generic
+// OpenID Connect provider. When TokenURL is empty, the token endpoint is
+// discovered from the provider configuration of IssuerURL.
+type OIDCConfig struct {
+	TokenURL     string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// OIDCSource fetches tokens from an OpenID Connect provider with the client
+// credentials grant
+type OIDCSource struct {
+	httpClient *http.Client
+	clock      clock.Clock
+	config     OIDCConfig
+
+	lock     sync.Mutex
+	tokenURL string
+}
+
+func NewOIDCSource(httpClient *http.Client, clock clock.Clock, config OIDCConfig) (*OIDCSource, error) {
+	if config.TokenURL == "" && config.IssuerURL == "" {
+		return nil, ErrNoTokenEndpoint
+	}
+	return &OIDCSource{
+		httpClient: httpClient,
+		clock:      clock,
+		config:     config,
+		tokenURL:   config.TokenURL,
+	}, nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (s *OIDCSource) Fetch() (Token, error) {
+	tokenURL, err := s.tokenEndpoint()
+	if err != nil {
+		return Token{}, err
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	request, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+
+	var response tokenResponse
+	err = s.do(request, &response)
+	if err != nil {
+		return Token{}, err
+	}
+	if response.AccessToken == "" {
+		return Token{}, errors.New("token response has no access token")
+	}
+	if response.TokenType != "" && !strings.EqualFold(response.TokenType, "bearer") {
+		return Token{}, fmt.Errorf("unsupported token type %q", response.TokenType)
+	}
+
+	token := Token{AccessToken: response.AccessToken}
+	if response.ExpiresIn > 0 {
+		token.ExpiresAt = s.clock.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// tokenEndpoint returns the configured token url, discovering it from the
+// issuer on first use
+func (s *OIDCSource) tokenEndpoint() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.tokenURL != "" {
+		return s.tokenURL, nil
+	}
+
+	request, err := http.NewRequest("GET", strings.TrimRight(s.config.IssuerURL, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	var discovery struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	err = s.do(request, &discovery)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover token endpoint: %s", err)
+	}
+	if discovery.TokenEndpoint == "" {
+		return "", errors.New("provider configuration has no token endpoint")
+	}
+
+	s.tokenURL = discovery.TokenEndpoint
+	return s.tokenURL, nil
+}
+
+func (s *OIDCSource) do(request *http.Request, result interface{}) error {
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		if len(body) > 512 {
+			body = body[:512]
+		}
+		return fmt.Errorf("unexpected status %d from %s: %s", response.StatusCode, request.URL, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, result)
+}
@@ -0,0 +1,103 @@
+package tokenprovider_test
+
+import (
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OIDCSource", func() {
+	var (
+		server *ghttp.Server
+		clock  *fakeclock.FakeClock
+		config tokenprovider.OIDCConfig
+		source *tokenprovider.OIDCSource
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		clock = fakeclock.NewFakeClock(time.Now())
+		config = tokenprovider.OIDCConfig{
+			TokenURL:     server.URL() + "/token",
+			ClientID:     "some-client",
+			ClientSecret: "some-secret",
+			Scopes:       []string{"routing.routes.write", "routing.router_groups.read"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		source, err = tokenprovider.NewOIDCSource(http.DefaultClient, clock, config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("fetches a token with the client credentials grant", func() {
+		server.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("POST", "/token"),
+			ghttp.VerifyBasicAuth("some-client", "some-secret"),
+			ghttp.VerifyForm(map[string][]string{
+				"grant_type": {"client_credentials"},
+				"scope":      {"routing.routes.write routing.router_groups.read"},
+			}),
+			ghttp.RespondWith(http.StatusOK, `{"access_token":"some-token","token_type":"Bearer","expires_in":600}`),
+		))
+
+		token, err := source.Fetch()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal(tokenprovider.Token{
+			AccessToken: "some-token",
+			ExpiresAt:   clock.Now().Add(10 * time.Minute),
+		}))
+	})
+
+	It("returns an error when the provider rejects the request", func() {
+		server.AppendHandlers(ghttp.RespondWith(http.StatusUnauthorized, `{"error":"invalid_client"}`))
+
+		_, err := source.Fetch()
+		Expect(err).To(MatchError(ContainSubstring("unexpected status 401")))
+		Expect(err).To(MatchError(ContainSubstring("invalid_client")))
+	})
+
+	Context("when only the issuer url is configured", func() {
+		BeforeEach(func() {
+			config.TokenURL = ""
+			config.IssuerURL = server.URL() + "/"
+		})
+
+		It("discovers the token endpoint once", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/.well-known/openid-configuration"),
+					ghttp.RespondWith(http.StatusOK, `{"token_endpoint":"`+server.URL()+`/discovered-token"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/discovered-token"),
+					ghttp.RespondWith(http.StatusOK, `{"access_token":"token-1"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/discovered-token"),
+					ghttp.RespondWith(http.StatusOK, `{"access_token":"token-2"}`),
+				),
+			)
+
+			Expect(source.Fetch()).To(Equal(tokenprovider.Token{AccessToken: "token-1"}))
+			Expect(source.Fetch()).To(Equal(tokenprovider.Token{AccessToken: "token-2"}))
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+	})
+
+	It("requires a token or issuer url", func() {
+		_, err := tokenprovider.NewOIDCSource(http.DefaultClient, clock, tokenprovider.OIDCConfig{ClientID: "some-client"})
+		Expect(err).To(Equal(tokenprovider.ErrNoTokenEndpoint))
+	})
+})
@@ -0,0 +1 @@
+package tokenprovider // import "code.cloudfoundry.org/route-emitter/tokenprovider"
@@ -0,0 +1,217 @@
+package tokenprovider
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	// DefaultRefreshAhead is how long before its expiry a token is refreshed
+	// when no lead time is configured
+	DefaultRefreshAhead = time.Minute
+
+	// refreshRetryInterval is how long to wait before retrying a failed
+	// refresh
+	refreshRetryInterval = 5 * time.Second
+)
+
+//go:generate counterfeiter -o fakes/fake_token_provider.go . TokenProvider
+
+// TokenProvider supplies the bearer token sent to the routing API
+type TokenProvider interface {
+	// AccessToken returns the current access token. forceUpdate discards the
+	// cached token, e.g. after it has been rejected.
+	AccessToken(forceUpdate bool) (string, error)
+}
+
+// Token is an access token and the time it expires. A zero ExpiresAt means
+// the expiry is unknown.
+type Token struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// Source fetches new tokens
+type Source interface {
+	Fetch() (Token, error)
+}
+
+// RefreshingProvider caches the token of a source and, while running as an
+// ifrit runner, fetches a new one ahead of its expiry so that callers are
+// not left with an expired token. Tokens are also refetched after maxAge, if
+// set, which lets sources such as token files pick up rotations.
+type RefreshingProvider struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	source       Source
+	refreshAhead time.Duration
+	maxAge       time.Duration
+
+	lock      sync.Mutex
+	token     Token
+	fetchedAt time.Time
+	retryAt   time.Time
+	fetched   chan struct{}
+}
+
+func NewRefreshingProvider(logger lager.Logger, clock clock.Clock, source Source, refreshAhead, maxAge time.Duration) *RefreshingProvider {
+	if refreshAhead <= 0 {
+		refreshAhead = DefaultRefreshAhead
+	}
+	return &RefreshingProvider{
+		logger:       logger.Session("token-provider"),
+		clock:        clock,
+		source:       source,
+		refreshAhead: refreshAhead,
+		maxAge:       maxAge,
+		fetched:      make(chan struct{}, 1),
+	}
+}
+
+func (p *RefreshingProvider) AccessToken(forceUpdate bool) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if forceUpdate || p.token.AccessToken == "" || p.expired() {
+		err := p.fetch()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return p.token.AccessToken, nil
+}
+
+func (p *RefreshingProvider) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	p.logger.Info("started", lager.Data{"refresh-ahead": p.refreshAhead.String(), "max-age": p.maxAge.String()})
+	defer p.logger.Info("finished")
+	close(ready)
+
+	for {
+		wait, ok := p.untilRefresh()
+		if ok && wait <= 0 {
+			p.refresh()
+			continue
+		}
+
+		var timer clock.Timer
+		var timeout <-chan time.Time
+		if ok {
+			timer = p.clock.NewTimer(wait)
+			timeout = timer.C()
+		}
+
+		select {
+		case <-timeout:
+			p.refresh()
+		case <-p.fetched:
+		case <-signals:
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (p *RefreshingProvider) refresh() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	err := p.fetch()
+	if err != nil {
+		p.logger.Error("failed-to-refresh-token", err)
+	}
+}
+
+// untilRefresh returns how long to wait before the token is refreshed, or
+// false if it does not need refreshing
+func (p *RefreshingProvider) untilRefresh() (time.Duration, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.fetchedAt.IsZero() && p.retryAt.IsZero() {
+		return 0, true
+	}
+
+	refreshAt := p.retryAt
+	if refreshAt.IsZero() && !p.token.ExpiresAt.IsZero() {
+		ahead := p.refreshAhead
+		if lifetime := p.token.ExpiresAt.Sub(p.fetchedAt); ahead > lifetime/2 {
+			ahead = lifetime / 2
+		}
+		refreshAt = p.token.ExpiresAt.Add(-ahead)
+	}
+	if p.retryAt.IsZero() && p.maxAge > 0 {
+		if expiresAt := p.fetchedAt.Add(p.maxAge); refreshAt.IsZero() || expiresAt.Before(refreshAt) {
+			refreshAt = expiresAt
+		}
+	}
+	if refreshAt.IsZero() {
+		return 0, false
+	}
+	// do not keep refetching a token that is already about to expire
+	if earliest := p.fetchedAt.Add(refreshRetryInterval); p.retryAt.IsZero() && refreshAt.Before(earliest) {
+		refreshAt = earliest
+	}
+
+	wait := refreshAt.Sub(p.clock.Now())
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+func (p *RefreshingProvider) expired() bool {
+	return !p.token.ExpiresAt.IsZero() && !p.clock.Now().Before(p.token.ExpiresAt)
+}
+
+// fetch replaces the token with a new one from the source. On failure the
+// old token is kept and the next attempt is made after refreshRetryInterval.
+func (p *RefreshingProvider) fetch() error {
+	token, err := p.source.Fetch()
+	if err != nil {
+		p.retryAt = p.clock.Now().Add(refreshRetryInterval)
+		p.notify()
+		return err
+	}
+
+	p.token = token
+	p.fetchedAt = p.clock.Now()
+	p.retryAt = time.Time{}
+	p.notify()
+
+	data := lager.Data{}
+	if !token.ExpiresAt.IsZero() {
+		data["expires-at"] = token.ExpiresAt.Format(time.RFC3339)
+		if p.expired() {
+			p.logger.Info("fetched-expired-token", data)
+			return nil
+		}
+	}
+	p.logger.Debug("fetched-token", data)
+	return nil
+}
+
+func (p *RefreshingProvider) notify() {
+	select {
+	case p.fetched <- struct{}{}:
+	default:
+	}
+}
+
+// NoTokenProvider is used when the routing API authenticates the emitter by
+// its client certificate alone, or does not authenticate it at all
+type NoTokenProvider struct{}
+
+func (NoTokenProvider) AccessToken(bool) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,153 @@
+package tokenprovider_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSource struct {
+	lock    sync.Mutex
+	tokens  []tokenprovider.Token
+	err     error
+	fetches int
+}
+
+func (s *fakeSource) Fetch() (tokenprovider.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.fetches++
+	if s.err != nil {
+		return tokenprovider.Token{}, s.err
+	}
+	token := s.tokens[0]
+	if len(s.tokens) > 1 {
+		s.tokens = s.tokens[1:]
+	}
+	return token, nil
+}
+
+func (s *fakeSource) Fetches() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.fetches
+}
+
+func (s *fakeSource) SetError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err
+}
+
+var _ = Describe("RefreshingProvider", func() {
+	var (
+		clock    *fakeclock.FakeClock
+		source   *fakeSource
+		provider *tokenprovider.RefreshingProvider
+		maxAge   time.Duration
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		source = &fakeSource{tokens: []tokenprovider.Token{
+			{AccessToken: "token-1", ExpiresAt: clock.Now().Add(10 * time.Minute)},
+			{AccessToken: "token-2", ExpiresAt: clock.Now().Add(20 * time.Minute)},
+		}}
+		maxAge = 0
+	})
+
+	JustBeforeEach(func() {
+		provider = tokenprovider.NewRefreshingProvider(lagertest.NewTestLogger("test"), clock, source, time.Minute, maxAge)
+	})
+
+	Describe("AccessToken", func() {
+		It("fetches the token once and caches it", func() {
+			Expect(provider.AccessToken(false)).To(Equal("token-1"))
+			Expect(provider.AccessToken(false)).To(Equal("token-1"))
+			Expect(source.Fetches()).To(Equal(1))
+		})
+
+		It("fetches a new token when forced", func() {
+			Expect(provider.AccessToken(false)).To(Equal("token-1"))
+			Expect(provider.AccessToken(true)).To(Equal("token-2"))
+		})
+
+		It("fetches a new token once the cached one expired", func() {
+			Expect(provider.AccessToken(false)).To(Equal("token-1"))
+			clock.Increment(10 * time.Minute)
+			Expect(provider.AccessToken(false)).To(Equal("token-2"))
+		})
+
+		Context("when the source fails", func() {
+			BeforeEach(func() {
+				source.err = errors.New("boom")
+			})
+
+			It("returns the error", func() {
+				_, err := provider.AccessToken(false)
+				Expect(err).To(MatchError("boom"))
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(provider)
+			Eventually(source.Fetches).Should(Equal(1))
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("refreshes the token ahead of its expiry", func() {
+			clock.WaitForWatcherAndIncrement(9*time.Minute - time.Second)
+			Consistently(source.Fetches).Should(Equal(1))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(source.Fetches).Should(Equal(2))
+			Expect(provider.AccessToken(false)).To(Equal("token-2"))
+			Expect(source.Fetches()).To(Equal(2))
+		})
+
+		Context("when the refresh fails", func() {
+			It("keeps the old token and retries", func() {
+				source.SetError(errors.New("boom"))
+				clock.WaitForWatcherAndIncrement(9 * time.Minute)
+				Eventually(source.Fetches).Should(Equal(2))
+				Expect(provider.AccessToken(false)).To(Equal("token-1"))
+
+				source.SetError(nil)
+				clock.WaitForWatcherAndIncrement(5 * time.Second)
+				Eventually(source.Fetches).Should(Equal(3))
+				Expect(provider.AccessToken(false)).To(Equal("token-2"))
+			})
+		})
+
+		Context("when the token has no expiry and a max age is set", func() {
+			BeforeEach(func() {
+				source.tokens = []tokenprovider.Token{{AccessToken: "token-1"}, {AccessToken: "token-2"}}
+				maxAge = 10 * time.Second
+			})
+
+			It("refetches the token after the max age", func() {
+				clock.WaitForWatcherAndIncrement(10 * time.Second)
+				Eventually(source.Fetches).Should(Equal(2))
+				Expect(provider.AccessToken(false)).To(Equal("token-2"))
+			})
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package tokenprovider_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTokenProvider(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TokenProvider Suite")
+}
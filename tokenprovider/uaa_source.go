@@ -0,0 +1,31 @@
+package tokenprovider
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	uaaclient "code.cloudfoundry.org/uaa-go-client"
+)
+
+// UAASource fetches tokens from UAA with the client credentials grant
+type UAASource struct {
+	client uaaclient.Client
+	clock  clock.Clock
+}
+
+func NewUAASource(client uaaclient.Client, clock clock.Clock) *UAASource {
+	return &UAASource{client: client, clock: clock}
+}
+
+func (s *UAASource) Fetch() (Token, error) {
+	token, err := s.client.FetchToken(true)
+	if err != nil {
+		return Token{}, err
+	}
+
+	result := Token{AccessToken: token.AccessToken}
+	if token.ExpiresIn > 0 {
+		result.ExpiresAt = s.clock.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return result, nil
+}
@@ -2,9 +2,11 @@ package unregistration
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/route-emitter/routingtable"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
 	"github.com/mitchellh/hashstructure"
 )
 
@@ -13,20 +15,70 @@ type Cache interface {
 	Add([]routingtable.RegistryMessage) error
 	Remove([]routingtable.RegistryMessage) error
 	List() []*Message
+	Count() int
+
+	AddInternal([]routingtable.RegistryMessage) error
+	RemoveInternal([]routingtable.RegistryMessage) error
+	ListInternal() []*Message
+	CountInternal() int
+
+	AddTCP([]tcpmodels.TcpRouteMapping) error
+	RemoveTCP([]tcpmodels.TcpRouteMapping) error
+	ListTCP() []*TCPMessage
+	CountTCP() int
+
+	// TakeDue returns the unregistrations whose next send is due and records
+	// the send. Entries that have been sent sendCount times are removed from
+	// the cache; their number is returned as well. spacing returns how long
+	// to wait before resending an entry that has been sent the given number
+	// of times.
+	TakeDue(now time.Time, sendCount int, spacing func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int)
+	TakeDueInternal(now time.Time, sendCount int, spacing func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int)
+	TakeDueTCP(now time.Time, sendCount int, spacing func(sentCount int) time.Duration) ([]tcpmodels.TcpRouteMapping, int)
+
+	// SyncCompleted is called once the routing table has been synced with
+	// the BBS and the registrations it produced have been removed from the
+	// cache
+	SyncCompleted()
+	// Persist saves the cache, including the send counts, if the cache is
+	// backed by a file and has changed since it was last saved
+	Persist() error
+}
+
+// tcpMappingKey identifies a tcp route mapping regardless of its ttl and
+// modification tag
+type tcpMappingKey struct {
+	routerGroupGUID string
+	externalPort    uint16
+	hostIP          string
+	hostPort        uint16
+	sniHostname     string
 }
 
 type cache struct {
-	messages map[uint64]*Message
-	mux      *sync.Mutex
-	logger   lager.Logger
+	messages         map[uint64]*Message
+	internalMessages map[uint64]*Message
+	tcpMessages      map[tcpMappingKey]*TCPMessage
+	// dirty is set when the cache changes and cleared once it is persisted
+	dirty  bool
+	mux    *sync.Mutex
+	logger lager.Logger
+	now    func() time.Time
 }
 
 func NewCache(logger lager.Logger) Cache {
+	return newCache(logger, time.Now)
+}
+
+func newCache(logger lager.Logger, now func() time.Time) *cache {
 	cacheLogger := logger.Session("unregistration-cache")
 	return &cache{
-		messages: map[uint64]*Message{},
-		mux:      &sync.Mutex{},
-		logger:   cacheLogger,
+		messages:         map[uint64]*Message{},
+		internalMessages: map[uint64]*Message{},
+		tcpMessages:      map[tcpMappingKey]*TCPMessage{},
+		mux:              &sync.Mutex{},
+		logger:           cacheLogger,
+		now:              now,
 	}
 }
 
@@ -34,39 +86,217 @@ func (c *cache) Add(registryMessages []routingtable.RegistryMessage) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 	c.logger.Debug("add", lager.Data{"cache": registryMessages})
-	for _, registryMessage := range registryMessages {
-		registryMessageHash, err := hashstructure.Hash(registryMessage, nil)
-		if err != nil {
-			return err
+	c.dirty = c.dirty || len(registryMessages) > 0
+	return addMessages(c.messages, registryMessages, c.now())
+}
+
+func (c *cache) Remove(registryMessages []routingtable.RegistryMessage) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.logger.Debug("remove", lager.Data{"cache": registryMessages})
+	removed, err := removeMessages(c.messages, registryMessages)
+	c.dirty = c.dirty || removed
+	return err
+}
+
+func (c *cache) List() []*Message {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return listMessages(c.messages)
+}
+
+func (c *cache) Count() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.messages)
+}
+
+func (c *cache) TakeDue(now time.Time, sendCount int, spacing func(int) time.Duration) ([]routingtable.RegistryMessage, int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	due, completed := takeDueMessages(c.messages, now, sendCount, spacing)
+	c.dirty = c.dirty || len(due) > 0
+	return due, completed
+}
+
+func (c *cache) AddInternal(registryMessages []routingtable.RegistryMessage) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.logger.Debug("add-internal", lager.Data{"cache": registryMessages})
+	c.dirty = c.dirty || len(registryMessages) > 0
+	return addMessages(c.internalMessages, registryMessages, c.now())
+}
+
+func (c *cache) RemoveInternal(registryMessages []routingtable.RegistryMessage) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.logger.Debug("remove-internal", lager.Data{"cache": registryMessages})
+	removed, err := removeMessages(c.internalMessages, registryMessages)
+	c.dirty = c.dirty || removed
+	return err
+}
+
+func (c *cache) ListInternal() []*Message {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return listMessages(c.internalMessages)
+}
+
+func (c *cache) CountInternal() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.internalMessages)
+}
+
+func (c *cache) TakeDueInternal(now time.Time, sendCount int, spacing func(int) time.Duration) ([]routingtable.RegistryMessage, int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	due, completed := takeDueMessages(c.internalMessages, now, sendCount, spacing)
+	c.dirty = c.dirty || len(due) > 0
+	return due, completed
+}
+
+func (c *cache) AddTCP(mappings []tcpmodels.TcpRouteMapping) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.logger.Debug("add-tcp", lager.Data{"cache": mappings})
+	c.dirty = c.dirty || len(mappings) > 0
+	for _, mapping := range mappings {
+		c.tcpMessages[keyForMapping(mapping)] = &TCPMessage{
+			RouteMapping: mapping,
+			AddedAt:      c.now(),
 		}
-		c.messages[registryMessageHash] = &Message{
-			RegistryMessage: registryMessage,
+	}
+	return nil
+}
+
+func (c *cache) RemoveTCP(mappings []tcpmodels.TcpRouteMapping) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.logger.Debug("remove-tcp", lager.Data{"cache": mappings})
+	for _, mapping := range mappings {
+		key := keyForMapping(mapping)
+		if _, ok := c.tcpMessages[key]; ok {
+			delete(c.tcpMessages, key)
+			c.dirty = true
 		}
 	}
 	return nil
 }
 
-func (c *cache) Remove(registryMessages []routingtable.RegistryMessage) error {
+func (c *cache) ListTCP() []*TCPMessage {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	c.logger.Debug("remove", lager.Data{"cache": registryMessages})
+
+	list := []*TCPMessage{}
+	for _, message := range c.tcpMessages {
+		copied := *message
+		list = append(list, &copied)
+	}
+	return list
+}
+
+func (c *cache) CountTCP() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.tcpMessages)
+}
+
+func (c *cache) TakeDueTCP(now time.Time, sendCount int, spacing func(int) time.Duration) ([]tcpmodels.TcpRouteMapping, int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	due := []tcpmodels.TcpRouteMapping{}
+	completed := 0
+	for key, message := range c.tcpMessages {
+		if message.NextSendAt.After(now) {
+			continue
+		}
+		due = append(due, message.RouteMapping)
+		message.SentCount++
+		if message.SentCount >= sendCount {
+			delete(c.tcpMessages, key)
+			completed++
+			continue
+		}
+		message.NextSendAt = now.Add(spacing(message.SentCount))
+	}
+	c.dirty = c.dirty || len(due) > 0
+	return due, completed
+}
+
+func (c *cache) SyncCompleted() {}
+
+func (c *cache) Persist() error {
+	return nil
+}
+
+func addMessages(messages map[uint64]*Message, registryMessages []routingtable.RegistryMessage, addedAt time.Time) error {
 	for _, registryMessage := range registryMessages {
 		registryMessageHash, err := hashstructure.Hash(registryMessage, nil)
 		if err != nil {
 			return err
 		}
-		delete(c.messages, registryMessageHash)
+		messages[registryMessageHash] = &Message{
+			RegistryMessage: registryMessage,
+			AddedAt:         addedAt,
+		}
 	}
 	return nil
 }
 
-func (c *cache) List() []*Message {
-	c.mux.Lock()
-	defer c.mux.Unlock()
+// removeMessages reports whether any of registryMessages was in messages
+func removeMessages(messages map[uint64]*Message, registryMessages []routingtable.RegistryMessage) (bool, error) {
+	removed := false
+	for _, registryMessage := range registryMessages {
+		registryMessageHash, err := hashstructure.Hash(registryMessage, nil)
+		if err != nil {
+			return removed, err
+		}
+		if _, ok := messages[registryMessageHash]; ok {
+			delete(messages, registryMessageHash)
+			removed = true
+		}
+	}
+	return removed, nil
+}
 
+// listMessages returns copies of the cached messages so that callers cannot
+// race with the send counts maintained by the cache
+func listMessages(messages map[uint64]*Message) []*Message {
 	list := []*Message{}
-	for _, message := range c.messages {
-		list = append(list, message)
+	for _, message := range messages {
+		copied := *message
+		list = append(list, &copied)
 	}
 	return list
 }
+
+func takeDueMessages(messages map[uint64]*Message, now time.Time, sendCount int, spacing func(int) time.Duration) ([]routingtable.RegistryMessage, int) {
+	due := []routingtable.RegistryMessage{}
+	completed := 0
+	for hash, message := range messages {
+		if message.NextSendAt.After(now) {
+			continue
+		}
+		due = append(due, message.RegistryMessage)
+		message.SentCount++
+		if message.SentCount >= sendCount {
+			delete(messages, hash)
+			completed++
+			continue
+		}
+		message.NextSendAt = now.Add(spacing(message.SentCount))
+	}
+	return due, completed
+}
+
+func keyForMapping(mapping tcpmodels.TcpRouteMapping) tcpMappingKey {
+	return tcpMappingKey{
+		routerGroupGUID: mapping.RouterGroupGuid,
+		externalPort:    mapping.ExternalPort,
+		hostIP:          mapping.HostIP,
+		hostPort:        mapping.HostPort,
+		sniHostname:     routingtable.MappingSniHostname(mapping),
+	}
+}
@@ -2,11 +2,13 @@ package unregistration_test
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/unregistration"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -47,6 +49,46 @@ var _ = Describe("Cache", func() {
 		registryMessage2 = routingtable.RegistryMessageFor(endpoint2, route2, false)
 	})
 
+	Describe("TakeDue", func() {
+		var (
+			now     time.Time
+			spacing func(int) time.Duration
+		)
+
+		BeforeEach(func() {
+			now = time.Now()
+			spacing = func(sentCount int) time.Duration {
+				return time.Duration(sentCount) * time.Second
+			}
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+		})
+
+		It("returns the due messages and counts the send", func() {
+			due, expired := cache.TakeDue(now, 3, spacing)
+			Expect(due).To(ConsistOf(registryMessage1))
+			Expect(expired).To(Equal(0))
+			Expect(cache.List()[0].SentCount).To(Equal(1))
+		})
+
+		It("holds the message back until the spacing has elapsed", func() {
+			cache.TakeDue(now, 3, spacing)
+
+			due, _ := cache.TakeDue(now.Add(500*time.Millisecond), 3, spacing)
+			Expect(due).To(BeEmpty())
+
+			due, _ = cache.TakeDue(now.Add(time.Second), 3, spacing)
+			Expect(due).To(ConsistOf(registryMessage1))
+		})
+
+		It("removes the message once it has been sent the required number of times", func() {
+			cache.TakeDue(now, 2, spacing)
+			due, expired := cache.TakeDue(now.Add(time.Second), 2, spacing)
+			Expect(due).To(ConsistOf(registryMessage1))
+			Expect(expired).To(Equal(1))
+			Expect(cache.List()).To(BeEmpty())
+		})
+	})
+
 	Describe("Add", func() {
 		It("adds a message", func() {
 			err := cache.Add([]routingtable.RegistryMessage{
@@ -131,6 +173,56 @@ var _ = Describe("Cache", func() {
 		})
 	})
 
+	Describe("internal unregistrations", func() {
+		It("are cached separately from http unregistrations", func() {
+			err := cache.AddInternal([]routingtable.RegistryMessage{registryMessage1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cache.List()).To(BeEmpty())
+			Expect(cache.Count()).To(Equal(0))
+
+			cachedMessages := cache.ListInternal()
+			Expect(cachedMessages).To(HaveLen(1))
+			Expect(cache.CountInternal()).To(Equal(1))
+			Expect(cachedMessages[0].RegistryMessage).To(Equal(registryMessage1))
+
+			err = cache.RemoveInternal([]routingtable.RegistryMessage{registryMessage1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cache.ListInternal()).To(BeEmpty())
+		})
+	})
+
+	Describe("tcp route mapping deletions", func() {
+		var mapping1, mapping2 tcpmodels.TcpRouteMapping
+
+		BeforeEach(func() {
+			mapping1 = tcpmodels.NewTcpRouteMapping("router-group", 61000, "1.1.1.1", 62000, 0)
+			mapping2 = tcpmodels.NewTcpRouteMapping("router-group", 61001, "2.2.2.2", 62001, 0)
+		})
+
+		It("adds and removes mappings", func() {
+			err := cache.AddTCP([]tcpmodels.TcpRouteMapping{mapping1, mapping2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cache.ListTCP()).To(HaveLen(2))
+			Expect(cache.CountTCP()).To(Equal(2))
+
+			err = cache.RemoveTCP([]tcpmodels.TcpRouteMapping{mapping1})
+			Expect(err).NotTo(HaveOccurred())
+			cachedMessages := cache.ListTCP()
+			Expect(cachedMessages).To(HaveLen(1))
+			Expect(cachedMessages[0].RouteMapping).To(Equal(mapping2))
+		})
+
+		It("ignores the ttl in the cache key", func() {
+			err := cache.AddTCP([]tcpmodels.TcpRouteMapping{mapping1})
+			Expect(err).NotTo(HaveOccurred())
+
+			withTTL := tcpmodels.NewTcpRouteMapping("router-group", 61000, "1.1.1.1", 62000, 120)
+			err = cache.RemoveTCP([]tcpmodels.TcpRouteMapping{withTTL})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cache.ListTCP()).To(BeEmpty())
+		})
+	})
+
 	Describe("concurrent cache access", func() {
 		It("does not cause a data race", func() {
 			registryMessages := []routingtable.RegistryMessage{registryMessage1}
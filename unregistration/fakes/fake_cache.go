@@ -3,9 +3,11 @@ package fakes
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/unregistration"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
 )
 
 type FakeCache struct {
@@ -20,6 +22,58 @@ type FakeCache struct {
 	addReturnsOnCall map[int]struct {
 		result1 error
 	}
+	AddInternalStub        func([]routingtable.RegistryMessage) error
+	addInternalMutex       sync.RWMutex
+	addInternalArgsForCall []struct {
+		arg1 []routingtable.RegistryMessage
+	}
+	addInternalReturns struct {
+		result1 error
+	}
+	addInternalReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AddTCPStub        func([]tcpmodels.TcpRouteMapping) error
+	addTCPMutex       sync.RWMutex
+	addTCPArgsForCall []struct {
+		arg1 []tcpmodels.TcpRouteMapping
+	}
+	addTCPReturns struct {
+		result1 error
+	}
+	addTCPReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CountStub        func() int
+	countMutex       sync.RWMutex
+	countArgsForCall []struct {
+	}
+	countReturns struct {
+		result1 int
+	}
+	countReturnsOnCall map[int]struct {
+		result1 int
+	}
+	CountInternalStub        func() int
+	countInternalMutex       sync.RWMutex
+	countInternalArgsForCall []struct {
+	}
+	countInternalReturns struct {
+		result1 int
+	}
+	countInternalReturnsOnCall map[int]struct {
+		result1 int
+	}
+	CountTCPStub        func() int
+	countTCPMutex       sync.RWMutex
+	countTCPArgsForCall []struct {
+	}
+	countTCPReturns struct {
+		result1 int
+	}
+	countTCPReturnsOnCall map[int]struct {
+		result1 int
+	}
 	ListStub        func() []*unregistration.Message
 	listMutex       sync.RWMutex
 	listArgsForCall []struct {
@@ -30,6 +84,36 @@ type FakeCache struct {
 	listReturnsOnCall map[int]struct {
 		result1 []*unregistration.Message
 	}
+	ListInternalStub        func() []*unregistration.Message
+	listInternalMutex       sync.RWMutex
+	listInternalArgsForCall []struct {
+	}
+	listInternalReturns struct {
+		result1 []*unregistration.Message
+	}
+	listInternalReturnsOnCall map[int]struct {
+		result1 []*unregistration.Message
+	}
+	ListTCPStub        func() []*unregistration.TCPMessage
+	listTCPMutex       sync.RWMutex
+	listTCPArgsForCall []struct {
+	}
+	listTCPReturns struct {
+		result1 []*unregistration.TCPMessage
+	}
+	listTCPReturnsOnCall map[int]struct {
+		result1 []*unregistration.TCPMessage
+	}
+	PersistStub        func() error
+	persistMutex       sync.RWMutex
+	persistArgsForCall []struct {
+	}
+	persistReturns struct {
+		result1 error
+	}
+	persistReturnsOnCall map[int]struct {
+		result1 error
+	}
 	RemoveStub        func([]routingtable.RegistryMessage) error
 	removeMutex       sync.RWMutex
 	removeArgsForCall []struct {
@@ -41,6 +125,77 @@ type FakeCache struct {
 	removeReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RemoveInternalStub        func([]routingtable.RegistryMessage) error
+	removeInternalMutex       sync.RWMutex
+	removeInternalArgsForCall []struct {
+		arg1 []routingtable.RegistryMessage
+	}
+	removeInternalReturns struct {
+		result1 error
+	}
+	removeInternalReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RemoveTCPStub        func([]tcpmodels.TcpRouteMapping) error
+	removeTCPMutex       sync.RWMutex
+	removeTCPArgsForCall []struct {
+		arg1 []tcpmodels.TcpRouteMapping
+	}
+	removeTCPReturns struct {
+		result1 error
+	}
+	removeTCPReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SyncCompletedStub        func()
+	syncCompletedMutex       sync.RWMutex
+	syncCompletedArgsForCall []struct {
+	}
+	TakeDueStub        func(time.Time, int, func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int)
+	takeDueMutex       sync.RWMutex
+	takeDueArgsForCall []struct {
+		arg1 time.Time
+		arg2 int
+		arg3 func(sentCount int) time.Duration
+	}
+	takeDueReturns struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}
+	takeDueReturnsOnCall map[int]struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}
+	TakeDueInternalStub        func(time.Time, int, func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int)
+	takeDueInternalMutex       sync.RWMutex
+	takeDueInternalArgsForCall []struct {
+		arg1 time.Time
+		arg2 int
+		arg3 func(sentCount int) time.Duration
+	}
+	takeDueInternalReturns struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}
+	takeDueInternalReturnsOnCall map[int]struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}
+	TakeDueTCPStub        func(time.Time, int, func(sentCount int) time.Duration) ([]tcpmodels.TcpRouteMapping, int)
+	takeDueTCPMutex       sync.RWMutex
+	takeDueTCPArgsForCall []struct {
+		arg1 time.Time
+		arg2 int
+		arg3 func(sentCount int) time.Duration
+	}
+	takeDueTCPReturns struct {
+		result1 []tcpmodels.TcpRouteMapping
+		result2 int
+	}
+	takeDueTCPReturnsOnCall map[int]struct {
+		result1 []tcpmodels.TcpRouteMapping
+		result2 int
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -110,6 +265,292 @@ func (fake *FakeCache) AddReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeCache) AddInternal(arg1 []routingtable.RegistryMessage) error {
+	var arg1Copy []routingtable.RegistryMessage
+	if arg1 != nil {
+		arg1Copy = make([]routingtable.RegistryMessage, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.addInternalMutex.Lock()
+	ret, specificReturn := fake.addInternalReturnsOnCall[len(fake.addInternalArgsForCall)]
+	fake.addInternalArgsForCall = append(fake.addInternalArgsForCall, struct {
+		arg1 []routingtable.RegistryMessage
+	}{arg1Copy})
+	fake.recordInvocation("AddInternal", []interface{}{arg1Copy})
+	fake.addInternalMutex.Unlock()
+	if fake.AddInternalStub != nil {
+		return fake.AddInternalStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.addInternalReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) AddInternalCallCount() int {
+	fake.addInternalMutex.RLock()
+	defer fake.addInternalMutex.RUnlock()
+	return len(fake.addInternalArgsForCall)
+}
+
+func (fake *FakeCache) AddInternalCalls(stub func([]routingtable.RegistryMessage) error) {
+	fake.addInternalMutex.Lock()
+	defer fake.addInternalMutex.Unlock()
+	fake.AddInternalStub = stub
+}
+
+func (fake *FakeCache) AddInternalArgsForCall(i int) []routingtable.RegistryMessage {
+	fake.addInternalMutex.RLock()
+	defer fake.addInternalMutex.RUnlock()
+	argsForCall := fake.addInternalArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCache) AddInternalReturns(result1 error) {
+	fake.addInternalMutex.Lock()
+	defer fake.addInternalMutex.Unlock()
+	fake.AddInternalStub = nil
+	fake.addInternalReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) AddInternalReturnsOnCall(i int, result1 error) {
+	fake.addInternalMutex.Lock()
+	defer fake.addInternalMutex.Unlock()
+	fake.AddInternalStub = nil
+	if fake.addInternalReturnsOnCall == nil {
+		fake.addInternalReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addInternalReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) AddTCP(arg1 []tcpmodels.TcpRouteMapping) error {
+	var arg1Copy []tcpmodels.TcpRouteMapping
+	if arg1 != nil {
+		arg1Copy = make([]tcpmodels.TcpRouteMapping, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.addTCPMutex.Lock()
+	ret, specificReturn := fake.addTCPReturnsOnCall[len(fake.addTCPArgsForCall)]
+	fake.addTCPArgsForCall = append(fake.addTCPArgsForCall, struct {
+		arg1 []tcpmodels.TcpRouteMapping
+	}{arg1Copy})
+	fake.recordInvocation("AddTCP", []interface{}{arg1Copy})
+	fake.addTCPMutex.Unlock()
+	if fake.AddTCPStub != nil {
+		return fake.AddTCPStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.addTCPReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) AddTCPCallCount() int {
+	fake.addTCPMutex.RLock()
+	defer fake.addTCPMutex.RUnlock()
+	return len(fake.addTCPArgsForCall)
+}
+
+func (fake *FakeCache) AddTCPCalls(stub func([]tcpmodels.TcpRouteMapping) error) {
+	fake.addTCPMutex.Lock()
+	defer fake.addTCPMutex.Unlock()
+	fake.AddTCPStub = stub
+}
+
+func (fake *FakeCache) AddTCPArgsForCall(i int) []tcpmodels.TcpRouteMapping {
+	fake.addTCPMutex.RLock()
+	defer fake.addTCPMutex.RUnlock()
+	argsForCall := fake.addTCPArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCache) AddTCPReturns(result1 error) {
+	fake.addTCPMutex.Lock()
+	defer fake.addTCPMutex.Unlock()
+	fake.AddTCPStub = nil
+	fake.addTCPReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) AddTCPReturnsOnCall(i int, result1 error) {
+	fake.addTCPMutex.Lock()
+	defer fake.addTCPMutex.Unlock()
+	fake.AddTCPStub = nil
+	if fake.addTCPReturnsOnCall == nil {
+		fake.addTCPReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addTCPReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) Count() int {
+	fake.countMutex.Lock()
+	ret, specificReturn := fake.countReturnsOnCall[len(fake.countArgsForCall)]
+	fake.countArgsForCall = append(fake.countArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Count", []interface{}{})
+	fake.countMutex.Unlock()
+	if fake.CountStub != nil {
+		return fake.CountStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.countReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) CountCallCount() int {
+	fake.countMutex.RLock()
+	defer fake.countMutex.RUnlock()
+	return len(fake.countArgsForCall)
+}
+
+func (fake *FakeCache) CountCalls(stub func() int) {
+	fake.countMutex.Lock()
+	defer fake.countMutex.Unlock()
+	fake.CountStub = stub
+}
+
+func (fake *FakeCache) CountReturns(result1 int) {
+	fake.countMutex.Lock()
+	defer fake.countMutex.Unlock()
+	fake.CountStub = nil
+	fake.countReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *FakeCache) CountReturnsOnCall(i int, result1 int) {
+	fake.countMutex.Lock()
+	defer fake.countMutex.Unlock()
+	fake.CountStub = nil
+	if fake.countReturnsOnCall == nil {
+		fake.countReturnsOnCall = make(map[int]struct {
+			result1 int
+		})
+	}
+	fake.countReturnsOnCall[i] = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *FakeCache) CountInternal() int {
+	fake.countInternalMutex.Lock()
+	ret, specificReturn := fake.countInternalReturnsOnCall[len(fake.countInternalArgsForCall)]
+	fake.countInternalArgsForCall = append(fake.countInternalArgsForCall, struct {
+	}{})
+	fake.recordInvocation("CountInternal", []interface{}{})
+	fake.countInternalMutex.Unlock()
+	if fake.CountInternalStub != nil {
+		return fake.CountInternalStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.countInternalReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) CountInternalCallCount() int {
+	fake.countInternalMutex.RLock()
+	defer fake.countInternalMutex.RUnlock()
+	return len(fake.countInternalArgsForCall)
+}
+
+func (fake *FakeCache) CountInternalCalls(stub func() int) {
+	fake.countInternalMutex.Lock()
+	defer fake.countInternalMutex.Unlock()
+	fake.CountInternalStub = stub
+}
+
+func (fake *FakeCache) CountInternalReturns(result1 int) {
+	fake.countInternalMutex.Lock()
+	defer fake.countInternalMutex.Unlock()
+	fake.CountInternalStub = nil
+	fake.countInternalReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *FakeCache) CountInternalReturnsOnCall(i int, result1 int) {
+	fake.countInternalMutex.Lock()
+	defer fake.countInternalMutex.Unlock()
+	fake.CountInternalStub = nil
+	if fake.countInternalReturnsOnCall == nil {
+		fake.countInternalReturnsOnCall = make(map[int]struct {
+			result1 int
+		})
+	}
+	fake.countInternalReturnsOnCall[i] = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *FakeCache) CountTCP() int {
+	fake.countTCPMutex.Lock()
+	ret, specificReturn := fake.countTCPReturnsOnCall[len(fake.countTCPArgsForCall)]
+	fake.countTCPArgsForCall = append(fake.countTCPArgsForCall, struct {
+	}{})
+	fake.recordInvocation("CountTCP", []interface{}{})
+	fake.countTCPMutex.Unlock()
+	if fake.CountTCPStub != nil {
+		return fake.CountTCPStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.countTCPReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) CountTCPCallCount() int {
+	fake.countTCPMutex.RLock()
+	defer fake.countTCPMutex.RUnlock()
+	return len(fake.countTCPArgsForCall)
+}
+
+func (fake *FakeCache) CountTCPCalls(stub func() int) {
+	fake.countTCPMutex.Lock()
+	defer fake.countTCPMutex.Unlock()
+	fake.CountTCPStub = stub
+}
+
+func (fake *FakeCache) CountTCPReturns(result1 int) {
+	fake.countTCPMutex.Lock()
+	defer fake.countTCPMutex.Unlock()
+	fake.CountTCPStub = nil
+	fake.countTCPReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *FakeCache) CountTCPReturnsOnCall(i int, result1 int) {
+	fake.countTCPMutex.Lock()
+	defer fake.countTCPMutex.Unlock()
+	fake.CountTCPStub = nil
+	if fake.countTCPReturnsOnCall == nil {
+		fake.countTCPReturnsOnCall = make(map[int]struct {
+			result1 int
+		})
+	}
+	fake.countTCPReturnsOnCall[i] = struct {
+		result1 int
+	}{result1}
+}
+
 func (fake *FakeCache) List() []*unregistration.Message {
 	fake.listMutex.Lock()
 	ret, specificReturn := fake.listReturnsOnCall[len(fake.listArgsForCall)]
@@ -162,6 +603,162 @@ func (fake *FakeCache) ListReturnsOnCall(i int, result1 []*unregistration.Messag
 	}{result1}
 }
 
+func (fake *FakeCache) ListInternal() []*unregistration.Message {
+	fake.listInternalMutex.Lock()
+	ret, specificReturn := fake.listInternalReturnsOnCall[len(fake.listInternalArgsForCall)]
+	fake.listInternalArgsForCall = append(fake.listInternalArgsForCall, struct {
+	}{})
+	fake.recordInvocation("ListInternal", []interface{}{})
+	fake.listInternalMutex.Unlock()
+	if fake.ListInternalStub != nil {
+		return fake.ListInternalStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.listInternalReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) ListInternalCallCount() int {
+	fake.listInternalMutex.RLock()
+	defer fake.listInternalMutex.RUnlock()
+	return len(fake.listInternalArgsForCall)
+}
+
+func (fake *FakeCache) ListInternalCalls(stub func() []*unregistration.Message) {
+	fake.listInternalMutex.Lock()
+	defer fake.listInternalMutex.Unlock()
+	fake.ListInternalStub = stub
+}
+
+func (fake *FakeCache) ListInternalReturns(result1 []*unregistration.Message) {
+	fake.listInternalMutex.Lock()
+	defer fake.listInternalMutex.Unlock()
+	fake.ListInternalStub = nil
+	fake.listInternalReturns = struct {
+		result1 []*unregistration.Message
+	}{result1}
+}
+
+func (fake *FakeCache) ListInternalReturnsOnCall(i int, result1 []*unregistration.Message) {
+	fake.listInternalMutex.Lock()
+	defer fake.listInternalMutex.Unlock()
+	fake.ListInternalStub = nil
+	if fake.listInternalReturnsOnCall == nil {
+		fake.listInternalReturnsOnCall = make(map[int]struct {
+			result1 []*unregistration.Message
+		})
+	}
+	fake.listInternalReturnsOnCall[i] = struct {
+		result1 []*unregistration.Message
+	}{result1}
+}
+
+func (fake *FakeCache) ListTCP() []*unregistration.TCPMessage {
+	fake.listTCPMutex.Lock()
+	ret, specificReturn := fake.listTCPReturnsOnCall[len(fake.listTCPArgsForCall)]
+	fake.listTCPArgsForCall = append(fake.listTCPArgsForCall, struct {
+	}{})
+	fake.recordInvocation("ListTCP", []interface{}{})
+	fake.listTCPMutex.Unlock()
+	if fake.ListTCPStub != nil {
+		return fake.ListTCPStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.listTCPReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) ListTCPCallCount() int {
+	fake.listTCPMutex.RLock()
+	defer fake.listTCPMutex.RUnlock()
+	return len(fake.listTCPArgsForCall)
+}
+
+func (fake *FakeCache) ListTCPCalls(stub func() []*unregistration.TCPMessage) {
+	fake.listTCPMutex.Lock()
+	defer fake.listTCPMutex.Unlock()
+	fake.ListTCPStub = stub
+}
+
+func (fake *FakeCache) ListTCPReturns(result1 []*unregistration.TCPMessage) {
+	fake.listTCPMutex.Lock()
+	defer fake.listTCPMutex.Unlock()
+	fake.ListTCPStub = nil
+	fake.listTCPReturns = struct {
+		result1 []*unregistration.TCPMessage
+	}{result1}
+}
+
+func (fake *FakeCache) ListTCPReturnsOnCall(i int, result1 []*unregistration.TCPMessage) {
+	fake.listTCPMutex.Lock()
+	defer fake.listTCPMutex.Unlock()
+	fake.ListTCPStub = nil
+	if fake.listTCPReturnsOnCall == nil {
+		fake.listTCPReturnsOnCall = make(map[int]struct {
+			result1 []*unregistration.TCPMessage
+		})
+	}
+	fake.listTCPReturnsOnCall[i] = struct {
+		result1 []*unregistration.TCPMessage
+	}{result1}
+}
+
+func (fake *FakeCache) Persist() error {
+	fake.persistMutex.Lock()
+	ret, specificReturn := fake.persistReturnsOnCall[len(fake.persistArgsForCall)]
+	fake.persistArgsForCall = append(fake.persistArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Persist", []interface{}{})
+	fake.persistMutex.Unlock()
+	if fake.PersistStub != nil {
+		return fake.PersistStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.persistReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) PersistCallCount() int {
+	fake.persistMutex.RLock()
+	defer fake.persistMutex.RUnlock()
+	return len(fake.persistArgsForCall)
+}
+
+func (fake *FakeCache) PersistCalls(stub func() error) {
+	fake.persistMutex.Lock()
+	defer fake.persistMutex.Unlock()
+	fake.PersistStub = stub
+}
+
+func (fake *FakeCache) PersistReturns(result1 error) {
+	fake.persistMutex.Lock()
+	defer fake.persistMutex.Unlock()
+	fake.PersistStub = nil
+	fake.persistReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) PersistReturnsOnCall(i int, result1 error) {
+	fake.persistMutex.Lock()
+	defer fake.persistMutex.Unlock()
+	fake.PersistStub = nil
+	if fake.persistReturnsOnCall == nil {
+		fake.persistReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.persistReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeCache) Remove(arg1 []routingtable.RegistryMessage) error {
 	var arg1Copy []routingtable.RegistryMessage
 	if arg1 != nil {
@@ -227,15 +824,391 @@ func (fake *FakeCache) RemoveReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeCache) RemoveInternal(arg1 []routingtable.RegistryMessage) error {
+	var arg1Copy []routingtable.RegistryMessage
+	if arg1 != nil {
+		arg1Copy = make([]routingtable.RegistryMessage, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.removeInternalMutex.Lock()
+	ret, specificReturn := fake.removeInternalReturnsOnCall[len(fake.removeInternalArgsForCall)]
+	fake.removeInternalArgsForCall = append(fake.removeInternalArgsForCall, struct {
+		arg1 []routingtable.RegistryMessage
+	}{arg1Copy})
+	fake.recordInvocation("RemoveInternal", []interface{}{arg1Copy})
+	fake.removeInternalMutex.Unlock()
+	if fake.RemoveInternalStub != nil {
+		return fake.RemoveInternalStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.removeInternalReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) RemoveInternalCallCount() int {
+	fake.removeInternalMutex.RLock()
+	defer fake.removeInternalMutex.RUnlock()
+	return len(fake.removeInternalArgsForCall)
+}
+
+func (fake *FakeCache) RemoveInternalCalls(stub func([]routingtable.RegistryMessage) error) {
+	fake.removeInternalMutex.Lock()
+	defer fake.removeInternalMutex.Unlock()
+	fake.RemoveInternalStub = stub
+}
+
+func (fake *FakeCache) RemoveInternalArgsForCall(i int) []routingtable.RegistryMessage {
+	fake.removeInternalMutex.RLock()
+	defer fake.removeInternalMutex.RUnlock()
+	argsForCall := fake.removeInternalArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCache) RemoveInternalReturns(result1 error) {
+	fake.removeInternalMutex.Lock()
+	defer fake.removeInternalMutex.Unlock()
+	fake.RemoveInternalStub = nil
+	fake.removeInternalReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) RemoveInternalReturnsOnCall(i int, result1 error) {
+	fake.removeInternalMutex.Lock()
+	defer fake.removeInternalMutex.Unlock()
+	fake.RemoveInternalStub = nil
+	if fake.removeInternalReturnsOnCall == nil {
+		fake.removeInternalReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.removeInternalReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) RemoveTCP(arg1 []tcpmodels.TcpRouteMapping) error {
+	var arg1Copy []tcpmodels.TcpRouteMapping
+	if arg1 != nil {
+		arg1Copy = make([]tcpmodels.TcpRouteMapping, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.removeTCPMutex.Lock()
+	ret, specificReturn := fake.removeTCPReturnsOnCall[len(fake.removeTCPArgsForCall)]
+	fake.removeTCPArgsForCall = append(fake.removeTCPArgsForCall, struct {
+		arg1 []tcpmodels.TcpRouteMapping
+	}{arg1Copy})
+	fake.recordInvocation("RemoveTCP", []interface{}{arg1Copy})
+	fake.removeTCPMutex.Unlock()
+	if fake.RemoveTCPStub != nil {
+		return fake.RemoveTCPStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.removeTCPReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) RemoveTCPCallCount() int {
+	fake.removeTCPMutex.RLock()
+	defer fake.removeTCPMutex.RUnlock()
+	return len(fake.removeTCPArgsForCall)
+}
+
+func (fake *FakeCache) RemoveTCPCalls(stub func([]tcpmodels.TcpRouteMapping) error) {
+	fake.removeTCPMutex.Lock()
+	defer fake.removeTCPMutex.Unlock()
+	fake.RemoveTCPStub = stub
+}
+
+func (fake *FakeCache) RemoveTCPArgsForCall(i int) []tcpmodels.TcpRouteMapping {
+	fake.removeTCPMutex.RLock()
+	defer fake.removeTCPMutex.RUnlock()
+	argsForCall := fake.removeTCPArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCache) RemoveTCPReturns(result1 error) {
+	fake.removeTCPMutex.Lock()
+	defer fake.removeTCPMutex.Unlock()
+	fake.RemoveTCPStub = nil
+	fake.removeTCPReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) RemoveTCPReturnsOnCall(i int, result1 error) {
+	fake.removeTCPMutex.Lock()
+	defer fake.removeTCPMutex.Unlock()
+	fake.RemoveTCPStub = nil
+	if fake.removeTCPReturnsOnCall == nil {
+		fake.removeTCPReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.removeTCPReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) SyncCompleted() {
+	fake.syncCompletedMutex.Lock()
+	fake.syncCompletedArgsForCall = append(fake.syncCompletedArgsForCall, struct {
+	}{})
+	fake.recordInvocation("SyncCompleted", []interface{}{})
+	fake.syncCompletedMutex.Unlock()
+	if fake.SyncCompletedStub != nil {
+		fake.SyncCompletedStub()
+	}
+}
+
+func (fake *FakeCache) SyncCompletedCallCount() int {
+	fake.syncCompletedMutex.RLock()
+	defer fake.syncCompletedMutex.RUnlock()
+	return len(fake.syncCompletedArgsForCall)
+}
+
+func (fake *FakeCache) SyncCompletedCalls(stub func()) {
+	fake.syncCompletedMutex.Lock()
+	defer fake.syncCompletedMutex.Unlock()
+	fake.SyncCompletedStub = stub
+}
+
+func (fake *FakeCache) TakeDue(arg1 time.Time, arg2 int, arg3 func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int) {
+	fake.takeDueMutex.Lock()
+	ret, specificReturn := fake.takeDueReturnsOnCall[len(fake.takeDueArgsForCall)]
+	fake.takeDueArgsForCall = append(fake.takeDueArgsForCall, struct {
+		arg1 time.Time
+		arg2 int
+		arg3 func(sentCount int) time.Duration
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("TakeDue", []interface{}{arg1, arg2, arg3})
+	fake.takeDueMutex.Unlock()
+	if fake.TakeDueStub != nil {
+		return fake.TakeDueStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.takeDueReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCache) TakeDueCallCount() int {
+	fake.takeDueMutex.RLock()
+	defer fake.takeDueMutex.RUnlock()
+	return len(fake.takeDueArgsForCall)
+}
+
+func (fake *FakeCache) TakeDueCalls(stub func(time.Time, int, func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int)) {
+	fake.takeDueMutex.Lock()
+	defer fake.takeDueMutex.Unlock()
+	fake.TakeDueStub = stub
+}
+
+func (fake *FakeCache) TakeDueArgsForCall(i int) (time.Time, int, func(sentCount int) time.Duration) {
+	fake.takeDueMutex.RLock()
+	defer fake.takeDueMutex.RUnlock()
+	argsForCall := fake.takeDueArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCache) TakeDueReturns(result1 []routingtable.RegistryMessage, result2 int) {
+	fake.takeDueMutex.Lock()
+	defer fake.takeDueMutex.Unlock()
+	fake.TakeDueStub = nil
+	fake.takeDueReturns = struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}{result1, result2}
+}
+
+func (fake *FakeCache) TakeDueReturnsOnCall(i int, result1 []routingtable.RegistryMessage, result2 int) {
+	fake.takeDueMutex.Lock()
+	defer fake.takeDueMutex.Unlock()
+	fake.TakeDueStub = nil
+	if fake.takeDueReturnsOnCall == nil {
+		fake.takeDueReturnsOnCall = make(map[int]struct {
+			result1 []routingtable.RegistryMessage
+			result2 int
+		})
+	}
+	fake.takeDueReturnsOnCall[i] = struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}{result1, result2}
+}
+
+func (fake *FakeCache) TakeDueInternal(arg1 time.Time, arg2 int, arg3 func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int) {
+	fake.takeDueInternalMutex.Lock()
+	ret, specificReturn := fake.takeDueInternalReturnsOnCall[len(fake.takeDueInternalArgsForCall)]
+	fake.takeDueInternalArgsForCall = append(fake.takeDueInternalArgsForCall, struct {
+		arg1 time.Time
+		arg2 int
+		arg3 func(sentCount int) time.Duration
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("TakeDueInternal", []interface{}{arg1, arg2, arg3})
+	fake.takeDueInternalMutex.Unlock()
+	if fake.TakeDueInternalStub != nil {
+		return fake.TakeDueInternalStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.takeDueInternalReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCache) TakeDueInternalCallCount() int {
+	fake.takeDueInternalMutex.RLock()
+	defer fake.takeDueInternalMutex.RUnlock()
+	return len(fake.takeDueInternalArgsForCall)
+}
+
+func (fake *FakeCache) TakeDueInternalCalls(stub func(time.Time, int, func(sentCount int) time.Duration) ([]routingtable.RegistryMessage, int)) {
+	fake.takeDueInternalMutex.Lock()
+	defer fake.takeDueInternalMutex.Unlock()
+	fake.TakeDueInternalStub = stub
+}
+
+func (fake *FakeCache) TakeDueInternalArgsForCall(i int) (time.Time, int, func(sentCount int) time.Duration) {
+	fake.takeDueInternalMutex.RLock()
+	defer fake.takeDueInternalMutex.RUnlock()
+	argsForCall := fake.takeDueInternalArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCache) TakeDueInternalReturns(result1 []routingtable.RegistryMessage, result2 int) {
+	fake.takeDueInternalMutex.Lock()
+	defer fake.takeDueInternalMutex.Unlock()
+	fake.TakeDueInternalStub = nil
+	fake.takeDueInternalReturns = struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}{result1, result2}
+}
+
+func (fake *FakeCache) TakeDueInternalReturnsOnCall(i int, result1 []routingtable.RegistryMessage, result2 int) {
+	fake.takeDueInternalMutex.Lock()
+	defer fake.takeDueInternalMutex.Unlock()
+	fake.TakeDueInternalStub = nil
+	if fake.takeDueInternalReturnsOnCall == nil {
+		fake.takeDueInternalReturnsOnCall = make(map[int]struct {
+			result1 []routingtable.RegistryMessage
+			result2 int
+		})
+	}
+	fake.takeDueInternalReturnsOnCall[i] = struct {
+		result1 []routingtable.RegistryMessage
+		result2 int
+	}{result1, result2}
+}
+
+func (fake *FakeCache) TakeDueTCP(arg1 time.Time, arg2 int, arg3 func(sentCount int) time.Duration) ([]tcpmodels.TcpRouteMapping, int) {
+	fake.takeDueTCPMutex.Lock()
+	ret, specificReturn := fake.takeDueTCPReturnsOnCall[len(fake.takeDueTCPArgsForCall)]
+	fake.takeDueTCPArgsForCall = append(fake.takeDueTCPArgsForCall, struct {
+		arg1 time.Time
+		arg2 int
+		arg3 func(sentCount int) time.Duration
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("TakeDueTCP", []interface{}{arg1, arg2, arg3})
+	fake.takeDueTCPMutex.Unlock()
+	if fake.TakeDueTCPStub != nil {
+		return fake.TakeDueTCPStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.takeDueTCPReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCache) TakeDueTCPCallCount() int {
+	fake.takeDueTCPMutex.RLock()
+	defer fake.takeDueTCPMutex.RUnlock()
+	return len(fake.takeDueTCPArgsForCall)
+}
+
+func (fake *FakeCache) TakeDueTCPCalls(stub func(time.Time, int, func(sentCount int) time.Duration) ([]tcpmodels.TcpRouteMapping, int)) {
+	fake.takeDueTCPMutex.Lock()
+	defer fake.takeDueTCPMutex.Unlock()
+	fake.TakeDueTCPStub = stub
+}
+
+func (fake *FakeCache) TakeDueTCPArgsForCall(i int) (time.Time, int, func(sentCount int) time.Duration) {
+	fake.takeDueTCPMutex.RLock()
+	defer fake.takeDueTCPMutex.RUnlock()
+	argsForCall := fake.takeDueTCPArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCache) TakeDueTCPReturns(result1 []tcpmodels.TcpRouteMapping, result2 int) {
+	fake.takeDueTCPMutex.Lock()
+	defer fake.takeDueTCPMutex.Unlock()
+	fake.TakeDueTCPStub = nil
+	fake.takeDueTCPReturns = struct {
+		result1 []tcpmodels.TcpRouteMapping
+		result2 int
+	}{result1, result2}
+}
+
+func (fake *FakeCache) TakeDueTCPReturnsOnCall(i int, result1 []tcpmodels.TcpRouteMapping, result2 int) {
+	fake.takeDueTCPMutex.Lock()
+	defer fake.takeDueTCPMutex.Unlock()
+	fake.TakeDueTCPStub = nil
+	if fake.takeDueTCPReturnsOnCall == nil {
+		fake.takeDueTCPReturnsOnCall = make(map[int]struct {
+			result1 []tcpmodels.TcpRouteMapping
+			result2 int
+		})
+	}
+	fake.takeDueTCPReturnsOnCall[i] = struct {
+		result1 []tcpmodels.TcpRouteMapping
+		result2 int
+	}{result1, result2}
+}
+
 func (fake *FakeCache) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.addMutex.RLock()
 	defer fake.addMutex.RUnlock()
+	fake.addInternalMutex.RLock()
+	defer fake.addInternalMutex.RUnlock()
+	fake.addTCPMutex.RLock()
+	defer fake.addTCPMutex.RUnlock()
+	fake.countMutex.RLock()
+	defer fake.countMutex.RUnlock()
+	fake.countInternalMutex.RLock()
+	defer fake.countInternalMutex.RUnlock()
+	fake.countTCPMutex.RLock()
+	defer fake.countTCPMutex.RUnlock()
 	fake.listMutex.RLock()
 	defer fake.listMutex.RUnlock()
+	fake.listInternalMutex.RLock()
+	defer fake.listInternalMutex.RUnlock()
+	fake.listTCPMutex.RLock()
+	defer fake.listTCPMutex.RUnlock()
+	fake.persistMutex.RLock()
+	defer fake.persistMutex.RUnlock()
 	fake.removeMutex.RLock()
 	defer fake.removeMutex.RUnlock()
+	fake.removeInternalMutex.RLock()
+	defer fake.removeInternalMutex.RUnlock()
+	fake.removeTCPMutex.RLock()
+	defer fake.removeTCPMutex.RUnlock()
+	fake.syncCompletedMutex.RLock()
+	defer fake.syncCompletedMutex.RUnlock()
+	fake.takeDueMutex.RLock()
+	defer fake.takeDueMutex.RUnlock()
+	fake.takeDueInternalMutex.RLock()
+	defer fake.takeDueInternalMutex.RUnlock()
+	fake.takeDueTCPMutex.RLock()
+	defer fake.takeDueTCPMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
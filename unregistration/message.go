@@ -1,8 +1,22 @@
 package unregistration
 
-import "code.cloudfoundry.org/route-emitter/routingtable"
+import (
+	"time"
+
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
+)
 
 type Message struct {
 	RegistryMessage routingtable.RegistryMessage
 	SentCount       int
+	AddedAt         time.Time
+	NextSendAt      time.Time
+}
+
+type TCPMessage struct {
+	RouteMapping tcpmodels.TcpRouteMapping
+	SentCount    int
+	AddedAt      time.Time
+	NextSendAt   time.Time
 }
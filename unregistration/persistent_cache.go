@@ -0,0 +1,301 @@
+package unregistration
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
+)
+
+// persistentCache is a cache that is saved to disk so that pending
+// unregistrations survive a restart. Entries loaded at startup are held back
+// until the first sync has completed: routes that are registered again by the
+// sync are dropped, the others are released to the sender.
+type persistentCache struct {
+	*cache
+
+	path   string
+	logger lager.Logger
+
+	restoredLock     sync.Mutex
+	restored         bool
+	restoredMessages map[uint64]*Message
+	restoredInternal map[uint64]*Message
+	restoredTCP      map[tcpMappingKey]*TCPMessage
+}
+
+type persistedCache struct {
+	Messages         []persistedMessage    `json:"messages"`
+	InternalMessages []persistedMessage    `json:"internal_messages"`
+	TCPMessages      []persistedTCPMessage `json:"tcp_messages"`
+}
+
+type persistedMessage struct {
+	Hash            uint64                       `json:"hash"`
+	RegistryMessage routingtable.RegistryMessage `json:"registry_message"`
+	SentCount       int                          `json:"sent_count"`
+	AddedAt         time.Time                    `json:"added_at"`
+}
+
+type persistedTCPMessage struct {
+	RouteMapping tcpmodels.TcpRouteMapping `json:"route_mapping"`
+	SentCount    int                       `json:"sent_count"`
+	AddedAt      time.Time                 `json:"added_at"`
+}
+
+// NewPersistentCache returns a cache backed by the file at path. Entries
+// found in the file that are older than maxAge are discarded; a maxAge of zero
+// keeps every entry.
+func NewPersistentCache(logger lager.Logger, clock clock.Clock, path string, maxAge time.Duration) (Cache, error) {
+	c := &persistentCache{
+		cache:            newCache(logger, clock.Now),
+		path:             path,
+		logger:           logger.Session("persistent-unregistration-cache", lager.Data{"path": path}),
+		restoredMessages: map[uint64]*Message{},
+		restoredInternal: map[uint64]*Message{},
+		restoredTCP:      map[tcpMappingKey]*TCPMessage{},
+	}
+
+	err := c.load(clock.Now(), maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *persistentCache) load(now time.Time, maxAge time.Duration) error {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		c.logger.Info("no-persisted-cache")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var persisted persistedCache
+	err = json.Unmarshal(data, &persisted)
+	if err != nil {
+		c.logger.Error("failed-to-parse-persisted-cache", err)
+		return nil
+	}
+
+	expired := func(addedAt time.Time) bool {
+		return maxAge > 0 && now.Sub(addedAt) > maxAge
+	}
+
+	var restored, discarded int
+	for _, m := range persisted.Messages {
+		if expired(m.AddedAt) {
+			discarded++
+			continue
+		}
+		c.restoredMessages[m.Hash] = &Message{RegistryMessage: m.RegistryMessage, SentCount: m.SentCount, AddedAt: m.AddedAt}
+		restored++
+	}
+	for _, m := range persisted.InternalMessages {
+		if expired(m.AddedAt) {
+			discarded++
+			continue
+		}
+		c.restoredInternal[m.Hash] = &Message{RegistryMessage: m.RegistryMessage, SentCount: m.SentCount, AddedAt: m.AddedAt}
+		restored++
+	}
+	for _, m := range persisted.TCPMessages {
+		if expired(m.AddedAt) {
+			discarded++
+			continue
+		}
+		c.restoredTCP[keyForMapping(m.RouteMapping)] = &TCPMessage{RouteMapping: m.RouteMapping, SentCount: m.SentCount, AddedAt: m.AddedAt}
+		restored++
+	}
+
+	c.restored = restored > 0
+	c.dirty = discarded > 0
+	c.logger.Info("loaded-persisted-cache", lager.Data{"restored": restored, "expired": discarded})
+	return nil
+}
+
+func (c *persistentCache) Remove(registryMessages []routingtable.RegistryMessage) error {
+	err := c.cache.Remove(registryMessages)
+	if err != nil {
+		return err
+	}
+
+	c.restoredLock.Lock()
+	defer c.restoredLock.Unlock()
+	removed, err := removeMessages(c.restoredMessages, registryMessages)
+	c.markDirty(removed)
+	return err
+}
+
+func (c *persistentCache) RemoveInternal(registryMessages []routingtable.RegistryMessage) error {
+	err := c.cache.RemoveInternal(registryMessages)
+	if err != nil {
+		return err
+	}
+
+	c.restoredLock.Lock()
+	defer c.restoredLock.Unlock()
+	removed, err := removeMessages(c.restoredInternal, registryMessages)
+	c.markDirty(removed)
+	return err
+}
+
+func (c *persistentCache) RemoveTCP(mappings []tcpmodels.TcpRouteMapping) error {
+	err := c.cache.RemoveTCP(mappings)
+	if err != nil {
+		return err
+	}
+
+	c.restoredLock.Lock()
+	defer c.restoredLock.Unlock()
+	for _, mapping := range mappings {
+		key := keyForMapping(mapping)
+		if _, ok := c.restoredTCP[key]; ok {
+			delete(c.restoredTCP, key)
+			c.markDirty(true)
+		}
+	}
+	return nil
+}
+
+func (c *persistentCache) markDirty(changed bool) {
+	if !changed {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.dirty = true
+}
+
+// SyncCompleted releases the restored entries that were not registered again
+// by the sync to the sender
+func (c *persistentCache) SyncCompleted() {
+	c.restoredLock.Lock()
+	defer c.restoredLock.Unlock()
+
+	if !c.restored {
+		return
+	}
+	c.restored = false
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	released := 0
+	for hash, message := range c.restoredMessages {
+		if _, ok := c.messages[hash]; !ok {
+			c.messages[hash] = message
+			released++
+		}
+	}
+	for hash, message := range c.restoredInternal {
+		if _, ok := c.internalMessages[hash]; !ok {
+			c.internalMessages[hash] = message
+			released++
+		}
+	}
+	for key, message := range c.restoredTCP {
+		if _, ok := c.tcpMessages[key]; !ok {
+			c.tcpMessages[key] = message
+			released++
+		}
+	}
+
+	c.restoredMessages = map[uint64]*Message{}
+	c.restoredInternal = map[uint64]*Message{}
+	c.restoredTCP = map[tcpMappingKey]*TCPMessage{}
+	c.dirty = true
+
+	c.logger.Info("reconciled-persisted-cache", lager.Data{"released": released})
+}
+
+// Persist writes the cache, including the send counts, to disk if it has
+// changed since it was last written
+func (c *persistentCache) Persist() error {
+	c.restoredLock.Lock()
+	c.mux.Lock()
+	if !c.dirty {
+		c.mux.Unlock()
+		c.restoredLock.Unlock()
+		return nil
+	}
+	persisted := persistedCache{
+		Messages:         persistMessages(c.messages, c.restoredMessages),
+		InternalMessages: persistMessages(c.internalMessages, c.restoredInternal),
+		TCPMessages:      persistTCPMessages(c.tcpMessages, c.restoredTCP),
+	}
+	c.dirty = false
+	c.mux.Unlock()
+	c.restoredLock.Unlock()
+
+	err := c.write(persisted)
+	if err != nil {
+		c.markDirty(true)
+	}
+	return err
+}
+
+func (c *persistentCache) write(persisted persistedCache) error {
+	data, err := json.Marshal(persisted)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), c.path)
+}
+
+func persistMessages(sources ...map[uint64]*Message) []persistedMessage {
+	persisted := []persistedMessage{}
+	for _, messages := range sources {
+		for hash, message := range messages {
+			persisted = append(persisted, persistedMessage{
+				Hash:            hash,
+				RegistryMessage: message.RegistryMessage,
+				SentCount:       message.SentCount,
+				AddedAt:         message.AddedAt,
+			})
+		}
+	}
+	return persisted
+}
+
+func persistTCPMessages(sources ...map[tcpMappingKey]*TCPMessage) []persistedTCPMessage {
+	persisted := []persistedTCPMessage{}
+	for _, messages := range sources {
+		for _, message := range messages {
+			persisted = append(persisted, persistedTCPMessage{
+				RouteMapping: message.RouteMapping,
+				SentCount:    message.SentCount,
+				AddedAt:      message.AddedAt,
+			})
+		}
+	}
+	return persisted
+}
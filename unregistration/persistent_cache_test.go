@@ -0,0 +1,157 @@
+package unregistration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/unregistration"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PersistentCache", func() {
+	var (
+		logger                             *lagertest.TestLogger
+		clock                              *fakeclock.FakeClock
+		tmpDir, path                       string
+		maxAge                             time.Duration
+		registryMessage1, registryMessage2 routingtable.RegistryMessage
+		mapping                            tcpmodels.TcpRouteMapping
+	)
+
+	newCache := func() unregistration.Cache {
+		cache, err := unregistration.NewPersistentCache(logger, clock, path, maxAge)
+		Expect(err).NotTo(HaveOccurred())
+		return cache
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "unregistration-cache")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(tmpDir, "cache.json")
+
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		maxAge = time.Hour
+
+		registryMessage1 = routingtable.RegistryMessageFor(
+			routingtable.Endpoint{InstanceGUID: "instance-guid-1", Host: "1.1.1.1", Port: 61001, ContainerPort: 11},
+			routingtable.Route{Hostname: "host-1.example.com"},
+			false,
+		)
+		registryMessage2 = routingtable.RegistryMessageFor(
+			routingtable.Endpoint{InstanceGUID: "instance-guid-2", Host: "2.2.2.2", Port: 61002, ContainerPort: 22},
+			routingtable.Route{Hostname: "host-2.example.com"},
+			false,
+		)
+		mapping = tcpmodels.NewTcpRouteMapping("router-group", 61000, "1.1.1.1", 62000, 0)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("starts empty when there is no file", func() {
+		cache := newCache()
+		cache.SyncCompleted()
+		Expect(cache.List()).To(BeEmpty())
+	})
+
+	Context("when a previous cache was persisted", func() {
+		BeforeEach(func() {
+			cache := newCache()
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+			Expect(cache.AddTCP([]tcpmodels.TcpRouteMapping{mapping})).To(Succeed())
+			noSpacing := func(int) time.Duration { return 0 }
+			for i := 0; i < 2; i++ {
+				cache.TakeDue(clock.Now(), 5, noSpacing)
+			}
+			Expect(cache.Persist()).To(Succeed())
+		})
+
+		It("holds the restored entries back until the first sync completes", func() {
+			cache := newCache()
+			Expect(cache.List()).To(BeEmpty())
+			Expect(cache.ListTCP()).To(BeEmpty())
+
+			cache.SyncCompleted()
+			Expect(cache.List()).To(HaveLen(2))
+			Expect(cache.ListTCP()).To(HaveLen(1))
+		})
+
+		It("keeps the send counts", func() {
+			cache := newCache()
+			cache.SyncCompleted()
+
+			sentCounts := []int{}
+			for _, message := range cache.List() {
+				sentCounts = append(sentCounts, message.SentCount)
+			}
+			Expect(sentCounts).To(ConsistOf(2, 2))
+		})
+
+		It("drops the entries registered again by the sync", func() {
+			cache := newCache()
+			Expect(cache.Remove([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+			Expect(cache.RemoveTCP([]tcpmodels.TcpRouteMapping{mapping})).To(Succeed())
+			cache.SyncCompleted()
+
+			cachedMessages := cache.List()
+			Expect(cachedMessages).To(HaveLen(1))
+			Expect(cachedMessages[0].RegistryMessage).To(Equal(registryMessage2))
+			Expect(cache.ListTCP()).To(BeEmpty())
+		})
+
+		Context("when the entries are older than the max age", func() {
+			It("discards them", func() {
+				clock.Increment(maxAge + time.Second)
+
+				cache := newCache()
+				cache.SyncCompleted()
+				Expect(cache.List()).To(BeEmpty())
+				Expect(cache.ListTCP()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Persist", func() {
+		It("only writes the file when the cache has changed", func() {
+			cache := newCache()
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+			Expect(cache.Persist()).To(Succeed())
+			Expect(path).To(BeAnExistingFile())
+
+			Expect(os.Remove(path)).To(Succeed())
+			Expect(cache.Persist()).To(Succeed())
+			Expect(path).NotTo(BeAnExistingFile())
+
+			Expect(cache.Remove([]routingtable.RegistryMessage{registryMessage2})).To(Succeed())
+			Expect(cache.Persist()).To(Succeed())
+			Expect(path).NotTo(BeAnExistingFile())
+
+			cache.TakeDue(clock.Now(), 5, func(int) time.Duration { return time.Minute })
+			Expect(cache.Persist()).To(Succeed())
+			Expect(path).To(BeAnExistingFile())
+		})
+	})
+
+	Context("when the file is corrupt", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(path, []byte("{not json"), 0644)).To(Succeed())
+		})
+
+		It("starts with an empty cache", func() {
+			cache := newCache()
+			cache.SyncCompleted()
+			Expect(cache.List()).To(BeEmpty())
+		})
+	})
+})
@@ -1,22 +1,61 @@
 package unregistration
 
 import (
+	"math/rand"
 	"os"
 	"time"
 
 	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/route-emitter/emitter"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 )
 
+// resendJitter is the fraction by which the spacing between two resends of
+// the same unregistration is shortened at random, so that unregistrations
+// added together do not stay in lockstep
+const resendJitter = 0.2
+
+// metricNames are the metrics emitted for one kind of unregistration
+type metricNames struct {
+	pending string
+	sent    string
+	expired string
+}
+
+var (
+	httpMetrics = metricNames{
+		pending: "UnregistrationsPending",
+		sent:    "UnregistrationsSent",
+		expired: "UnregistrationsExpired",
+	}
+	internalMetrics = metricNames{
+		pending: "InternalUnregistrationsPending",
+		sent:    "InternalUnregistrationsSent",
+		expired: "InternalUnregistrationsExpired",
+	}
+	tcpMetrics = metricNames{
+		pending: "TCPUnregistrationsPending",
+		sent:    "TCPUnregistrationsSent",
+		expired: "TCPUnregistrationsExpired",
+	}
+)
+
 type Sender struct {
-	logger      lager.Logger
-	clock       clock.Clock
-	cache       Cache
-	natsEmitter emitter.NATSEmitter
-	interval    time.Duration
-	sendCount   int
+	logger            lager.Logger
+	clock             clock.Clock
+	cache             Cache
+	natsEmitter       emitter.NATSEmitter
+	routingAPIEmitter emitter.RoutingAPIEmitter
+	metronClient      loggingclient.IngressClient
+	interval          time.Duration
+	sendCount         int
+	internalInterval  time.Duration
+	internalSendCount int
+	tcpInterval       time.Duration
+	tcpSendCount      int
+	randSource        *rand.Rand
 }
 
 func NewSender(
@@ -24,16 +63,29 @@ func NewSender(
 	clock clock.Clock,
 	cache Cache,
 	natsEmitter emitter.NATSEmitter,
+	routingAPIEmitter emitter.RoutingAPIEmitter,
+	metronClient loggingclient.IngressClient,
 	interval time.Duration,
 	sendCount int,
+	internalInterval time.Duration,
+	internalSendCount int,
+	tcpInterval time.Duration,
+	tcpSendCount int,
 ) Sender {
 	return Sender{
-		logger:      logger.Session("unregistration-sender"),
-		clock:       clock,
-		cache:       cache,
-		natsEmitter: natsEmitter,
-		interval:    interval,
-		sendCount:   sendCount,
+		logger:            logger.Session("unregistration-sender"),
+		clock:             clock,
+		cache:             cache,
+		natsEmitter:       natsEmitter,
+		routingAPIEmitter: routingAPIEmitter,
+		metronClient:      metronClient,
+		interval:          interval,
+		sendCount:         sendCount,
+		internalInterval:  internalInterval,
+		internalSendCount: internalSendCount,
+		tcpInterval:       tcpInterval,
+		tcpSendCount:      tcpSendCount,
+		randSource:        rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
@@ -42,29 +94,126 @@ func (s Sender) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	close(ready)
 	defer s.logger.Info("exiting")
 
-	sendTicker := s.clock.NewTicker(s.interval)
-	defer sendTicker.Stop()
+	sendTicker := s.newTicker(s.interval, s.sendCount)
+	defer stopTicker(sendTicker)
+
+	internalSendTicker := s.newTicker(s.internalInterval, s.internalSendCount)
+	defer stopTicker(internalSendTicker)
+
+	var tcpSendTicker clock.Ticker
+	if s.routingAPIEmitter != nil {
+		tcpSendTicker = s.newTicker(s.tcpInterval, s.tcpSendCount)
+	}
+	defer stopTicker(tcpSendTicker)
 
 	for {
 		select {
 		case <-signals:
 			s.logger.Info("stopping")
+			s.persist()
 			return nil
 
-		case <-sendTicker.C():
-			messages := s.cache.List()
+		case now := <-tickerChan(sendTicker):
+			messages, expired := s.cache.TakeDue(now, s.sendCount, s.spacing(s.interval))
 			if len(messages) > 0 {
-				s.logger.Debug("messages", lager.Data{"cache": messages})
+				s.logger.Debug("messages", lager.Data{"count": len(messages), "expired": expired})
+				_, err := s.natsEmitter.Emit(routingtable.MessagesToEmit{UnregistrationMessages: messages})
+				if err != nil {
+					s.logger.Error("failed-to-emit-unregistrations", err)
+				}
+			}
+			s.emitMetrics(httpMetrics, s.cache.Count(), len(messages), expired)
+			s.persist()
+
+		case now := <-tickerChan(internalSendTicker):
+			messages, expired := s.cache.TakeDueInternal(now, s.internalSendCount, s.spacing(s.internalInterval))
+			if len(messages) > 0 {
+				s.logger.Debug("internal-messages", lager.Data{"count": len(messages), "expired": expired})
+				_, err := s.natsEmitter.Emit(routingtable.MessagesToEmit{InternalUnregistrationMessages: messages})
+				if err != nil {
+					s.logger.Error("failed-to-emit-internal-unregistrations", err)
+				}
 			}
-			for _, message := range messages {
-				s.natsEmitter.Emit(routingtable.MessagesToEmit{
-					UnregistrationMessages: []routingtable.RegistryMessage{message.RegistryMessage},
-				})
-				message.SentCount++
-				if message.SentCount == s.sendCount {
-					s.cache.Remove([]routingtable.RegistryMessage{message.RegistryMessage})
+			s.emitMetrics(internalMetrics, s.cache.CountInternal(), len(messages), expired)
+			s.persist()
+
+		case now := <-tickerChan(tcpSendTicker):
+			mappings, expired := s.cache.TakeDueTCP(now, s.tcpSendCount, s.spacing(s.tcpInterval))
+			if len(mappings) > 0 {
+				s.logger.Debug("tcp-messages", lager.Data{"count": len(mappings), "expired": expired})
+				err := s.routingAPIEmitter.Emit(routingtable.TCPRouteMappings{Unregistrations: mappings})
+				if err != nil {
+					s.logger.Error("failed-to-emit-tcp-unregistrations", err)
 				}
 			}
+			s.emitMetrics(tcpMetrics, s.cache.CountTCP(), len(mappings), expired)
+			s.persist()
 		}
 	}
 }
+
+// spacing returns the delay before the next resend of an unregistration that
+// has been sent sentCount times. The delay doubles with every send and is
+// shortened by up to resendJitter, so the next resend is never due later
+// than the doubled delay.
+func (s Sender) spacing(interval time.Duration) func(sentCount int) time.Duration {
+	return func(sentCount int) time.Duration {
+		delay := interval << uint(sentCount-1)
+		jitter := time.Duration(s.randSource.Float64() * resendJitter * float64(delay))
+		return delay - jitter
+	}
+}
+
+func (s Sender) emitMetrics(names metricNames, pending, sent, expired int) {
+	err := s.metronClient.SendMetric(names.pending, pending)
+	if err != nil {
+		s.logger.Error("cannot-send-unregistration-metric", err, lager.Data{"metric-name": names.pending})
+	}
+	if sent > 0 {
+		err = s.metronClient.IncrementCounterWithDelta(names.sent, uint64(sent))
+		if err != nil {
+			s.logger.Error("cannot-send-unregistration-metric", err, lager.Data{"metric-name": names.sent})
+		}
+	}
+	if expired > 0 {
+		err = s.metronClient.IncrementCounterWithDelta(names.expired, uint64(expired))
+		if err != nil {
+			s.logger.Error("cannot-send-unregistration-metric", err, lager.Data{"metric-name": names.expired})
+		}
+	}
+}
+
+func (s Sender) persist() {
+	err := s.cache.Persist()
+	if err != nil {
+		s.logger.Error("failed-to-persist-cache", err)
+	}
+}
+
+// newTicker returns nil when resending is disabled for a kind of
+// unregistration
+// ResendEnabled reports whether unregistrations are resent at all with the
+// given interval and send count
+func ResendEnabled(interval time.Duration, sendCount int) bool {
+	return interval > 0 && sendCount > 0
+}
+
+func (s Sender) newTicker(interval time.Duration, sendCount int) clock.Ticker {
+	if !ResendEnabled(interval, sendCount) {
+		return nil
+	}
+	return s.clock.NewTicker(interval)
+}
+
+func tickerChan(ticker clock.Ticker) <-chan time.Time {
+	if ticker == nil {
+		return nil
+	}
+	return ticker.C()
+}
+
+func stopTicker(ticker clock.Ticker) {
+	if ticker != nil {
+		ticker.Stop()
+	}
+}
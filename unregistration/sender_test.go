@@ -7,10 +7,12 @@ import (
 	"github.com/tedsuo/ifrit"
 
 	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/route-emitter/emitter/fakes"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/unregistration"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -18,21 +20,33 @@ import (
 
 var _ = Describe("Sender", func() {
 	var (
-		sender        ifrit.Runner
-		senderProcess ifrit.Process
-		natsEmitter   *fakes.FakeNATSEmitter
-		cache         unregistration.Cache
-		clock         *fakeclock.FakeClock
-		sendInterval  time.Duration
+		sender            ifrit.Runner
+		senderProcess     ifrit.Process
+		natsEmitter       *fakes.FakeNATSEmitter
+		routingAPIEmitter *fakes.FakeRoutingAPIEmitter
+		fakeMetronClient  *mfakes.FakeIngressClient
+		cache             unregistration.Cache
+		clock             *fakeclock.FakeClock
+		sendInterval      time.Duration
+		internalInterval  time.Duration
+		tcpInterval       time.Duration
+		logger            *lagertest.TestLogger
 	)
 
 	BeforeEach(func() {
-		logger := lagertest.NewTestLogger("sender")
+		logger = lagertest.NewTestLogger("sender")
 		cache = unregistration.NewCache(logger)
 		natsEmitter = &fakes.FakeNATSEmitter{}
+		routingAPIEmitter = &fakes.FakeRoutingAPIEmitter{}
+		fakeMetronClient = &mfakes.FakeIngressClient{}
 		clock = fakeclock.NewFakeClock(time.Now())
 		sendInterval = 500 * time.Millisecond
-		sender = unregistration.NewSender(logger, clock, cache, natsEmitter, sendInterval, 3)
+		internalInterval = 0
+		tcpInterval = 0
+	})
+
+	JustBeforeEach(func() {
+		sender = unregistration.NewSender(logger, clock, cache, natsEmitter, routingAPIEmitter, fakeMetronClient, sendInterval, 3, internalInterval, 2, tcpInterval, 2)
 		senderProcess = ifrit.Background(sender)
 	})
 
@@ -75,47 +89,84 @@ var _ = Describe("Sender", func() {
 			})
 		})
 
-		It("emits unregistration for each message the required number of times", func() {
+		It("emits the due unregistrations in one batch per tick with increasing spacing", func() {
+			clock.WaitForWatcherAndIncrement(sendInterval)
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+			Expect(natsEmitter.EmitArgsForCall(0).UnregistrationMessages).To(ConsistOf(
+				routingtable.RegistryMessageFor(endpoint1, route1, false),
+				routingtable.RegistryMessageFor(endpoint2, route2, false),
+			))
+
 			clock.WaitForWatcherAndIncrement(sendInterval)
 			Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+			Expect(natsEmitter.EmitArgsForCall(1).UnregistrationMessages).To(HaveLen(2))
 
+			// the third send is spaced by up to twice the interval
+			clock.WaitForWatcherAndIncrement(sendInterval)
+			clock.WaitForWatcherAndIncrement(sendInterval)
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(3))
+			Expect(natsEmitter.EmitArgsForCall(2).UnregistrationMessages).To(HaveLen(2))
+			Expect(cache.List()).To(BeEmpty())
+
+			clock.WaitForWatcherAndIncrement(sendInterval)
 			clock.WaitForWatcherAndIncrement(sendInterval)
-			Eventually(natsEmitter.EmitCallCount).Should(Equal(4))
+			Consistently(natsEmitter.EmitCallCount).Should(Equal(3))
+		})
 
+		It("emits pending, sent and expired metrics", func() {
 			clock.WaitForWatcherAndIncrement(sendInterval)
-			Eventually(natsEmitter.EmitCallCount).Should(Equal(6))
+			Eventually(fakeMetronClient.IncrementCounterWithDeltaCallCount).Should(Equal(1))
+			name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal("UnregistrationsSent"))
+			Expect(delta).To(BeEquivalentTo(2))
+
+			Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(1))
+			name, value, _ := fakeMetronClient.SendMetricArgsForCall(0)
+			Expect(name).To(Equal("UnregistrationsPending"))
+			Expect(value).To(Equal(2))
 
 			clock.WaitForWatcherAndIncrement(sendInterval)
-			Consistently(natsEmitter.EmitCallCount).Should(Equal(6))
+			clock.WaitForWatcherAndIncrement(sendInterval)
+			clock.WaitForWatcherAndIncrement(sendInterval)
+			Eventually(fakeMetronClient.IncrementCounterWithDeltaCallCount).Should(Equal(4))
+			name, delta = fakeMetronClient.IncrementCounterWithDeltaArgsForCall(3)
+			Expect(name).To(Equal("UnregistrationsExpired"))
+			Expect(delta).To(BeEquivalentTo(2))
+
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(4))
+			name, value, _ = fakeMetronClient.SendMetricArgsForCall(3)
+			Expect(name).To(Equal("UnregistrationsPending"))
+			Expect(value).To(Equal(0))
 		})
 
 		Context("when one of the messages is removed", func() {
 			It("stops emitting unregistration messages", func() {
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(4))
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
 
 				cache.Remove([]routingtable.RegistryMessage{
 					routingtable.RegistryMessageFor(endpoint1, route1, false),
 				})
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(5))
-
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Consistently(natsEmitter.EmitCallCount).Should(Equal(5))
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(3))
+				Expect(natsEmitter.EmitArgsForCall(2).UnregistrationMessages).To(ConsistOf(
+					routingtable.RegistryMessageFor(endpoint2, route2, false),
+				))
 			})
 		})
 
 		Context("when another message is added", func() {
-			It("stops emitting unregistration messages", func() {
+			It("emits it on the next tick", func() {
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(4))
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
 
 				endpoint3 := routingtable.Endpoint{
 					InstanceGUID:  "instance-guid-3",
@@ -132,8 +183,63 @@ var _ = Describe("Sender", func() {
 				})
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(7))
+				Eventually(natsEmitter.EmitCallCount).Should(Equal(3))
+				Expect(natsEmitter.EmitArgsForCall(2).UnregistrationMessages).To(ConsistOf(
+					routingtable.RegistryMessageFor(endpoint3, route3, false),
+				))
 			})
 		})
 	})
+
+	Context("when there are internal unregistrations in cache", func() {
+		var internalMessage routingtable.RegistryMessage
+
+		BeforeEach(func() {
+			sendInterval = 0
+			internalInterval = 200 * time.Millisecond
+			internalMessage = routingtable.InternalEndpointRegistryMessageFor(
+				routingtable.Endpoint{ContainerIP: "1.2.3.4"},
+				routingtable.InternalRoute{Hostname: "internal.apps.internal"},
+				false,
+			)
+			Expect(cache.AddInternal([]routingtable.RegistryMessage{internalMessage})).To(Succeed())
+		})
+
+		It("emits internal unregistrations at their own interval and count", func() {
+			clock.WaitForWatcherAndIncrement(internalInterval)
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(1))
+			Expect(natsEmitter.EmitArgsForCall(0).InternalUnregistrationMessages).To(ConsistOf(internalMessage))
+
+			clock.WaitForWatcherAndIncrement(internalInterval)
+			Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+
+			clock.WaitForWatcherAndIncrement(internalInterval)
+			Consistently(natsEmitter.EmitCallCount).Should(Equal(2))
+			Expect(cache.ListInternal()).To(BeEmpty())
+		})
+	})
+
+	Context("when there are tcp route mapping deletions in cache", func() {
+		var mapping tcpmodels.TcpRouteMapping
+
+		BeforeEach(func() {
+			sendInterval = 0
+			tcpInterval = 300 * time.Millisecond
+			mapping = tcpmodels.NewTcpRouteMapping("router-group", 61000, "1.1.1.1", 62000, 0)
+			Expect(cache.AddTCP([]tcpmodels.TcpRouteMapping{mapping})).To(Succeed())
+		})
+
+		It("deletes them through the routing api the required number of times", func() {
+			clock.WaitForWatcherAndIncrement(tcpInterval)
+			Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(1))
+			Expect(routingAPIEmitter.EmitArgsForCall(0).Unregistrations).To(ConsistOf(mapping))
+
+			clock.WaitForWatcherAndIncrement(tcpInterval)
+			Eventually(routingAPIEmitter.EmitCallCount).Should(Equal(2))
+
+			clock.WaitForWatcherAndIncrement(tcpInterval)
+			Consistently(routingAPIEmitter.EmitCallCount).Should(Equal(2))
+			Expect(cache.ListTCP()).To(BeEmpty())
+		})
+	})
 })
@@ -0,0 +1,231 @@
+package watcher
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+)
+
+// eventCoalescer folds bursts of actual lrp events together. Events are
+// grouped by the process level routing key; the first event for a key opens a
+// window and every event for the same key arriving before the window closes is
+// folded into the pending batch. Only the net change of each instance is
+// released when the window expires.
+type eventCoalescer struct {
+	clock   clock.Clock
+	window  time.Duration
+	batches map[routingtable.RoutingKey]*eventBatch
+	timer   clock.Timer
+}
+
+type eventBatch struct {
+	deadline  time.Time
+	instances []string
+	events    map[string][]models.Event
+}
+
+func newEventCoalescer(clock clock.Clock, window time.Duration) *eventCoalescer {
+	if window <= 0 {
+		return nil
+	}
+
+	return &eventCoalescer{
+		clock:   clock,
+		window:  window,
+		batches: map[routingtable.RoutingKey]*eventBatch{},
+	}
+}
+
+// add buffers the event and returns true, or returns false if the event cannot
+// be coalesced and should be handled right away
+func (c *eventCoalescer) add(event models.Event) bool {
+	if c == nil {
+		return false
+	}
+
+	processGUID, ok := actualEventProcessGUID(event)
+	if !ok {
+		return false
+	}
+
+	key := routingtable.NewRoutingKey(processGUID, 0)
+	batch, ok := c.batches[key]
+	if !ok {
+		batch = &eventBatch{
+			deadline: c.clock.Now().Add(c.window),
+			events:   map[string][]models.Event{},
+		}
+		c.batches[key] = batch
+	}
+
+	instanceKey := event.Key()
+	pending, ok := batch.events[instanceKey]
+	if !ok {
+		batch.instances = append(batch.instances, instanceKey)
+	}
+
+	if len(pending) > 0 {
+		if folded, ok := foldEvents(pending[len(pending)-1], event); ok {
+			pending = pending[:len(pending)-1]
+			if folded != nil {
+				pending = append(pending, folded)
+			}
+			batch.events[instanceKey] = pending
+			c.startTimer()
+			return true
+		}
+	}
+
+	batch.events[instanceKey] = append(pending, event)
+	c.startTimer()
+	return true
+}
+
+// flush releases the pending batch for the given process guid regardless of
+// its deadline. It is used to preserve ordering when a desired lrp event
+// arrives for a process that has buffered actual lrp events.
+func (c *eventCoalescer) flush(processGUID string) []models.Event {
+	if c == nil {
+		return nil
+	}
+
+	key := routingtable.NewRoutingKey(processGUID, 0)
+	batch, ok := c.batches[key]
+	if !ok {
+		return nil
+	}
+
+	delete(c.batches, key)
+	return batch.release()
+}
+
+// expired releases every batch whose window has closed and rearms the timer
+// for the next pending batch
+func (c *eventCoalescer) expired() []models.Event {
+	if c == nil {
+		return nil
+	}
+
+	c.timer = nil
+	now := c.clock.Now()
+
+	var released []models.Event
+	for key, batch := range c.batches {
+		if batch.deadline.After(now) {
+			continue
+		}
+		delete(c.batches, key)
+		released = append(released, batch.release()...)
+	}
+
+	c.startTimer()
+	return released
+}
+
+func (c *eventCoalescer) timerC() <-chan time.Time {
+	if c == nil || c.timer == nil {
+		return nil
+	}
+	return c.timer.C()
+}
+
+func (c *eventCoalescer) stop() {
+	if c == nil || c.timer == nil {
+		return
+	}
+	c.timer.Stop()
+	c.timer = nil
+}
+
+func (c *eventCoalescer) startTimer() {
+	if c.timer != nil || len(c.batches) == 0 {
+		return
+	}
+
+	var next time.Time
+	for _, batch := range c.batches {
+		if next.IsZero() || batch.deadline.Before(next) {
+			next = batch.deadline
+		}
+	}
+
+	c.timer = c.clock.NewTimer(next.Sub(c.clock.Now()))
+}
+
+func (b *eventBatch) release() []models.Event {
+	var events []models.Event
+	for _, instance := range b.instances {
+		events = append(events, b.events[instance]...)
+	}
+	return events
+}
+
+// foldEvents combines two consecutive events for the same instance into the
+// event that represents their net change. It returns false when the events
+// cannot be combined and a nil event when they cancel each other out.
+func foldEvents(previous, next models.Event) (models.Event, bool) {
+	switch previous := previous.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		switch next := next.(type) {
+		case *models.ActualLRPInstanceChangedEvent:
+			after := next.After.ToActualLRP(next.ActualLRPKey, next.ActualLRPInstanceKey)
+			return models.NewActualLRPInstanceCreatedEvent(after), true
+		case *models.ActualLRPInstanceRemovedEvent:
+			return nil, true
+		}
+	case *models.ActualLRPInstanceChangedEvent:
+		before := previous.Before.ToActualLRP(previous.ActualLRPKey, previous.ActualLRPInstanceKey)
+		switch next := next.(type) {
+		case *models.ActualLRPInstanceChangedEvent:
+			after := next.After.ToActualLRP(next.ActualLRPKey, next.ActualLRPInstanceKey)
+			return models.NewActualLRPInstanceChangedEvent(before, after), true
+		case *models.ActualLRPInstanceRemovedEvent:
+			return models.NewActualLRPInstanceRemovedEvent(before), true
+		}
+	}
+
+	return nil, false
+}
+
+func actualEventProcessGUID(event models.Event) (string, bool) {
+	switch event := event.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		if event.ActualLrp == nil {
+			return "", false
+		}
+		return event.ActualLrp.ProcessGuid, true
+	case *models.ActualLRPInstanceChangedEvent:
+		if event.Before == nil || event.After == nil {
+			return "", false
+		}
+		return event.ProcessGuid, true
+	case *models.ActualLRPInstanceRemovedEvent:
+		if event.ActualLrp == nil {
+			return "", false
+		}
+		return event.ActualLrp.ProcessGuid, true
+	}
+
+	return "", false
+}
+
+func desiredEventProcessGUID(event models.Event) string {
+	switch event := event.(type) {
+	case *models.DesiredLRPCreatedEvent:
+		if event.DesiredLrp != nil {
+			return event.DesiredLrp.ProcessGuid
+		}
+	case *models.DesiredLRPChangedEvent:
+		if event.After != nil {
+			return event.After.ProcessGuid
+		}
+	case *models.DesiredLRPRemovedEvent:
+		if event.DesiredLrp != nil {
+			return event.DesiredLrp.ProcessGuid
+		}
+	}
+
+	return ""
+}
@@ -26,6 +26,14 @@ type FakeRouteHandler struct {
 		arg1 lager.Logger
 		arg2 models.Event
 	}
+	PruneProcessStub        func(lager.Logger, string, *models.DesiredLRP, []*models.ActualLRP)
+	pruneProcessMutex       sync.RWMutex
+	pruneProcessArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 *models.DesiredLRP
+		arg4 []*models.ActualLRP
+	}
 	RefreshDesiredStub        func(lager.Logger, []*models.DesiredLRP)
 	refreshDesiredMutex       sync.RWMutex
 	refreshDesiredArgsForCall []struct {
@@ -150,6 +158,45 @@ func (fake *FakeRouteHandler) HandleEventArgsForCall(i int) (lager.Logger, model
 	return argsForCall.arg1, argsForCall.arg2
 }
 
+func (fake *FakeRouteHandler) PruneProcess(arg1 lager.Logger, arg2 string, arg3 *models.DesiredLRP, arg4 []*models.ActualLRP) {
+	var arg4Copy []*models.ActualLRP
+	if arg4 != nil {
+		arg4Copy = make([]*models.ActualLRP, len(arg4))
+		copy(arg4Copy, arg4)
+	}
+	fake.pruneProcessMutex.Lock()
+	fake.pruneProcessArgsForCall = append(fake.pruneProcessArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 *models.DesiredLRP
+		arg4 []*models.ActualLRP
+	}{arg1, arg2, arg3, arg4Copy})
+	fake.recordInvocation("PruneProcess", []interface{}{arg1, arg2, arg3, arg4Copy})
+	fake.pruneProcessMutex.Unlock()
+	if fake.PruneProcessStub != nil {
+		fake.PruneProcessStub(arg1, arg2, arg3, arg4)
+	}
+}
+
+func (fake *FakeRouteHandler) PruneProcessCallCount() int {
+	fake.pruneProcessMutex.RLock()
+	defer fake.pruneProcessMutex.RUnlock()
+	return len(fake.pruneProcessArgsForCall)
+}
+
+func (fake *FakeRouteHandler) PruneProcessCalls(stub func(lager.Logger, string, *models.DesiredLRP, []*models.ActualLRP)) {
+	fake.pruneProcessMutex.Lock()
+	defer fake.pruneProcessMutex.Unlock()
+	fake.PruneProcessStub = stub
+}
+
+func (fake *FakeRouteHandler) PruneProcessArgsForCall(i int) (lager.Logger, string, *models.DesiredLRP, []*models.ActualLRP) {
+	fake.pruneProcessMutex.RLock()
+	defer fake.pruneProcessMutex.RUnlock()
+	argsForCall := fake.pruneProcessArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
 func (fake *FakeRouteHandler) RefreshDesired(arg1 lager.Logger, arg2 []*models.DesiredLRP) {
 	var arg2Copy []*models.DesiredLRP
 	if arg2 != nil {
@@ -301,6 +348,8 @@ func (fake *FakeRouteHandler) Invocations() map[string][][]interface{} {
 	defer fake.emitInternalMutex.RUnlock()
 	fake.handleEventMutex.RLock()
 	defer fake.handleEventMutex.RUnlock()
+	fake.pruneProcessMutex.RLock()
+	defer fake.pruneProcessMutex.RUnlock()
 	fake.refreshDesiredMutex.RLock()
 	defer fake.refreshDesiredMutex.RUnlock()
 	fake.shouldRefreshDesiredMutex.RLock()
@@ -2,6 +2,7 @@ package watcher
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
 	"sync"
 	"sync/atomic"
@@ -17,6 +18,22 @@ import (
 
 const (
 	routeSyncDuration = "RouteEmitterSyncDuration"
+
+	coalescerEventsReceivedCounter = "CoalescerEventsReceived"
+	coalescerEventsEmittedCounter  = "CoalescerEventsEmitted"
+
+	cachedEventsSizeGauge       = "CachedEventsSize"
+	cachedEventsOverflowCounter = "CachedEventsOverflow"
+
+	eventSubscriptionFailuresCounter = "EventSubscriptionFailures"
+	eventStreamDownDuration          = "EventStreamDownDuration"
+
+	resubscribeMinBackoff = 500 * time.Millisecond
+	resubscribeMaxBackoff = 30 * time.Second
+
+	refreshQueueSize = 32
+
+	DefaultMaxCachedEvents = 10000
 )
 
 //go:generate counterfeiter -o fakes/fake_routehandler.go . RouteHandler
@@ -33,6 +50,7 @@ type RouteHandler interface {
 	EmitInternal(logger lager.Logger)
 	ShouldRefreshDesired(*models.ActualLRP) bool
 	RefreshDesired(lager.Logger, []*models.DesiredLRP)
+	PruneProcess(logger lager.Logger, processGUID string, desiredLRP *models.DesiredLRP, runningActual []*models.ActualLRP)
 }
 
 type Watcher struct {
@@ -45,6 +63,11 @@ type Watcher struct {
 	emitInternalCh chan struct{}
 	logger         lager.Logger
 	metronClient   loggingclient.IngressClient
+	coalescer      *eventCoalescer
+	refreshCh      chan string
+
+	maxCachedEvents int
+	randSource      *rand.Rand
 }
 
 func NewWatcher(
@@ -57,7 +80,13 @@ func NewWatcher(
 	emitInternalCh chan struct{},
 	logger lager.Logger,
 	metronClient loggingclient.IngressClient,
+	coalesceWindow time.Duration,
+	maxCachedEvents int,
 ) *Watcher {
+	if maxCachedEvents <= 0 {
+		maxCachedEvents = DefaultMaxCachedEvents
+	}
+
 	return &Watcher{
 		cellID:         cellID,
 		bbsClient:      bbsClient,
@@ -68,9 +97,21 @@ func NewWatcher(
 		emitInternalCh: emitInternalCh,
 		logger:         logger.Session("watcher"),
 		metronClient:   metronClient,
+		coalescer:      newEventCoalescer(clock, coalesceWindow),
+		refreshCh:      make(chan string, refreshQueueSize),
+
+		maxCachedEvents: maxCachedEvents,
+		randSource:      rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// RefreshCh accepts process guids whose routes should be refreshed from the
+// BBS without running a full sync. Refreshes requested while a sync is in
+// progress run once it completes.
+func (w *Watcher) RefreshCh() chan<- string {
+	return w.refreshCh
+}
+
 type syncEventResult struct {
 	startTime     time.Time
 	desired       []*models.DesiredLRP
@@ -85,11 +126,12 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 
 	eventChan := make(chan models.Event)
 	resubscribeChannel := make(chan error)
+	subscribedChannel := make(chan struct{})
 
 	eventSource := &atomic.Value{}
 	var stopEventSource int32
 
-	go watcher.checkForEvents(resubscribeChannel, eventChan, eventSource, watcher.logger)
+	go watcher.checkForEvents(resubscribeChannel, subscribedChannel, eventChan, eventSource, watcher.logger)
 	watcher.logger.Debug("listening-on-channels")
 	close(ready)
 	watcher.logger.Debug("started")
@@ -97,19 +139,71 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 	cachedEvents := make(map[string]models.Event)
 	syncEnd := make(chan *syncEventResult)
 	syncing := false
+	cacheOverflowed := false
+	resyncPending := false
+	// a sync requested during a sync runs once it completes
+	syncRequested := false
+	// refreshes requested during a sync run once it completes
+	pendingRefreshes := []string{}
+	refreshPending := func() {
+		for _, processGUID := range pendingRefreshes {
+			watcher.refreshProcess(watcher.logger.Session("refresh-process", lager.Data{"process-guid": processGUID}), processGUID)
+		}
+		pendingRefreshes = []string{}
+	}
+
+	var resubscribeTimer clock.Timer
+	var resubscribeAttempts int
+	// a resync owed after the cache overflowed is retried with backoff until
+	// a sync succeeds
+	var resyncTimer clock.Timer
+	var resyncAttempts int
+	var subscribedAt, streamDownSince time.Time
+
+	dispatchEvent := func(event models.Event) {
+		if syncing {
+			if cacheOverflowed {
+				watcher.logger.Debug("dropping-event-after-cache-overflow", lager.Data{
+					"type": event.EventType(),
+				})
+				return
+			}
+			if _, ok := cachedEvents[event.Key()]; !ok && len(cachedEvents) >= watcher.maxCachedEvents {
+				watcher.logger.Info("cached-events-overflow", lager.Data{
+					"max-cached-events": watcher.maxCachedEvents,
+				})
+				if err := watcher.metronClient.IncrementCounter(cachedEventsOverflowCounter); err != nil {
+					watcher.logger.Error("failed-to-send-cached-events-overflow-metric", err)
+				}
+				// the events received so far can no longer be reconciled with the
+				// sync in progress; drop them and resync once it completes
+				cachedEvents = make(map[string]models.Event)
+				cacheOverflowed = true
+				return
+			}
+			watcher.logger.Info("caching-event", lager.Data{
+				"type": event.EventType(),
+			})
+			cachedEvents[event.Key()] = event
+			return
+		}
+		logger := watcher.logger.Session("handling-event")
+		watcher.handleEvent(logger, event)
+	}
 
 	for {
 		select {
 		case event := <-eventChan:
-			if syncing {
-				watcher.logger.Info("caching-event", lager.Data{
-					"type": event.EventType(),
-				})
-				cachedEvents[event.Key()] = event
+			if watcher.coalescer.add(event) {
+				if err := watcher.metronClient.IncrementCounter(coalescerEventsReceivedCounter); err != nil {
+					watcher.logger.Error("failed-to-send-coalescer-events-received-metric", err)
+				}
 				continue
 			}
-			logger := watcher.logger.Session("handling-event")
-			watcher.handleEvent(logger, event)
+			watcher.dispatchCoalesced(watcher.coalescer.flush(desiredEventProcessGUID(event)), dispatchEvent)
+			dispatchEvent(event)
+		case <-watcher.coalescer.timerC():
+			watcher.dispatchCoalesced(watcher.coalescer.expired(), dispatchEvent)
 		case <-watcher.emitExternalCh:
 			logger := watcher.logger.Session("emit-external")
 			watcher.routeHandler.EmitExternal(logger)
@@ -121,17 +215,37 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 			logger := watcher.logger.Session("sync")
 			if syncEvent.err != nil {
 				logger.Error("failed-to-sync-events", syncEvent.err)
+				if cacheOverflowed || resyncAttempts > 0 {
+					resyncAttempts++
+				}
+				cacheOverflowed = false
+				refreshPending()
+				if syncRequested {
+					logger.Info("starting-requested-sync")
+					syncRequested = false
+					go watcher.sync(logger, syncEnd)
+					syncing = true
+					continue
+				}
+				if resyncAttempts > 0 {
+					backoff := watcher.resubscribeBackoff(resyncAttempts)
+					if resyncTimer != nil {
+						resyncTimer.Stop()
+					}
+					resyncTimer = watcher.clock.NewTimer(backoff)
+					logger.Info("delaying-resync-after-cache-overflow", lager.Data{
+						"attempt": resyncAttempts,
+						"backoff": backoff.String(),
+					})
+				}
 				continue
 			}
 
-			var cachedDesired []*models.DesiredLRP
-			for _, e := range cachedEvents {
-				desired := watcher.retrieveDesiredWhileSyncing(logger, e, syncEvent.desired)
-				if len(desired) > 0 {
-					cachedDesired = append(cachedDesired, desired...)
-				}
+			if err := watcher.metronClient.SendMetric(cachedEventsSizeGauge, len(cachedEvents)); err != nil {
+				logger.Error("failed-to-send-cached-events-size-metric", err)
 			}
 
+			cachedDesired := watcher.retrieveCachedDesired(logger, cachedEvents, syncEvent.desired)
 			if len(cachedDesired) > 0 {
 				syncEvent.desired = append(syncEvent.desired, cachedDesired...)
 			}
@@ -151,27 +265,127 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 
 			cachedEvents = make(map[string]models.Event)
 			logger.Info("complete")
-		case <-watcher.syncCh:
+			resyncAttempts = 0
+			if resyncTimer != nil {
+				resyncTimer.Stop()
+				resyncTimer = nil
+			}
+			refreshPending()
+
+			if cacheOverflowed || resyncPending || syncRequested {
+				if cacheOverflowed {
+					logger.Info("resyncing-after-cache-overflow")
+				} else if resyncPending {
+					logger.Info("resyncing-after-resubscribe")
+				} else {
+					logger.Info("starting-requested-sync")
+				}
+				cacheOverflowed = false
+				resyncPending = false
+				syncRequested = false
+				go watcher.sync(logger, syncEnd)
+				syncing = true
+			}
+		case processGUID := <-watcher.refreshCh:
+			logger := watcher.logger.Session("refresh-process", lager.Data{"process-guid": processGUID})
 			if syncing {
-				watcher.logger.Debug("sync-already-in-progress")
+				logger.Info("queued-until-sync-completes")
+				if !containsString(pendingRefreshes, processGUID) {
+					pendingRefreshes = append(pendingRefreshes, processGUID)
+				}
 				continue
 			}
+			watcher.refreshProcess(logger, processGUID)
+		case <-watcher.syncCh:
 			logger := watcher.logger.Session("sync")
+			if syncing {
+				logger.Info("queued-until-sync-completes")
+				syncRequested = true
+				continue
+			}
 			logger.Info("starting")
 			go watcher.sync(logger, syncEnd)
 			syncing = true
+		case <-subscribedChannel:
+			subscribedAt = watcher.clock.Now()
+			if streamDownSince.IsZero() {
+				continue
+			}
+
+			downtime := subscribedAt.Sub(streamDownSince)
+			streamDownSince = time.Time{}
+			if err := watcher.metronClient.SendDuration(eventStreamDownDuration, downtime); err != nil {
+				watcher.logger.Error("failed-to-send-event-stream-down-duration-metric", err)
+			}
+
+			// events may have been missed while the stream was down
+			logger := watcher.logger.Session("sync")
+			logger.Info("syncing-after-resubscribe", lager.Data{"downtime": downtime.String()})
+			if syncing {
+				resyncPending = true
+				continue
+			}
+			go watcher.sync(logger, syncEnd)
+			syncing = true
 		case err := <-resubscribeChannel:
+			now := watcher.clock.Now()
 			watcher.logger.Error("event-source-error", err)
+			if err := watcher.metronClient.IncrementCounter(eventSubscriptionFailuresCounter); err != nil {
+				watcher.logger.Error("failed-to-send-event-subscription-failures-metric", err)
+			}
 			if es := eventSource.Load(); es != nil {
 				err := es.(events.EventSource).Close()
 				if err != nil {
 					watcher.logger.Error("failed-closing-event-source", err)
 				}
 			}
-			go watcher.checkForEvents(resubscribeChannel, eventChan, eventSource, watcher.logger)
+
+			if streamDownSince.IsZero() {
+				streamDownSince = now
+			}
+			// only a subscription that stayed up resets the backoff, later
+			// failures to resubscribe keep backing off
+			if !subscribedAt.IsZero() && now.Sub(subscribedAt) > resubscribeMaxBackoff {
+				resubscribeAttempts = 0
+			}
+			subscribedAt = time.Time{}
+
+			backoff := watcher.resubscribeBackoff(resubscribeAttempts)
+			resubscribeAttempts++
+			if backoff == 0 {
+				go watcher.checkForEvents(resubscribeChannel, subscribedChannel, eventChan, eventSource, watcher.logger)
+				continue
+			}
+
+			watcher.logger.Info("delaying-resubscribe", lager.Data{
+				"attempt": resubscribeAttempts,
+				"backoff": backoff.String(),
+			})
+			resubscribeTimer = watcher.clock.NewTimer(backoff)
+		case <-timerChan(resubscribeTimer):
+			resubscribeTimer = nil
+			go watcher.checkForEvents(resubscribeChannel, subscribedChannel, eventChan, eventSource, watcher.logger)
+		case <-timerChan(resyncTimer):
+			resyncTimer = nil
+			// a sync started since covers the overflow; if it fails the resync
+			// is delayed again
+			if syncing {
+				continue
+			}
+			logger := watcher.logger.Session("sync")
+			logger.Info("resyncing-after-cache-overflow")
+			go watcher.sync(logger, syncEnd)
+			syncing = true
 
 		case <-signals:
 			watcher.logger.Info("stopping")
+			watcher.coalescer.stop()
+			if resubscribeTimer != nil {
+				resubscribeTimer.Stop()
+			}
+			if resyncTimer != nil {
+				resyncTimer.Stop()
+			}
 			atomic.StoreInt32(&stopEventSource, 1)
 			if es := eventSource.Load(); es != nil {
 				err := es.(events.EventSource).Close()
@@ -184,8 +398,49 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 	}
 }
 
-func (w *Watcher) retrieveDesiredInternal(logger lager.Logger, event models.Event, currentDesireds []*models.DesiredLRP, syncing bool) []*models.DesiredLRP {
-	var err error
+// resubscribeBackoff returns how long to wait before the given resubscribe
+// attempt; it also delays retrying a resync after a failed sync. The first attempt is immediate; later attempts back off
+// exponentially up to resubscribeMaxBackoff, with up to half of the delay
+// randomized so that emitters do not reconnect to the BBS in lockstep.
+func (w *Watcher) resubscribeBackoff(attempt int) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+
+	backoff := resubscribeMinBackoff
+	for i := 1; i < attempt && backoff < resubscribeMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > resubscribeMaxBackoff {
+		backoff = resubscribeMaxBackoff
+	}
+
+	half := int64(backoff / 2)
+	return time.Duration(half + w.randSource.Int63n(half+1))
+}
+
+func timerChan(timer clock.Timer) <-chan time.Time {
+	if timer == nil {
+		return nil
+	}
+	return timer.C()
+}
+
+func (w *Watcher) dispatchCoalesced(events []models.Event, dispatch func(models.Event)) {
+	if len(events) == 0 {
+		return
+	}
+
+	if err := w.metronClient.IncrementCounterWithDelta(coalescerEventsEmittedCounter, uint64(len(events))); err != nil {
+		w.logger.Error("failed-to-send-coalescer-events-emitted-metric", err)
+	}
+
+	for _, event := range events {
+		dispatch(event)
+	}
+}
+
+func runningActualLRP(logger lager.Logger, event models.Event) *models.ActualLRP {
 	var actualLRP *models.ActualLRP
 	switch event := event.(type) {
 	case *models.ActualLRPInstanceCreatedEvent:
@@ -199,39 +454,68 @@ func (w *Watcher) retrieveDesiredInternal(logger lager.Logger, event models.Even
 		logger.Error("nil-actual-lrp", nil, lager.Data{"event-type": event.EventType()})
 		return nil
 	}
-	var desiredLRPs []*models.DesiredLRP
 	if actualLRP.State != models.ActualLRPStateRunning {
 		return nil
 	}
-	if w.routeHandler.ShouldRefreshDesired(actualLRP) || (syncing && !foundInCurrentDesireds(actualLRP.ProcessGuid, currentDesireds)) {
-		logger.Info("refreshing-desired-lrp-info", lager.Data{"process-guid": actualLRP.ProcessGuid})
-		desiredLRPs, err = w.bbsClient.DesiredLRPs(logger, models.DesiredLRPFilter{
-			ProcessGuids: []string{actualLRP.ProcessGuid},
-		})
-		if err != nil {
-			logger.Error("failed-getting-desired-lrps-for-missing-actual-lrp", err)
-		}
-	}
-
-	return desiredLRPs
+	return actualLRP
 }
 
 func (w *Watcher) retrieveDesired(logger lager.Logger, event models.Event) []*models.DesiredLRP {
-	return w.retrieveDesiredInternal(logger, event, nil, false)
-}
+	actualLRP := runningActualLRP(logger, event)
+	if actualLRP == nil || !w.routeHandler.ShouldRefreshDesired(actualLRP) {
+		return nil
+	}
+
+	logger.Info("refreshing-desired-lrp-info", lager.Data{"process-guid": actualLRP.ProcessGuid})
+	desiredLRPs, err := w.bbsClient.DesiredLRPs(logger, models.DesiredLRPFilter{
+		ProcessGuids: []string{actualLRP.ProcessGuid},
+	})
+	if err != nil {
+		logger.Error("failed-getting-desired-lrps-for-missing-actual-lrp", err)
+	}
 
-func (w *Watcher) retrieveDesiredWhileSyncing(logger lager.Logger, event models.Event, currentDesireds []*models.DesiredLRP) []*models.DesiredLRP {
-	return w.retrieveDesiredInternal(logger, event, currentDesireds, true)
+	return desiredLRPs
 }
 
-func foundInCurrentDesireds(guid string, currentDesireds []*models.DesiredLRP) bool {
+// retrieveCachedDesired fetches, in a single BBS call, the desired lrps of
+// every cached event whose process is either stale in the route handler or
+// missing from the desired lrps returned by the sync
+func (w *Watcher) retrieveCachedDesired(logger lager.Logger, cachedEvents map[string]models.Event, currentDesireds []*models.DesiredLRP) []*models.DesiredLRP {
+	current := make(map[string]struct{}, len(currentDesireds))
 	for _, d := range currentDesireds {
-		if d.ProcessGuid == guid {
-			return true
+		current[d.ProcessGuid] = struct{}{}
+	}
+
+	requested := make(map[string]struct{})
+	var processGuids []string
+	for _, event := range cachedEvents {
+		actualLRP := runningActualLRP(logger, event)
+		if actualLRP == nil {
+			continue
+		}
+		if _, ok := requested[actualLRP.ProcessGuid]; ok {
+			continue
+		}
+		_, found := current[actualLRP.ProcessGuid]
+		if w.routeHandler.ShouldRefreshDesired(actualLRP) || !found {
+			requested[actualLRP.ProcessGuid] = struct{}{}
+			processGuids = append(processGuids, actualLRP.ProcessGuid)
 		}
 	}
 
-	return false
+	if len(processGuids) == 0 {
+		return nil
+	}
+
+	logger.Info("refreshing-desired-lrp-info", lager.Data{"process-guids": processGuids})
+	desiredLRPs, err := w.bbsClient.DesiredLRPs(logger, models.DesiredLRPFilter{
+		ProcessGuids: processGuids,
+	})
+	if err != nil {
+		logger.Error("failed-getting-desired-lrps-for-missing-actual-lrp", err)
+	}
+
+	return desiredLRPs
 }
 
 func (w *Watcher) handleEvent(logger lager.Logger, event models.Event) {
@@ -242,6 +526,41 @@ func (w *Watcher) handleEvent(logger lager.Logger, event models.Event) {
 	w.routeHandler.HandleEvent(logger, event)
 }
 
+func (w *Watcher) refreshProcess(logger lager.Logger, processGUID string) {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	desiredLRPs, err := getDesiredLRPs(logger, w.bbsClient, []string{processGUID})
+	if err != nil {
+		return
+	}
+
+	actualLRPs, err := w.bbsClient.ActualLRPs(logger, models.ActualLRPFilter{CellID: w.cellID, ProcessGuid: processGUID})
+	if err != nil {
+		logger.Error("failed-getting-actual-lrps", err)
+		return
+	}
+
+	var desiredLRP *models.DesiredLRP
+	if len(desiredLRPs) > 0 {
+		desiredLRP = desiredLRPs[0]
+		w.routeHandler.RefreshDesired(logger, desiredLRPs)
+	}
+
+	runningActual := []*models.ActualLRP{}
+	for _, actualLRP := range actualLRPs {
+		if actualLRP.State != models.ActualLRPStateRunning {
+			continue
+		}
+		runningActual = append(runningActual, actualLRP)
+		w.routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+	}
+
+	// instances that stopped and a process that is no longer desired must
+	// not keep their routes
+	w.routeHandler.PruneProcess(logger, processGUID, desiredLRP, runningActual)
+}
+
 func (w *Watcher) sync(logger lager.Logger, ch chan<- *syncEventResult) {
 	var runningActualLRPs []*models.ActualLRP
 	var desiredLRPs []*models.DesiredLRP
@@ -321,7 +640,7 @@ func (w *Watcher) sync(logger lager.Logger, ch chan<- *syncEventResult) {
 	}
 }
 
-func (w *Watcher) checkForEvents(resubscribeChannel chan error, eventChan chan models.Event, eventSource *atomic.Value, logger lager.Logger) {
+func (w *Watcher) checkForEvents(resubscribeChannel chan error, subscribedChannel chan struct{}, eventChan chan models.Event, eventSource *atomic.Value, logger lager.Logger) {
 	var err error
 	var es events.EventSource
 
@@ -334,6 +653,7 @@ func (w *Watcher) checkForEvents(resubscribeChannel chan error, eventChan chan m
 	logger.Info("subscribed-to-bbs-events")
 
 	eventSource.Store(es)
+	subscribedChannel <- struct{}{}
 
 	var event models.Event
 	for {
@@ -367,3 +687,12 @@ func getDesiredLRPs(logger lager.Logger, bbsClient bbs.Client, guids []string) (
 	logger.Debug("succeeded-getting-desired-lrps", lager.Data{"num-desired-responses": len(desiredLRPs)})
 	return desiredLRPs, nil
 }
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -16,11 +16,11 @@ import (
 	"code.cloudfoundry.org/route-emitter/emitter"
 	"code.cloudfoundry.org/route-emitter/routehandlers"
 	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/tokenprovider"
 	"code.cloudfoundry.org/route-emitter/unregistration"
 	"code.cloudfoundry.org/route-emitter/watcher"
 	"code.cloudfoundry.org/routing-api/fake_routing_api"
 	"code.cloudfoundry.org/routing-info/cfroutes"
-	uaaclient "code.cloudfoundry.org/uaa-go-client"
 	"code.cloudfoundry.org/workpool"
 	"github.com/nats-io/nats.go"
 	. "github.com/onsi/ginkgo"
@@ -61,13 +61,12 @@ var _ = Describe("Watcher Integration", func() {
 		workPool, err := workpool.NewWorkPool(1)
 		Expect(err).NotTo(HaveOccurred())
 		fakeMetronClient = &mfakes.FakeIngressClient{}
-		natsEmitter := emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, false)
-		natsTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+		natsEmitter := emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, false, emitter.NATSEmitterOptions{})
+		natsTable := routingtable.NewRoutingTable(false, fakeMetronClient, routingtable.TCPPortConflictFirstWins, nil)
 
-		uaaClient := uaaclient.NewNoOpUaaClient()
-		routingAPIEmitter := emitter.NewRoutingAPIEmitter(logger, routingApiClient, uaaClient, 100)
+		routingAPIEmitter := emitter.NewRoutingAPIEmitter(logger, routingApiClient, tokenprovider.NoTokenProvider{}, 100, nil)
 		unregistrationCache := unregistration.NewCache(logger)
-		handler := routehandlers.NewHandler(natsTable, natsEmitter, routingAPIEmitter, false, fakeMetronClient, unregistrationCache)
+		handler := routehandlers.NewHandler(natsTable, natsEmitter, routingAPIEmitter, false, fakeMetronClient, unregistrationCache, routehandlers.HandlerOptions{})
 		clock := fakeclock.NewFakeClock(time.Now())
 		testWatcher = watcher.NewWatcher(
 			cellID,
@@ -79,6 +78,8 @@ var _ = Describe("Watcher Integration", func() {
 			emitInternalCh,
 			logger,
 			fakeMetronClient,
+			0,
+			0,
 		)
 	})
 
@@ -3,6 +3,7 @@ package watcher_test
 import (
 	"errors"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/bbs/events"
@@ -81,6 +82,8 @@ var _ = Describe("Watcher", func() {
 		emitExternalCh   chan struct{}
 		emitInternalCh   chan struct{}
 		fakeMetronClient *mfakes.FakeIngressClient
+		coalesceWindow   time.Duration
+		maxCachedEvents  int
 	)
 
 	BeforeEach(func() {
@@ -97,6 +100,8 @@ var _ = Describe("Watcher", func() {
 		emitInternalCh = make(chan struct{})
 		cellID = ""
 		fakeMetronClient = &mfakes.FakeIngressClient{}
+		coalesceWindow = 0
+		maxCachedEvents = 0
 	})
 
 	JustBeforeEach(func() {
@@ -110,6 +115,8 @@ var _ = Describe("Watcher", func() {
 			emitInternalCh,
 			logger,
 			fakeMetronClient,
+			coalesceWindow,
+			maxCachedEvents,
 		)
 		process = ifrit.Invoke(testWatcher)
 	})
@@ -293,6 +300,56 @@ var _ = Describe("Watcher", func() {
 			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount, 5*time.Second, 300*time.Millisecond).Should(BeNumerically(">=", 2))
 			Eventually(logger).Should(gbytes.Say("event-source-error"))
 		})
+
+		It("emits a subscription failure metric", func() {
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(BeNumerically(">=", 1))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("EventSubscriptionFailures"))
+		})
+
+		It("backs off before resubscribing again", func() {
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+			Eventually(logger).Should(gbytes.Say("delaying-resubscribe"))
+			Consistently(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+
+			clock.WaitForWatcherAndIncrement(500 * time.Millisecond)
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(3))
+		})
+	})
+
+	Context("when a long-lived subscription drops and resubscribing keeps failing", func() {
+		BeforeEach(func() {
+			streamDropped := make(chan struct{})
+			eventSource.NextStub = func() (models.Event, error) {
+				<-streamDropped
+				return nil, errors.New("stream dropped")
+			}
+
+			var subscriptions int32
+			bbsClient.SubscribeToInstanceEventsByCellIDStub = func(logger lager.Logger, cellID string) (events.EventSource, error) {
+				if atomic.AddInt32(&subscriptions, 1) == 1 {
+					return eventSource, nil
+				}
+				return nil, errors.New("kaboom")
+			}
+
+			go func() {
+				defer GinkgoRecover()
+				Eventually(logger).Should(gbytes.Say("subscribed-to-bbs-events"))
+				clock.Increment(time.Minute)
+				close(streamDropped)
+			}()
+		})
+
+		It("resubscribes right away once and then backs off", func() {
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+			Eventually(logger).Should(gbytes.Say("delaying-resubscribe"))
+			Consistently(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+
+			clock.WaitForWatcherAndIncrement(500 * time.Millisecond)
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(3))
+			Eventually(logger).Should(gbytes.Say("delaying-resubscribe"))
+			Consistently(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(3))
+		})
 	})
 
 	Context("when subscribe to events fails", func() {
@@ -322,6 +379,22 @@ var _ = Describe("Watcher", func() {
 			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount, 5*time.Second, 300*time.Millisecond).Should(Equal(2))
 			Eventually(logger).Should(gbytes.Say("kaboom"))
 		})
+
+		It("syncs once the subscription is restored", func() {
+			close(bbsErrorChannel)
+			Eventually(logger).Should(gbytes.Say("syncing-after-resubscribe"))
+			Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+		})
+
+		It("emits how long the event stream was down", func() {
+			Eventually(logger).Should(gbytes.Say("kaboom"))
+			clock.Increment(2 * time.Second)
+			close(bbsErrorChannel)
+			Eventually(fakeMetronClient.SendDurationCallCount).Should(BeNumerically(">=", 1))
+			name, value, _ := fakeMetronClient.SendDurationArgsForCall(0)
+			Expect(name).To(Equal("EventStreamDownDuration"))
+			Expect(value).To(Equal(2 * time.Second))
+		})
 	})
 
 	Describe("emit external event", func() {
@@ -338,6 +411,221 @@ var _ = Describe("Watcher", func() {
 		})
 	})
 
+	Describe("refreshing a single process", func() {
+		var (
+			desiredLRP *models.DesiredLRP
+			runningLRP *models.ActualLRP
+			crashedLRP *models.ActualLRP
+		)
+
+		BeforeEach(func() {
+			desiredLRP = getDesiredLRP("process-guid-1", "log-guid-1", 5222, 61000)
+			runningLRP = getActualLRP("process-guid-1", "instance-guid-1", "1.1.1.1", "2.2.2.2", 61000, 5222, false)
+			crashedLRP = getActualLRP("process-guid-1", "instance-guid-2", "1.1.1.2", "2.2.2.3", 61001, 5222, false)
+			crashedLRP.State = models.ActualLRPStateCrashed
+
+			bbsClient.DesiredLRPsReturns([]*models.DesiredLRP{desiredLRP}, nil)
+			bbsClient.ActualLRPsReturns([]*models.ActualLRP{runningLRP, crashedLRP}, nil)
+		})
+
+		JustBeforeEach(func() {
+			testWatcher.RefreshCh() <- "process-guid-1"
+		})
+
+		It("fetches the desired and actual lrps for the process", func() {
+			Eventually(bbsClient.DesiredLRPsCallCount).Should(Equal(1))
+			_, desiredFilter := bbsClient.DesiredLRPsArgsForCall(0)
+			Expect(desiredFilter.ProcessGuids).To(ConsistOf("process-guid-1"))
+
+			Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+			_, actualFilter := bbsClient.ActualLRPsArgsForCall(0)
+			Expect(actualFilter.ProcessGuid).To(Equal("process-guid-1"))
+		})
+
+		It("refreshes the desired lrp and the running instances", func() {
+			Eventually(routeHandler.RefreshDesiredCallCount).Should(Equal(1))
+			_, desired := routeHandler.RefreshDesiredArgsForCall(0)
+			Expect(desired).To(ConsistOf(desiredLRP))
+
+			Eventually(routeHandler.HandleEventCallCount).Should(Equal(1))
+			_, event := routeHandler.HandleEventArgsForCall(0)
+			Expect(event).To(Equal(models.NewActualLRPInstanceCreatedEvent(runningLRP)))
+		})
+
+		It("does not run a full sync", func() {
+			Consistently(routeHandler.SyncCallCount).Should(Equal(0))
+		})
+
+		It("prunes routes and endpoints the process no longer has", func() {
+			Eventually(routeHandler.PruneProcessCallCount).Should(Equal(1))
+			_, processGUID, desired, runningActual := routeHandler.PruneProcessArgsForCall(0)
+			Expect(processGUID).To(Equal("process-guid-1"))
+			Expect(desired).To(Equal(desiredLRP))
+			Expect(runningActual).To(ConsistOf(runningLRP))
+		})
+
+		Context("when the desired lrp no longer exists", func() {
+			BeforeEach(func() {
+				bbsClient.DesiredLRPsReturns([]*models.DesiredLRP{}, nil)
+				bbsClient.ActualLRPsReturns([]*models.ActualLRP{}, nil)
+			})
+
+			It("prunes everything registered for the process", func() {
+				Eventually(routeHandler.PruneProcessCallCount).Should(Equal(1))
+				_, processGUID, desired, runningActual := routeHandler.PruneProcessArgsForCall(0)
+				Expect(processGUID).To(Equal("process-guid-1"))
+				Expect(desired).To(BeNil())
+				Expect(runningActual).To(BeEmpty())
+			})
+		})
+
+		Context("when fetching the actual lrps fails", func() {
+			BeforeEach(func() {
+				bbsClient.ActualLRPsReturns(nil, errors.New("kaboom"))
+			})
+
+			It("does not refresh the process", func() {
+				Eventually(logger).Should(gbytes.Say("failed-getting-actual-lrps"))
+				Consistently(routeHandler.RefreshDesiredCallCount).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("refreshing a process during a sync", func() {
+		var (
+			unblock    chan struct{}
+			runningLRP *models.ActualLRP
+		)
+
+		BeforeEach(func() {
+			unblock = make(chan struct{})
+			runningLRP = getActualLRP("process-guid-1", "instance-guid-1", "1.1.1.1", "2.2.2.2", 61000, 5222, false)
+			bbsClient.ActualLRPsStub = func(_ lager.Logger, f models.ActualLRPFilter) ([]*models.ActualLRP, error) {
+				if f.ProcessGuid == "" {
+					<-unblock
+					return nil, nil
+				}
+				return []*models.ActualLRP{runningLRP}, nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			syncCh <- struct{}{}
+			Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+			testWatcher.RefreshCh() <- "process-guid-1"
+			testWatcher.RefreshCh() <- "process-guid-1"
+		})
+
+		It("queues the refresh until the sync completes", func() {
+			Eventually(logger).Should(gbytes.Say("queued-until-sync-completes"))
+			Consistently(routeHandler.PruneProcessCallCount).Should(Equal(0))
+
+			close(unblock)
+
+			Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+			Eventually(routeHandler.PruneProcessCallCount).Should(Equal(1))
+			Consistently(routeHandler.PruneProcessCallCount).Should(Equal(1))
+			_, processGUID, _, _ := routeHandler.PruneProcessArgsForCall(0)
+			Expect(processGUID).To(Equal("process-guid-1"))
+		})
+	})
+
+	Describe("coalescing events", func() {
+		var (
+			eventCh    chan EventHolder
+			actualLRP  *models.ActualLRP
+			crashedLRP *models.ActualLRP
+		)
+
+		BeforeEach(func() {
+			coalesceWindow = 500 * time.Millisecond
+			eventCh = make(chan EventHolder, 10)
+			// make the variable local to avoid race detection
+			nextEventValue := eventCh
+
+			eventSource.NextStub = func() (models.Event, error) {
+				select {
+				case x := <-nextEventValue:
+					return x.event, nil
+				case <-time.After(10 * time.Millisecond):
+					return nil, nil
+				}
+			}
+
+			actualLRP = getActualLRP("process-guid-1", "instance-guid-1", "1.1.1.1", "2.2.2.2", 61000, 5222, false)
+			crashedLRP = getActualLRP("process-guid-1", "instance-guid-1", "1.1.1.1", "2.2.2.2", 61000, 5222, false)
+			crashedLRP.State = models.ActualLRPStateCrashed
+		})
+
+		It("folds the events for an instance into their net change", func() {
+			eventCh <- EventHolder{models.NewActualLRPInstanceCreatedEvent(crashedLRP)}
+			eventCh <- EventHolder{models.NewActualLRPInstanceChangedEvent(crashedLRP, actualLRP)}
+			Consistently(routeHandler.HandleEventCallCount).Should(Equal(0))
+
+			clock.WaitForWatcherAndIncrement(coalesceWindow)
+			Eventually(routeHandler.HandleEventCallCount).Should(Equal(1))
+			_, event := routeHandler.HandleEventArgsForCall(0)
+			createdEvent, ok := event.(*models.ActualLRPInstanceCreatedEvent)
+			Expect(ok).To(BeTrue())
+			Expect(createdEvent.ActualLrp.State).To(Equal(models.ActualLRPStateRunning))
+		})
+
+		It("drops events that cancel each other out", func() {
+			eventCh <- EventHolder{models.NewActualLRPInstanceCreatedEvent(actualLRP)}
+			eventCh <- EventHolder{models.NewActualLRPInstanceRemovedEvent(actualLRP)}
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(2))
+
+			clock.WaitForWatcherAndIncrement(coalesceWindow)
+			Consistently(routeHandler.HandleEventCallCount).Should(Equal(0))
+		})
+
+		It("emits metrics for the events received and emitted", func() {
+			eventCh <- EventHolder{models.NewActualLRPInstanceCreatedEvent(crashedLRP)}
+			eventCh <- EventHolder{models.NewActualLRPInstanceChangedEvent(crashedLRP, actualLRP)}
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(2))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("CoalescerEventsReceived"))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(1)).To(Equal("CoalescerEventsReceived"))
+
+			clock.WaitForWatcherAndIncrement(coalesceWindow)
+			Eventually(fakeMetronClient.IncrementCounterWithDeltaCallCount).Should(Equal(1))
+			name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal("CoalescerEventsEmitted"))
+			Expect(delta).To(BeEquivalentTo(1))
+		})
+
+		Context("when a desired lrp event arrives for a process with pending events", func() {
+			It("handles the pending events before the desired lrp event", func() {
+				desiredLRP := getDesiredLRP("process-guid-1", "log-guid-1", 5222, 61000)
+				eventCh <- EventHolder{models.NewActualLRPInstanceCreatedEvent(actualLRP)}
+				eventCh <- EventHolder{models.NewDesiredLRPRemovedEvent(desiredLRP)}
+
+				Eventually(routeHandler.HandleEventCallCount).Should(Equal(2))
+				_, first := routeHandler.HandleEventArgsForCall(0)
+				_, second := routeHandler.HandleEventArgsForCall(1)
+				Expect(first).To(BeAssignableToTypeOf(&models.ActualLRPInstanceCreatedEvent{}))
+				Expect(second).To(BeAssignableToTypeOf(&models.DesiredLRPRemovedEvent{}))
+			})
+		})
+
+		Context("when events are received for different processes", func() {
+			It("keeps a separate window for each process", func() {
+				otherLRP := getActualLRP("process-guid-2", "instance-guid-2", "1.1.1.1", "2.2.2.2", 61001, 5222, false)
+				eventCh <- EventHolder{models.NewActualLRPInstanceCreatedEvent(actualLRP)}
+				Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+
+				clock.WaitForWatcherAndIncrement(coalesceWindow / 2)
+				eventCh <- EventHolder{models.NewActualLRPInstanceCreatedEvent(otherLRP)}
+				Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(2))
+
+				clock.WaitForWatcherAndIncrement(coalesceWindow / 2)
+				Eventually(routeHandler.HandleEventCallCount).Should(Equal(1))
+
+				clock.WaitForWatcherAndIncrement(coalesceWindow / 2)
+				Eventually(routeHandler.HandleEventCallCount).Should(Equal(2))
+			})
+		})
+	})
+
 	Describe("Sync Events", func() {
 		var (
 			errCh   chan error
@@ -497,6 +785,88 @@ var _ = Describe("Watcher", func() {
 					Eventually(logger).Should(gbytes.Say("nil-actual-lrp"))
 				})
 			})
+
+			It("emits the number of cached events", func() {
+				Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+				name, value, _ := fakeMetronClient.SendMetricArgsForCall(0)
+				Expect(name).To(Equal("CachedEventsSize"))
+				Expect(value).To(Equal(1))
+			})
+		})
+
+		Context("when the cached events exceed the limit", func() {
+			BeforeEach(func() {
+				maxCachedEvents = 1
+
+				var calls int32
+				bbsClient.ActualLRPsStub = func(lager.Logger, models.ActualLRPFilter) ([]*models.ActualLRP, error) {
+					defer GinkgoRecover()
+					if atomic.AddInt32(&calls, 1) > 1 {
+						return nil, nil
+					}
+					Eventually(eventCh).Should(BeSent(EventHolder{models.NewActualLRPInstanceRemovedEvent(actualLRP1)}))
+					Eventually(logger).Should(gbytes.Say("caching-event"))
+					Eventually(eventCh).Should(BeSent(EventHolder{models.NewActualLRPInstanceRemovedEvent(actualLRP2)}))
+					Eventually(logger).Should(gbytes.Say("cached-events-overflow"))
+					return nil, nil
+				}
+			})
+
+			It("drops the cached events", func() {
+				Eventually(routeHandler.SyncCallCount).Should(BeNumerically(">=", 1))
+				_, _, _, _, cachedEvents := routeHandler.SyncArgsForCall(0)
+				Expect(cachedEvents).To(BeEmpty())
+			})
+
+			It("emits an overflow metric", func() {
+				Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+				Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("CachedEventsOverflow"))
+			})
+
+			It("schedules another sync", func() {
+				Eventually(logger).Should(gbytes.Say("resyncing-after-cache-overflow"))
+				Eventually(routeHandler.SyncCallCount).Should(Equal(2))
+				Consistently(routeHandler.SyncCallCount).Should(Equal(2))
+			})
+
+			Context("when the sync fails", func() {
+				BeforeEach(func() {
+					var calls int32
+					bbsClient.ActualLRPsStub = func(lager.Logger, models.ActualLRPFilter) ([]*models.ActualLRP, error) {
+						defer GinkgoRecover()
+						switch atomic.AddInt32(&calls, 1) {
+						case 1:
+							Eventually(eventCh).Should(BeSent(EventHolder{models.NewActualLRPInstanceRemovedEvent(actualLRP1)}))
+							Eventually(logger).Should(gbytes.Say("caching-event"))
+							Eventually(eventCh).Should(BeSent(EventHolder{models.NewActualLRPInstanceRemovedEvent(actualLRP2)}))
+							Eventually(logger).Should(gbytes.Say("cached-events-overflow"))
+							return nil, errors.New("bam")
+						case 2:
+							return nil, errors.New("bam")
+						default:
+							return nil, nil
+						}
+					}
+				})
+
+				It("retries the resync with backoff until a sync succeeds", func() {
+					Eventually(logger).Should(gbytes.Say("delaying-resync-after-cache-overflow"))
+					Consistently(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+
+					clock.Increment(30 * time.Second)
+					Eventually(logger).Should(gbytes.Say("resyncing-after-cache-overflow"))
+					Eventually(logger).Should(gbytes.Say("delaying-resync-after-cache-overflow"))
+					Expect(bbsClient.ActualLRPsCallCount()).To(Equal(2))
+					Expect(routeHandler.SyncCallCount()).To(Equal(0))
+
+					clock.Increment(30 * time.Second)
+					Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+					Expect(bbsClient.ActualLRPsCallCount()).To(Equal(3))
+
+					clock.Increment(30 * time.Second)
+					Consistently(bbsClient.ActualLRPsCallCount).Should(Equal(3))
+				})
+			})
 		})
 
 		Context("during sync", func() {
@@ -516,9 +886,21 @@ var _ = Describe("Watcher", func() {
 				close(unblock)
 			})
 
-			It("ignores a sync event", func() {
+			It("queues a sync event until the sync completes", func() {
+				Eventually(syncCh).Should(BeSent(struct{}{}))
+				Eventually(logger).Should(gbytes.Say("queued-until-sync-completes"))
 				Eventually(syncCh).Should(BeSent(struct{}{}))
-				Eventually(logger).Should(gbytes.Say("sync-already-in-progress"))
+				Eventually(logger).Should(gbytes.Say("queued-until-sync-completes"))
+				Consistently(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+
+				unblock <- struct{}{}
+				Eventually(logger).Should(gbytes.Say("starting-requested-sync"))
+				Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(2))
+				Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+
+				unblock <- struct{}{}
+				Eventually(routeHandler.SyncCallCount).Should(Equal(2))
+				Consistently(bbsClient.ActualLRPsCallCount).Should(Equal(2))
 			})
 
 			It("can be signaled", func() {
@@ -836,6 +1218,27 @@ var _ = Describe("Watcher", func() {
 						Expect(desiredInfo).To(ContainElement(desiredLRP3))
 					})
 
+					Context("and several processes are missing their desired lrp", func() {
+						BeforeEach(func() {
+							bbsClient.ActualLRPsStub = func(lager.Logger, models.ActualLRPFilter) ([]*models.ActualLRP, error) {
+								defer GinkgoRecover()
+								sendEvent()
+								Eventually(logger).Should(gbytes.Say("caching-event"))
+								Eventually(eventCh).Should(BeSent(EventHolder{models.NewActualLRPInstanceCreatedEvent(actualLRP2)}))
+								Eventually(logger).Should(gbytes.Say("caching-event"))
+								return []*models.ActualLRP{actualLRP1}, nil
+							}
+						})
+
+						It("fetches their desired lrps in a single call", func() {
+							Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+							Expect(bbsClient.DesiredLRPsCallCount()).To(Equal(2))
+
+							_, filter := bbsClient.DesiredLRPsArgsForCall(1)
+							Expect(filter.ProcessGuids).To(ConsistOf(actualLRP2.ProcessGuid, actualLRP3.ProcessGuid))
+						})
+					})
+
 					Context("and fetching desired scheduling info fails", func() {
 						BeforeEach(func() {
 							bbsClient.DesiredLRPsStub = func(l lager.Logger, f models.DesiredLRPFilter) ([]*models.DesiredLRP, error) {